@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// maxIntervalChanges is the number of interval changes kept per monitor.
+const maxIntervalChanges = 20
+
+// IntervalChange represents a change of the check interval of a monitor.
+type IntervalChange struct {
+	Time     time.Time
+	Interval string
+	Reason   string
+}
+
+// stableFor returns how long a recovered monitor must stay up before returning to its normal frequency.
+func (m *Monitor) stableFor() time.Duration {
+	stable, err := time.ParseDuration(m.StableFor)
+	if err != nil || stable < 0 {
+		return defaultStableFor
+	}
+	return stable
+}
+
+// adaptiveInterval returns the fast recheck interval if the monitor is down or has not yet been stable
+// for long enough after recovering.
+func (m *Monitor) adaptiveInterval(now time.Time) (time.Duration, bool) {
+	if m.DownFreq == "" {
+		return 0, false
+	}
+	fast, err := time.ParseDuration(m.DownFreq)
+	if err != nil || fast <= 0 {
+		log.Println("invalid down frequency", m.Name, m.DownFreq)
+		return 0, false
+	}
+	// the state is also saved by record, which may run at the same time for a check now
+	unlock := lockRecord(m.ID)
+	defer unlock()
+	status, err := getStatus(m.ID)
+	if err != nil {
+		return 0, false
+	}
+	state, err := getState(m.ID)
+	if err != nil {
+		log.Println("get monitor state", m.Name, err)
+		return 0, false
+	}
+	down := status.StatusCode != m.StatusOK && !status.Maintenance
+	changed := false
+	switch {
+	case down && !state.FastRecheck:
+		state.FastRecheck = true
+		state.UpSince = time.Time{}
+		state.addIntervalChange(now, m.DownFreq, "down: "+status.Status)
+		changed = true
+	case down:
+		if !state.UpSince.IsZero() {
+			state.UpSince = time.Time{}
+			changed = true
+		}
+	case state.FastRecheck && state.UpSince.IsZero():
+		state.UpSince = status.Time
+		changed = true
+	case state.FastRecheck && now.Sub(state.UpSince) >= m.stableFor():
+		state.FastRecheck = false
+		state.UpSince = time.Time{}
+		state.addIntervalChange(now, m.Freq, "stable for "+m.stableFor().String())
+		changed = true
+	}
+	if changed {
+		log.Println("check interval", m.Name, "fast recheck", state.FastRecheck)
+		if err := saveState(m.ID, state); err != nil {
+			log.Println("save monitor state", m.Name, err)
+		}
+	}
+	return fast, state.FastRecheck
+}
+
+// addIntervalChange records a change of check interval.
+func (s *MonitorState) addIntervalChange(t time.Time, interval, reason string) {
+	s.Intervals = append(s.Intervals, IntervalChange{Time: t, Interval: interval, Reason: reason})
+	if len(s.Intervals) > maxIntervalChanges {
+		s.Intervals = s.Intervals[len(s.Intervals)-maxIntervalChanges:]
+	}
+}
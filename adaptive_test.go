@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStableFor(t *testing.T) {
+	tests := []struct {
+		stableFor string
+		want      time.Duration
+	}{
+		{"", defaultStableFor},
+		{"10m", 10 * time.Minute},
+		{"0s", 0},
+		{"-1m", defaultStableFor},
+		{"a while", defaultStableFor},
+	}
+	for _, tt := range tests {
+		m := Monitor{StableFor: tt.stableFor}
+		if got := m.stableFor(); got != tt.want {
+			t.Errorf("stableFor(%q) = %v, want %v", tt.stableFor, got, tt.want)
+		}
+	}
+}
+
+func TestAdaptiveInterval(t *testing.T) {
+	testDB(t, backendBolt)
+	m := Monitor{ID: "m1", Name: "site", Freq: "5m", DownFreq: "30s", StableFor: "2m", StatusOK: 200}
+	start := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name   string
+		second int // time of the status and the check
+		code   int
+		next   time.Duration // from the check
+	}{
+		{"up", 0, 200, 5 * time.Minute},
+		{"down", 300, 500, 30 * time.Second},
+		{"still down", 330, 500, 30 * time.Second},
+		{"recovered", 360, 200, 30 * time.Second},
+		{"not yet stable", 420, 200, 30 * time.Second},
+		{"down again", 450, 500, 30 * time.Second},
+		{"recovered again", 480, 200, 30 * time.Second},
+		{"stable", 600, 200, 5 * time.Minute},
+		{"up", 900, 200, 5 * time.Minute},
+	}
+	for _, step := range steps {
+		now := start.Add(time.Duration(step.second) * time.Second)
+		if err := saveStatus(Status{MonitorID: m.ID, Time: now, StatusCode: step.code}); err != nil {
+			t.Fatal(err)
+		}
+		next, err := m.nextCheck(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := next.Sub(now); got != step.next {
+			t.Errorf("%s at %ds: next check in %v, want %v", step.name, step.second, got, step.next)
+		}
+	}
+	state, err := getState(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Intervals) != 2 {
+		t.Errorf("recorded %d interval changes, want 2: %+v", len(state.Intervals), state.Intervals)
+	}
+}
+
+func TestAdaptiveIntervalWaitsForRecord(t *testing.T) {
+	testDB(t, backendBolt)
+	m := Monitor{ID: "m1", Name: "site", Freq: "5m", DownFreq: "30s", StatusOK: 200}
+	now := time.Now()
+	if err := saveStatus(Status{MonitorID: m.ID, Time: now, StatusCode: 500}); err != nil {
+		t.Fatal(err)
+	}
+	// a check now records a result, opening an incident, while the scheduler picks the next check
+	unlock := lockRecord(m.ID)
+	done := make(chan struct{})
+	go func() {
+		m.adaptiveInterval(now)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := saveState(m.ID, MonitorState{Incident: 7}); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	<-done
+	state, err := getState(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Incident != 7 || !state.FastRecheck {
+		t.Errorf("state %+v, want the incident kept and fast recheck", state)
+	}
+}
+
+func TestAddIntervalChange(t *testing.T) {
+	state := MonitorState{}
+	start := time.Now()
+	for i := range maxIntervalChanges + 5 {
+		state.addIntervalChange(start.Add(time.Duration(i)*time.Minute), "1m", "test")
+	}
+	if len(state.Intervals) != maxIntervalChanges {
+		t.Fatalf("kept %d interval changes, want %d", len(state.Intervals), maxIntervalChanges)
+	}
+	if want := start.Add(5 * time.Minute); !state.Intervals[0].Time.Equal(want) {
+		t.Errorf("oldest kept change at %v, want %v", state.Intervals[0].Time, want)
+	}
+}
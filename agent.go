@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// localLocation is the location name of checks run by the server itself.
+const localLocation = "local"
+
+// agentLastSeenInterval is the minimum time between updates of the last contact of an agent.
+const agentLastSeenInterval = time.Minute
+
+var errAgentAuth = errors.New("invalid agent token")
+
+// Agent represents a remote probe that runs checks from another location.
+type Agent struct {
+	Name      string
+	Location  string
+	TokenHash string
+	Created   time.Time
+	LastSeen  time.Time
+}
+
+type agentKey struct{}
+
+// newAgentToken returns a random token and its hash.
+func newAgentToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(raw)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hex encoded sha256 hash of a token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// agentAuth authenticates remote agents by bearer token.
+func agentAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			http.Error(w, errAgentAuth.Error(), http.StatusUnauthorized)
+			return
+		}
+		hash := hashToken(token)
+		agents, err := getAgents()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, agent := range agents {
+			if subtle.ConstantTimeCompare([]byte(agent.TokenHash), []byte(hash)) == 1 {
+				if time.Since(agent.LastSeen) > agentLastSeenInterval {
+					agent.LastSeen = time.Now()
+					if err := saveAgent(agent, true); err != nil {
+						log.Println("update agent", agent.Name, err)
+					}
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), agentKey{}, agent)))
+				return
+			}
+		}
+		log.Println("agent authentication failed", r.RemoteAddr)
+		http.Error(w, errAgentAuth.Error(), http.StatusUnauthorized)
+	})
+}
+
+// requestAgent returns the authenticated agent of the request.
+func requestAgent(r *http.Request) (Agent, bool) {
+	agent, ok := r.Context().Value(agentKey{}).(Agent)
+	return agent, ok
+}
+
+// assignedMonitors returns the active monitors to be checked from the location.
+func assignedMonitors(location string) ([]Monitor, error) {
+	monitors, err := getMonitors()
+	if err != nil {
+		return nil, err
+	}
+	assigned := []Monitor{}
+	for _, m := range monitors {
+		if m.Active && slices.Contains(m.Locations, location) {
+			m.Notifiers = nil
+			assigned = append(assigned, m)
+		}
+	}
+	return assigned, nil
+}
+
+func agentMonitors(w http.ResponseWriter, r *http.Request) {
+	agent, ok := requestAgent(r)
+	if !ok {
+		http.Error(w, errAgentAuth.Error(), http.StatusUnauthorized)
+		return
+	}
+	monitors, err := assignedMonitors(agent.Location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(monitors); err != nil {
+		log.Println("encode agent monitors", err)
+	}
+}
+
+func agentResults(w http.ResponseWriter, r *http.Request) {
+	agent, ok := requestAgent(r)
+	if !ok {
+		http.Error(w, errAgentAuth.Error(), http.StatusUnauthorized)
+		return
+	}
+	var results []Status
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&results); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	monitors, err := assignedMonitors(agent.Location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accepted := 0
+	for _, status := range results {
+		// agents of earlier versions identify monitors by name
+		i := slices.IndexFunc(monitors, func(m Monitor) bool {
+			return m.ID == status.MonitorID || (status.MonitorID == "" && m.Name == status.Site)
+		})
+		if i < 0 {
+			log.Println("agent", agent.Name, "result for unassigned monitor", status.Site)
+			continue
+		}
+		status.MonitorID = monitors[i].ID
+		status.Location = agent.Location
+		if err := saveLocationStatus(status); err != nil {
+			log.Println("save location status", status.Site, agent.Location, err)
+			continue
+		}
+		accepted++
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "accepted %d of %d results\n", accepted, len(results))
+}
+
+// consensus combines the local check with fresh results from remote locations. The monitor is down
+// when at least Quorum locations report it down.
+func (m *Monitor) consensus(local Status) Status {
+	local.Location = localLocation
+	if m.Quorum < 1 || len(m.Locations) == 0 {
+		return local
+	}
+	remote, err := getLocationStatuses(m.ID)
+	if err != nil {
+		log.Println("get location statuses", m.Name, err)
+		return local
+	}
+	frequency, err := m.frequency()
+	if err != nil {
+		frequency = time.Minute
+	}
+	results := []Status{local}
+	for _, status := range remote {
+		if local.Time.Sub(status.Time) <= 2*frequency+time.Minute {
+			results = append(results, status)
+		}
+	}
+	var up, down []Status
+	breakdown := make([]LocationResult, 0, len(results))
+	for _, status := range results {
+		breakdown = append(breakdown, LocationResult{
+			Location:   status.Location,
+			Time:       status.Time,
+			StatusCode: status.StatusCode,
+			Status:     status.Status,
+		})
+		if status.StatusCode == m.StatusOK {
+			up = append(up, status)
+		} else {
+			down = append(down, status)
+		}
+	}
+	chosen := local
+	switch {
+	case len(down) >= m.Quorum && local.StatusCode == m.StatusOK:
+		chosen = down[0]
+	case len(down) < m.Quorum && local.StatusCode != m.StatusOK && len(up) > 0:
+		chosen = up[0]
+	}
+	chosen.MonitorID = m.ID
+	chosen.Site = m.Name
+	chosen.Locations = breakdown
+	log.Println("consensus", m.Name, len(down), "of", len(results), "locations down, quorum", m.Quorum)
+	return chosen
+}
+
+// runAgent runs the remote probe agent until interrupted.
+func runAgent(args []string) error {
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	server := flags.String("server", os.Getenv("UPTIME_SERVER"), "url of the uptime server")
+	token := flags.String("token", os.Getenv("UPTIME_AGENT_TOKEN"), "agent token")
+	workers := flags.Int("workers", defaultWorkers, "maximum concurrent checks")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *server == "" || *token == "" {
+		return errors.New("agent requires -server and -token")
+	}
+	probe := &probe{
+		server:  strings.TrimSuffix(*server, "/"),
+		token:   *token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		due:     map[string]time.Time{},
+		state:   map[string]probeState{},
+		workers: make(chan struct{}, max(*workers, 1)),
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+	log.Println("starting agent for", probe.server)
+	probe.run(ctx)
+	log.Println("agent stopped")
+	return nil
+}
+
+// probe is the client side of a remote agent. Monitors are checked on their own schedules, recheck at their
+// down frequency while failing from this location, and results are kept until the server accepts them.
+type probe struct {
+	server   string
+	token    string
+	client   *http.Client
+	monitors []Monitor
+	workers  chan struct{}
+	lock     sync.Mutex
+	due      map[string]time.Time  // next check by monitor ID
+	state    map[string]probeState // by monitor ID
+	results  []Status
+	backoff  time.Duration // delay before the next push after a failed push
+	retry    time.Time     // time of the next push after a failed push
+}
+
+// probeState is the recent outcome of the checks of a monitor from the agent.
+type probeState struct {
+	down    bool      // the last check failed
+	upSince time.Time // time of the first success after a failure
+}
+
+// update returns the state after a check of the monitor.
+func (s probeState) update(m Monitor, status Status) probeState {
+	switch {
+	case status.StatusCode != m.StatusOK:
+		return probeState{down: true}
+	case s.down:
+		return probeState{upSince: status.Time}
+	default:
+		return s
+	}
+}
+
+// next returns the time of the next check of the monitor after t: at the down frequency of the monitor
+// while it is down or has not yet been stable for long enough, otherwise by its schedule.
+func (s probeState) next(m Monitor, after time.Time) (time.Time, error) {
+	fast, err := time.ParseDuration(m.DownFreq)
+	recovering := !s.upSince.IsZero() && after.Sub(s.upSince) < m.stableFor()
+	if err == nil && fast > 0 && (s.down || recovering) {
+		if next := after.Add(fast); m.Schedule.permits(next) {
+			return next, nil
+		}
+	}
+	return m.scheduledCheck(after)
+}
+
+func (p *probe) run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	refresh := time.NewTicker(agentRefresh)
+	defer refresh.Stop()
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	p.refresh(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-refresh.C:
+			p.refresh(ctx)
+		case now := <-tick.C:
+			p.start(ctx, &wg, now)
+			p.push(ctx, now)
+		}
+	}
+}
+
+// refresh retrieves the monitor assignments from the server.
+func (p *probe) refresh(ctx context.Context) {
+	body, err := p.request(ctx, http.MethodGet, "/agent/monitors", nil)
+	if err != nil {
+		log.Println("get assignments", err)
+		return
+	}
+	var monitors []Monitor
+	if err := json.Unmarshal(body, &monitors); err != nil {
+		log.Println("decode assignments", err)
+		return
+	}
+	if len(monitors) != len(p.monitors) {
+		log.Println("assigned", len(monitors), "monitors")
+	}
+	p.monitors = monitors
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for id := range p.due {
+		if !slices.ContainsFunc(monitors, func(m Monitor) bool { return m.ID == id }) {
+			delete(p.due, id)
+			delete(p.state, id)
+		}
+	}
+}
+
+// start launches the checks that are due. Monitors with a cron pattern wait for its first match, others are
+// checked on assignment.
+func (p *probe) start(ctx context.Context, wg *sync.WaitGroup, now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, m := range p.monitors {
+		due, ok := p.due[m.ID]
+		if !ok && m.Schedule.Cron != "" {
+			if due, err := m.nextCron(now); err != nil {
+				log.Println("monitor", m.Name, err)
+			} else {
+				p.due[m.ID] = due
+			}
+			continue
+		}
+		if ok && now.Before(due) {
+			continue
+		}
+		next, err := p.state[m.ID].next(m, now)
+		if err != nil {
+			log.Println("monitor", m.Name, err)
+			continue
+		}
+		p.due[m.ID] = next
+		if !m.Schedule.permits(now) {
+			continue
+		}
+		select {
+		case p.workers <- struct{}{}:
+		default:
+			log.Println("all workers busy, skipping", m.Name)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-p.workers }()
+			status := m.Check(ctx)
+			p.lock.Lock()
+			defer p.lock.Unlock()
+			p.results = append(p.results, status)
+			state := p.state[m.ID].update(m, status)
+			p.state[m.ID] = state
+			// schedule from the end of the check, as the server does
+			if next, err := state.next(m, time.Now()); err == nil {
+				p.due[m.ID] = next
+			}
+		}()
+	}
+}
+
+// push sends completed results to the server. Results that could not be pushed are kept, up to
+// agentBuffer, and retried with increasing delay.
+func (p *probe) push(ctx context.Context, now time.Time) {
+	p.lock.Lock()
+	results := p.results
+	p.results = nil
+	p.lock.Unlock()
+	if len(results) == 0 || now.Before(p.retry) {
+		p.requeue(results)
+		return
+	}
+	payload, err := json.Marshal(results)
+	if err != nil {
+		log.Println("encode results", err)
+		return
+	}
+	if _, err := p.request(ctx, http.MethodPost, "/agent/results", payload); err != nil {
+		p.backoff = min(max(2*p.backoff, agentPushRetry), agentRefresh)
+		p.retry = now.Add(p.backoff)
+		log.Println("push", len(results), "results", err, "retry in", p.backoff)
+		p.requeue(results)
+		return
+	}
+	p.backoff = 0
+	p.retry = time.Time{}
+	log.Println("pushed", len(results), "results")
+}
+
+// requeue returns unsent results ahead of newer ones, dropping the oldest beyond agentBuffer.
+func (p *probe) requeue(results []Status) {
+	if len(results) == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.results = append(results, p.results...)
+	if dropped := len(p.results) - agentBuffer; dropped > 0 {
+		log.Println("result buffer full, dropping", dropped, "oldest results")
+		p.results = p.results[dropped:]
+	}
+}
+
+func (p *probe) request(ctx context.Context, method, path string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.server+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, errors.New(strconv.Itoa(resp.StatusCode) + " " + strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAgentAuth(t *testing.T) {
+	testDB(t, backendBolt)
+	if err := saveAgent(Agent{Name: "eu", Location: "eu", TokenHash: hashToken("secret")}, false); err != nil {
+		t.Fatal(err)
+	}
+	request := func(token string) int {
+		r := httptest.NewRequest(http.MethodGet, "/agent/monitors", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		agentAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if agent, ok := requestAgent(r); !ok || agent.Name != "eu" {
+				t.Errorf("requestAgent() = %+v, %v, want eu", agent, ok)
+			}
+		})).ServeHTTP(w, r)
+		return w.Code
+	}
+	lastSeen := func() time.Time {
+		t.Helper()
+		agent, err := getAgent("eu")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent.LastSeen
+	}
+	if code := request("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("invalid token = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if !lastSeen().IsZero() {
+		t.Error("invalid token updated last seen")
+	}
+	if code := request("secret"); code != http.StatusOK {
+		t.Fatalf("valid token = %d, want %d", code, http.StatusOK)
+	}
+	first := lastSeen()
+	if time.Since(first) > time.Minute {
+		t.Fatalf("last seen %v, want now", first)
+	}
+	// results are pushed every second; last seen is saved at most once per agentLastSeenInterval
+	request("secret")
+	if got := lastSeen(); !got.Equal(first) {
+		t.Errorf("last seen updated to %v within %v", got, agentLastSeenInterval)
+	}
+	agent, err := getAgent("eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.LastSeen = time.Now().Add(-2 * agentLastSeenInterval)
+	if err := saveAgent(agent, true); err != nil {
+		t.Fatal(err)
+	}
+	request("secret")
+	if got := lastSeen(); time.Since(got) > time.Minute {
+		t.Errorf("last seen %v after %v, want now", got, 2*agentLastSeenInterval)
+	}
+}
+
+func TestConsensus(t *testing.T) {
+	testDB(t, backendBolt)
+	now := time.Now()
+	result := func(location string, code int, age time.Duration) Status {
+		return Status{Location: location, Time: now.Add(-age), StatusCode: code, Status: strconv.Itoa(code)}
+	}
+	tests := []struct {
+		name    string
+		quorum  int
+		local   Status
+		remote  []Status
+		want    int
+		results int
+	}{
+		{"no quorum uses local", 0, result(localLocation, 503, 0), []Status{result("eu", 200, 0)}, 503, 0},
+		{"all up", 2, result(localLocation, 200, 0), []Status{result("eu", 200, 0), result("us", 200, 0)}, 200, 3},
+		{"local down alone", 2, result(localLocation, 503, 0),
+			[]Status{result("eu", 200, 0), result("us", 200, 0)}, 200, 3},
+		{"remote down below quorum", 2, result(localLocation, 200, 0),
+			[]Status{result("eu", 503, 0), result("us", 200, 0)}, 200, 3},
+		{"quorum with local", 2, result(localLocation, 503, 0),
+			[]Status{result("eu", 503, 0), result("us", 200, 0)}, 503, 3},
+		{"quorum of remotes", 2, result(localLocation, 200, 0),
+			[]Status{result("eu", 503, 0), result("us", 503, 0)}, 503, 3},
+		{"stale results ignored", 2, result(localLocation, 200, 0),
+			[]Status{result("eu", 503, time.Hour), result("us", 503, 0)}, 200, 2},
+		{"local down without fresh results", 2, result(localLocation, 503, 0),
+			[]Status{result("eu", 200, time.Hour)}, 503, 1},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Monitor{ID: "m" + strconv.Itoa(i), Name: tt.name, Freq: "1m", StatusOK: 200,
+				Locations: []string{"eu", "us"}, Quorum: tt.quorum}
+			for _, status := range tt.remote {
+				status.MonitorID = m.ID
+				if err := saveLocationStatus(status); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := m.consensus(tt.local)
+			if got.StatusCode != tt.want {
+				t.Errorf("consensus() status %d, want %d", got.StatusCode, tt.want)
+			}
+			if len(got.Locations) != tt.results {
+				t.Errorf("consensus() combined %d results, want %d", len(got.Locations), tt.results)
+			}
+		})
+	}
+}
+
+func TestProbeState(t *testing.T) {
+	now := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	m := Monitor{Freq: "5m", DownFreq: "30s", StatusOK: 200}
+	up := Status{StatusCode: 200, Time: now}
+	down := Status{StatusCode: 503, Time: now}
+	tests := []struct {
+		name    string
+		monitor Monitor
+		state   probeState
+		status  Status
+		after   time.Time
+		want    time.Time
+	}{
+		{"up", m, probeState{}, up, now, now.Add(5 * time.Minute)},
+		{"down", m, probeState{}, down, now, now.Add(30 * time.Second)},
+		{"recovering", m, probeState{down: true}, up, now.Add(time.Minute), now.Add(90 * time.Second)},
+		{"stable again", m, probeState{down: true}, up, now.Add(time.Hour), now.Add(time.Hour + 5*time.Minute)},
+		{"no down frequency", Monitor{Freq: "5m", StatusOK: 200}, probeState{}, down, now, now.Add(5 * time.Minute)},
+		{"down outside schedule", Monitor{Freq: "5m", DownFreq: "30s", StatusOK: 200,
+			Schedule: Schedule{TimeZone: "UTC", Start: "09:00", End: "12:00"}}, probeState{},
+			Status{StatusCode: 503, Time: now.Add(-time.Minute)}, now.Add(-15 * time.Second),
+			now.Add(21 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := tt.state.update(tt.monitor, tt.status)
+			got, err := state.next(tt.monitor, tt.after)
+			if err != nil {
+				t.Fatalf("next() error = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbePush(t *testing.T) {
+	fail := true
+	var received [][]Status
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, errAgentAuth.Error(), http.StatusUnauthorized)
+			return
+		}
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var results []Status
+		if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
+			t.Error(err)
+		}
+		received = append(received, results)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	p := &probe{server: server.URL, token: "secret", client: server.Client()}
+	now := time.Now()
+	p.results = []Status{{MonitorID: "m1"}}
+
+	p.push(context.Background(), now)
+	if len(p.results) != 1 || p.backoff != agentPushRetry || !p.retry.Equal(now.Add(agentPushRetry)) {
+		t.Fatalf("after failed push: %d results, backoff %v, retry %v", len(p.results), p.backoff, p.retry)
+	}
+	p.results = append(p.results, Status{MonitorID: "m2"})
+	p.push(context.Background(), now.Add(time.Second))
+	if len(p.results) != 2 || p.backoff != agentPushRetry {
+		t.Fatalf("push before retry: %d results, backoff %v", len(p.results), p.backoff)
+	}
+	for _, want := range []time.Duration{2 * agentPushRetry, 4 * agentPushRetry, 8 * agentPushRetry, agentRefresh,
+		agentRefresh} {
+		now = p.retry
+		p.push(context.Background(), now)
+		if p.backoff != want {
+			t.Errorf("backoff %v, want %v", p.backoff, want)
+		}
+	}
+	fail = false
+	p.push(context.Background(), p.retry)
+	if len(p.results) != 0 || p.backoff != 0 || !p.retry.IsZero() {
+		t.Fatalf("after push: %d results, backoff %v, retry %v", len(p.results), p.backoff, p.retry)
+	}
+	if len(received) != 1 || len(received[0]) != 2 || received[0][0].MonitorID != "m1" {
+		t.Errorf("received %v, want the results oldest first", received)
+	}
+}
+
+func TestProbeRequeue(t *testing.T) {
+	p := &probe{}
+	p.results = []Status{{MonitorID: "new"}}
+	older := make([]Status, agentBuffer)
+	older[0].MonitorID = "oldest"
+	older[1].MonitorID = "kept"
+	p.requeue(older)
+	if len(p.results) != agentBuffer {
+		t.Fatalf("requeue kept %d results, want %d", len(p.results), agentBuffer)
+	}
+	if p.results[0].MonitorID != "kept" || p.results[len(p.results)-1].MonitorID != "new" {
+		t.Errorf("requeue kept %q to %q, want kept to new", p.results[0].MonitorID, p.results[len(p.results)-1].MonitorID)
+	}
+}
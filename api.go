@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	maxAPIBody          = 1 << 20 // bytes of request body read by the api
+	defaultHistoryLimit = 1000    // history records returned by the api unless limit is given
+	maxHistoryLimit     = 10000   // upper bound of the limit of history records
+)
+
+var errNoStatus = errors.New("no status yet")
+
+// APIStatus is the current status of a monitor returned by the api.
+type APIStatus struct {
+	ID          string
+	Name        string
+	Active      bool
+	Up          bool
+	Maintenance bool
+	Flapping    bool
+	Uptime24    float64 // per cent
+	Status      Status
+}
+
+// APIStats summarizes the checks of a monitor over a time range; durations are in nanoseconds.
+type APIStats struct {
+	From   time.Time
+	To     time.Time
+	Checks int
+	Good   int
+	Uptime float64 // per cent, time weighted
+	Up     time.Duration
+	Down   time.Duration
+	Min    time.Duration
+	Avg    time.Duration
+	Max    time.Duration
+	P95    time.Duration
+}
+
+// writeJSON writes v as the JSON response.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("encode api response", err)
+	}
+}
+
+// apiError writes an error as the JSON response.
+func apiError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// readBody returns the request body, limited to maxAPIBody.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBody))
+}
+
+// timeRange reads the from and to query parameters (RFC 3339); the default is the last 24 hours.
+func timeRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now()
+	if value := r.URL.Query().Get("to"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid to time " + value)
+		}
+		to = t
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := r.URL.Query().Get("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid from time " + value)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// apiMonitors lists the monitors, optionally only the one with the name given by the name parameter.
+func apiMonitors(w http.ResponseWriter, r *http.Request) {
+	monitors, err := getMonitors()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if name := r.URL.Query().Get("name"); name != "" {
+		monitors = slices.DeleteFunc(monitors, func(m Monitor) bool { return m.Name != name })
+	}
+	writeJSON(w, http.StatusOK, monitors)
+}
+
+func apiMonitor(w http.ResponseWriter, r *http.Request) {
+	monitor, err := getMonitor(r.PathValue("site"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, monitor)
+}
+
+// decodeAPIMonitor decodes a monitor from the request body onto monitor and validates it for the user of
+// the request; unknown fields are rejected. It returns the status code of the error.
+func decodeAPIMonitor(w http.ResponseWriter, r *http.Request, monitor *Monitor) (int, error) {
+	id := monitor.ID
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(monitor); err != nil {
+		return http.StatusBadRequest, err
+	}
+	monitor.ID = id
+	user, err := currentUser(r)
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	if !user.manages(monitor.Team) {
+		return http.StatusForbidden, teamError(monitor.Team)
+	}
+	if monitor.Name == "" {
+		return http.StatusBadRequest, errors.New("name is required")
+	}
+	if existing, err := getMonitorByName(monitor.Name); err == nil && existing.ID != monitor.ID {
+		return http.StatusConflict, errors.New("monitor " + monitor.Name + " exists")
+	}
+	if err := validateConfigMonitor(*monitor); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := monitor.validateParents(); err != nil {
+		return http.StatusBadRequest, err
+	}
+	ids, err := store.Notifiers()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for _, notifier := range slices.Concat(monitor.Notifiers, monitor.EscalateTo) {
+		if !slices.Contains(ids, notifier) {
+			return http.StatusBadRequest, errors.New("no such notifier " + notifier)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// apiCreateMonitor creates a monitor; omitted fields default as in the config file.
+func apiCreateMonitor(w http.ResponseWriter, r *http.Request) {
+	monitor := Monitor{Type: HTTP, Freq: "5m", Timeout: "5s", StatusOK: http.StatusOK, Active: true}
+	if code, err := decodeAPIMonitor(w, r, &monitor); err != nil {
+		apiError(w, code, err)
+		return
+	}
+	var err error
+	if monitor.ID, err = newID(); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := saveMonitor(monitor, false); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	auditChange(r, auditCreate, "monitor", monitor.Name, monitor.ID, nil, monitor)
+	reset <- syscall.SIGHUP
+	w.Header().Set("Location", "/api/v1/monitors/"+monitor.ID)
+	writeJSON(w, http.StatusCreated, monitor)
+}
+
+// apiReplaceMonitor replaces a monitor; omitted fields default as on creation.
+func apiReplaceMonitor(w http.ResponseWriter, r *http.Request) {
+	updateAPIMonitor(w, r, func(Monitor) Monitor {
+		return Monitor{Type: HTTP, Freq: "5m", Timeout: "5s", StatusOK: http.StatusOK, Active: true}
+	})
+}
+
+// apiPatchMonitor changes the fields of a monitor present in the request.
+func apiPatchMonitor(w http.ResponseWriter, r *http.Request) {
+	updateAPIMonitor(w, r, func(existing Monitor) Monitor {
+		return existing
+	})
+}
+
+// updateAPIMonitor updates the monitor of the path with the request decoded onto the monitor returned by
+// base.
+func updateAPIMonitor(w http.ResponseWriter, r *http.Request, base func(Monitor) Monitor) {
+	before, err := getMonitor(r.PathValue("site"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	if isManagedMonitor(before.Name) {
+		apiError(w, http.StatusConflict, errManaged)
+		return
+	}
+	monitor := base(before)
+	monitor.ID = before.ID
+	if code, err := decodeAPIMonitor(w, r, &monitor); err != nil {
+		apiError(w, code, err)
+		return
+	}
+	if err := saveMonitor(monitor, true); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	auditChange(r, auditUpdate, "monitor", monitor.Name, monitor.ID, before, monitor)
+	reset <- syscall.SIGHUP
+	writeJSON(w, http.StatusOK, monitor)
+}
+
+// apiDeleteMonitor deletes a monitor, and its history if the history parameter is true.
+func apiDeleteMonitor(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	before, err := getMonitor(site)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	if isManagedMonitor(before.Name) {
+		apiError(w, http.StatusConflict, errManaged)
+		return
+	}
+	if err := removeMonitor(site); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	entry := AuditEntry{Action: auditDelete, Kind: "monitor", Target: before.Name, TargetID: site,
+		Changes: auditDiff(before, nil)}
+	if history, _ := strconv.ParseBool(r.URL.Query().Get("history")); history {
+		if err := deleteHistory(site); err != nil {
+			apiError(w, http.StatusInternalServerError, err)
+			return
+		}
+		entry.Detail = "history deleted"
+	}
+	recordAudit(r, entry)
+	reset <- syscall.SIGHUP
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiStatuses returns the current status of all monitors.
+func apiStatuses(w http.ResponseWriter, _ *http.Request) {
+	statuses := []APIStatus{}
+	for _, monitor := range getAllMonitorsForDisplay() {
+		statuses = append(statuses, APIStatus{
+			ID:          monitor.ID,
+			Name:        monitor.Name,
+			Active:      monitor.Active,
+			Up:          monitor.DisplayStatus,
+			Maintenance: monitor.Maintenance,
+			Flapping:    monitor.Flapping,
+			Uptime24:    monitor.PerCent,
+			Status:      monitor.Status,
+		})
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func apiMonitorStatus(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	if _, err := getMonitor(site); err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	status, err := getStatus(site)
+	if err != nil || status.Time.IsZero() {
+		apiError(w, http.StatusNotFound, errNoStatus)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// apiHistory returns up to limit check results of a monitor after from and up to to, oldest first; the next
+// page is requested with from set to the time of the last record.
+func apiHistory(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	if _, err := getMonitor(site); err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	from, to, err := timeRange(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit := defaultHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxHistoryLimit {
+			apiError(w, http.StatusBadRequest, errors.New("limit must be between 1 and "+
+				strconv.Itoa(maxHistoryLimit)))
+			return
+		}
+	}
+	history, err := store.History(site, from.Add(time.Nanosecond), to, limit)
+	if errors.Is(err, errPath) {
+		history, err = []Status{}, nil // no history yet
+	}
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// apiStats summarizes the checks of a monitor over the time range from its rollups.
+func apiStats(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	if _, err := getMonitor(site); err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	from, to, err := timeRange(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	rollup, err := summarizeRange(site, from, to)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APIStats{
+		From:   from,
+		To:     to,
+		Checks: rollup.Count,
+		Good:   rollup.Good,
+		Uptime: rollup.Uptime(),
+		Up:     rollup.Up,
+		Down:   rollup.Down,
+		Min:    rollup.Min,
+		Avg:    rollup.Avg(),
+		Max:    rollup.Max,
+		P95:    rollup.Percentile(95),
+	})
+}
+
+// apiNotifierFields returns a notifier as returned by the api: the layout of the config file with its ID
+// and credentials redacted.
+func apiNotifierFields(id string) (map[string]any, error) {
+	kind, data, err := getNotify(id)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := notifierFields(kind, data, true)
+	if err != nil {
+		return nil, err
+	}
+	fields["id"] = id
+	return fields, nil
+}
+
+// apiNotifiers lists the notifiers, optionally only the one with the name given by the name parameter.
+func apiNotifiers(w http.ResponseWriter, r *http.Request) {
+	ids, err := store.Notifiers()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	notifiers := []map[string]any{}
+	for _, id := range ids {
+		fields, err := apiNotifierFields(id)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if name := r.URL.Query().Get("name"); name != "" && fields["name"] != name {
+			continue
+		}
+		notifiers = append(notifiers, fields)
+	}
+	writeJSON(w, http.StatusOK, notifiers)
+}
+
+func apiNotifier(w http.ResponseWriter, r *http.Request) {
+	fields, err := apiNotifierFields(r.PathValue("notify"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, fields)
+}
+
+// decodeAPINotifier decodes a notifier in the layout of the config file from the request body and checks
+// that the user of the request manages its team. It returns the status code of the error.
+func decodeAPINotifier(w http.ResponseWriter, r *http.Request) (configNotifier, int, error) {
+	body, err := readBody(w, r)
+	if err != nil {
+		return configNotifier{}, http.StatusBadRequest, err
+	}
+	notifier, err := decodeNotifier(body)
+	if err != nil {
+		return notifier, http.StatusBadRequest, err
+	}
+	user, err := currentUser(r)
+	if err != nil {
+		return notifier, http.StatusUnauthorized, err
+	}
+	if team := notifierTeam(notifier.Data); !user.manages(team) {
+		return notifier, http.StatusForbidden, teamError(team)
+	}
+	return notifier, http.StatusOK, nil
+}
+
+func apiCreateNotifier(w http.ResponseWriter, r *http.Request) {
+	notifier, code, err := decodeAPINotifier(w, r)
+	if err != nil {
+		apiError(w, code, err)
+		return
+	}
+	if hasRedacted(notifier.Data) {
+		apiError(w, http.StatusBadRequest, errors.New("credentials of a new notifier may not be "+redacted))
+		return
+	}
+	id, err := createNotify(notifier.Name, notifier.Type, json.RawMessage(notifier.Data))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	auditChange(r, auditCreate, "notifier", notifier.Name, id, nil, notifier.Data)
+	reset <- syscall.SIGHUP
+	fields, err := apiNotifierFields(id)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/notifiers/"+id)
+	writeJSON(w, http.StatusCreated, fields)
+}
+
+// apiUpdateNotifier replaces a notifier; redacted credentials keep their value. The type cannot change.
+func apiUpdateNotifier(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("notify")
+	kind, before, err := getNotify(id)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	if isManagedNotifier(notifierName(before)) {
+		apiError(w, http.StatusConflict, errManaged)
+		return
+	}
+	notifier, code, err := decodeAPINotifier(w, r)
+	if err != nil {
+		apiError(w, code, err)
+		return
+	}
+	if notifier.Type != kind {
+		apiError(w, http.StatusBadRequest, errors.New("notifier type cannot change from "+string(kind)))
+		return
+	}
+	data, err := keepSecrets(notifier.Data, before)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := updateNotify(id, kind, json.RawMessage(data)); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	auditChange(r, auditUpdate, "notifier", notifier.Name, id, before, data)
+	reset <- syscall.SIGHUP
+	fields, err := apiNotifierFields(id)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, fields)
+}
+
+func apiDeleteNotifier(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("notify")
+	_, before, err := getNotify(id)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+	name := notifierName(before)
+	if isManagedNotifier(name) {
+		apiError(w, http.StatusConflict, errManaged)
+		return
+	}
+	if err := removeNotify(id); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	auditChange(r, auditDelete, "notifier", name, id, before, nil)
+	reset <- syscall.SIGHUP
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAPIHistoryPages(t *testing.T) {
+	testDB(t, backendBolt)
+	if err := store.SaveMonitor(Monitor{ID: "m1", Name: "site", StatusOK: 200}, false); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	want := []time.Time{}
+	for i := range 5 {
+		status := Status{MonitorID: "m1", Time: start.Add(time.Duration(i)*time.Minute + 250*time.Millisecond),
+			StatusCode: 200}
+		if err := store.AddHistory("m1", 200, status); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, status.Time)
+	}
+	got := []time.Time{}
+	from := start
+	for page := 0; ; page++ {
+		if page > len(want) {
+			t.Fatal("history does not end")
+		}
+		query := url.Values{"from": {from.Format(time.RFC3339Nano)}, "limit": {"2"}}
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/monitors/m1/history?"+query.Encode(), nil)
+		r.SetPathValue("site", "m1")
+		w := httptest.NewRecorder()
+		apiHistory(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("apiHistory() = %d %s", w.Code, w.Body)
+		}
+		var history []Status
+		if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+			t.Fatal(err)
+		}
+		if len(history) > 2 {
+			t.Fatalf("page of %d records, want at most 2", len(history))
+		}
+		if len(history) == 0 {
+			break
+		}
+		for _, status := range history {
+			got = append(got, status.Time)
+		}
+		from = history[len(history)-1].Time
+	}
+	if len(got) != len(want) {
+		t.Fatalf("pages returned %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("record %d at %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// audited actions.
+const (
+	auditCreate      = "create"
+	auditUpdate      = "update"
+	auditDelete      = "delete"
+	auditPause       = "pause"
+	auditResume      = "resume"
+	auditPurge       = "purge"
+	auditImport      = "import"
+	auditApply       = "apply"
+	auditBackup      = "backup"
+	auditLogin       = "login"
+	auditLoginFailed = "login failed"
+)
+
+// auditActions and auditKinds are the choices of the audit log filter.
+var (
+	auditActions = []string{auditCreate, auditUpdate, auditDelete, auditPause, auditResume, auditPurge,
+		auditImport, auditApply, auditBackup, auditLogin, auditLoginFailed}
+	auditKinds = []string{"monitor", "notifier", "user", "history", "maintenance", "settings", "config",
+		"session", "token", "agent", "database"}
+)
+
+// auditHidden are the fields whose values are never written to the audit log: passwords, token hashes and
+// notifier credentials. A change to one is recorded without its values.
+var auditHidden = append([]string{"Pass", "Hash", "TokenHash"}, secretFields...)
+
+// AuditEntry records who did what and when.
+type AuditEntry struct {
+	ID       uint64
+	Time     time.Time
+	User     string
+	Remote   string // address of the client
+	Action   string
+	Kind     string        // one of auditKinds
+	Target   string        // name of the monitor, notifier, user, window or agent acted on, or the backup file
+	TargetID string        `json:",omitempty"`
+	Changes  []AuditChange `json:",omitempty"`
+	Detail   string        `json:",omitempty"`
+}
+
+// AuditChange is a field changed by an audited action; Before or After is empty when the entry is created
+// or deleted.
+type AuditChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// AuditFilter selects audit entries; empty fields match all.
+type AuditFilter struct {
+	User   string
+	Action string
+	Kind   string
+	Target string // substring of the target, case insensitive
+	From   time.Time
+	To     time.Time
+}
+
+// auditFilter reads an audit filter from query values; dates are local days, inclusive.
+func auditFilter(values url.Values) (AuditFilter, error) {
+	filter := AuditFilter{
+		User:   strings.TrimSpace(values.Get("user")),
+		Action: values.Get("action"),
+		Kind:   values.Get("kind"),
+		Target: strings.TrimSpace(values.Get("target")),
+	}
+	if value := values.Get("from"); value != "" {
+		from, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+		if err != nil {
+			return filter, errors.New("invalid from date " + value)
+		}
+		filter.From = from
+	}
+	if value := values.Get("to"); value != "" {
+		to, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+		if err != nil {
+			return filter, errors.New("invalid to date " + value)
+		}
+		filter.To = to.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
+
+// matches reports whether an entry is selected by the filter.
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	switch {
+	case f.User != "" && entry.User != f.User,
+		f.Action != "" && entry.Action != f.Action,
+		f.Kind != "" && entry.Kind != f.Kind,
+		f.Target != "" && !strings.Contains(strings.ToLower(entry.Target), strings.ToLower(f.Target)),
+		!f.From.IsZero() && entry.Time.Before(f.From),
+		!f.To.IsZero() && !entry.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// auditFields flattens the JSON encoding of v, or v itself if it is already encoded, to its top level
+// fields, with values encoded as JSON except for strings.
+func auditFields(v any) map[string]string {
+	fields := map[string]string{}
+	if v == nil {
+		return fields
+	}
+	bytes, ok := v.([]byte)
+	if !ok {
+		var err error
+		if bytes, err = json.Marshal(v); err != nil {
+			log.Println("audit fields", err)
+			return fields
+		}
+	}
+	values := map[string]any{}
+	if err := json.Unmarshal(bytes, &values); err != nil {
+		return fields
+	}
+	for key, value := range values {
+		if s, ok := value.(string); ok {
+			fields[key] = s
+			continue
+		}
+		encoded, _ := json.Marshal(value)
+		fields[key] = string(encoded)
+	}
+	return fields
+}
+
+// auditDiff returns the fields that differ between before and after; nil stands for a record that does
+// not exist.
+func auditDiff(before, after any) []AuditChange {
+	old, updated := auditFields(before), auditFields(after)
+	keys := []string{}
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range updated {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	changes := []AuditChange{}
+	for _, key := range keys {
+		a, b := old[key], updated[key]
+		if a == b || (hiddenValue(a) == "" && hiddenValue(b) == "") {
+			continue
+		}
+		if slices.Contains(auditHidden, key) {
+			a, b = hiddenValue(a), hiddenValue(b)
+		}
+		changes = append(changes, AuditChange{Field: key, Before: a, After: b})
+	}
+	return changes
+}
+
+// hiddenValue replaces a hidden value that is set.
+func hiddenValue(value string) string {
+	if value == "" || value == "null" {
+		return ""
+	}
+	return "(hidden)"
+}
+
+// recordAudit saves an entry for the user of the request. Errors are logged; auditing never blocks the
+// action audited.
+func recordAudit(r *http.Request, entry AuditEntry) {
+	if entry.User == "" {
+		// the session user may just have been deleted
+		if user, err := currentUser(r); err == nil {
+			entry.User = user.Name
+		} else if session, err := sessionUser(r); err == nil {
+			entry.User = session.Name
+		}
+	}
+	if token, ok := requestToken(r); ok {
+		entry.Detail = strings.TrimSpace(entry.Detail + " (api token " + token.Name + ")")
+	}
+	entry.Time = time.Now()
+	entry.Remote = r.RemoteAddr
+	if err := saveAuditEntry(&entry); err != nil {
+		log.Println("save audit entry", entry.Action, entry.Kind, entry.Target, err)
+	}
+}
+
+// auditChange records an action on a monitor, notifier or other record with the changes from before
+// to after.
+func auditChange(r *http.Request, action, kind, target, targetID string, before, after any) {
+	recordAudit(r, AuditEntry{
+		Action:   action,
+		Kind:     kind,
+		Target:   target,
+		TargetID: targetID,
+		Changes:  auditDiff(before, after),
+	})
+}
+
+// describeChanges returns the changes of an entry on one line.
+func describeChanges(changes []AuditChange) string {
+	parts := make([]string, 0, len(changes))
+	for _, change := range changes {
+		parts = append(parts, change.Field+": "+change.Before+" -> "+change.After)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// exportAudit writes audit entries as csv or ndjson.
+func exportAudit(w io.Writer, entries []AuditEntry, format string) error {
+	switch format {
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"id", "time", "user", "remote", "action", "kind", "target", "target_id",
+			"changes", "detail"}); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := writer.Write([]string{
+				strconv.FormatUint(entry.ID, 10),
+				entry.Time.Format(time.RFC3339),
+				entry.User,
+				entry.Remote,
+				entry.Action,
+				entry.Kind,
+				entry.Target,
+				entry.TargetID,
+				describeChanges(entry.Changes),
+				entry.Detail,
+			}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return errors.New("invalid audit format " + format)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditDiff(t *testing.T) {
+	monitor := Monitor{ID: "m1", Name: "api", Freq: "5m", Active: true}
+	changed := monitor
+	changed.Freq = "1m"
+	changed.Active = false
+	changed.Notifiers = []string{"n1"}
+	tests := []struct {
+		name   string
+		before any
+		after  any
+		want   []AuditChange
+	}{
+		{"unchanged", monitor, monitor, []AuditChange{}},
+		{"update", monitor, changed, []AuditChange{
+			{Field: "Active", Before: "true", After: "false"},
+			{Field: "Freq", Before: "5m", After: "1m"},
+			{Field: "Notifiers", Before: "null", After: `["n1"]`},
+		}},
+		{"create", nil, User{Name: "alice", Pass: "hash", Role: roleEditor}, []AuditChange{
+			{Field: "Name", After: "alice"},
+			{Field: "Pass", After: "(hidden)"},
+			{Field: "Role", After: "editor"},
+		}},
+		{"delete", User{Name: "alice", Pass: "hash"}, nil, []AuditChange{
+			{Field: "Name", Before: "alice"},
+			{Field: "Pass", Before: "(hidden)"},
+		}},
+		{"password changed", User{Name: "alice", Pass: "old"}, User{Name: "alice", Pass: "new"}, []AuditChange{
+			{Field: "Pass", Before: "(hidden)", After: "(hidden)"},
+		}},
+		{"notifier data", []byte(`{"name":"ops","token":"old","channel":"a"}`),
+			[]byte(`{"name":"ops","token":"new","channel":"b"}`), []AuditChange{
+				{Field: "channel", Before: "a", After: "b"},
+				{Field: "token", Before: "(hidden)", After: "(hidden)"},
+			}},
+		{"credential removed", []byte(`{"url":"https://hooks.example.com/secret"}`), []byte(`{"url":""}`),
+			[]AuditChange{{Field: "url", Before: "(hidden)"}}},
+		{"agent token", Agent{Name: "eu", TokenHash: "abc"}, Agent{Name: "eu", TokenHash: "def"}, []AuditChange{
+			{Field: "TokenHash", Before: "(hidden)", After: "(hidden)"},
+		}},
+		{"empty values", []byte(`{"name":"ops","token":null}`), []byte(`{"name":"ops","token":""}`),
+			[]AuditChange{}},
+		{"invalid json", []byte("not json"), nil, []AuditChange{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auditDiff(tt.before, tt.after); !slices.Equal(got, tt.want) {
+				t.Errorf("auditDiff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditFilter(t *testing.T) {
+	day := func(d, hour int) time.Time { return time.Date(2026, 1, d, hour, 0, 0, 0, time.Local) }
+	entry := AuditEntry{Time: day(5, 12), User: "alice", Action: auditUpdate, Kind: "monitor", Target: "API Server"}
+	tests := []struct {
+		name  string
+		query string
+		match bool
+		err   bool
+	}{
+		{"everything", "", true, false},
+		{"user", "user=alice", true, false},
+		{"other user", "user=bob", false, false},
+		{"user with spaces", "user=+alice+", true, false},
+		{"action", "action=update", true, false},
+		{"other action", "action=delete", false, false},
+		{"kind", "kind=notifier", false, false},
+		{"target substring", "target=server", true, false},
+		{"other target", "target=web", false, false},
+		{"on the day", "from=2026-01-05&to=2026-01-05", true, false},
+		{"from later", "from=2026-01-06", false, false},
+		{"to earlier", "to=2026-01-04", false, false},
+		{"invalid from", "from=yesterday", false, true},
+		{"invalid to", "to=05/01/2026", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter, err := auditFilter(values)
+			if (err != nil) != tt.err {
+				t.Fatalf("auditFilter(%q) error = %v, want error %v", tt.query, err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := filter.matches(entry); got != tt.match {
+				t.Errorf("auditFilter(%q).matches() = %v, want %v", tt.query, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestRecordAudit(t *testing.T) {
+	testDB(t, backendBolt)
+	r := httptest.NewRequest("POST", "/monitor/edit/m1", nil)
+	for _, target := range []string{"api", "web", "api"} {
+		auditChange(r, auditUpdate, "monitor", target, "id-"+target, Monitor{Freq: "5m"}, Monitor{Freq: "1m"})
+	}
+	recordAudit(r, AuditEntry{User: "alice", Action: auditBackup, Kind: "database", Target: "uptime.db"})
+	entries, err := getAuditEntries(AuditFilter{Kind: "monitor", Target: "api"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID <= entries[1].ID {
+		t.Fatalf("audit entries %+v, want two, newest first", entries)
+	}
+	if entries[0].Remote != r.RemoteAddr || entries[0].Time.IsZero() || entries[0].TargetID != "id-api" ||
+		describeChanges(entries[0].Changes) != "Freq: 5m -> 1m" {
+		t.Errorf("audit entry %+v", entries[0])
+	}
+	if entries, err := getAuditEntries(AuditFilter{}, 2); err != nil || len(entries) != 2 || entries[0].User != "alice" {
+		t.Errorf("limited audit entries %+v, %v, want the newest two", entries, err)
+	}
+}
+
+func TestExportAudit(t *testing.T) {
+	entries := []AuditEntry{{
+		ID: 1, Time: time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC), User: "alice", Remote: "192.0.2.1:1234",
+		Action: auditUpdate, Kind: "monitor", Target: "api", TargetID: "m1", Detail: "config, reloaded",
+		Changes: []AuditChange{{Field: "Freq", Before: "5m", After: "1m"}, {Field: "Active", Before: "true"}},
+	}}
+	var csv bytes.Buffer
+	if err := exportAudit(&csv, entries, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,time,user,remote,action,kind,target,target_id,changes,detail\n" +
+		`1,2026-01-05T12:00:00Z,alice,192.0.2.1:1234,update,monitor,api,m1,Freq: 5m -> 1m; Active: true -> ,` +
+		`"config, reloaded"` + "\n"
+	if csv.String() != want {
+		t.Errorf("csv export\n%s\nwant\n%s", csv.String(), want)
+	}
+	var ndjson bytes.Buffer
+	if err := exportAudit(&ndjson, append(entries, entries...), "ndjson"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n"); len(lines) != 2 ||
+		!strings.Contains(lines[0], `"Field":"Freq"`) {
+		t.Errorf("ndjson export %s", ndjson.String())
+	}
+	if err := exportAudit(&ndjson, entries, "xml"); err == nil {
+		t.Error("exported the audit log as xml")
+	}
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+const (
+	backupPrefix     = "uptime-"
+	backupSuffix     = ".db"
+	archiveSuffix    = ".tar" // backups with the sqlite store, holding uptime.db and uptime.sqlite
+	backupTimeFormat = "20060102-150405"
+)
+
+var errDBInUse = errors.New("database is in use by the running server; back it up with -server and -token instead")
+
+// backupFile is a backup in the backup directory.
+type backupFile struct {
+	Path string
+	Time time.Time
+	Seq  int // of backups taken within the same second, from 1
+	Size int64
+}
+
+// backupDir returns the directory of scheduled backups.
+func (s Settings) backupDir() string {
+	if s.BackupDir != "" {
+		return s.BackupDir
+	}
+	return filepath.Join(dataDir(), "backups")
+}
+
+// backupKeep returns the number of scheduled backups to keep.
+func (s Settings) backupKeep() int {
+	if s.BackupKeep > 0 {
+		return s.BackupKeep
+	}
+	return defaultBackupKeep
+}
+
+// sqliteConfigured reports whether UPTIME_STORE selects the sqlite store.
+func sqliteConfigured() bool {
+	return os.Getenv("UPTIME_STORE") == backendSQLite
+}
+
+// backupName returns the file name of a backup taken at t: a bbolt database, or with the sqlite store a tar
+// archive of both databases.
+func backupName(t time.Time) string {
+	if sqliteConfigured() {
+		return backupPrefix + t.Format(backupTimeFormat) + archiveSuffix
+	}
+	return backupPrefix + t.Format(backupTimeFormat) + backupSuffix
+}
+
+// writeBackup writes a consistent copy of the database to w while the server keeps running. With the
+// sqlite store, the backup is a tar archive of uptime.db and uptime.sqlite.
+func writeBackup(w io.Writer) (int64, error) {
+	if sqlite, ok := store.(*sqliteStore); ok {
+		return writeArchive(w, db, sqlite)
+	}
+	return writeBolt(w, db)
+}
+
+// writeBolt writes a consistent copy of a bbolt database to w from a read transaction.
+func writeBolt(w io.Writer, source *bbolt.DB) (int64, error) {
+	var n int64
+	err := source.View(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// writeArchive writes a tar archive of consistent copies of the bbolt database and the sqlite store to w.
+// The copies are taken one after the other.
+func writeArchive(w io.Writer, source *bbolt.DB, sqlite *sqliteStore) (int64, error) {
+	out := &countingWriter{w: w}
+	archive := tar.NewWriter(out)
+	if err := source.View(func(tx *bbolt.Tx) error {
+		if err := archive.WriteHeader(&tar.Header{
+			Name: dbFile, Mode: 0o600, Size: tx.Size(), ModTime: time.Now(),
+		}); err != nil {
+			return err
+		}
+		_, err := tx.WriteTo(archive)
+		return err
+	}); err != nil {
+		return out.n, err
+	}
+	dir, err := os.MkdirTemp("", "uptime-backup-")
+	if err != nil {
+		return out.n, err
+	}
+	defer os.RemoveAll(dir)
+	copied := filepath.Join(dir, sqliteFile)
+	if err := sqlite.backup(copied); err != nil {
+		return out.n, err
+	}
+	file, err := os.Open(copied)
+	if err != nil {
+		return out.n, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return out.n, err
+	}
+	if err := archive.WriteHeader(&tar.Header{
+		Name: sqliteFile, Mode: 0o600, Size: info.Size(), ModTime: time.Now(),
+	}); err != nil {
+		return out.n, err
+	}
+	if _, err := io.Copy(archive, file); err != nil {
+		return out.n, err
+	}
+	return out.n, archive.Close()
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// createBackup writes a backup into dir and returns its path. The backup is written to a temporary file
+// which is renamed when complete, so a partial backup never replaces a good one. Backups taken within the
+// same second are numbered (uptime-<time>-2.db) rather than replacing each other.
+func createBackup(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	temp, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := writeBackup(temp); err != nil {
+		temp.Close()
+		return "", err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return "", err
+	}
+	if err := temp.Close(); err != nil {
+		return "", err
+	}
+	name := backupName(time.Now())
+	ext := filepath.Ext(name)
+	for seq := 1; ; seq++ {
+		file := filepath.Join(dir, name)
+		if seq > 1 {
+			file = filepath.Join(dir, strings.TrimSuffix(name, ext)+"-"+strconv.Itoa(seq)+ext)
+		}
+		// reserve the name; the complete backup is renamed over the empty file
+		reserved, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		reserved.Close()
+		if err := os.Rename(temp.Name(), file); err != nil {
+			os.Remove(file)
+			return "", err
+		}
+		return file, nil
+	}
+}
+
+// listBackups returns the backups in dir, newest first.
+func listBackups(dir string) ([]backupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []backupFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	backups := []backupFile{}
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), backupPrefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		stamp, bolt := strings.CutSuffix(stamp, backupSuffix)
+		stamp, archive := strings.CutSuffix(stamp, archiveSuffix)
+		if !bolt && !archive {
+			continue
+		}
+		seq := 1
+		if len(stamp) > len(backupTimeFormat) {
+			n, err := strconv.Atoi(strings.TrimPrefix(stamp[len(backupTimeFormat):], "-"))
+			if err != nil || n < 2 || stamp[len(backupTimeFormat)] != '-' {
+				continue
+			}
+			stamp, seq = stamp[:len(backupTimeFormat)], n
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{Path: filepath.Join(dir, entry.Name()), Time: t, Seq: seq,
+			Size: info.Size()})
+	}
+	slices.SortFunc(backups, func(a, b backupFile) int {
+		if c := b.Time.Compare(a.Time); c != 0 {
+			return c
+		}
+		return b.Seq - a.Seq
+	})
+	return backups, nil
+}
+
+// rotateBackups deletes all but the newest keep backups in dir.
+func rotateBackups(dir string, keep int) error {
+	backups, err := listBackups(dir)
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups[min(keep, len(backups)):] {
+		if err := os.Remove(backup.Path); err != nil {
+			return err
+		}
+		log.Println("removed backup", backup.Path)
+	}
+	return nil
+}
+
+// scheduledBackup creates a backup when the newest one is older than the configured interval and
+// rotates old backups. It is run by the janitor.
+func scheduledBackup() {
+	settings, err := getSettings()
+	if err != nil {
+		log.Println("get settings", err)
+		return
+	}
+	if settings.BackupInterval == "" {
+		return
+	}
+	interval, err := parseRetention(settings.BackupInterval)
+	if err != nil {
+		log.Println("invalid backup interval", settings.BackupInterval)
+		return
+	}
+	dir := settings.backupDir()
+	backups, err := listBackups(dir)
+	if err != nil {
+		log.Println("list backups", err)
+		return
+	}
+	// allow for the janitor running slightly earlier than one interval after the last backup
+	if len(backups) > 0 && time.Since(backups[0].Time) < interval-janitorInterval/2 {
+		return
+	}
+	file, err := createBackup(dir)
+	if err != nil {
+		log.Println("scheduled backup", err)
+		return
+	}
+	log.Println("database backed up to", file)
+	if err := rotateBackups(dir, settings.backupKeep()); err != nil {
+		log.Println("rotate backups", err)
+	}
+}
+
+// runBackup writes a backup of the database to a file or stdout. The running server holds an exclusive lock
+// on the database, so while it runs the backup is downloaded from the server with -server and -token.
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := flags.String("o", "", "backup file, - for stdout (default uptime-<time>.db, .tar with the sqlite store)")
+	server := flags.String("server", os.Getenv("UPTIME_SERVER"), "url of a running uptime server to back up")
+	token := flags.String("token", os.Getenv("UPTIME_API_TOKEN"), "api token with the backup scope")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *server != "" {
+		return fetchBackup(strings.TrimSuffix(*server, "/"), *token, *output)
+	}
+	source, err := bbolt.Open(filepath.Join(dataDir(), dbFile), 0o600,
+		&bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if errors.Is(err, berrors.ErrTimeout) {
+		return errDBInUse
+	}
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	var sqlite *sqliteStore
+	if sqliteConfigured() {
+		if sqlite, err = openSQLite(filepath.Join(dataDir(), sqliteFile)); err != nil {
+			return err
+		}
+		defer sqlite.Close()
+	}
+	if *output == "" {
+		*output = backupName(time.Now())
+	}
+	out, err := createOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	var n int64
+	if sqlite != nil {
+		n, err = writeArchive(out, source, sqlite)
+	} else {
+		n, err = writeBolt(out, source)
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("wrote", n, "bytes to", *output)
+	return nil
+}
+
+// fetchBackup downloads a backup from a running server to output, named as the server names it if empty.
+// A partial download is removed.
+func fetchBackup(server, token, output string) error {
+	if token == "" {
+		return errors.New("backup from a server requires -token")
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server+"/api/v1/backup", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		return errors.New(resp.Status + " " + strings.TrimSpace(string(body)))
+	}
+	if output == "" {
+		_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		output = filepath.Base(params["filename"])
+		if err != nil || !strings.HasPrefix(output, backupPrefix) {
+			output = backupName(time.Now())
+		}
+	}
+	out, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
+		if output != "-" {
+			os.Remove(output)
+		}
+		return err
+	}
+	log.Println("wrote", n, "bytes from", server, "to", output)
+	return nil
+}
+
+// createOutput creates a new backup file, or returns stdout for -.
+func createOutput(name string) (*os.File, error) {
+	if name == "-" {
+		return os.Stdout, nil
+	}
+	return os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+}
+
+// runRestore replaces the database with a backup after validating it. The server must be stopped; the
+// replaced database is kept as uptime.db.pre-restore.<time>.bak, and uptime.sqlite as
+// uptime.sqlite.pre-restore.<time>.bak. The backup must match UPTIME_STORE: an archive including
+// uptime.sqlite for the sqlite store, a bbolt database otherwise.
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: uptime restore <backup file>")
+	}
+	backup := flags.Arg(0)
+	dir := dataDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	files, err := unpackBackup(backup, dir)
+	defer func() {
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}()
+	if err != nil {
+		return errors.New("invalid backup " + backup + ": " + err.Error())
+	}
+	_, withSQLite := files[sqliteFile]
+	switch {
+	case sqliteConfigured() && !withSQLite:
+		return errors.New("backup " + backup + " has no sqlite store; the sqlite store is restored from a backup " +
+			"taken with UPTIME_STORE=sqlite")
+	case !sqliteConfigured() && withSQLite:
+		return errors.New("backup " + backup + " includes a sqlite store; restore it with UPTIME_STORE=sqlite")
+	}
+	if err := validateBackup(files[dbFile]); err != nil {
+		return errors.New("invalid backup " + backup + ": " + err.Error())
+	}
+	if withSQLite {
+		if err := validateSQLiteBackup(files[sqliteFile]); err != nil {
+			return errors.New("invalid backup " + backup + ": " + err.Error())
+		}
+	}
+	stamp := time.Now().Format(backupTimeFormat)
+	file := filepath.Join(dir, dbFile)
+	if _, err := os.Stat(file); err == nil {
+		current, err := bbolt.Open(file, 0o600, &bbolt.Options{Timeout: time.Second})
+		if errors.Is(err, berrors.ErrTimeout) {
+			return errors.New("database is in use; stop the server before restoring")
+		}
+		if err != nil {
+			return err
+		}
+		saved := file + ".pre-restore." + stamp + ".bak"
+		err = current.View(func(tx *bbolt.Tx) error {
+			return tx.CopyFile(saved, 0o600)
+		})
+		current.Close()
+		if err != nil {
+			return err
+		}
+		log.Println("current database saved to", saved)
+	}
+	sqlitePath := filepath.Join(dir, sqliteFile)
+	if _, err := os.Stat(sqlitePath); err == nil && withSQLite {
+		saved := sqlitePath + ".pre-restore." + stamp + ".bak"
+		if err := copySQLite(sqlitePath, saved); err != nil {
+			return err
+		}
+		log.Println("current sqlite store saved to", saved)
+	}
+	if err := os.Rename(files[dbFile], file); err != nil {
+		return err
+	}
+	if withSQLite {
+		// the write-ahead log of the replaced store must not be applied to the restored one
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if err := os.Remove(sqlitePath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(files[sqliteFile], sqlitePath); err != nil {
+			return err
+		}
+	}
+	log.Println("restored", backup, "to", dir)
+	return nil
+}
+
+// unpackBackup copies the databases of a backup to temporary files in dir and returns their paths by
+// database file name: uptime.db, and for an archive also uptime.sqlite. The paths of partial copies are
+// returned with an error so they can be removed.
+func unpackBackup(backup, dir string) (map[string]string, error) {
+	files := map[string]string{}
+	in, err := os.Open(backup)
+	if err != nil {
+		return files, err
+	}
+	defer in.Close()
+	archive := tar.NewReader(in)
+	header, err := archive.Next()
+	if err != nil {
+		// not an archive: a bbolt database
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return files, err
+		}
+		temp, err := copyTemp(dir, in)
+		if temp != "" {
+			files[dbFile] = temp
+		}
+		return files, err
+	}
+	for ; err == nil; header, err = archive.Next() {
+		if header.Name != dbFile && header.Name != sqliteFile {
+			return files, errors.New("unexpected file " + header.Name + " in archive")
+		}
+		temp, copyErr := copyTemp(dir, archive)
+		if temp != "" {
+			files[header.Name] = temp
+		}
+		if copyErr != nil {
+			return files, copyErr
+		}
+	}
+	if !errors.Is(err, io.EOF) {
+		return files, err
+	}
+	if _, ok := files[dbFile]; !ok {
+		return files, errors.New("archive has no " + dbFile)
+	}
+	return files, nil
+}
+
+// copyTemp copies r to a new temporary file in dir and returns its path.
+func copyTemp(dir string, r io.Reader) (string, error) {
+	temp, err := os.CreateTemp(dir, ".restore-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(temp, r); err != nil {
+		temp.Close()
+		return temp.Name(), err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return temp.Name(), err
+	}
+	return temp.Name(), temp.Close()
+}
+
+// copySQLite writes a consistent copy of the sqlite database in file to copied.
+func copySQLite(file, copied string) error {
+	conn, err := sql.Open("sqlite", file)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return (&sqliteStore{db: conn}).backup(copied)
+}
+
+// validateSQLiteBackup checks that file is a consistent sqlite store with a schema this version supports.
+func validateSQLiteBackup(file string) error {
+	conn, err := sql.Open("sqlite", file)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return errors.New("sqlite integrity check: " + result)
+	}
+	var version, monitors, users int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > sqliteVersion {
+		return errors.New("sqlite version " + strconv.Itoa(version) + " is newer than supported version " +
+			strconv.Itoa(sqliteVersion))
+	}
+	if err := conn.QueryRow("SELECT (SELECT count(*) FROM monitors), (SELECT count(*) FROM users)").
+		Scan(&monitors, &users); err != nil {
+		return errors.New("not an uptime sqlite store: " + err.Error())
+	}
+	log.Println("sqlite store is valid: version", version, "with", monitors, "monitors and", users, "users")
+	return nil
+}
+
+// validateBackup checks that file is a consistent uptime database with a schema this version supports.
+func validateBackup(file string) error {
+	backup, err := bbolt.Open(file, 0o600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+	return backup.View(func(tx *bbolt.Tx) error {
+		var problem error
+		for err := range tx.Check() {
+			if problem == nil {
+				problem = err
+			}
+		}
+		if problem != nil {
+			return problem
+		}
+		version, err := getSchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if version > schemaVersion() {
+			return errors.New("schema version " + strconv.Itoa(version) + " is newer than supported version " +
+				strconv.Itoa(schemaVersion()))
+		}
+		monitors, users := tx.Bucket([]byte("monitors")), tx.Bucket([]byte("users"))
+		if monitors == nil && users == nil {
+			return errors.New("not an uptime database")
+		}
+		log.Println("backup is valid: schema version", version, "with", bucketLen(monitors), "monitors and",
+			bucketLen(users), "users")
+		return nil
+	})
+}
+
+// bucketLen returns the number of keys in a bucket; zero for a nil bucket.
+func bucketLen(bucket *bbolt.Bucket) int {
+	if bucket == nil {
+		return 0
+	}
+	return bucket.Stats().KeyN
+}
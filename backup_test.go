@@ -0,0 +1,274 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestListAndRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"uptime-20260105-120000.db",
+		"uptime-20260107-120000.tar",
+		"uptime-20260106-120000-2.db",
+		"uptime-20260106-120000.db",
+		"uptime-20260104-120000.db",
+		"uptime-latest.db",
+		"other-20260108-120000.db",
+		"uptime-20260108-120000.txt",
+		"uptime-20260108-120000-1.db",
+		"uptime-20260108-120000-x.db",
+		"uptime-20260108-1200002.db",
+		".backup-123",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := listBackups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, backup := range backups {
+		got = append(got, filepath.Base(backup.Path))
+	}
+	want := "uptime-20260107-120000.tar uptime-20260106-120000-2.db uptime-20260106-120000.db " +
+		"uptime-20260105-120000.db uptime-20260104-120000.db"
+	if strings.Join(got, " ") != want {
+		t.Errorf("listBackups() = %v, want %s", got, want)
+	}
+	if err := rotateBackups(dir, 3); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(names)-2 {
+		t.Errorf("%d files after rotation, want %d", len(entries), len(names)-2)
+	}
+	for _, name := range []string{"uptime-20260105-120000.db", "uptime-20260104-120000.db"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not rotated", name)
+		}
+	}
+	if backups, err := listBackups(filepath.Join(dir, "missing")); err != nil || len(backups) != 0 {
+		t.Errorf("listBackups() of missing directory = %v, %v, want none", backups, err)
+	}
+}
+
+func TestCreateBackup(t *testing.T) {
+	for _, backend := range []string{backendBolt, backendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			testDB(t, backend)
+			if err := saveMonitor(Monitor{ID: "m1", Name: "site", StatusOK: 200}, false); err != nil {
+				t.Fatal(err)
+			}
+			dir := filepath.Join(t.TempDir(), "backups")
+			file, err := createBackup(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantSuffix := backupSuffix
+			if backend == backendSQLite {
+				wantSuffix = archiveSuffix
+			}
+			if !strings.HasSuffix(file, wantSuffix) {
+				t.Errorf("backup %s, want suffix %s", file, wantSuffix)
+			}
+			// a second backup, most likely within the same second, is kept beside the first
+			second, err := createBackup(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if backups, err := listBackups(dir); err != nil || len(backups) != 2 || backups[0].Path != second {
+				t.Errorf("listBackups() = %v, %v, want %s and %s, newest first", backups, err, second, file)
+			}
+			files, err := unpackBackup(file, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateBackup(files[dbFile]); err != nil {
+				t.Error(err)
+			}
+			if backend == backendSQLite {
+				if err := validateSQLiteBackup(files[sqliteFile]); err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if _, ok := files[sqliteFile]; ok {
+				t.Error("bolt backup includes a sqlite store")
+			}
+			backup, err := bbolt.Open(files[dbFile], 0o600, &bbolt.Options{ReadOnly: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer backup.Close()
+			if err := backup.View(func(tx *bbolt.Tx) error {
+				if getKey([]string{"monitors", "m1"}, tx) == nil {
+					t.Error("monitor missing from backup")
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestValidateBackup(t *testing.T) {
+	dir := t.TempDir()
+	create := func(name string, fn func(tx *bbolt.Tx) error) string {
+		file := filepath.Join(dir, name)
+		backup, err := bbolt.Open(file, 0o600, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer backup.Close()
+		if err := backup.Update(fn); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	users := func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucket([]byte("users"))
+		return err
+	}
+	garbage := filepath.Join(dir, "garbage")
+	if err := os.WriteFile(garbage, []byte(strings.Repeat("not a database", 1000)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		file string
+		err  bool
+	}{
+		{"valid", create("valid", users), false},
+		{"current schema", create("current", func(tx *bbolt.Tx) error {
+			if err := users(tx); err != nil {
+				return err
+			}
+			return setSchemaVersion(tx, schemaVersion())
+		}), false},
+		{"newer schema", create("newer", func(tx *bbolt.Tx) error {
+			if err := users(tx); err != nil {
+				return err
+			}
+			return setSchemaVersion(tx, schemaVersion()+1)
+		}), true},
+		{"not uptime", create("other", func(tx *bbolt.Tx) error {
+			_, err := tx.CreateBucket([]byte("other"))
+			return err
+		}), true},
+		{"not bbolt", garbage, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateBackup(tt.file); (err != nil) != tt.err {
+				t.Errorf("validateBackup() error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	testDB(t, backendBolt)
+	if err := saveMonitor(Monitor{ID: "m1", Name: "before", StatusOK: 200}, false); err != nil {
+		t.Fatal(err)
+	}
+	file, err := createBackup(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveMonitor(Monitor{ID: "m2", Name: "after", StatusOK: 200}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := runRestore([]string{file}); err == nil {
+		t.Error("restored over the database in use")
+	}
+	store.Close()
+	db.Close()
+	if err := runRestore([]string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := filepath.Glob(filepath.Join(dataDir(), dbFile+".pre-restore.*.bak")); len(saved) != 1 {
+		t.Errorf("saved databases %v, want one", saved)
+	}
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	if err := openStore(); err != nil {
+		t.Fatal(err)
+	}
+	monitors, err := getMonitors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(monitors) != 1 || monitors[0].Name != "before" {
+		t.Errorf("restored monitors %+v, want the monitor from the backup", monitors)
+	}
+	t.Setenv("UPTIME_STORE", backendSQLite)
+	store.Close()
+	db.Close()
+	if err := runRestore([]string{file}); err == nil {
+		t.Error("restored a bolt backup for the sqlite store")
+	}
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	if err := openStore(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetchBackup(t *testing.T) {
+	testDB(t, backendBolt)
+	if err := saveMonitor(Monitor{ID: "m1", Name: "site", StatusOK: 200}, false); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, errTokenAuth.Error(), http.StatusUnauthorized)
+			return
+		}
+		downloadBackup(w, r)
+	}))
+	defer server.Close()
+	t.Chdir(t.TempDir())
+
+	if err := fetchBackup(server.URL, "", ""); err == nil {
+		t.Error("fetched a backup without a token")
+	}
+	if err := fetchBackup(server.URL, "wrong", "denied.db"); err == nil {
+		t.Error("fetched a backup with an invalid token")
+	}
+	if _, err := os.Stat("denied.db"); !os.IsNotExist(err) {
+		t.Error("created a backup file for a failed download")
+	}
+	if err := fetchBackup(server.URL, "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := listBackups(".")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("downloaded backups %v, %v, want one named by the server", backups, err)
+	}
+	if time.Since(backups[0].Time) > time.Minute {
+		t.Errorf("backup taken at %v", backups[0].Time)
+	}
+	if err := validateBackup(backups[0].Path); err != nil {
+		t.Error(err)
+	}
+	if err := fetchBackup(server.URL, "secret", backups[0].Path); err == nil {
+		t.Error("overwrote an existing backup")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"slices"
+
+	"go.etcd.io/bbolt"
+)
+
+// bucketLayout describes a top level bucket of the database. Nested buckets hold a bucket per monitor or
+// notifier plus the listed keys; other buckets hold only values.
+type bucketLayout struct {
+	name   string
+	nested bool
+	keys   []string
+}
+
+// dbLayout lists all top level buckets.
+var dbLayout = []bucketLayout{
+	{name: "meta"},
+	{name: "monitors"},
+	{name: "status"},
+	{name: "history", nested: true},
+	{name: "rollups", nested: true, keys: []string{"version"}},
+	{name: "users"},
+	{name: "notify", nested: true},
+	{name: "maintenance"},
+	{name: "state"},
+	{name: "agents"},
+	{name: "locations", nested: true},
+	{name: "incidents"},
+	{name: "secrets"},
+	{name: "settings"},
+	{name: "audit"},
+	{name: "tokens"},
+}
+
+// initDB creates missing buckets and logs entries that do not match the expected layout.
+func initDB() error {
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		for _, layout := range dbLayout {
+			if _, err := tx.CreateBucketIfNotExists([]byte(layout.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, problem := range checkLayout() {
+		log.Println("database layout:", problem)
+	}
+	return nil
+}
+
+// checkLayout returns the differences between the database and dbLayout.
+func checkLayout() []string {
+	problems := []string{}
+	known := map[string]bucketLayout{}
+	for _, layout := range dbLayout {
+		known[layout.name] = layout
+	}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			layout, ok := known[string(name)]
+			if !ok {
+				problems = append(problems, "unknown bucket "+string(name))
+				return nil
+			}
+			return bucket.ForEach(func(k, v []byte) error {
+				switch {
+				case layout.nested && v != nil && !slices.Contains(layout.keys, string(k)):
+					problems = append(problems, "unexpected value "+string(k)+" in bucket "+layout.name)
+				case !layout.nested && v == nil:
+					problems = append(problems, "unexpected bucket "+string(k)+" in bucket "+layout.name)
+				}
+				return nil
+			})
+		})
+	}); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestInitDB(t *testing.T) {
+	testDB(t, backendBolt)
+	if err := db.View(func(tx *bbolt.Tx) error {
+		for _, layout := range dbLayout {
+			if tx.Bucket([]byte(layout.name)) == nil {
+				t.Errorf("bucket %s not created", layout.name)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if problems := checkLayout(); len(problems) != 0 {
+		t.Errorf("checkLayout() of a new database = %v, want none", problems)
+	}
+	if !needsSetup() {
+		t.Error("new database does not need setup")
+	}
+	if err := store.SaveUser(User{Name: "admin", Pass: "hash", Role: roleAdmin}, false); err != nil {
+		t.Fatal(err)
+	}
+	if needsSetup() {
+		t.Error("database with a user needs setup")
+	}
+	// the users are not read again once setup is done
+	if err := store.DeleteUser("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if needsSetup() {
+		t.Error("setup needed again after the users were read")
+	}
+	if err := openStore(); err != nil {
+		t.Fatal(err)
+	}
+	if !needsSetup() {
+		t.Error("reopened database without users does not need setup")
+	}
+}
+
+func TestCheckLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   []string
+		key    string
+		bucket bool
+		want   string
+	}{
+		{"value in nested bucket", []string{"history"}, "stray", false, "unexpected value stray in bucket history"},
+		{"known key in nested bucket", []string{"rollups"}, "version", false, ""},
+		{"bucket in flat bucket", []string{"monitors"}, "nested", true, "unexpected bucket nested in bucket monitors"},
+		{"monitor bucket", []string{"history"}, "m1", true, ""},
+		{"unknown bucket", nil, "extra", true, "unknown bucket extra"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t, backendBolt)
+			if err := db.Update(func(tx *bbolt.Tx) error {
+				if tt.path == nil {
+					_, err := tx.CreateBucket([]byte(tt.key))
+					return err
+				}
+				bucket := getBucket(tt.path, tx)
+				if tt.bucket {
+					_, err := bucket.CreateBucket([]byte(tt.key))
+					return err
+				}
+				return bucket.Put([]byte(tt.key), []byte("1"))
+			}); err != nil {
+				t.Fatal(err)
+			}
+			problems := checkLayout()
+			if tt.want == "" && len(problems) != 0 {
+				t.Errorf("checkLayout() = %v, want none", problems)
+			}
+			if tt.want != "" && (len(problems) != 1 || problems[0] != tt.want) {
+				t.Errorf("checkLayout() = %v, want %q", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	testDB(t, backendBolt)
+	testCookie(t)
+	handler := firstRun(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/setup":
+			setup(w, r)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/setup", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/monitor/", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/setup" {
+		t.Errorf("before setup, got %d to %q, want redirect to /setup", w.Code, w.Header().Get("Location"))
+	}
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{"missing name", url.Values{"name": {" "}, "pass": {"secret"}, "confirm": {"secret"}}},
+		{"missing pass", url.Values{"name": {"admin"}}},
+		{"passwords differ", url.Values{"name": {"admin"}, "pass": {"secret"}, "confirm": {"other"}}},
+	}
+	for _, tt := range tests {
+		post(tt.form)
+		if !needsSetup() {
+			t.Fatalf("%s: created a user", tt.name)
+		}
+	}
+	w = post(url.Values{"name": {" admin "}, "pass": {"secret"}, "confirm": {"secret"}})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Errorf("setup got %d to %q, want redirect to /", w.Code, w.Header().Get("Location"))
+	}
+	user, err := store.User("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != roleAdmin || !validateUser(User{Name: "admin", Pass: "secret"}) {
+		t.Errorf("setup created %+v, want an admin with the given password", user)
+	}
+	if w := post(url.Values{"name": {"other"}, "pass": {"secret"}, "confirm": {"secret"}}); w.Code != http.StatusForbidden {
+		t.Errorf("second setup got %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/monitor/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("after setup got %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckNow(t *testing.T) {
+	testDB(t, backendBolt)
+	code := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+	monitor := Monitor{ID: "m1", Name: "site", Type: HTTP, URL: server.URL, Freq: "1m", Timeout: "5s",
+		StatusOK: http.StatusOK, Active: true}
+	if err := store.SaveMonitor(monitor, false); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		code     int
+		form     string
+		passed   bool
+		recorded bool
+		notified bool
+	}{
+		{"up", http.StatusOK, "", true, false, false},
+		{"down", http.StatusInternalServerError, "", false, false, false},
+		{"recorded", http.StatusOK, "record=on", true, true, false},
+		{"notify requires record", http.StatusOK, "notify=on", true, false, false},
+		{"recorded and notified", http.StatusInternalServerError, "record=on&notify=on", false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code = tt.code
+			r := httptest.NewRequest(http.MethodPost, "/monitor/check/m1?format=json", strings.NewReader(tt.form))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.SetPathValue("site", "m1")
+			w := httptest.NewRecorder()
+			checkNow(w, r)
+			var result CheckResult
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Passed != tt.passed || result.Recorded != tt.recorded || result.Notified != tt.notified {
+				t.Errorf("checkNow() = passed %v recorded %v notified %v, want %v %v %v", result.Passed,
+					result.Recorded, result.Notified, tt.passed, tt.recorded, tt.notified)
+			}
+			if result.Status.StatusCode != tt.code {
+				t.Errorf("status code = %d, want %d", result.Status.StatusCode, tt.code)
+			}
+			last, _ := store.LastHistory("m1")
+			if recorded := last.Time.Equal(result.Status.Time); recorded != tt.recorded {
+				t.Errorf("result in history = %v, want %v", recorded, tt.recorded)
+			}
+		})
+	}
+}
+
+func TestRecordSerialized(t *testing.T) {
+	testDB(t, backendBolt)
+	monitor := Monitor{ID: "m1", Name: "site", Type: HTTP, Freq: "1m", StatusOK: http.StatusOK, Active: true}
+	if err := store.SaveMonitor(monitor, false); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	monitor.record(context.Background(), Status{Time: now, StatusCode: http.StatusOK, Status: "200 OK"},
+		recordOptions{})
+	wg := sync.WaitGroup{}
+	for i := range 10 {
+		wg.Go(func() {
+			monitor.record(context.Background(), Status{Time: now.Add(time.Duration(i+1) * time.Second),
+				StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}, recordOptions{})
+		})
+	}
+	wg.Wait()
+	incidents, err := getIncidents("m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incidents) != 1 {
+		t.Errorf("concurrent results opened %d incidents, want 1", len(incidents))
+	}
+}
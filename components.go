@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -52,14 +56,6 @@ func formButton(name, action string) g.Node {
 	)
 }
 
-func checkbox(name string, checked bool) g.Node {
-	return h.Input(
-		h.Type("checkbox"),
-		h.Name(name),
-		g.If(checked, g.Attr("checked", "true")),
-	)
-}
-
 func inputTableRow(label, name, kind, value, size string) g.Node {
 	return h.Tr(
 		h.Td(h.Label(h.For(name), g.Text(label))),
@@ -69,18 +65,51 @@ func inputTableRow(label, name, kind, value, size string) g.Node {
 	)
 }
 
-func userTable(users []User) g.Node {
+// roleRow is a table row to choose the role of a user.
+func roleRow(current Role) g.Node {
+	options := []g.Node{}
+	for _, role := range roles {
+		options = append(options, h.Option(h.Value(string(role)), g.Text(string(role)),
+			g.If(role == current, h.Selected())))
+	}
+	return h.Tr(
+		h.Td(h.Label(h.For("role"), g.Text("Role"))),
+		h.Td(h.Select(h.Name("role"), h.ID("role"), g.Group(options))),
+	)
+}
+
+// teamRow is a table row to choose the team of a monitor or notifier: any team for admins and editors
+// in no team, one of their own for other editors.
+func teamRow(user User, team string) g.Node {
+	if user.can(roleAdmin) || len(user.Teams) == 0 {
+		return inputTableRow("Team", "team", "text", team, "60")
+	}
+	options := []g.Node{}
+	for _, t := range user.Teams {
+		options = append(options, h.Option(h.Value(t), g.Text(t), g.If(t == team, h.Selected())))
+	}
+	return h.Tr(
+		h.Td(h.Label(h.For("team"), g.Text("Team"))),
+		h.Td(h.Select(h.Name("team"), h.ID("team"), g.Group(options))),
+	)
+}
+
+func userTable(users []User, admin bool) g.Node {
 	rows := []g.Node{}
 	header := h.Tr(
 		h.Th(g.Text("Name")),
+		h.Th(g.Text("Role")),
+		h.Th(g.Text("Teams")),
 		h.Th(g.Attr("colspan=\"2\""), g.Text("Actions")),
 	)
 	rows = append(rows, header)
 	for _, user := range users {
 		row := h.Tr(
 			h.Td(h.Label(g.Text(user.Name))),
+			h.Td(g.Text(string(user.role()))),
+			h.Td(g.Text(strings.Join(user.Teams, ", "))),
 			h.Td(linkButton("/user/"+user.Name, "Edit")),
-			h.Td(formButton("Delete", "/user/delete/"+user.Name)),
+			g.If(admin, h.Td(formButton("Delete", "/user/delete/"+user.Name))),
 		)
 		rows = append(rows, row)
 	}
@@ -110,7 +139,7 @@ func statusTable() g.Node {
 			}
 		}
 		row := h.Tr(
-			h.Td(name),
+			h.Td(name, g.If(monitor.Maintenance, maintenanceBadge()), g.If(monitor.Flapping, flappingBadge())),
 			h.Td(h.Button(h.Style("background:"+"green"),
 				g.Text(strconv.FormatFloat(monitor.PerCent, 'f', 2, 64)+" %")),
 				h.Title("last 24 hours"),
@@ -118,7 +147,7 @@ func statusTable() g.Node {
 			h.Td(g.Text(monitor.Status.Time.Format(time.RFC822))),
 			h.Td(g.Text(monitor.Status.ResponseTime.Round(time.Millisecond).String())),
 			h.Td(g.Text(strconv.Itoa(monitor.Status.CertExpiry))),
-			h.Td(linkButton("/monitor/details/"+monitor.Name, "Details")),
+			h.Td(linkButton("/monitor/details/"+monitor.ID, "Details")),
 		)
 		rows = append(rows, row)
 	}
@@ -128,6 +157,14 @@ func statusTable() g.Node {
 	)
 }
 
+func maintenanceBadge() g.Node {
+	return h.Button(g.Text("Maintenance"), h.Style("background:orange;color:black;"), h.Title("In maintenance window"))
+}
+
+func flappingBadge() g.Node {
+	return h.Button(g.Text("Flapping"), h.Style("background:purple"), h.Title("Notifications held until stable"))
+}
+
 func historyTable(history []Status) g.Node {
 	rows := []g.Node{}
 	header := h.Tr(
@@ -142,7 +179,7 @@ func historyTable(history []Status) g.Node {
 	for _, s := range history {
 		row := h.Tr(
 			h.Td(g.Text(s.Site)),
-			h.Td(g.Text(s.Status)),
+			h.Td(g.Text(s.Status), g.If(s.Maintenance, maintenanceBadge())),
 			h.Td(g.Text(strconv.Itoa(s.StatusCode))),
 			h.Td(g.Text(s.Time.Local().Format(time.RFC822))),
 			h.Td(g.Text(s.ResponseTime.Round(time.Millisecond).String())),
@@ -155,6 +192,84 @@ func historyTable(history []Status) g.Node {
 	)
 }
 
+func rollupTable(rollups []Rollup, hourly bool) g.Node {
+	format := time.DateOnly
+	if hourly {
+		format = time.RFC822
+	}
+	rows := []g.Node{h.Tr(
+		h.Th(g.Text("Period")),
+		h.Th(g.Text("Checks")),
+		h.Th(g.Text("Uptime")),
+		h.Th(g.Text("Min")),
+		h.Th(g.Text("Avg")),
+		h.Th(g.Text("Max")),
+		h.Th(g.Text("p95")),
+	)}
+	for _, r := range rollups {
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(r.Start.Local().Format(format))),
+			h.Td(g.Text(strconv.Itoa(r.Count))),
+			h.Td(g.Text(strconv.FormatFloat(r.Uptime(), 'f', 2, 64)+" %")),
+			h.Td(g.Text(r.Min.Round(time.Millisecond).String())),
+			h.Td(g.Text(r.Avg().Round(time.Millisecond).String())),
+			h.Td(g.Text(r.Max.Round(time.Millisecond).String())),
+			h.Td(g.Text(r.Percentile(95).Round(time.Millisecond).String())),
+		))
+	}
+	return h.Table(
+		g.Group(rows),
+	)
+}
+
+func backupTable(backups []backupFile) g.Node {
+	rows := []g.Node{}
+	for _, backup := range backups {
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(backup.Time.Format(time.RFC822))),
+			h.Td(g.Text(filepath.Base(backup.Path))),
+			h.Td(g.Text(strconv.FormatFloat(float64(backup.Size)/(1<<20), 'f', 2, 64)+" MiB")),
+		))
+	}
+	return h.Table(
+		h.Tr(
+			h.Th(g.Text("Time")),
+			h.Th(g.Text("File")),
+			h.Th(g.Text("Size")),
+		),
+		g.Group(rows),
+	)
+}
+
+func configTable(file string, state configState, changes []configChange, err error) g.Node {
+	if file == "" {
+		return h.P(g.Text("No config file; set UPTIME_CONFIG to manage monitors and notifiers from a file."))
+	}
+	applied := "never"
+	if !state.Applied.IsZero() {
+		applied = state.Applied.Local().Format(time.RFC822)
+	}
+	var problem g.Node
+	if err != nil {
+		problem = h.P(g.Text("Config error: " + err.Error()))
+	}
+	pending := []g.Node{}
+	for _, change := range changes {
+		pending = append(pending, h.Li(g.Text(change.String())))
+	}
+	return h.Div(
+		h.Table(
+			h.Tr(h.Th(g.Text("File")), h.Td(g.Text(file))),
+			h.Tr(h.Th(g.Text("Last Applied")), h.Td(g.Text(applied))),
+			h.Tr(h.Th(g.Text("Managed")), h.Td(g.Text(strconv.Itoa(len(state.Monitors))+" monitors, "+
+				strconv.Itoa(len(state.Notifiers))+" notifiers"))),
+		),
+		problem,
+		g.If(err == nil && len(changes) == 0, h.P(g.Text("Database matches the config file."))),
+		g.If(len(changes) > 0, h.Ul(pending...)),
+	)
+}
+
 func compactHistoryTable(history []Status, statusOK int) g.Node {
 	rows := []g.Node{}
 	header := h.Tr(
@@ -180,6 +295,163 @@ func compactHistoryTable(history []Status, statusOK int) g.Node {
 	)
 }
 
+func scheduleTable(monitor Monitor, state MonitorState) g.Node {
+	next := "not scheduled"
+	if t, ok := checks.nextCheck(monitor.ID); ok && monitor.Active {
+		next = t.Local().Format(time.RFC822)
+	}
+	interval := monitor.Schedule.describe(monitor.Freq)
+	if state.FastRecheck {
+		interval = "every " + monitor.DownFreq + " (fast recheck)"
+	}
+	rows := []g.Node{
+		h.Tr(
+			h.Th(g.Text("Schedule")),
+			h.Th(g.Text("Current Interval")),
+			h.Th(g.Text("Next Check")),
+		),
+		h.Tr(
+			h.Td(g.Text(monitor.Schedule.describe(monitor.Freq))),
+			h.Td(g.Text(interval)),
+			h.Td(g.Text(next)),
+		),
+	}
+	for i := len(state.Intervals) - 1; i >= 0; i-- {
+		change := state.Intervals[i]
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(change.Time.Local().Format(time.RFC822))),
+			h.Td(g.Text("interval "+change.Interval)),
+			h.Td(g.Text(change.Reason)),
+		))
+	}
+	return h.Table(g.Group(rows))
+}
+
+func checkNowForm(site string) g.Node {
+	return h.Form(
+		h.Method("post"),
+		h.Action("/monitor/check/"+site),
+		h.Input(h.Type("checkbox"), h.Name("record"), h.ID("record")),
+		h.Label(h.For("record"), g.Text("Record in history")),
+		h.Input(h.Type("checkbox"), h.Name("notify"), h.ID("notify")),
+		h.Label(h.For("notify"), g.Text("Send notifications (when recorded)")),
+		submitButton("Check Now"),
+	)
+}
+
+func checkResultTable(result CheckResult, statusOK int) g.Node {
+	s := result.Status
+	assertion := "fail"
+	if result.Passed {
+		assertion = "pass"
+	}
+	var cert g.Node = g.Text("none")
+	if !s.CertNotAfter.IsZero() {
+		cert = g.Text(strconv.Itoa(s.CertExpiry) + " days (" + s.CertNotAfter.Local().Format(time.RFC822) +
+			") issued by " + s.CertIssuer)
+	}
+	return h.Table(
+		h.Tr(h.Th(g.Text("Check Result"), g.Attr("colspan", "2"))),
+		h.Tr(h.Td(g.Text("Time")), h.Td(g.Text(s.Time.Local().Format(time.RFC822)))),
+		h.Tr(h.Td(g.Text("Status")), h.Td(g.Text(s.Status))),
+		h.Tr(h.Td(g.Text("Response Time")), h.Td(g.Text(s.ResponseTime.Round(time.Millisecond).String()))),
+		h.Tr(h.Td(g.Text("Timing")), h.Td(timingBar(s.Timing))),
+		h.Tr(h.Td(g.Text("Certificate")), h.Td(cert)),
+		h.Tr(
+			h.Td(g.Text("Assertion: status code "+strconv.Itoa(statusOK))),
+			h.Td(g.Text(assertion+" (got "+strconv.Itoa(s.StatusCode)+")")),
+		),
+		h.Tr(
+			h.Td(g.Text("Recorded / Notified")),
+			h.Td(g.Text(strconv.FormatBool(result.Recorded)+" / "+strconv.FormatBool(result.Notified))),
+		),
+	)
+}
+
+// locationTable displays the latest result from each location checking the monitor.
+func locationTable(monitor Monitor) g.Node {
+	if len(monitor.Locations) == 0 {
+		return nil
+	}
+	statuses, err := getLocationStatuses(monitor.ID)
+	if err != nil {
+		log.Println("get location statuses", monitor.Name, err)
+	}
+	rows := []g.Node{
+		h.Tr(
+			h.Th(g.Text("Location")),
+			h.Th(g.Text("Status")),
+			h.Th(g.Text("Time")),
+		),
+	}
+	for _, s := range statuses {
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(s.Location)),
+			h.Td(g.Text(s.Status)),
+			h.Td(g.Text(s.Time.Local().Format(time.RFC822))),
+		))
+	}
+	quorum := "local check only"
+	if monitor.Quorum > 0 {
+		quorum = "down when " + strconv.Itoa(monitor.Quorum) + " locations report down"
+	}
+	return h.Div(
+		h.Br(),
+		h.Table(
+			h.Tr(h.Th(g.Text("Locations: "+quorum), g.Attr("colspan", "3"))),
+			g.Group(rows),
+		),
+	)
+}
+
+// timingTable displays the timing breakdown of the latest check.
+func timingTable(latest Status) g.Node {
+	if latest.Time.IsZero() {
+		return nil
+	}
+	return h.Table(
+		h.Tr(h.Th(g.Text("Latest Check Timing"))),
+		h.Tr(h.Td(timingBar(latest.Timing))),
+	)
+}
+
+// timingBar displays the phases of an http check as a stacked bar.
+func timingBar(timing Timing) g.Node {
+	total := timing.Total()
+	if total <= 0 {
+		return g.Text("no timing data")
+	}
+	phases := []struct {
+		name     string
+		color    string
+		duration time.Duration
+	}{
+		{"DNS", "#1f77b4", timing.DNS},
+		{"Connect", "#ff7f0e", timing.Connect},
+		{"TLS", "#2ca02c", timing.TLS},
+		{"TTFB", "#d62728", timing.TTFB},
+		{"Transfer", "#9467bd", timing.Transfer},
+	}
+	bars := []g.Node{}
+	legend := []g.Node{}
+	for _, phase := range phases {
+		label := phase.name + " " + phase.duration.Round(time.Microsecond).String()
+		legend = append(legend, h.Span(h.Style("color:"+phase.color), g.Text("■ ")), g.Text(label+" "))
+		if phase.duration <= 0 {
+			continue
+		}
+		width := strconv.FormatFloat(float64(phase.duration)/float64(total)*100, 'f', 2, 64)
+		bars = append(bars, h.Div(
+			h.Style("display:inline-block;height:1.2em;width:"+width+"%;background:"+phase.color),
+			h.Title(label),
+		))
+	}
+	return h.Div(
+		h.Div(h.Style("width:30em;white-space:nowrap;font-size:0"), g.Group(bars)),
+		h.Div(g.Group(legend)),
+	)
+}
+
 func newUserDialog() g.Node {
 	return h.Dialog(
 		h.Style("background-color: #4a4a4a; color: white"),
@@ -193,17 +465,11 @@ func newUserDialog() g.Node {
 				inputTableRow("Pass", "pass", "password", "", "40"),
 			),
 			h.Label(h.For("showpass"), g.Text("Show Password"), g.Attr("onclick", "togglePass();")),
-			h.Br(),
-			h.Label(
-				g.Attr("for", "admin"),
-				g.Text("Admin"),
-			),
-			h.Input(
-				g.Attr("name", "admin"),
-				g.Attr("type", "checkbox"),
+			h.Table(
+				roleRow(roleViewer),
+				inputTableRow("Teams (comma separated)", "teams", "text", "", "40"),
 			),
 			h.Br(),
-			h.Br(),
 			h.Button(
 				g.Attr("type", "button"),
 				g.Attr("onclick", "document.getElementById('new').close()"),
@@ -242,6 +508,71 @@ func histPurgeDialog(site, value string) g.Node {
 	)
 }
 
+func scheduleRows(schedule Schedule) g.Node {
+	days := []g.Node{}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		days = append(days, h.Input(
+			h.Type("checkbox"),
+			h.Name("day"),
+			h.Value(strconv.Itoa(int(day))),
+			g.If(slices.Contains(schedule.Days, day), h.Checked()),
+		), g.Text(day.String()[:3]))
+	}
+	return g.Group{
+		inputTableRow("Cron (optional)", "cron", "text", schedule.Cron, "60"),
+		inputTableRow("Time Zone", "timezone", "text", schedule.TimeZone, "60"),
+		inputTableRow("Window Start", "start", "time", schedule.Start, "60"),
+		inputTableRow("Window End", "end", "time", schedule.End, "60"),
+		h.Tr(
+			h.Td(h.Label(g.Text("Days"))),
+			h.Td(g.Group(days)),
+		),
+	}
+}
+
+func parentRows(id string, parents []string) g.Node {
+	monitors, err := getMonitors()
+	if err != nil {
+		log.Println("get monitors", err)
+	}
+	boxes := []g.Node{}
+	for _, m := range monitors {
+		if m.ID == id {
+			continue
+		}
+		boxes = append(boxes, h.Input(
+			h.Type("checkbox"),
+			h.Name("parent"),
+			h.Value(m.ID),
+			g.If(slices.Contains(parents, m.ID), h.Checked()),
+		), g.Text(m.Name))
+	}
+	return h.Tr(
+		h.Td(h.Label(g.Text("Depends On"))),
+		h.Td(g.Group(boxes)),
+	)
+}
+
+func alertRows(monitor Monitor) g.Node {
+	boxes := []g.Node{}
+	for _, n := range getAllNotifications() {
+		boxes = append(boxes, h.Input(
+			h.Type("checkbox"),
+			h.Name("escalate"),
+			h.Value(n.ID),
+			g.If(slices.Contains(monitor.EscalateTo, n.ID), h.Checked()),
+		), g.Text(n.Name))
+	}
+	return g.Group{
+		inputTableRow("Repeat Alert Every", "repeatalert", "text", monitor.RepeatAlert, "60"),
+		inputTableRow("Escalate After", "escalateafter", "text", monitor.EscalateAfter, "60"),
+		h.Tr(
+			h.Td(h.Label(g.Text("Escalate To"))),
+			h.Td(g.Group(boxes)),
+		),
+	}
+}
+
 func radioGroup(label, name string, radios []Radio) g.Node {
 	inputs := []g.Node{}
 	for _, radio := range radios {
@@ -271,6 +602,7 @@ func notificationForm(kind NotifyType, notification []byte) (g.Node, g.Node, err
 			return nil, nil, fmt.Errorf("invalid slack payload: %w", err)
 		}
 		return h.Table(
+				inputTableRow("Name", "name", "text", n.Name, "60"),
 				inputTableRow("Token", "token", "text", n.Token, "60"),
 				inputTableRow("Channel", "channel", "text", n.Channel, "60"),
 			),
@@ -283,6 +615,7 @@ func notificationForm(kind NotifyType, notification []byte) (g.Node, g.Node, err
 			return nil, nil, fmt.Errorf("invalid discord payload: %w", err)
 		}
 		return h.Table(
+				inputTableRow("Name", "name", "text", n.Name, "60"),
 				inputTableRow("Webhook URL", "webhook", "text", n.URL, "60"),
 			),
 			h.Input(h.Name("type"), h.Type("hidden"), h.Value("discord")),
@@ -294,6 +627,7 @@ func notificationForm(kind NotifyType, notification []byte) (g.Node, g.Node, err
 			return nil, nil, fmt.Errorf("invalid mailgun payload: %w", err)
 		}
 		return h.Table(
+				inputTableRow("Name", "name", "text", n.Name, "60"),
 				inputTableRow("API Key", "apikey", "text", n.APIKey, "60"),
 				inputTableRow("Email Domain", "domain", "text", n.Domain, "60"),
 				inputTableRow("Recipient Email(s)", "email", "text",
@@ -365,3 +699,69 @@ func envelopeSVG() g.Node {
 		g.El("path", g.Attr("d", path)),
 	)
 }
+
+// auditFilterForm filters the audit log by the query values.
+func auditFilterForm(values url.Values) g.Node {
+	choices := func(name string, options []string) g.Node {
+		nodes := []g.Node{h.Name(name), h.Option(h.Value(""), g.Text("any"))}
+		for _, option := range options {
+			nodes = append(nodes, h.Option(h.Value(option), g.Text(option),
+				g.If(values.Get(name) == option, h.Selected())))
+		}
+		return h.Select(nodes...)
+	}
+	return h.Form(
+		h.Method("get"),
+		h.Action("/audit/"),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("User")),
+				h.Th(g.Text("Action")),
+				h.Th(g.Text("Kind")),
+				h.Th(g.Text("Target")),
+				h.Th(g.Text("From")),
+				h.Th(g.Text("To")),
+			),
+			h.Tr(
+				h.Td(h.Input(h.Name("user"), h.Type("text"), h.Value(values.Get("user")), g.Attr("size", "12"))),
+				h.Td(choices("action", auditActions)),
+				h.Td(choices("kind", auditKinds)),
+				h.Td(h.Input(h.Name("target"), h.Type("text"), h.Value(values.Get("target")), g.Attr("size", "20"))),
+				h.Td(h.Input(h.Name("from"), h.Type("date"), h.Value(values.Get("from")))),
+				h.Td(h.Input(h.Name("to"), h.Type("date"), h.Value(values.Get("to")))),
+			),
+		),
+		submitButton("Filter"),
+	)
+}
+
+// auditTable displays audit entries with their changes.
+func auditTable(entries []AuditEntry) g.Node {
+	rows := []g.Node{
+		h.Tr(
+			h.Th(g.Text("Time")),
+			h.Th(g.Text("User")),
+			h.Th(g.Text("Action")),
+			h.Th(g.Text("Kind")),
+			h.Th(g.Text("Target")),
+			h.Th(g.Text("Changes")),
+			h.Th(g.Text("Remote")),
+		),
+	}
+	for _, entry := range entries {
+		changes := []g.Node{}
+		for _, change := range entry.Changes {
+			changes = append(changes, h.Li(g.Text(change.Field+": "+change.Before+" → "+change.After)))
+		}
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(entry.Time.Local().Format(time.RFC822))),
+			h.Td(g.Text(entry.User)),
+			h.Td(g.Text(entry.Action)),
+			h.Td(g.Text(entry.Kind)),
+			h.Td(g.Text(entry.Target)),
+			h.Td(g.If(entry.Detail != "", h.P(g.Text(entry.Detail))), g.If(len(changes) > 0, h.Ul(changes...))),
+			h.Td(g.Text(entry.Remote)),
+		))
+	}
+	return h.Table(g.Group(rows))
+}
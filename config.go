@@ -0,0 +1,566 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// config change actions.
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionManage = "manage" // an existing identical entry is taken over by the config file
+	actionDelete = "delete"
+)
+
+var (
+	errManaged   = errors.New("managed by the config file; change the config file instead")
+	envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	// configLock serializes reconciliation from startup, reloads and the web interface.
+	configLock sync.Mutex
+)
+
+// Config declares monitors and notifiers that are managed by the config file.
+type Config struct {
+	Monitors  []Monitor
+	Notifiers []configNotifier
+}
+
+// configNotifier is a notifier declared in the config file.
+type configNotifier struct {
+	Name string
+	Type NotifyType
+	Data []byte // json of the notifier of Type, as saved in the database
+}
+
+// configState records what was last applied from the config file.
+type configState struct {
+	File      string
+	Applied   time.Time
+	Monitors  []string
+	Notifiers []string
+}
+
+// configChange is a change that reconciles the database with the config file.
+type configChange struct {
+	Action   string
+	Kind     string // monitor or notifier
+	Name     string
+	Fields   []string // changed fields of an update
+	monitor  Monitor
+	notifier configNotifier
+}
+
+func (c configChange) String() string {
+	change := c.Action + " " + c.Kind + " " + c.Name
+	if len(c.Fields) > 0 {
+		change += " (" + strings.Join(c.Fields, ", ") + ")"
+	}
+	return change
+}
+
+// configFile returns the path of the config file set by UPTIME_CONFIG; empty if not used.
+func configFile() string {
+	return os.Getenv("UPTIME_CONFIG")
+}
+
+// readConfig reads a YAML, JSON or TOML config file, chosen by extension. Keys match the field names of
+// Monitor case insensitively and ${VAR} in a string value is replaced by the environment variable VAR.
+func readConfig(file string) (Config, error) {
+	config := Config{}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+	var doc any
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	case ".toml":
+		var table map[string]any
+		_, err = toml.Decode(string(data), &table)
+		doc = table
+	default:
+		return config, errors.New("unsupported config format " + ext)
+	}
+	if err != nil {
+		return config, err
+	}
+	if doc, err = expandEnv(doc); err != nil {
+		return config, err
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return config, err
+	}
+	return decodeConfig(raw)
+}
+
+// decodeConfig decodes the monitors and notifiers of a JSON document, filling in defaults of monitors.
+func decodeConfig(raw []byte) (Config, error) {
+	config := Config{}
+	var entries struct {
+		Monitors  []json.RawMessage
+		Notifiers []json.RawMessage
+	}
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return config, err
+	}
+	for _, entry := range entries.Monitors {
+		monitor := Monitor{Type: HTTP, Freq: "5m", Timeout: "5s", StatusOK: http.StatusOK, Active: true}
+		if err := json.Unmarshal(entry, &monitor); err != nil {
+			return config, fmt.Errorf("monitor %s: %w", entry, err)
+		}
+		monitor.ID = "" // monitors are referred to by name; IDs are assigned by the database
+		config.Monitors = append(config.Monitors, monitor)
+	}
+	for _, entry := range entries.Notifiers {
+		notifier, err := decodeNotifier(entry)
+		if err != nil {
+			return config, err
+		}
+		config.Notifiers = append(config.Notifiers, notifier)
+	}
+	return config, nil
+}
+
+// expandEnv replaces ${VAR} references in the strings of a decoded document.
+func expandEnv(value any) (any, error) {
+	var err error
+	switch v := value.(type) {
+	case string:
+		missing := []string{}
+		expanded := envReference.ReplaceAllStringFunc(v, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return nil, errors.New("environment variable " + strings.Join(missing, ", ") + " not set")
+		}
+		return expanded, nil
+	case map[string]any:
+		for key, item := range v {
+			if v[key], err = expandEnv(item); err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if v[i], err = expandEnv(item); err != nil {
+				return nil, err
+			}
+		}
+	case []map[string]any:
+		for _, item := range v {
+			if _, err = expandEnv(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
+
+// decodeNotifier decodes a notifier entry into the notifier of its type.
+func decodeNotifier(entry []byte) (configNotifier, error) {
+	var notifier configNotifier
+	var header struct {
+		Name string
+		Type string
+	}
+	if err := json.Unmarshal(entry, &header); err != nil {
+		return notifier, err
+	}
+	notifier.Name = header.Name
+	notifier.Type = NotifyType(header.Type)
+	data, err := newNotifierData(notifier.Type)
+	if header.Type == "mailgun" {
+		notifier.Type = MailGun
+		data, err = newNotifierData(MailGun)
+	}
+	if err != nil {
+		return notifier, fmt.Errorf("notifier %s: %w %s", notifier.Name, err, header.Type)
+	}
+	if err := json.Unmarshal(entry, data); err != nil {
+		return notifier, fmt.Errorf("notifier %s: %w", notifier.Name, err)
+	}
+	notifier.Data, err = json.Marshal(data)
+	return notifier, err
+}
+
+// newNotifierData returns a pointer to the notifier struct of a notifier type.
+func newNotifierData(kind NotifyType) (any, error) {
+	switch kind {
+	case Slack:
+		return &SlackNotifier{}, nil
+	case Discord:
+		return &DisordNotifier{}, nil
+	case MailGun:
+		return &MailGunNotifier{}, nil
+	default:
+		return nil, errInvalidNoficationType
+	}
+}
+
+// sameNotifierData reports whether two encodings of a notifier are equivalent.
+func sameNotifierData(kind NotifyType, a, b []byte) bool {
+	first, err := newNotifierData(kind)
+	if err != nil {
+		return false
+	}
+	second, _ := newNotifierData(kind)
+	if json.Unmarshal(a, first) != nil || json.Unmarshal(b, second) != nil {
+		return false
+	}
+	return reflect.DeepEqual(first, second)
+}
+
+// validateConfigMonitor checks the settings of a monitor declared in the config file.
+func validateConfigMonitor(m Monitor) error {
+	if m.Type != HTTP {
+		return fmt.Errorf("%w type %s", errNotImplemented, m.Type)
+	}
+	if u, err := url.Parse(m.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid url " + m.URL)
+	}
+	if _, err := m.frequency(); err != nil {
+		return err
+	}
+	if timeout, err := time.ParseDuration(m.Timeout); err != nil || timeout <= 0 {
+		return errors.New("invalid timeout " + m.Timeout)
+	}
+	if err := m.Schedule.validate(); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{
+		"flap window": m.FlapWindow, "down recheck interval": m.DownFreq, "stable for": m.StableFor,
+		"repeat alert interval": m.RepeatAlert, "escalate after": m.EscalateAfter,
+	} {
+		if value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(value); err != nil || duration < 0 {
+			return errors.New("invalid " + name + " " + value)
+		}
+	}
+	if m.Retention != "" {
+		if _, err := parseRetention(m.Retention); err != nil {
+			return err
+		}
+	}
+	if m.FlapThreshold < 0 {
+		return errors.New("invalid flap threshold")
+	}
+	if m.Quorum < 0 || m.Quorum > len(m.Locations)+1 {
+		return errors.New("invalid quorum")
+	}
+	return nil
+}
+
+// normalizeMonitor replaces empty slices by nil so monitors compare equal regardless of their encoding.
+func normalizeMonitor(m Monitor) Monitor {
+	for _, list := range []*[]string{&m.Notifiers, &m.Parents, &m.Locations, &m.EscalateTo} {
+		if len(*list) == 0 {
+			*list = nil
+		}
+	}
+	if len(m.Schedule.Days) == 0 {
+		m.Schedule.Days = nil
+	}
+	return m
+}
+
+// changedFields returns the names of the fields, other than the ID, that differ between two monitors.
+func changedFields(current, desired Monitor) []string {
+	fields := []string{}
+	a, b := reflect.ValueOf(normalizeMonitor(current)), reflect.ValueOf(normalizeMonitor(desired))
+	for i := range a.NumField() {
+		if a.Type().Field(i).Name == "ID" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			fields = append(fields, a.Type().Field(i).Name)
+		}
+	}
+	return fields
+}
+
+// planConfig validates the config against the database and returns the changes that apply it. Entries
+// previously applied from the config file and since removed from it are deleted; other entries of the
+// database are left alone.
+func planConfig(config Config) ([]configChange, error) {
+	state, err := getConfigState()
+	if err != nil {
+		return nil, err
+	}
+	cat, err := loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	changes := []configChange{}
+	notifiers := map[string]configNotifier{}
+	for _, notifier := range config.Notifiers {
+		if notifier.Name == "" {
+			return nil, errors.New("notifier without name")
+		}
+		if _, ok := notifiers[notifier.Name]; ok {
+			return nil, errors.New("duplicate notifier " + notifier.Name)
+		}
+		notifiers[notifier.Name] = notifier
+		change := configChange{Kind: "notifier", Name: notifier.Name, notifier: notifier}
+		id, exists := cat.notifierIDs[notifier.Name]
+		kind, data, err := getNotify(id)
+		switch {
+		case !exists || err != nil:
+			change.Action = actionCreate
+		case kind != notifier.Type:
+			return nil, errors.New("notifier " + notifier.Name + " changes type from " + string(kind) +
+				"; remove it from the config and add it with a new name")
+		case !sameNotifierData(kind, data, notifier.Data):
+			change.Action = actionUpdate
+		case !slices.Contains(state.Notifiers, notifier.Name):
+			change.Action = actionManage
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	existing, err := getMonitors()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]Monitor{}
+	current := map[string]Monitor{}
+	for _, monitor := range existing {
+		monitor = cat.named(monitor)
+		if !slices.Contains(state.Monitors, monitor.Name) {
+			byName[monitor.Name] = monitor
+		}
+		current[monitor.Name] = monitor
+	}
+	declared := map[string]bool{}
+	for _, monitor := range config.Monitors {
+		if monitor.Name == "" {
+			return nil, errors.New("monitor without name")
+		}
+		if declared[monitor.Name] {
+			return nil, errors.New("duplicate monitor " + monitor.Name)
+		}
+		declared[monitor.Name] = true
+		byName[monitor.Name] = monitor
+	}
+	for _, monitor := range config.Monitors {
+		if err := validateConfigMonitor(monitor); err != nil {
+			return nil, errors.New("monitor " + monitor.Name + ": " + err.Error())
+		}
+		if err := monitor.checkParents(monitor.Name, byName); err != nil {
+			return nil, errors.New("monitor " + monitor.Name + ": " + err.Error())
+		}
+		for _, name := range append(slices.Clone(monitor.Notifiers), monitor.EscalateTo...) {
+			_, declared := notifiers[name]
+			_, exists := cat.notifierIDs[name]
+			if !declared && (!exists || slices.Contains(state.Notifiers, name)) {
+				return nil, errors.New("monitor " + monitor.Name + ": no such notifier " + name)
+			}
+		}
+		change := configChange{Kind: "monitor", Name: monitor.Name, monitor: monitor}
+		previous, ok := current[monitor.Name]
+		if ok {
+			change.Fields = changedFields(previous, monitor)
+		}
+		switch {
+		case !ok:
+			change.Action = actionCreate
+		case len(change.Fields) > 0:
+			change.Action = actionUpdate
+		case !slices.Contains(state.Monitors, monitor.Name):
+			change.Action = actionManage
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	for _, name := range state.Monitors {
+		if _, ok := current[name]; ok && !declared[name] {
+			changes = append(changes, configChange{Action: actionDelete, Kind: "monitor", Name: name})
+		}
+	}
+	for _, name := range state.Notifiers {
+		_, exists := cat.notifierIDs[name]
+		if _, ok := notifiers[name]; !ok && exists {
+			changes = append(changes, configChange{Action: actionDelete, Kind: "notifier", Name: name})
+		}
+	}
+	return changes, nil
+}
+
+// applyConfig makes the changes of a plan and records the entries managed by the config file.
+// Notifiers are created before the monitors that use them and deleted after. New monitors and
+// notifiers are given IDs up front, so monitors may refer to parents created by the same plan.
+func applyConfig(file string, config Config, changes []configChange) error {
+	cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if change.Kind != "notifier" || change.Action == actionDelete {
+			continue
+		}
+		var err error
+		switch change.Action {
+		case actionCreate:
+			var id string
+			if id, err = cat.addNotifier(change.Name); err == nil {
+				err = store.CreateNotifier(id, change.notifier.Type, change.notifier.Data)
+			}
+		case actionUpdate:
+			err = store.UpdateNotifier(cat.notifierIDs[change.Name], change.notifier.Data)
+		}
+		if err != nil {
+			return errors.New(change.String() + ": " + err.Error())
+		}
+	}
+	for _, change := range changes {
+		if change.Kind == "monitor" && change.Action == actionCreate {
+			if _, err := cat.addMonitor(change.Name); err != nil {
+				return errors.New(change.String() + ": " + err.Error())
+			}
+		}
+	}
+	for _, change := range changes {
+		if change.Kind != "monitor" {
+			continue
+		}
+		var err error
+		switch change.Action {
+		case actionCreate, actionUpdate:
+			var monitor Monitor
+			if monitor, err = cat.identified(change.monitor); err == nil {
+				err = saveMonitor(monitor, change.Action == actionUpdate)
+			}
+		case actionDelete:
+			err = removeMonitor(cat.monitorIDs[change.Name])
+		}
+		if err != nil {
+			return errors.New(change.String() + ": " + err.Error())
+		}
+	}
+	for _, change := range changes {
+		if change.Kind == "notifier" && change.Action == actionDelete {
+			if err := removeNotify(cat.notifierIDs[change.Name]); err != nil {
+				return errors.New(change.String() + ": " + err.Error())
+			}
+		}
+	}
+	state := configState{File: file, Applied: time.Now()}
+	for _, monitor := range config.Monitors {
+		state.Monitors = append(state.Monitors, monitor.Name)
+	}
+	for _, notifier := range config.Notifiers {
+		state.Notifiers = append(state.Notifiers, notifier.Name)
+	}
+	return saveConfigState(state)
+}
+
+// reconcileConfig applies the config file, if one is set, and returns the changes made.
+func reconcileConfig() ([]configChange, error) {
+	file := configFile()
+	if file == "" {
+		return nil, nil
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	config, err := readConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := planConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyConfig(file, config, changes); err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		log.Println("config:", change)
+	}
+	return changes, nil
+}
+
+// isManagedMonitor reports whether the named monitor is managed by the config file.
+func isManagedMonitor(name string) bool {
+	state, err := getConfigState()
+	if err != nil {
+		log.Println("get config state", err)
+		return false
+	}
+	return configFile() != "" && slices.Contains(state.Monitors, name)
+}
+
+// isManagedNotifier reports whether the named notifier is managed by the config file.
+func isManagedNotifier(name string) bool {
+	state, err := getConfigState()
+	if err != nil {
+		log.Println("get config state", err)
+		return false
+	}
+	return configFile() != "" && slices.Contains(state.Notifiers, name)
+}
+
+// runConfig implements the config command: plan shows the changes the config file makes, apply makes them.
+func runConfig(args []string) error {
+	if len(args) == 0 || (args[0] != "plan" && args[0] != "apply") {
+		return errors.New("usage: uptime config plan|apply [-f file]")
+	}
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	file := flags.String("f", configFile(), "config file (yaml, json or toml)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("no config file; use -f or set UPTIME_CONFIG")
+	}
+	config, err := readConfig(*file)
+	if err != nil {
+		return err
+	}
+	changes, err := planConfig(config)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) == 0 {
+		fmt.Println("no changes")
+	}
+	if args[0] == "plan" {
+		return nil
+	}
+	if err := applyConfig(*file, config, changes); err != nil {
+		return err
+	}
+	fmt.Println("applied", len(changes), "changes")
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SLACK_TOKEN", "xoxb-secret")
+	files := map[string]string{
+		"uptime.yaml": `
+monitors:
+  - name: site
+    url: https://example.com
+    freq: 1m
+notifiers:
+  - name: ops
+    type: slack
+    token: ${SLACK_TOKEN}
+`,
+		"uptime.json": `{"monitors": [{"name": "site", "url": "https://example.com", "freq": "1m"}],
+"notifiers": [{"name": "ops", "type": "slack", "token": "${SLACK_TOKEN}"}]}`,
+		"uptime.toml": `
+[[monitors]]
+name = "site"
+url = "https://example.com"
+freq = "1m"
+
+[[notifiers]]
+name = "ops"
+type = "slack"
+token = "${SLACK_TOKEN}"
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(dir, name)
+			if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := readConfig(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(config.Monitors) != 1 || len(config.Notifiers) != 1 {
+				t.Fatalf("readConfig() = %+v, want a monitor and a notifier", config)
+			}
+			m := config.Monitors[0]
+			if m.Name != "site" || m.Freq != "1m" || m.Timeout != "5s" || m.StatusOK != 200 || !m.Active || m.Type != HTTP {
+				t.Errorf("monitor %+v, want site with defaults", m)
+			}
+			n := config.Notifiers[0]
+			if n.Type != Slack || !strings.Contains(string(n.Data), "xoxb-secret") {
+				t.Errorf("notifier %s %s, want slack with the token from the environment", n.Type, n.Data)
+			}
+		})
+	}
+	t.Run("missing variable", func(t *testing.T) {
+		file := filepath.Join(dir, "missing.yaml")
+		if err := os.WriteFile(file, []byte("monitors:\n  - name: ${UPTIME_TEST_UNSET}\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfig(file); err == nil || !strings.Contains(err.Error(), "UPTIME_TEST_UNSET") {
+			t.Errorf("readConfig() error = %v, want missing UPTIME_TEST_UNSET", err)
+		}
+	})
+	t.Run("unsupported format", func(t *testing.T) {
+		file := filepath.Join(dir, "uptime.ini")
+		if err := os.WriteFile(file, []byte(""), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfig(file); err == nil {
+			t.Error("read an ini config")
+		}
+	})
+}
+
+func TestPlanConfig(t *testing.T) {
+	monitor := func(name string, fields ...func(*Monitor)) Monitor {
+		m := Monitor{Name: name, Type: HTTP, URL: "https://" + name + ".example.com", Freq: "5m", Timeout: "5s",
+			StatusOK: 200, Active: true}
+		for _, field := range fields {
+			field(&m)
+		}
+		return m
+	}
+	notifier := func(name, token string) configNotifier {
+		n, err := decodeNotifier([]byte(`{"name":"` + name + `","type":"slack","token":"` + token + `"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	applied := Config{
+		Monitors:  []Monitor{monitor("api"), monitor("web", func(m *Monitor) { m.Parents = []string{"api"} })},
+		Notifiers: []configNotifier{notifier("ops", "one")},
+	}
+	tests := []struct {
+		name      string
+		unmanaged []Monitor // created outside the config file
+		config    Config
+		want      []string
+		err       string
+	}{
+		{"unchanged", nil, applied, nil, ""},
+		{"create", nil, Config{
+			Monitors: append(slices.Clone(applied.Monitors),
+				monitor("db", func(m *Monitor) { m.Notifiers = []string{"chat"} })),
+			Notifiers: append(slices.Clone(applied.Notifiers), notifier("chat", "two")),
+		}, []string{"create notifier chat", "create monitor db"}, ""},
+		{"update", nil, Config{
+			Monitors:  []Monitor{monitor("api", func(m *Monitor) { m.Freq = "1m"; m.Timeout = "2s" }), applied.Monitors[1]},
+			Notifiers: []configNotifier{notifier("ops", "rotated")},
+		}, []string{"update notifier ops", "update monitor api (Freq, Timeout)"}, ""},
+		{"delete removed entries", nil, Config{Monitors: []Monitor{monitor("api")}},
+			[]string{"delete monitor web", "delete notifier ops"}, ""},
+		{"manage identical unmanaged monitor", []Monitor{monitor("db")},
+			Config{Monitors: append(slices.Clone(applied.Monitors), monitor("db")), Notifiers: applied.Notifiers},
+			[]string{"manage monitor db"}, ""},
+		{"unmanaged monitors are left alone", []Monitor{monitor("db")}, applied, nil, ""},
+		{"update unmanaged monitor", []Monitor{monitor("db")}, Config{
+			Monitors:  append(slices.Clone(applied.Monitors), monitor("db", func(m *Monitor) { m.Active = false })),
+			Notifiers: applied.Notifiers,
+		}, []string{"update monitor db (Active)"}, ""},
+		{"parent from the database", []Monitor{monitor("db")}, Config{
+			Monitors:  append(slices.Clone(applied.Monitors), monitor("cache", func(m *Monitor) { m.Parents = []string{"db"} })),
+			Notifiers: applied.Notifiers,
+		}, []string{"create monitor cache"}, ""},
+		{"duplicate monitor", nil, Config{Monitors: []Monitor{monitor("api"), monitor("api")}}, nil,
+			"duplicate monitor api"},
+		{"duplicate notifier", nil, Config{Notifiers: []configNotifier{notifier("ops", "a"), notifier("ops", "b")}}, nil,
+			"duplicate notifier ops"},
+		{"monitor without name", nil, Config{Monitors: []Monitor{monitor("")}}, nil, "monitor without name"},
+		{"invalid url", nil, Config{Monitors: []Monitor{monitor("api", func(m *Monitor) { m.URL = "ftp://api" })}},
+			nil, "invalid url"},
+		{"invalid frequency", nil, Config{Monitors: []Monitor{monitor("api", func(m *Monitor) { m.Freq = "often" })}},
+			nil, "monitor api"},
+		{"missing parent", nil, Config{Monitors: []Monitor{monitor("api", func(m *Monitor) { m.Parents = []string{"db"} })}},
+			nil, "monitor api"},
+		{"dependency cycle", nil, Config{Monitors: []Monitor{
+			monitor("api", func(m *Monitor) { m.Parents = []string{"web"} }),
+			monitor("web", func(m *Monitor) { m.Parents = []string{"api"} }),
+		}}, nil, "monitor api"},
+		{"notifier removed from the config", nil, Config{
+			Monitors: []Monitor{monitor("api", func(m *Monitor) { m.Notifiers = []string{"ops"} })},
+		}, nil, "no such notifier ops"},
+		{"notifier type changed", nil, Config{Notifiers: []configNotifier{{Name: "ops", Type: Discord, Data: []byte("{}")}}},
+			nil, "changes type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t, backendBolt)
+			changes, err := planConfig(applied)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig("uptime.yaml", applied, changes); err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range tt.unmanaged {
+				if err := saveMonitor(m, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			changes, err = planConfig(tt.config)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("planConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, change := range changes {
+				got = append(got, change.String())
+			}
+			if strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+				t.Errorf("planConfig() = %q, want %q", got, tt.want)
+			}
+			if err := applyConfig("uptime.yaml", tt.config, changes); err != nil {
+				t.Fatal(err)
+			}
+			if changes, err := planConfig(tt.config); err != nil || len(changes) != 0 {
+				t.Errorf("planConfig() after applying = %v, %v, want no changes", changes, err)
+			}
+		})
+	}
+}
@@ -2,17 +2,17 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"slices"
+	"sync/atomic"
 	"time"
 
 	"go.etcd.io/bbolt"
-	berrors "go.etcd.io/bbolt/errors"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -33,18 +33,16 @@ var (
 // openDB Opens, creates if non-existent, db file in XDG_DATA_HOME/uptime.db.
 func openDB() error {
 	var err error
-	xdg, ok := os.LookupEnv("XDG_DATA_HOME")
-	if !ok {
-		home, _ := os.UserHomeDir()
-		xdg = filepath.Join(home, ".local/share/uptime")
-	}
-	file := filepath.Join(xdg, dbFile)
+	file := filepath.Join(dataDir(), dbFile)
 	db, err = bbolt.Open(file, 0o666, &bbolt.Options{Timeout: time.Second})
 	if err != nil {
 		return err
 	}
 	log.Println("loaded db file", file)
-	return nil
+	if err := migrateSchema(); err != nil {
+		return err
+	}
+	return initDB()
 }
 
 // createBucket creates and return bucket at given path, intermediate buckets along path are also created.
@@ -84,12 +82,6 @@ func getKey(path []string, tx *bbolt.Tx) []byte {
 	return value
 }
 
-// keyExists returns true if key exists at given path.
-func keyExists(path []string, tx *bbolt.Tx) bool {
-	key := getKey(path, tx)
-	return key != nil
-}
-
 // addKey creates a new key with name, value in bucket at path, bucket and intermediate buckets
 // will be created if not existing.
 func addKey(name string, path []string, value []byte) error {
@@ -99,38 +91,24 @@ func addKey(name string, path []string, value []byte) error {
 	})
 }
 
-// getStatus return the name status.
-func getStatus(name string) (Status, error) {
-	status := Status{}
-	path := []string{"status", name}
-	err := db.View(func(tx *bbolt.Tx) error {
-		key := getKey(path, tx)
-		if err := json.Unmarshal(key, &status); err != nil {
-			return err
-		}
-		return nil
-	})
-	return status, err
+// getStatus returns the latest status of the monitor with the given ID.
+func getStatus(id string) (Status, error) {
+	return store.Status(id)
+}
+
+// saveStatus saves the latest status of a monitor.
+func saveStatus(status Status) error {
+	return store.SaveStatus(status)
 }
 
-func purgeHistData(site, date string) error {
-	log.Println("purge data from", site, "before", date)
+func purgeHistData(id, date string) error {
+	log.Println("purge data from", id, "before", date)
 	dateTime, err := time.Parse(time.DateOnly, date)
 	if err != nil {
 		return err
 	}
-	stop := []byte(dateTime.Format(time.RFC3339))
-	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("history"))
-		history := bucket.Bucket([]byte(site))
-		c := history.Cursor()
-		for k, _ := c.First(); k != nil && bytes.Compare(k, stop) <= 0; k, _ = c.Next() {
-			if err := history.Delete(k); err != nil {
-				return err
-			}
-		}
-		return nil
-	})
+	_, err = store.PruneHistory(id, dateTime, 0)
+	return err
 }
 
 // getTime returns RFC3339 time for given timeframe.
@@ -155,156 +133,110 @@ func getTime(frame TimeFrame) []byte {
 
 // getHistory returns array of status values from the given path for the given timeframe.
 func getHistory(path []string, frame TimeFrame) ([]Status, error) {
-	stats := []Status{}
-	status := Status{}
-	end := []byte(time.Now().Format(time.RFC3339))
-	start := getTime(frame)
-	err := db.View(func(tx *bbolt.Tx) error {
-		bucket := getBucket(path, tx)
-		if bucket == nil {
-			return errPath
-		}
-		c := bucket.Cursor()
-		for k, v := c.Seek(start); k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
-			if err := json.Unmarshal(v, &status); err != nil {
-				return err
-			}
-			stats = append(stats, status)
-		}
-		return nil
-	})
+	start, err := time.Parse(time.RFC3339, string(getTime(frame)))
+	if err != nil {
+		return nil, err
+	}
+	stats, err := store.History(path[len(path)-1], start, time.Now(), 0)
 	slices.Reverse(stats)
 	return stats, err
 }
 
-func getHistoryDetails(monitor string, ok int) (Details, error) {
+func getHistoryDetails(monitor string) (Details, error) {
 	var details Details
 	var err error
-	details.Status, err = getHistory([]string{"history", monitor}, all)
+	details.Response24, details.Uptime24, err = getStats(monitor, day)
 	if err != nil {
 		return details, err
 	}
-	details.Response24, details.Uptime24, err = getStats(monitor, day, ok)
+	details.Response30, details.Uptime30, err = getStats(monitor, month)
 	if err != nil {
 		return details, err
 	}
-	details.Response30, details.Uptime30, err = getStats(monitor, month, ok)
+	details.Month, err = getRollupStats(monitor, month)
+	if err != nil {
+		return details, err
+	}
+	details.Year, err = getRollupStats(monitor, year)
 	return details, err
 }
 
-func getStats(monitor string, timeFrame TimeFrame, ok int) (int, float64, error) {
-	var good, total float64
-	var status Status
-	var responseTime int
-	first := getTime(timeFrame)
-	now := []byte(time.Now().Format(time.RFC3339))
-	if err := db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("history"))
-		history := bucket.Bucket([]byte(monitor))
-		c := history.Cursor()
-		for k, v := c.Seek(first); k != nil && bytes.Compare(k, now) <= 0; k, v = c.Next() {
-			if err := json.Unmarshal(v, &status); err != nil {
-				return err
-			}
-			total++
-			if status.StatusCode == ok {
-				good++
-			}
-			responseTime += int(status.ResponseTime.Milliseconds())
-		}
-		return nil
-	}); err != nil {
+// getStats returns the average response time in milliseconds and the uptime percentage of the monitor
+// for the time frame, computed from rollups.
+func getStats(monitor string, timeFrame TimeFrame) (int, float64, error) {
+	rollup, err := getRollupStats(monitor, timeFrame)
+	if err != nil {
 		return 0, 0, err
 	}
-	if total == 0 {
-		return 0, 0, nil
+	return int(rollup.Avg().Milliseconds()), rollup.Uptime(), nil
+}
+
+// getRollupStats returns the combined rollup of the monitor for the time frame.
+func getRollupStats(monitor string, timeFrame TimeFrame) (Rollup, error) {
+	since, err := time.Parse(time.RFC3339, string(getTime(timeFrame)))
+	if err != nil {
+		return Rollup{}, err
 	}
-	return responseTime / int(total), good / total * 100, nil
+	return summarize(monitor, since)
+}
+
+// addHistory saves a check result to the history of the monitor with the given ID and updates its rollups.
+func addHistory(id string, status Status, ok int) error {
+	return store.AddHistory(id, ok, status)
 }
 
 // getMonitors returns array of all Monitor structs.
 func getMonitors() ([]Monitor, error) {
-	monitors := []Monitor{}
-	monitor := Monitor{}
-	err := db.View(func(tx *bbolt.Tx) error {
-		bucket := getBucket([]string{"monitors"}, tx)
-		return bucket.ForEach(func(_, v []byte) error {
-			if err := json.Unmarshal(v, &monitor); err != nil {
-				return err
-			}
-			monitors = append(monitors, monitor)
-			return nil
-		})
-	})
-	return monitors, err
+	return store.Monitors()
 }
 
-// getMonitor returns monitor struct of given name.
-func getMonitor(name string) (Monitor, error) {
-	monitor := Monitor{}
-	err := db.View(func(tx *bbolt.Tx) error {
-		bucket := getBucket([]string{"monitors"}, tx)
-		value := bucket.Get([]byte(name))
-		if err := json.Unmarshal(value, &monitor); err != nil {
-			return err
-		}
-		return nil
-	})
-	return monitor, err
+// getMonitor returns the monitor with the given ID.
+func getMonitor(id string) (Monitor, error) {
+	return store.Monitor(id)
 }
 
-// saveMonitor save Monitor in database.
-func saveMonitor(monitor Monitor, update bool) error {
-	bytes, err := json.Marshal(monitor)
+// getMonitorByName returns the monitor with the given name.
+func getMonitorByName(name string) (Monitor, error) {
+	monitors, err := store.Monitors()
 	if err != nil {
-		return err
+		return Monitor{}, err
 	}
-	return db.Update(func(tx *bbolt.Tx) error {
-		keyExists := keyExists([]string{"monitors", monitor.Name}, tx)
-		if keyExists && !update {
-			return errKeyExists
-		}
-		if !keyExists && update {
-			return errNoKey
+	for _, monitor := range monitors {
+		if monitor.Name == name {
+			return monitor, nil
 		}
-		bucket := tx.Bucket([]byte("monitors"))
-		if err := bucket.Put([]byte(monitor.Name), bytes); err != nil {
+	}
+	return Monitor{}, errNoKey
+}
+
+// saveMonitor save Monitor in database; a new monitor without an ID is assigned one. Names are unique.
+func saveMonitor(monitor Monitor, update bool) error {
+	if existing, err := getMonitorByName(monitor.Name); err == nil && existing.ID != monitor.ID {
+		return errors.New("monitor " + monitor.Name + " exists")
+	}
+	if monitor.ID == "" && !update {
+		var err error
+		if monitor.ID, err = newID(); err != nil {
 			return err
 		}
-		return nil
-	})
+	}
+	return store.SaveMonitor(monitor, update)
 }
 
-// removeMonitor deletes the named monitor from database.
-func removeMonitor(name string) error {
-	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("monitors"))
-		return bucket.Delete([]byte(name))
-	})
+// removeMonitor deletes the monitor with the given ID from database and from the parents of other monitors.
+func removeMonitor(id string) error {
+	return store.DeleteMonitor(id)
 }
 
-// deleteHistory deletes named history bucket.
-func deleteHistory(name string) error {
-	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("history"))
-		if err := bucket.DeleteBucket([]byte(name)); err != nil {
-			return err
-		}
-		bucket = tx.Bucket([]byte("status"))
-		return bucket.Delete([]byte(name))
-	})
+// deleteHistory deletes the history of the monitor with the given ID.
+func deleteHistory(id string) error {
+	return store.DeleteHistory(id)
 }
 
 // validateUser confirms provide username/password matches username/password in db.
 func validateUser(user User) bool {
-	var truth User
-	if err := db.View(func(tx *bbolt.Tx) error {
-		bytes := getKey([]string{"users", user.Name}, tx)
-		if err := json.Unmarshal(bytes, &truth); err != nil {
-			return err
-		}
-		return nil
-	}); err != nil {
+	truth, err := store.User(user.Name)
+	if err != nil {
 		log.Println("validate user", err)
 		return false
 	}
@@ -326,51 +258,38 @@ func setPass(user User) (User, error) {
 	return user, nil
 }
 
-// checkAdmin checks if given username is an admin.
-func checkAdmin(name string) bool {
-	var user User
-	if err := db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("users"))
-		value := bucket.Get([]byte(name))
-		if err := json.Unmarshal(value, &user); err != nil {
-			return err
-		}
-		return nil
-	}); err != nil {
+// setupDone records that a user exists, so that firstRun does not read the users on every request. The last
+// admin cannot be deleted, so setup is not needed again until another store is opened.
+var setupDone atomic.Bool
+
+// needsSetup reports whether the first user has still to be created.
+func needsSetup() bool {
+	if setupDone.Load() {
 		return false
 	}
-	return user.Admin
+	users, err := store.Users()
+	if err == nil && len(users) > 0 {
+		setupDone.Store(true)
+	}
+	return err == nil && len(users) == 0
 }
 
 // getUsers returns array of all users in db; password is nulled.
 func getUsers() []User {
-	var user User
-	var users []User
-	if err := db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("users"))
-		return bucket.ForEach(func(k, v []byte) error {
-			if err := json.Unmarshal(v, &user); err != nil {
-				return err
-			}
-			user.Name = string(k)
-			user.Pass = ""
-			users = append(users, user)
-			return nil
-		})
-	}); err != nil {
+	users, err := store.Users()
+	if err != nil {
 		return []User{}
 	}
+	for i := range users {
+		users[i].Pass = ""
+	}
 	return users
 }
 
 // getUers returns user struct for named user.
 func getUser(name string) User {
-	var user User
-	if err := db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("users"))
-		v := bucket.Get([]byte(name))
-		return json.Unmarshal(v, &user)
-	}); err != nil {
+	user, err := store.User(name)
+	if err != nil {
 		return User{}
 	}
 	return user
@@ -383,204 +302,600 @@ func insertUser(user User) error {
 	if err != nil {
 		return err
 	}
-	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("users"))
-		v := bucket.Get([]byte(user.Name))
-		if v != nil {
-			return errUser
-		}
-		bytes, err := json.Marshal(&user)
+	return store.SaveUser(user, false)
+}
+
+// modifyUser updates a user in db; the password is kept if none is given.
+func modifyUser(user User) error {
+	if user.Pass == "" {
+		existing, err := store.User(user.Name)
 		if err != nil {
 			return err
 		}
-		return bucket.Put([]byte(user.Name), bytes)
+		user.Pass = existing.Pass
+		return store.SaveUser(user, true)
+	}
+	var err error
+	user, err = setPass(user)
+	if err != nil {
+		return err
+	}
+	return store.SaveUser(user, true)
+}
+
+// removeUser deletes a user from db.
+func removeUser(name string) error {
+	return store.DeleteUser(name)
+}
+
+// removeNotify deletes the notifier with the given ID.
+func removeNotify(id string) error {
+	return store.DeleteNotifier(id)
+}
+
+// createNofify inserts a new nofification bucket into database under a new ID, which is returned. Names
+// are unique.
+func createNotify(name string, notifyType NotifyType, data any) (string, error) {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	if err := checkNotifierName(name, ""); err != nil {
+		return "", err
+	}
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	return id, store.CreateNotifier(id, notifyType, bytes)
+}
+
+// updateNotify updates an existing notification bucket.
+func updateNotify(id string, notifyType NotifyType, data any) error {
+	log.Println("update notification", id, notifyType, data)
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := checkNotifierName(notifierName(bytes), id); err != nil {
+		return err
+	}
+	return store.UpdateNotifier(id, bytes)
+}
+
+// checkNotifierName confirms that no notifier other than the one with the given ID has the name.
+func checkNotifierName(name, id string) error {
+	if name == "" {
+		return errors.New("notifier name is required")
+	}
+	for _, notification := range getAllNotifications() {
+		if notification.Name == name && notification.ID != id {
+			return errors.New("notifier " + name + " exists")
+		}
+	}
+	return nil
+}
+
+// getNotify retrieves the data of the notifier with the given ID.
+func getNotify(id string) (NotifyType, []byte, error) {
+	return store.Notifier(id)
+}
+
+// getAllNotifications retrieves array of Notification data from db.
+func getAllNotifications() []Notification {
+	var notifications []Notification
+	ids, err := store.Notifiers()
+	if err != nil {
+		log.Println("get notifications", err)
+		return []Notification{}
+	}
+	for _, id := range ids {
+		notification := Notification{ID: id}
+		kind, data, err := store.Notifier(id)
+		if err != nil {
+			log.Println("get notification", id, err)
+			return []Notification{}
+		}
+		notification.Type = kind
+		if data == nil {
+			log.Println("no data for notification", id)
+			return []Notification{}
+		}
+		notification.Name = notifierName(data)
+		notification.Team = notifierTeam(data)
+		if err := json.Unmarshal(data, &notification.Notification); err != nil {
+			log.Println("unmarshal notification data", err)
+			return []Notification{}
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications
+}
+
+func getAllMonitorsForDisplay() []MonitorDisplay {
+	display := []MonitorDisplay{}
+	monitors, _ := getMonitors()
+	for _, monitor := range monitors {
+		disp := MonitorDisplay{
+			ID:          monitor.ID,
+			Name:        monitor.Name,
+			Active:      monitor.Active,
+			Maintenance: monitor.inMaintenance(time.Now()),
+		}
+		disp.Status, _ = getStatus(monitor.ID)
+		state, _ := getState(monitor.ID)
+		disp.Flapping = state.Flapping
+		disp.DisplayStatus = disp.Status.StatusCode == monitor.StatusOK
+		if rollup, err := getRollupStats(monitor.ID, day); err == nil {
+			disp.PerCent = rollup.Uptime()
+		}
+		display = append(display, disp)
+	}
+	return display
+}
+
+// getMaintenances returns all maintenance windows.
+func getMaintenances() ([]Maintenance, error) {
+	windows := []Maintenance{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("maintenance"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var window Maintenance
+			if err := json.Unmarshal(v, &window); err != nil {
+				return err
+			}
+			windows = append(windows, window)
+			return nil
+		})
 	})
+	return windows, err
 }
 
-// modifyUser updates a user in db.
-func modifyUser(user User) error {
-	var err error
-	user, err = setPass(user)
+// getMaintenance returns the maintenance window with the given ID.
+func getMaintenance(id string) (Maintenance, error) {
+	window := Maintenance{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("maintenance"))
+		if bucket == nil {
+			return errNoKey
+		}
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return errNoKey
+		}
+		return json.Unmarshal(value, &window)
+	})
+	return window, err
+}
+
+// saveMaintenance inserts a new maintenance window.
+func saveMaintenance(window Maintenance) error {
+	bytes, err := json.Marshal(window)
 	if err != nil {
 		return err
 	}
 	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("users"))
-		v := bucket.Get([]byte(user.Name))
-		if v == nil {
-			return errNoUser
-		}
-		bytes, err := json.Marshal(&user)
+		bucket, err := tx.CreateBucketIfNotExists([]byte("maintenance"))
 		if err != nil {
 			return err
 		}
-		return bucket.Put([]byte(user.Name), bytes)
+		if bucket.Get([]byte(window.ID)) != nil {
+			return errKeyExists
+		}
+		return bucket.Put([]byte(window.ID), bytes)
 	})
 }
 
-// removeUser deletes a user from db.
-func removeUser(name string) error {
+// removeMaintenance deletes the maintenance window with the given ID.
+func removeMaintenance(id string) error {
 	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("users"))
-		v := bucket.Get([]byte(name))
-		if v == nil {
-			return errNoUser
+		bucket := tx.Bucket([]byte("maintenance"))
+		if bucket == nil || bucket.Get([]byte(id)) == nil {
+			return errNoKey
 		}
-		return bucket.Delete([]byte(name))
+		return bucket.Delete([]byte(id))
 	})
 }
 
-// removeNotify deletes the name notification bucket.
-func removeNotify(name string) error {
-	monitor := Monitor{}
-	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("notify"))
+// getState returns the recent state history of the monitor with the given ID.
+func getState(id string) (MonitorState, error) {
+	state := MonitorState{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("state"))
 		if bucket == nil {
-			return fmt.Errorf("%w nofify", berrors.ErrBucketNotFound)
+			return nil
 		}
-		if err := bucket.DeleteBucket([]byte(name)); err != nil {
-			return fmt.Errorf("delete bucket %s %w", name, err)
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return nil
 		}
-		bucket = tx.Bucket([]byte("monitors"))
-		err := bucket.ForEach(func(key, v []byte) error {
-			if err := json.Unmarshal(v, &monitor); err != nil {
-				return fmt.Errorf("unmarshal monitor %s %w", string(key), err)
-			}
-			monitor.Notifiers = slices.DeleteFunc(monitor.Notifiers, func(n string) bool {
-				return n == name
-			})
-			bytes, err := json.Marshal(monitor)
-			if err != nil {
-				return fmt.Errorf("marshal monitor %s %w", monitor.Name, err)
+		return json.Unmarshal(value, &state)
+	})
+	return state, err
+}
+
+// saveState saves the state history of the monitor with the given ID.
+func saveState(id string, state MonitorState) error {
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return addKey(id, []string{"state"}, bytes)
+}
+
+// getAgents returns all remote agents.
+func getAgents() ([]Agent, error) {
+	agents := []Agent{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("agents"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var agent Agent
+			if err := json.Unmarshal(v, &agent); err != nil {
+				return err
 			}
-			return bucket.Put(key, bytes)
+			agents = append(agents, agent)
+			return nil
 		})
-		return err
 	})
+	return agents, err
 }
 
-// createNofify inserts a new nofification bucket into database.
-func createNotify(name string, notifyType NotifyType, data any) error {
-	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("notify"))
+// getAgent returns the named remote agent.
+func getAgent(name string) (Agent, error) {
+	agent := Agent{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("agents"))
 		if bucket == nil {
-			return berrors.ErrBucketNotFound
+			return errNoKey
 		}
-		bytes, err := json.Marshal(data)
-		if err != nil {
-			return err
+		value := bucket.Get([]byte(name))
+		if value == nil {
+			return errNoKey
 		}
-		bucket, err = bucket.CreateBucket([]byte(name))
+		return json.Unmarshal(value, &agent)
+	})
+	return agent, err
+}
+
+// saveAgent saves a remote agent.
+func saveAgent(agent Agent, update bool) error {
+	bytes, err := json.Marshal(agent)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("agents"))
 		if err != nil {
 			return err
 		}
-		if err := bucket.Put([]byte("type"), []byte(notifyType)); err != nil {
-			return err
+		exists := bucket.Get([]byte(agent.Name)) != nil
+		if exists && !update {
+			return errKeyExists
 		}
-		return bucket.Put([]byte("data"), bytes)
+		if !exists && update {
+			return errNoKey
+		}
+		return bucket.Put([]byte(agent.Name), bytes)
 	})
 }
 
-// updateNotify updates an existing notification bucket.
-func updateNotify(name string, notifyType NotifyType, data any) error {
-	log.Println("update notification", name, notifyType, data)
+// removeAgent deletes the named remote agent.
+func removeAgent(name string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("agents"))
+		if bucket == nil || bucket.Get([]byte(name)) == nil {
+			return errNoKey
+		}
+		return bucket.Delete([]byte(name))
+	})
+}
+
+// getAPITokens returns all api tokens.
+func getAPITokens() ([]APIToken, error) {
+	tokens := []APIToken{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("tokens"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var token APIToken
+			if err := json.Unmarshal(v, &token); err != nil {
+				return err
+			}
+			tokens = append(tokens, token)
+			return nil
+		})
+	})
+	return tokens, err
+}
+
+// getAPIToken returns the api token with the given ID.
+func getAPIToken(id string) (APIToken, error) {
+	var token APIToken
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("tokens"))
+		if bucket == nil {
+			return errNoKey
+		}
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return errNoKey
+		}
+		return json.Unmarshal(value, &token)
+	})
+	return token, err
+}
+
+// saveAPIToken saves an api token.
+func saveAPIToken(token APIToken) error {
+	bytes, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return addKey(token.ID, []string{"tokens"}, bytes)
+}
+
+// removeAPITokens deletes the api tokens with the given IDs.
+func removeAPITokens(ids ...string) error {
 	return db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("notify"))
+		bucket := tx.Bucket([]byte("tokens"))
+		if bucket == nil {
+			return errNoKey
+		}
+		for _, id := range ids {
+			if bucket.Get([]byte(id)) == nil {
+				return errNoKey
+			}
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveLocationStatus saves the latest result of a monitor from a remote location.
+func saveLocationStatus(status Status) error {
+	bytes, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return addKey(status.Location, []string{"locations", status.MonitorID}, bytes)
+}
+
+// getLocationStatuses returns the latest results of the monitor with the given ID from all remote locations.
+func getLocationStatuses(id string) ([]Status, error) {
+	statuses := []Status{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("locations"))
+		if bucket == nil {
+			return nil
+		}
+		bucket = bucket.Bucket([]byte(id))
 		if bucket == nil {
-			return fmt.Errorf("%w notify", berrors.ErrBucketNotFound)
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var status Status
+			if err := json.Unmarshal(v, &status); err != nil {
+				return err
+			}
+			statuses = append(statuses, status)
+			return nil
+		})
+	})
+	return statuses, err
+}
+
+// itob returns an 8-byte big endian representation of v.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// saveIncident saves an incident; new incidents are assigned an ID.
+func saveIncident(incident *Incident) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("incidents"))
+		if err != nil {
+			return err
+		}
+		if incident.ID == 0 {
+			if incident.ID, err = bucket.NextSequence(); err != nil {
+				return err
+			}
 		}
-		bytes, err := json.Marshal(data)
+		bytes, err := json.Marshal(incident)
 		if err != nil {
 			return err
 		}
-		bucket = bucket.Bucket([]byte(name))
+		return bucket.Put(itob(incident.ID), bytes)
+	})
+}
+
+// getIncident returns the incident with the given ID.
+func getIncident(id uint64) (Incident, error) {
+	incident := Incident{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("incidents"))
 		if bucket == nil {
-			return fmt.Errorf("%w %s", berrors.ErrBucketNotFound, name)
+			return errNotFound
+		}
+		value := bucket.Get(itob(id))
+		if value == nil {
+			return errNotFound
 		}
-		return bucket.Put([]byte("data"), bytes)
+		return json.Unmarshal(value, &incident)
 	})
+	return incident, err
 }
 
-// getNotify retrieves named notification data.
-func getNotify(name string) (NotifyType, []byte, error) {
-	var notifyType NotifyType
-	var data []byte
+// getIncidents returns incidents, newest first, for the monitor with the given ID or all monitors if id is
+// empty.
+func getIncidents(id string) ([]Incident, error) {
+	incidents := []Incident{}
 	err := db.View(func(tx *bbolt.Tx) error {
-		notifications := tx.Bucket([]byte("notify"))
-		if notifications == nil {
-			return berrors.ErrBucketNotFound
+		bucket := tx.Bucket([]byte("incidents"))
+		if bucket == nil {
+			return nil
 		}
-		notify := notifications.Bucket([]byte(name))
-		if notify == nil {
-			return berrors.ErrBucketNotFound
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var incident Incident
+			if err := json.Unmarshal(v, &incident); err != nil {
+				return err
+			}
+			if id == "" || incident.MonitorID == id {
+				incidents = append(incidents, incident)
+			}
 		}
-		notifyType = NotifyType(notify.Get([]byte("type")))
-		data = notify.Get([]byte("data"))
 		return nil
 	})
-	return notifyType, data, err
+	return incidents, err
 }
 
-// getAllNotifications retrieves array of Notification data from db.
-func getAllNotifications() []Notification {
-	var notifications []Notification
-	var notification Notification
+// saveAuditEntry saves a new audit entry and assigns its ID.
+func saveAuditEntry(entry *AuditEntry) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("audit"))
+		if err != nil {
+			return err
+		}
+		if entry.ID, err = bucket.NextSequence(); err != nil {
+			return err
+		}
+		bytes, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(itob(entry.ID), bytes)
+	})
+}
+
+// getAuditEntries returns the audit entries selected by filter, newest first; at most limit entries
+// unless limit is 0.
+func getAuditEntries(filter AuditFilter, limit int) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
 	err := db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("notify"))
+		bucket := tx.Bucket([]byte("audit"))
 		if bucket == nil {
-			return berrors.ErrBucketNotFound
+			return nil
 		}
-		return bucket.ForEach(func(k, _ []byte) error {
-			notification.Name = string(k)
-			notifyBucket := bucket.Bucket(k)
-			if notifyBucket == nil {
-				return berrors.ErrBucketNotFound
-			}
-			notification.Type = NotifyType(notifyBucket.Get([]byte("type")))
-			dataValue := notifyBucket.Get([]byte("data"))
-			if dataValue == nil {
-				log.Println("no data for notification", notification.Name)
-				return errNoKey
-			}
-			if err := json.Unmarshal(dataValue, &notification.Notification); err != nil {
-				log.Println("unmarshal notification data", err)
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil && (limit == 0 || len(entries) < limit); k, v = c.Prev() {
+			var entry AuditEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
 				return err
 			}
-			notifications = append(notifications, notification)
+			if filter.matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// getSecret returns the named secret key, creating a random key on first use.
+func getSecret(name string) ([]byte, error) {
+	var key []byte
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("secrets"))
+		if err != nil {
+			return err
+		}
+		if value := bucket.Get([]byte(name)); value != nil {
+			key = bytes.Clone(value)
 			return nil
-		})
+		}
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		return bucket.Put([]byte(name), key)
 	})
+	return key, err
+}
+
+// getSettings returns the global settings.
+func getSettings() (Settings, error) {
+	settings := Settings{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("settings"))
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte("settings"))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &settings)
+	})
+	return settings, err
+}
+
+// saveSettings saves the global settings.
+func saveSettings(settings Settings) error {
+	bytes, err := json.Marshal(settings)
 	if err != nil {
-		log.Println("get notifications", err)
-		return []Notification{}
+		return err
 	}
-	return notifications
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("settings"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("settings"), bytes)
+	})
 }
 
-func getAllMonitorsForDisplay() []MonitorDisplay {
-	display := []MonitorDisplay{}
-	monitors, _ := getMonitors()
-	for _, monitor := range monitors {
-		disp := MonitorDisplay{
-			Name:   monitor.Name,
-			Active: monitor.Active,
-		}
-		disp.Status, _ = getStatus(monitor.Name)
-		history, _ := getHistory([]string{"history", monitor.Name}, day)
-		var total, good float64
-		for i, hist := range history {
-			if i == 0 {
-				if history[i].StatusCode == monitor.StatusOK {
-					disp.DisplayStatus = true
-				}
-			}
-			total++
-			if hist.StatusCode == monitor.StatusOK {
-				good++
-			}
-			disp.PerCent = good / total * 100
+// pruneHistory deletes up to limit history records of the named monitor older than before and returns
+// the number deleted. Each call is a single short transaction.
+func pruneHistory(name string, before time.Time, limit int) (int, error) {
+	return store.PruneHistory(name, before, limit)
+}
+
+// historyCounts returns the number of history records of each monitor.
+func historyCounts() (map[string]int, error) {
+	return store.HistoryCounts()
+}
+
+// getConfigState returns what was last applied from the config file.
+func getConfigState() (configState, error) {
+	state := configState{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("meta"))
+		if bucket == nil {
+			return nil
 		}
-		display = append(display, disp)
+		value := bucket.Get([]byte("config"))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &state)
+	})
+	return state, err
+}
+
+// saveConfigState records what was applied from the config file.
+func saveConfigState(state configState) error {
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
 	}
-	return display
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("config"), bytes)
+	})
 }
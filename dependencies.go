@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parentCheckTTL is how long the result of a live check of a parent is shared by its failing children.
+const parentCheckTTL = 30 * time.Second
+
+var errDependencyCycle = errors.New("monitor dependencies form a cycle")
+
+// parentCheck is a live check of a parent monitor shared by its children.
+type parentCheck struct {
+	done chan struct{} // closed when the check has finished
+	time time.Time
+	down bool
+}
+
+// parentChecks holds the latest live check of each parent monitor.
+var parentChecks = struct {
+	sync.Mutex
+	checks map[string]*parentCheck
+}{checks: map[string]*parentCheck{}}
+
+// downParent returns the name of a parent monitor that is down, or an empty string if all parents are up.
+func (m *Monitor) downParent(ctx context.Context) string {
+	for _, id := range m.Parents {
+		parent, err := getMonitor(id)
+		if err != nil {
+			log.Println("get parent monitor", m.Name, id, err)
+			continue
+		}
+		status, err := getStatus(id)
+		if err == nil && status.StatusCode != parent.StatusOK {
+			return parent.Name
+		}
+		// the parent may not have noticed the failure yet
+		if parent.Active && parent.Type == HTTP && parentDown(ctx, parent) {
+			return parent.Name
+		}
+	}
+	return ""
+}
+
+// parentDown reports whether a live check finds the parent down. Children failing together share one
+// check, and its result is reused for parentCheckTTL, so a parent is not checked once per child.
+func parentDown(ctx context.Context, parent Monitor) bool {
+	parentChecks.Lock()
+	check, ok := parentChecks.checks[parent.ID]
+	if ok && check.finished() && time.Since(check.time) > parentCheckTTL {
+		ok = false
+	}
+	if ok {
+		parentChecks.Unlock()
+		select {
+		case <-ctx.Done():
+			return false
+		case <-check.done:
+			return check.down
+		}
+	}
+	check = &parentCheck{done: make(chan struct{})}
+	parentChecks.checks[parent.ID] = check
+	parentChecks.Unlock()
+	check.down = parent.Check(ctx).StatusCode != parent.StatusOK
+	check.time = time.Now()
+	close(check.done)
+	return check.down
+}
+
+// finished reports whether the check has finished.
+func (c *parentCheck) finished() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// dependents returns the monitors that depend, directly or indirectly, on the monitor with the given ID.
+func dependents(id string) []Monitor {
+	monitors, err := getMonitors()
+	if err != nil {
+		log.Println("get monitors", err)
+		return nil
+	}
+	found := []Monitor{}
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, m := range monitors {
+			if seen[m.ID] || !slices.Contains(m.Parents, current) {
+				continue
+			}
+			seen[m.ID] = true
+			found = append(found, m)
+			queue = append(queue, m.ID)
+		}
+	}
+	return found
+}
+
+// validateParents confirms that the parents of the monitor exist and do not lead back to the monitor.
+func (m *Monitor) validateParents() error {
+	monitors, err := getMonitors()
+	if err != nil {
+		return err
+	}
+	byID := map[string]Monitor{}
+	for _, monitor := range monitors {
+		byID[monitor.ID] = monitor
+	}
+	byID[m.ID] = *m
+	return m.checkParents(m.ID, byID)
+}
+
+// checkParents confirms that the parents of the monitor, found in monitors under key, are in monitors and do
+// not lead back to the monitor. Monitors are keyed by ID, or by name where parents are names as in the
+// config file.
+func (m *Monitor) checkParents(key string, monitors map[string]Monitor) error {
+	queue := slices.Clone(m.Parents)
+	seen := map[string]bool{}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == key {
+			return errDependencyCycle
+		}
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		parent, ok := monitors[current]
+		if !ok {
+			return errors.New("no such parent monitor " + current)
+		}
+		queue = append(queue, parent.Parents...)
+	}
+	return nil
+}
+
+// sendRootCauseNotification sends the down and recovery notifications of a parent monitor to its notifiers
+// and those of all monitors that depend on it, so that the channels told of the outage also hear it resolved.
+// Down notifications name the dependent monitors and which of them have failed a check since.
+func (m *Monitor) sendRootCauseNotification(ctx context.Context, status Status, children []Monitor) []string {
+	root := *m
+	names := make([]string, 0, len(children))
+	unreachable := []string{}
+	for _, child := range children {
+		names = append(names, child.Name)
+		for _, n := range child.Notifiers {
+			if !slices.Contains(root.Notifiers, n) {
+				root.Notifiers = append(root.Notifiers, n)
+			}
+		}
+		if childStatus, err := getStatus(child.ID); err == nil && childStatus.Unreachable {
+			unreachable = append(unreachable, child.Name)
+		}
+	}
+	if status.StatusCode != m.StatusOK {
+		status.Status += " (root cause; " + strconv.Itoa(len(children)) + " dependent monitors: " +
+			strings.Join(names, ", ")
+		if len(unreachable) > 0 {
+			status.Status += "; unreachable: " + strings.Join(unreachable, ", ")
+		}
+		status.Status += ")"
+	}
+	log.Println("root cause notification", m.Name, status.Status)
+	return root.sendStatusNotification(ctx, status)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckParents(t *testing.T) {
+	monitors := map[string]Monitor{
+		"a": {ID: "a"},
+		"b": {ID: "b", Parents: []string{"a"}},
+		"c": {ID: "c", Parents: []string{"b"}},
+		"d": {ID: "d", Parents: []string{"b", "c"}},
+	}
+	tests := []struct {
+		name    string
+		monitor Monitor
+		err     error
+		missing bool
+	}{
+		{"no parents", Monitor{ID: "e"}, nil, false},
+		{"chain", Monitor{ID: "e", Parents: []string{"c"}}, nil, false},
+		{"shared ancestors", Monitor{ID: "e", Parents: []string{"c", "d"}}, nil, false},
+		{"self", Monitor{ID: "a", Parents: []string{"a"}}, errDependencyCycle, false},
+		{"cycle", Monitor{ID: "a", Parents: []string{"c"}}, errDependencyCycle, false},
+		{"missing parent", Monitor{ID: "e", Parents: []string{"x"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			byID := map[string]Monitor{}
+			for id, m := range monitors {
+				byID[id] = m
+			}
+			byID[tt.monitor.ID] = tt.monitor
+			err := tt.monitor.checkParents(tt.monitor.ID, byID)
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("checkParents() = %v, want %v", err, tt.err)
+				}
+			case tt.missing:
+				if err == nil {
+					t.Error("checkParents() accepted a missing parent")
+				}
+			case err != nil:
+				t.Errorf("checkParents() = %v", err)
+			}
+		})
+	}
+}
+
+func TestDependents(t *testing.T) {
+	testDB(t, backendBolt)
+	for _, m := range []Monitor{
+		{ID: "a", Name: "a"},
+		{ID: "b", Name: "b", Parents: []string{"a"}},
+		{ID: "c", Name: "c", Parents: []string{"b"}},
+		{ID: "d", Name: "d", Parents: []string{"a", "c"}},
+		{ID: "e", Name: "e"},
+	} {
+		if err := store.SaveMonitor(m, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{"a", []string{"b", "c", "d"}},
+		{"b", []string{"c", "d"}},
+		{"d", []string{}},
+		{"e", []string{}},
+	}
+	for _, tt := range tests {
+		got := []string{}
+		for _, m := range dependents(tt.id) {
+			got = append(got, m.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("dependents(%s) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestDownParentSharesCheck(t *testing.T) {
+	testDB(t, backendBolt)
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	parent := Monitor{ID: "parent", Name: "gateway", Type: HTTP, URL: server.URL, Timeout: "5s", StatusOK: 200,
+		Active: true}
+	if err := store.SaveMonitor(parent, false); err != nil {
+		t.Fatal(err)
+	}
+	parentChecks.Lock()
+	clear(parentChecks.checks)
+	parentChecks.Unlock()
+	child := Monitor{ID: "child", Name: "app", Parents: []string{"parent"}}
+	results := make([]string, 5)
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Go(func() {
+			results[i] = child.downParent(context.Background())
+		})
+	}
+	wg.Wait()
+	for i, got := range results {
+		if got != "gateway" {
+			t.Errorf("child %d: downParent() = %q, want gateway", i, got)
+		}
+	}
+	if got := child.downParent(context.Background()); got != "gateway" {
+		t.Errorf("downParent() = %q from the shared result, want gateway", got)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("parent checked %d times, want once", got)
+	}
+}
+
+func TestRootCauseNotification(t *testing.T) {
+	testDB(t, backendBolt)
+	var mu sync.Mutex
+	received := map[string][]string{}
+	for _, name := range []string{"ops", "web", "api"} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var message DiscordMessage
+			if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			received[name] = append(received[name], message.Embeds[1].Description)
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		if err := store.CreateNotifier(name, Discord, []byte(`{"name":"`+name+`","url":"`+server.URL+`"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parent := Monitor{ID: "parent", Name: "gateway", Type: HTTP, Freq: "1m", StatusOK: 200, Active: true,
+		Notifiers: []string{"ops"}}
+	for _, m := range []Monitor{
+		parent,
+		{ID: "web", Name: "web", Type: HTTP, Freq: "1m", StatusOK: 200, Parents: []string{"parent"},
+			Notifiers: []string{"web", "ops"}},
+		{ID: "api", Name: "api", Type: HTTP, Freq: "1m", StatusOK: 200, Parents: []string{"parent"},
+			Notifiers: []string{"api"}},
+	} {
+		if err := store.SaveMonitor(m, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only web has failed a check since the gateway went down
+	if err := saveStatus(Status{MonitorID: "web", Site: "web", StatusCode: 503, Unreachable: true,
+		Status: "unreachable (parent gateway down)"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	options := recordOptions{Notify: true}
+	parent.record(context.Background(), Status{Time: now, StatusCode: 503, Status: "503 Service Unavailable"}, options)
+	parent.record(context.Background(), Status{Time: now.Add(time.Minute), StatusCode: 200, Status: "200 OK"}, options)
+	down := "503 Service Unavailable (root cause; 2 dependent monitors: api, web; unreachable: web)"
+	for _, name := range []string{"ops", "web", "api"} {
+		got := received[name]
+		if len(got) != 2 || !strings.HasPrefix(got[0], down) || !strings.HasPrefix(got[1], "200 OK (down for") {
+			t.Errorf("%s received %q, want the root cause and its recovery", name, got)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 type DisordNotifier struct {
 	Name string `json:"name,omitempty"`
 	URL  string `json:"url,omitempty"`
+	Team string `json:"team,omitempty"`
 }
 
 // DiscordMessage represents the payload structure used to send messages to a Discord webhook.
@@ -135,3 +136,22 @@ func sendDiscordTestNotification(ctx context.Context, notification []byte) error
 	}
 	return discord.Send(ctx, data)
 }
+
+func sendDiscordMessageNotification(ctx context.Context, notification []byte, title, message string) error {
+	var discord DisordNotifier
+	if err := json.Unmarshal(notification, &discord); err != nil {
+		return err
+	}
+	data := DiscordMessage{
+		Content:  title,
+		Username: "Uptime",
+		Embeds: []DiscordEmbed{
+			{
+				Title:       title,
+				Color:       discordBlue,
+				Description: message,
+			},
+		},
+	}
+	return discord.Send(ctx, data)
+}
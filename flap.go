@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// MonitorState represents the recent state history of a monitor.
+type MonitorState struct {
+	Transitions []time.Time
+	Flapping    bool
+	FlapStart   time.Time
+	FastRecheck bool
+	UpSince     time.Time
+	Intervals   []IntervalChange
+	Incident    uint64 // ID of the open incident
+
+	CertNotified time.Time // last certificate expiry notification
+}
+
+// flapLimits returns the number of transitions and the window used to detect flapping.
+func (m *Monitor) flapLimits() (int, time.Duration) {
+	threshold := m.FlapThreshold
+	if threshold < 1 {
+		threshold = defaultFlapThreshold
+	}
+	window, err := time.ParseDuration(m.FlapWindow)
+	if err != nil || window <= 0 {
+		window = defaultFlapWindow
+	}
+	return threshold, window
+}
+
+// detectFlapping records a state transition and updates the flapping state of the monitor.
+// It returns true if per transition notifications should be held.
+func (m *Monitor) detectFlapping(ctx context.Context, oldStatus, newStatus Status, notify bool) bool {
+	state, err := getState(m.ID)
+	if err != nil {
+		log.Println("get monitor state", m.Name, err)
+		return false
+	}
+	threshold, window := m.flapLimits()
+	changed := false
+	before := len(state.Transitions)
+	state.Transitions = slices.DeleteFunc(state.Transitions, func(t time.Time) bool {
+		return newStatus.Time.Sub(t) > window
+	})
+	if len(state.Transitions) != before {
+		changed = true
+	}
+	if !oldStatus.Time.IsZero() && (oldStatus.StatusCode == m.StatusOK) != (newStatus.StatusCode == m.StatusOK) {
+		state.Transitions = append(state.Transitions, newStatus.Time)
+		changed = true
+	}
+	switch {
+	case !state.Flapping && len(state.Transitions) > threshold:
+		state.Flapping = true
+		state.FlapStart = newStatus.Time
+		log.Println("monitor flapping", m.Name, len(state.Transitions), "transitions in", window)
+		if notify {
+			m.sendMessageNotification(ctx, "Uptime Monitor Flapping",
+				m.Name+" changed state "+strconv.Itoa(len(state.Transitions))+" times in "+window.String()+
+					"; notifications are held until it is stable")
+		}
+	case state.Flapping && len(state.Transitions) == 0:
+		state.Flapping = false
+		log.Println("monitor stable", m.Name, newStatus.Status)
+		if notify {
+			m.sendMessageNotification(ctx, "Uptime Monitor Stable",
+				m.Name+" is stable after flapping for "+newStatus.Time.Sub(state.FlapStart).Round(time.Second).String()+
+					"; current status "+newStatus.Status)
+		}
+	default:
+		if !changed {
+			return state.Flapping
+		}
+	}
+	if err := saveState(m.ID, state); err != nil {
+		log.Println("save monitor state", m.Name, err)
+	}
+	return state.Flapping
+}
+
+func (m *Monitor) sendMessageNotification(ctx context.Context, title, message string) []string {
+	sent := []string{}
+	for _, n := range m.Notifiers {
+		kind, notification, err := getNotify(n)
+		if err != nil {
+			log.Println("get notification for monitor", m.Name, n, err)
+			continue
+		}
+		switch kind {
+		case Slack:
+			err = sendSlackMessageNotification(ctx, notification, title, message)
+		case Discord:
+			err = sendDiscordMessageNotification(ctx, notification, title, message)
+		case MailGun:
+			err = sendMailGunMessageNotification(ctx, notification, title, message)
+		default:
+			err = errInvalidNoficationType
+		}
+		if err != nil {
+			log.Println("send message notification", err)
+			continue
+		}
+		sent = append(sent, notifierName(notification))
+		log.Println("sent", kind, "message notification for", m.Name, title)
+	}
+	return sent
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFlapLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		monitor   Monitor
+		threshold int
+		window    time.Duration
+	}{
+		{"defaults", Monitor{}, defaultFlapThreshold, defaultFlapWindow},
+		{"configured", Monitor{FlapThreshold: 3, FlapWindow: "10m"}, 3, 10 * time.Minute},
+		{"invalid window", Monitor{FlapThreshold: 3, FlapWindow: "soon"}, 3, defaultFlapWindow},
+		{"negative", Monitor{FlapThreshold: -1, FlapWindow: "-5m"}, defaultFlapThreshold, defaultFlapWindow},
+	}
+	for _, tt := range tests {
+		threshold, window := tt.monitor.flapLimits()
+		if threshold != tt.threshold || window != tt.window {
+			t.Errorf("%s: flapLimits() = %d, %v, want %d, %v", tt.name, threshold, window, tt.threshold, tt.window)
+		}
+	}
+}
+
+func TestDetectFlapping(t *testing.T) {
+	testDB(t, backendBolt)
+	m := Monitor{ID: "flappy", Name: "flappy", StatusOK: 200, FlapThreshold: 3, FlapWindow: "10m"}
+	start := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		minute int
+		code   int
+		want   bool
+	}{
+		{0, 200, false},
+		{1, 500, false}, // transition 1
+		{2, 200, false}, // 2
+		{3, 200, false},
+		{4, 500, false}, // 3
+		{5, 200, true},  // 4, over the threshold
+		{6, 200, true},
+		{12, 200, true}, // the first transition expired, still held
+		{16, 200, false},
+	}
+	previous := Status{}
+	for _, step := range steps {
+		status := Status{Time: start.Add(time.Duration(step.minute) * time.Minute), StatusCode: step.code}
+		if got := m.detectFlapping(context.Background(), previous, status, false); got != step.want {
+			t.Fatalf("minute %d: detectFlapping() = %v, want %v", step.minute, got, step.want)
+		}
+		previous = status
+	}
+	state, err := getState(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Flapping || len(state.Transitions) != 0 {
+		t.Errorf("state after settling = %+v, want stable without transitions", state)
+	}
+}
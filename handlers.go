@@ -4,14 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -32,11 +36,18 @@ func mainPage(w http.ResponseWriter, r *http.Request) {
 	if err := layout("Uptime", []g.Node{
 		h.H2(g.Text("Uptime Status")),
 		h.Br(nil),
-		g.If(isAdmin(r), linkButton("/monitor/new", "New Monitor")),
+		g.If(hasRole(r, roleEditor), linkButton("/monitor/new", "New Monitor")),
 		linkButton("notifications/", "Notifications"),
-		linkButton("/logs", "View Logs"),
+		linkButton("/maintenance/", "Maintenance"),
+		linkButton("/incidents/", "Incidents"),
+		g.If(isAdmin(r), linkButton("/agents/", "Agents")),
+		g.If(isAdmin(r), linkButton("/database/", "Database")),
+		g.If(isAdmin(r), linkButton("/audit/", "Audit Log")),
+		g.If(isAdmin(r), linkButton("/logs", "View Logs")),
+		linkButton("/scheduler", "Scheduler"),
 		linkButton("/logout", "Logout"),
 		linkButton("/user/", "User Admin"),
+		linkButton("/tokens/", "API Tokens"),
 		h.Button(
 			g.Attr("type", "button"),
 			g.Attr("onclick", "document.getElementById('about').showModal()"),
@@ -71,6 +82,38 @@ func logs(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+func schedulerStatus(w http.ResponseWriter, _ *http.Request) {
+	stats := checks.stats()
+	if err := layout("Scheduler", []g.Node{
+		h.H2(g.Text("Check Scheduler")),
+		linkButton("/scheduler", "Refresh"),
+		linkButton("/", "Home"),
+		h.Br(), h.Br(),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("Monitors")),
+				h.Th(g.Text("Workers")),
+				h.Th(g.Text("Per Host")),
+				h.Th(g.Text("Busy")),
+				h.Th(g.Text("Queue Depth")),
+				h.Th(g.Text("Check Lag")),
+				h.Th(g.Text("Max Lag")),
+			),
+			h.Tr(
+				h.Td(g.Text(strconv.Itoa(stats.Monitors))),
+				h.Td(g.Text(strconv.Itoa(stats.Workers))),
+				h.Td(g.Text(strconv.Itoa(stats.HostWorkers))),
+				h.Td(g.Text(strconv.Itoa(stats.Busy))),
+				h.Td(g.Text(strconv.Itoa(stats.QueueDepth))),
+				h.Td(g.Text(stats.Lag.Round(time.Millisecond).String())),
+				h.Td(g.Text(stats.MaxLag.Round(time.Millisecond).String())),
+			),
+		),
+	}).Render(w); err != nil {
+		log.Println("render error", err)
+	}
+}
+
 func logout(w http.ResponseWriter, _ *http.Request) {
 	if err := cookie.Clear(w, cookieName, false); err != nil {
 		log.Println("clear cookie", err)
@@ -107,22 +150,75 @@ func login(w http.ResponseWriter, r *http.Request) {
 	}
 	if !validateUser(user) {
 		log.Println("unauthorized user")
+		recordAudit(r, AuditEntry{User: user.Name, Action: auditLoginFailed, Kind: "session", Target: user.Name})
 		http.Error(w, "unauthozied", http.StatusUnauthorized)
 		return
 	}
-	sessionUser := SessionUser{
-		Name:  user.Name,
-		Admin: checkAdmin(user.Name),
-	}
-	data, err := json.Marshal(sessionUser)
-	if err != nil {
-		log.Println("marshal error", err)
+	if err := saveSession(w, SessionUser{Name: user.Name}); err != nil {
+		log.Println("save session", err)
 		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
 		return
 	}
-	if err := cookie.Save(w, cookieName, data); err != nil {
-		log.Println("marshal error", err)
-		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
+	recordAudit(r, AuditEntry{User: user.Name, Action: auditLogin, Kind: "session", Target: user.Name})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// setupLock serializes the creation of the first admin.
+var setupLock sync.Mutex
+
+func setupPage(w http.ResponseWriter, r *http.Request) {
+	if !needsSetup() {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	if err := layout("Setup", []g.Node{
+		h.H2(g.Text("Welcome to Uptime")),
+		h.P(g.Text("Create the first administrator to get started.")),
+		h.Form(h.Class("center"),
+			h.Action("/setup"),
+			h.Method("POST"),
+			h.Table(
+				inputTableRow("Name", "name", "text", "", "40"),
+				inputTableRow("Pass", "pass", "password", "", "40"),
+				inputTableRow("Confirm", "confirm", "password", "", "40"),
+			),
+			submitButton("Create Admin"),
+		),
+	}).Render(w); err != nil {
+		log.Println("render error", err)
+	}
+}
+
+func setup(w http.ResponseWriter, r *http.Request) {
+	setupLock.Lock()
+	defer setupLock.Unlock()
+	if !needsSetup() {
+		http.Error(w, "setup already complete", http.StatusForbidden)
+		return
+	}
+	user := User{
+		Name: strings.TrimSpace(r.FormValue("name")),
+		Pass: r.FormValue("pass"),
+		Role: roleAdmin,
+	}
+	if user.Name == "" || user.Pass == "" {
+		displayError(w, errors.New("name and pass are required"))
+		return
+	}
+	if user.Pass != r.FormValue("confirm") {
+		displayError(w, errors.New("passwords do not match"))
+		return
+	}
+	if err := insertUser(user); err != nil {
+		displayError(w, err)
+		return
+	}
+	log.Println("setup: created admin", user.Name)
+	recordAudit(r, AuditEntry{User: user.Name, Action: auditCreate, Kind: "user", Target: user.Name,
+		Changes: auditDiff(nil, user), Detail: "first run setup"})
+	if err := saveSession(w, SessionUser{Name: user.Name}); err != nil {
+		log.Println("save session", err)
+		http.Redirect(w, r, "/login", http.StatusFound)
 		return
 	}
 	http.Redirect(w, r, "/", http.StatusFound)
@@ -131,19 +227,20 @@ func login(w http.ResponseWriter, r *http.Request) {
 func admin(w http.ResponseWriter, r *http.Request) {
 	var logins []User
 
-	data, err := sessionUser(r)
+	data, err := currentUser(r)
 	if err != nil {
 		return
 	}
-	if data.Admin {
+	manager := data.can(roleAdmin)
+	if manager {
 		logins = getUsers()
 	} else {
-		logins = append(logins, getUser(data.Name))
+		logins = append(logins, data)
 	}
 	if err := layout("Admin", []g.Node{
 		container(true,
 			h.H2(g.Text("Admin Page")),
-			g.If(data.Admin,
+			g.If(manager,
 				h.Button(
 					g.Attr("type", "button"),
 					g.Attr("onclick", "document.getElementById('new').showModal()"),
@@ -152,7 +249,7 @@ func admin(w http.ResponseWriter, r *http.Request) {
 			),
 			linkButton("/", "Home"),
 			h.Br(nil), h.Br(nil),
-			userTable(logins),
+			userTable(logins, manager),
 		),
 		newUserDialog(),
 	}).Render(w); err != nil {
@@ -182,10 +279,10 @@ func editUser(w http.ResponseWriter, r *http.Request) {
 					g.Attr("size", "40"),
 				),
 			),
-			h.Div(
-				h.Label(g.Text("Admin")),
-				checkbox("admin", user.Admin),
-			),
+			g.If(isAdmin(r), h.Table(
+				roleRow(user.role()),
+				inputTableRow("Teams (comma separated)", "teams", "text", strings.Join(user.Teams, ","), "40"),
+			)),
 			h.Div(
 				linkButton("/user/", "Cancel"),
 				submitButton("Edit"),
@@ -198,10 +295,19 @@ func editUser(w http.ResponseWriter, r *http.Request) {
 
 func deleteUser(w http.ResponseWriter, r *http.Request) {
 	user := r.PathValue("user")
+	before := getUser(user)
+	if before.can(roleAdmin) && remainingAdmins(user) == 0 {
+		displayError(w, errors.New("cannot delete the last admin"))
+		return
+	}
 	if err := removeUser(user); err != nil {
 		displayError(w, err)
 		return
 	}
+	if err := revokeUserTokens(user); err != nil {
+		log.Println("revoke api tokens", user, err)
+	}
+	auditChange(r, auditDelete, "user", user, "", before, nil)
 	http.Redirect(w, r, "/user/", http.StatusFound)
 }
 
@@ -210,19 +316,23 @@ func addUser(w http.ResponseWriter, r *http.Request) {
 		displayError(w, err)
 		return
 	}
-	user := User{
-		Name: r.FormValue("name"),
-		Pass: r.FormValue("pass"),
+	role, err := parseRole(r.FormValue("role"))
+	if err != nil {
+		displayError(w, err)
+		return
 	}
-	admin := r.FormValue("admin")
-	if admin == "on" {
-		user.Admin = true
+	user := User{
+		Name:  r.FormValue("name"),
+		Pass:  r.FormValue("pass"),
+		Role:  role,
+		Teams: splitList(r.FormValue("teams")),
 	}
-	log.Println("add user", user, admin)
+	log.Println("add user", user.Name, user.Role, user.Teams)
 	if err := insertUser(user); err != nil {
 		displayError(w, err)
 		return
 	}
+	auditChange(r, auditCreate, "user", user.Name, "", nil, user)
 	http.Redirect(w, r, "/user/", http.StatusFound)
 }
 
@@ -235,15 +345,27 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	user.Pass = r.FormValue("pass")
-	admin := r.FormValue("admin")
-	if admin == "on" {
-		user.Admin = true
+	before := getUser(user.Name)
+	user.Role, user.Teams = before.role(), before.Teams
+	// only admins change roles and teams; users change their own password
+	if isAdmin(r) {
+		role, err := parseRole(r.FormValue("role"))
+		if err != nil {
+			displayError(w, err)
+			return
+		}
+		if role != roleAdmin && before.can(roleAdmin) && remainingAdmins(user.Name) == 0 {
+			displayError(w, errors.New("cannot remove the role of the last admin"))
+			return
+		}
+		user.Role, user.Teams = role, splitList(r.FormValue("teams"))
 	}
 	if err := modifyUser(user); err != nil {
 		log.Println("add user", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	auditChange(r, auditUpdate, "user", user.Name, "", before, getUser(user.Name))
 	http.Redirect(w, r, "/user/", http.StatusFound)
 }
 
@@ -258,14 +380,18 @@ func displayError(w http.ResponseWriter, err error) {
 	}
 }
 
-func newMonitor(w http.ResponseWriter, _ *http.Request) {
+func newMonitor(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
 	notifications := getAllNotifications()
 	notifyCheckboxes := make([]g.Node, 0, len(notifications)+1)
 	for _, n := range notifications {
 		checkbox := h.Input(
 			h.Type("checkbox"),
-			h.Name(n.Name),
-			g.Text(n.Name),
+			h.Name(n.ID),
 		)
 		notifyCheckboxes = append(notifyCheckboxes, checkbox, g.Text(n.Name))
 	}
@@ -278,6 +404,15 @@ func newMonitor(w http.ResponseWriter, _ *http.Request) {
 				inputTableRow("Name", "name", "text", "", "60"),
 				inputTableRow("URL", "url", "text", "", "60"),
 				inputTableRow("OK Status", "statusok", "number", "200", "60"),
+				inputTableRow("Group", "group", "text", "", "60"),
+				teamRow(user, ""),
+				inputTableRow("Flap Threshold", "flapthreshold", "number", "", "60"),
+				inputTableRow("Flap Window", "flapwindow", "text", "", "60"),
+				inputTableRow("Down Recheck Interval", "downfreq", "text", "", "60"),
+				inputTableRow("Stable For", "stablefor", "text", "", "60"),
+				inputTableRow("Agent Locations (comma separated)", "locations", "text", "", "60"),
+				inputTableRow("Quorum", "quorum", "number", "", "60"),
+				inputTableRow("History Retention (e.g. 30d)", "retention", "text", "", "60"),
 				radioGroup("Frequency", "freq", []Radio{
 					{"1m", "1 Minute", false},
 					{"5m", "5 Minutes", false},
@@ -294,6 +429,9 @@ func newMonitor(w http.ResponseWriter, _ *http.Request) {
 					{"http", "Website", false},
 					{"ping", "Ping", false},
 				}),
+				scheduleRows(Schedule{}),
+				parentRows("", nil),
+				alertRows(Monitor{}),
 				h.Tr(
 					h.Td(h.Label(g.Text("Notifications"))),
 					h.Td(g.Group(notifyCheckboxes)),
@@ -319,11 +457,13 @@ func createMonitor(w http.ResponseWriter, r *http.Request) {
 		Freq:    r.FormValue("freq"),
 		Timeout: r.FormValue("timeout"),
 		Type:    MonitorType(r.FormValue("type")),
+		Group:   strings.TrimSpace(r.FormValue("group")),
+		Team:    strings.TrimSpace(r.FormValue("team")),
 		Active:  true,
 	}
-	for key, value := range r.Form {
-		if key == "notifications" {
-			monitor.Notifiers = append(monitor.Notifiers, value...)
+	for _, n := range getAllNotifications() {
+		if r.FormValue(n.ID) == "on" {
+			monitor.Notifiers = append(monitor.Notifiers, n.ID)
 		}
 	}
 	log.Println(monitor)
@@ -334,6 +474,39 @@ func createMonitor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	monitor.StatusOK = ok
+	monitor.Schedule, err = scheduleFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := adaptiveFromForm(r, &monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := locationsFromForm(r, &monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := flapFromForm(r, &monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := alertsFromForm(r, &monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if value := strings.TrimSpace(r.FormValue("retention")); value != "" {
+		if _, err := parseRetention(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		monitor.Retention = value
+	}
+	monitor.Parents = r.Form["parent"]
+	if err := monitor.validateParents(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if monitor.Type == PING {
 		displayError(w, errNotImplemented)
 		return
@@ -347,13 +520,24 @@ func createMonitor(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if created, err := getMonitorByName(monitor.Name); err == nil {
+		auditChange(r, auditCreate, "monitor", created.Name, created.ID, nil, created)
+	}
 	reset <- syscall.SIGHUP
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func editMonitor(w http.ResponseWriter, r *http.Request) {
-	site := r.PathValue("site")
-	monitor, err := getMonitor(site)
+	monitor, err := getMonitor(r.PathValue("site"))
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if isManagedMonitor(monitor.Name) {
+		displayError(w, errManaged)
+		return
+	}
+	user, err := currentUser(r)
 	if err != nil {
 		displayError(w, err)
 		return
@@ -363,9 +547,8 @@ func editMonitor(w http.ResponseWriter, r *http.Request) {
 	for _, n := range notifications {
 		checkbox := h.Input(
 			h.Type("checkbox"),
-			h.Name(n.Name),
-			g.Text(n.Name),
-			g.If(slices.Contains(monitor.Notifiers, n.Name), h.Checked()),
+			h.Name(n.ID),
+			g.If(slices.Contains(monitor.Notifiers, n.ID), h.Checked()),
 		)
 		notifyCheckboxes = append(notifyCheckboxes, checkbox, g.Text(n.Name))
 	}
@@ -373,7 +556,7 @@ func editMonitor(w http.ResponseWriter, r *http.Request) {
 		h.H2(g.Text("Edit Monitor")),
 		h.Form(
 			h.Method("post"),
-			h.Action("/monitor/edit/"+monitor.Name),
+			h.Action("/monitor/edit/"+monitor.ID),
 			h.Table(
 				h.Tr(
 					h.Td(h.Label(h.For("name"), g.Text("Name"))),
@@ -405,6 +588,16 @@ func editMonitor(w http.ResponseWriter, r *http.Request) {
 						g.Attr("size", "60"),
 					)),
 				),
+				inputTableRow("Group", "group", "text", monitor.Group, "60"),
+				teamRow(user, monitor.Team),
+				inputTableRow("Flap Threshold", "flapthreshold", "number", flapThreshold(monitor), "60"),
+				inputTableRow("Flap Window", "flapwindow", "text", monitor.FlapWindow, "60"),
+				inputTableRow("Down Recheck Interval", "downfreq", "text", monitor.DownFreq, "60"),
+				inputTableRow("Stable For", "stablefor", "text", monitor.StableFor, "60"),
+				inputTableRow("Agent Locations (comma separated)", "locations", "text",
+					strings.Join(monitor.Locations, ","), "60"),
+				inputTableRow("Quorum", "quorum", "number", quorum(monitor), "60"),
+				inputTableRow("History Retention (e.g. 30d)", "retention", "text", monitor.Retention, "60"),
 				radioGroup("Frequency", "freq", []Radio{
 					{"1m", "1 Minute", monitor.Freq == "1m"},
 					{"5m", "5 Minutes", monitor.Freq == "5m"},
@@ -421,6 +614,9 @@ func editMonitor(w http.ResponseWriter, r *http.Request) {
 					{"http", "Website", monitor.Type == "http"},
 					{"ping", "Ping", monitor.Type == "ping"},
 				}),
+				scheduleRows(monitor.Schedule),
+				parentRows(monitor.ID, monitor.Parents),
+				alertRows(monitor),
 				h.Tr(
 					h.Td(h.Label(g.Text("Notifications"))),
 					h.Td(g.Group(notifyCheckboxes)),
@@ -435,11 +631,19 @@ func editMonitor(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteSite(w http.ResponseWriter, r *http.Request) {
-	monitor := r.PathValue("site")
+	monitor, err := getMonitor(r.PathValue("site"))
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if isManagedMonitor(monitor.Name) {
+		displayError(w, errManaged)
+		return
+	}
 	if err := layout("Delete Monitor", []g.Node{
-		h.H2(g.Text("Delete Monitor " + monitor)),
+		h.H2(g.Text("Delete Monitor " + monitor.Name)),
 		h.Form(
-			h.Action("/monitor/delete/"+monitor),
+			h.Action("/monitor/delete/"+monitor.ID),
 			h.Method("post"),
 			h.Input(
 				h.Type("checkbox"),
@@ -461,6 +665,15 @@ func deleteSite(w http.ResponseWriter, r *http.Request) {
 
 func deleteMonitor(w http.ResponseWriter, r *http.Request) {
 	site := r.PathValue("site")
+	before, err := getMonitor(site)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if isManagedMonitor(before.Name) {
+		displayError(w, errManaged)
+		return
+	}
 	if err := r.ParseForm(); err != nil {
 		log.Println("parse form", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -472,18 +685,26 @@ func deleteMonitor(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	entry := AuditEntry{Action: auditDelete, Kind: "monitor", Target: before.Name, TargetID: site,
+		Changes: auditDiff(before, nil)}
 	if r.FormValue("history") != "" {
 		if err := deleteHistory(site); err != nil {
 			log.Println("delete history", site, err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		entry.Detail = "history deleted"
 	}
+	recordAudit(r, entry)
 	reset <- syscall.SIGHUP
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func updateMonitor(w http.ResponseWriter, r *http.Request) {
+	if isManagedMonitor(getMonitorName(r.PathValue("site"))) {
+		displayError(w, errManaged)
+		return
+	}
 	notifications := getAllNotifications()
 	if err := r.ParseForm(); err != nil {
 		log.Println("parse form", err)
@@ -491,11 +712,14 @@ func updateMonitor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	monitor := Monitor{
-		Name:    r.FormValue("name"),
+		ID:      r.PathValue("site"),
+		Name:    strings.TrimSpace(r.FormValue("name")),
 		URL:     r.FormValue("url"),
 		Freq:    r.FormValue("freq"),
 		Timeout: r.FormValue("timeout"),
 		Type:    MonitorType(r.FormValue("type")),
+		Group:   strings.TrimSpace(r.FormValue("group")),
+		Team:    strings.TrimSpace(r.FormValue("team")),
 		Active:  true,
 	}
 	ok, err := strconv.Atoi(r.FormValue("statusok"))
@@ -506,10 +730,43 @@ func updateMonitor(w http.ResponseWriter, r *http.Request) {
 	monitor.StatusOK = ok
 	// check notifications
 	for _, n := range notifications {
-		notification := r.FormValue(n.Name)
+		notification := r.FormValue(n.ID)
 		if notification == "on" {
-			monitor.Notifiers = append(monitor.Notifiers, n.Name)
+			monitor.Notifiers = append(monitor.Notifiers, n.ID)
+		}
+	}
+	monitor.Schedule, err = scheduleFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := adaptiveFromForm(r, &monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := locationsFromForm(r, &monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := flapFromForm(r, &monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := alertsFromForm(r, &monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if value := strings.TrimSpace(r.FormValue("retention")); value != "" {
+		if _, err := parseRetention(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		monitor.Retention = value
+	}
+	monitor.Parents = r.Form["parent"]
+	if err := monitor.validateParents(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 	if monitor.Type == PING {
 		displayError(w, errNotImplemented)
@@ -519,15 +776,118 @@ func updateMonitor(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid url", http.StatusBadRequest)
 		return
 	}
+	before, err := getMonitor(monitor.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err := saveMonitor(monitor, true); err != nil {
 		log.Println("new monitor", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	auditChange(r, auditUpdate, "monitor", monitor.Name, monitor.ID, before, monitor)
 	reset <- syscall.SIGHUP
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+func scheduleFromForm(r *http.Request) (Schedule, error) {
+	schedule := Schedule{
+		Cron:     strings.TrimSpace(r.FormValue("cron")),
+		TimeZone: strings.TrimSpace(r.FormValue("timezone")),
+		Start:    r.FormValue("start"),
+		End:      r.FormValue("end"),
+	}
+	for _, value := range r.Form["day"] {
+		day, err := strconv.Atoi(value)
+		if err != nil || day < int(time.Sunday) || day > int(time.Saturday) {
+			return schedule, errors.New("invalid day " + value)
+		}
+		schedule.Days = append(schedule.Days, time.Weekday(day))
+	}
+	return schedule, schedule.validate()
+}
+
+func flapFromForm(r *http.Request, monitor *Monitor) error {
+	if value := r.FormValue("flapthreshold"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 0 {
+			return errors.New("invalid flap threshold " + value)
+		}
+		monitor.FlapThreshold = threshold
+	}
+	if value := strings.TrimSpace(r.FormValue("flapwindow")); value != "" {
+		if window, err := time.ParseDuration(value); err != nil || window <= 0 {
+			return errors.New("invalid flap window " + value)
+		}
+		monitor.FlapWindow = value
+	}
+	return nil
+}
+
+func adaptiveFromForm(r *http.Request, monitor *Monitor) error {
+	if value := strings.TrimSpace(r.FormValue("downfreq")); value != "" {
+		if freq, err := time.ParseDuration(value); err != nil || freq <= 0 {
+			return errors.New("invalid down recheck interval " + value)
+		}
+		monitor.DownFreq = value
+	}
+	if value := strings.TrimSpace(r.FormValue("stablefor")); value != "" {
+		if stable, err := time.ParseDuration(value); err != nil || stable < 0 {
+			return errors.New("invalid stable for " + value)
+		}
+		monitor.StableFor = value
+	}
+	return nil
+}
+
+func alertsFromForm(r *http.Request, monitor *Monitor) error {
+	if value := strings.TrimSpace(r.FormValue("repeatalert")); value != "" {
+		if repeat, err := time.ParseDuration(value); err != nil || repeat <= 0 {
+			return errors.New("invalid repeat alert interval " + value)
+		}
+		monitor.RepeatAlert = value
+	}
+	if value := strings.TrimSpace(r.FormValue("escalateafter")); value != "" {
+		if escalate, err := time.ParseDuration(value); err != nil || escalate <= 0 {
+			return errors.New("invalid escalate after " + value)
+		}
+		monitor.EscalateAfter = value
+	}
+	monitor.EscalateTo = r.Form["escalate"]
+	return nil
+}
+
+func locationsFromForm(r *http.Request, monitor *Monitor) error {
+	for location := range strings.SplitSeq(r.FormValue("locations"), ",") {
+		if location = strings.TrimSpace(location); location != "" {
+			monitor.Locations = append(monitor.Locations, location)
+		}
+	}
+	if value := r.FormValue("quorum"); value != "" {
+		quorum, err := strconv.Atoi(value)
+		if err != nil || quorum < 0 || quorum > len(monitor.Locations)+1 {
+			return errors.New("invalid quorum " + value)
+		}
+		monitor.Quorum = quorum
+	}
+	return nil
+}
+
+func quorum(monitor Monitor) string {
+	if monitor.Quorum == 0 {
+		return ""
+	}
+	return strconv.Itoa(monitor.Quorum)
+}
+
+func flapThreshold(monitor Monitor) string {
+	if monitor.FlapThreshold == 0 {
+		return ""
+	}
+	return strconv.Itoa(monitor.FlapThreshold)
+}
+
 func history(w http.ResponseWriter, r *http.Request) {
 	site := r.PathValue("site")
 	duration := r.PathValue("duration")
@@ -544,15 +904,28 @@ func history(w http.ResponseWriter, r *http.Request) {
 	default:
 		timeFrame = day
 	}
-	history, err := getHistory([]string{"history", site}, timeFrame)
+	var history []Status
+	var rollups []Rollup
+	var err error
+	if timeFrame == day {
+		history, err = getHistory([]string{"history", site}, timeFrame)
+		slices.Reverse(history)
+	} else {
+		rollups, err = historyRollups(site, timeFrame)
+	}
 	if err != nil {
 		log.Println("get status", err)
 		http.Error(w, "unable to access database: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	slices.Reverse(history)
+	monitor, err := getMonitor(site)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	team := monitor.Team
 	if err := layout("History", []g.Node{
-		h.H2(g.Text("Uptime History")),
+		h.H2(g.Text("Uptime History: " + monitor.Name)),
 		h.Div(
 			linkButton("/monitor/history/"+site+"/day", "day"),
 			linkButton("/monitor/history/"+site+"/week", "week"),
@@ -560,18 +933,51 @@ func history(w http.ResponseWriter, r *http.Request) {
 			linkButton("/monitor/history/"+site+"/year", "year"),
 			linkButton("/monitor/history/"+site+"/all", "all time"),
 			linkButton("/", "Home"),
-			g.If(isAdmin(r), h.Button(h.Type("button"), h.Style("background:red"), g.Text("Purge Data"),
+			g.If(canManage(r, team), h.Button(h.Type("button"), h.Style("background:red"), g.Text("Purge Data"),
 				g.Attr("onclick", "document.getElementById('purge').showModal()"))),
 		),
-		g.If(history == nil, h.P(g.Text("No data for time period"))),
-		h.P(g.Text(strconv.Itoa(len(history)) + " records")),
-		historyTable(history),
+		h.Div(
+			linkButton("/monitor/history/"+site+"/export/csv", "Export CSV"),
+			linkButton("/monitor/history/"+site+"/export/ndjson", "Export NDJSON"),
+			g.If(canManage(r, team), h.Form(
+				h.Method("post"),
+				h.Action("/monitor/history/import/"+site),
+				h.EncType("multipart/form-data"),
+				h.Input(h.Type("file"), h.Name("file"), h.Accept(".ndjson"), h.Required()),
+				submitButton("Import NDJSON"),
+			)),
+		),
+		g.If(history == nil && rollups == nil, h.P(g.Text("No data for time period"))),
+		g.If(timeFrame == day, g.Group{
+			h.P(g.Text(strconv.Itoa(len(history)) + " records")),
+			historyTable(history),
+		}),
+		g.If(timeFrame != day, rollupTable(rollups, timeFrame == week)),
 		histPurgeDialog(site, time.Now().Add(-time.Hour*24*30).Format(time.DateOnly)),
 	}).Render(w); err != nil {
 		log.Println("render error", err)
 	}
 }
 
+// historyRollups returns the rollups of a monitor for a long time frame, newest first: hourly for a week,
+// daily beyond.
+func historyRollups(site string, timeFrame TimeFrame) ([]Rollup, error) {
+	since, err := time.Parse(time.RFC3339, string(getTime(timeFrame)))
+	if err != nil {
+		return nil, err
+	}
+	period := rollupDay
+	if timeFrame == week {
+		period = rollupHour
+	}
+	rollups, err := getRollups(site, period, since)
+	if len(rollups) == 0 {
+		return nil, err
+	}
+	slices.Reverse(rollups)
+	return rollups, err
+}
+
 func validateURL(s string) bool {
 	url, err := url.Parse(s)
 	if err != nil {
@@ -588,29 +994,39 @@ func validateURL(s string) bool {
 }
 
 func notifications(w http.ResponseWriter, r *http.Request) {
-	admin := isAdmin(r)
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	editor := user.can(roleEditor)
 	notifications := getAllNotifications()
 	rows := []g.Node{}
 	for _, n := range notifications {
+		managed := isManagedNotifier(n.Name)
+		manages := user.manages(n.Team)
 		row := h.Tr(
 			h.Td(g.Text(n.Name)),
 			h.Td(g.Text(string(n.Type))),
-			g.If(admin, h.Td(linkButton("/notifications/edit/"+n.Name, "Edit"))),
-			g.If(admin, h.Td(linkButton("/notifications/test/"+n.Name, "Test"))),
-			g.If(admin, h.Td(formButton("Delete", "/notifications/delete/"+n.Name))),
+			h.Td(g.Text(n.Team)),
+			g.If(manages && !managed, h.Td(linkButton("/notifications/edit/"+n.ID, "Edit"))),
+			g.If(manages, h.Td(linkButton("/notifications/test/"+n.ID, "Test"))),
+			g.If(manages && !managed, h.Td(formButton("Delete", "/notifications/delete/"+n.ID))),
+			g.If(manages && managed, h.Td(g.Text("managed by config"), g.Attr("colspan", "2"))),
 		)
 		rows = append(rows, row)
 	}
 	if err := layout("Notifications", []g.Node{
 		h.H1(g.Text("Notifications")),
-		g.If(admin, linkButton("/notifications/new", "New Notification")),
+		g.If(editor, linkButton("/notifications/new", "New Notification")),
 		linkButton("/", "Home"),
 		h.Br(), h.Br(),
 		h.Table(
 			h.Tr(
 				h.Th(g.Text("Name")),
 				h.Th(g.Text("Type")),
-				g.If(admin, h.Th(g.Text("Actions"), g.Attr("colspan", "3"))),
+				h.Th(g.Text("Team")),
+				g.If(editor, h.Th(g.Text("Actions"), g.Attr("colspan", "3"))),
 			),
 			g.Group(rows),
 		),
@@ -619,7 +1035,12 @@ func notifications(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func newNotification(w http.ResponseWriter, _ *http.Request) {
+func newNotification(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
 	if err := layoutExtra("New Notification", []g.Node{
 		h.H1(g.Text("New Notifications")),
 		h.Form(
@@ -627,6 +1048,7 @@ func newNotification(w http.ResponseWriter, _ *http.Request) {
 			h.Action("/notifications/new"),
 			h.Table(
 				inputTableRow("Name", "name", "text", "", "40"),
+				teamRow(user, ""),
 				radioGroup("Notification Type", "type", []Radio{
 					{"slack", "Slack", false},
 					{"discord", "Discord", false},
@@ -702,6 +1124,16 @@ func newNotification(w http.ResponseWriter, _ *http.Request) {
 
 func deleletNotification(w http.ResponseWriter, r *http.Request) {
 	notify := r.PathValue("notify")
+	_, before, err := getNotify(notify)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	name := notifierName(before)
+	if isManagedNotifier(name) {
+		displayError(w, errManaged)
+		return
+	}
 	if err := r.ParseForm(); err != nil {
 		displayError(w, err)
 		return
@@ -711,6 +1143,7 @@ func deleletNotification(w http.ResponseWriter, r *http.Request) {
 		displayError(w, err)
 		return
 	}
+	auditChange(r, auditDelete, "notifier", name, notify, before, nil)
 	http.Redirect(w, r, "/notifications/", http.StatusFound)
 }
 
@@ -720,31 +1153,41 @@ func createNotification(w http.ResponseWriter, r *http.Request) {
 		displayError(w, err)
 		return
 	}
+	name := r.FormValue("name")
+	team := strings.TrimSpace(r.FormValue("team"))
+	var id string
+	var notifier any
 	switch r.FormValue("type") {
 	case "slack":
 		slack := SlackNotifier{
-			Name:    r.FormValue("name"),
+			Name:    name,
 			Token:   r.FormValue("token"),
 			Channel: r.FormValue("channel"),
+			Team:    team,
 		}
 		log.Println("create slack notification", slack)
-		err = createNotify(slack.Name, Slack, slack)
+		id, err = createNotify(slack.Name, Slack, slack)
+		notifier = slack
 	case "discord":
 		discord := DisordNotifier{
-			Name: r.FormValue("name"),
+			Name: name,
 			URL:  r.FormValue("webhook"),
+			Team: team,
 		}
 		log.Println("create discord notification", discord)
-		err = createNotify(discord.Name, Discord, discord)
+		id, err = createNotify(discord.Name, Discord, discord)
+		notifier = discord
 	case "mailgun":
 		mailgun := MailGunNotifier{
-			Name:       r.FormValue("name"),
+			Name:       name,
 			APIKey:     r.FormValue("apikey"),
 			Domain:     r.FormValue("domain"),
 			Recipients: strings.Split(r.FormValue("recipients"), ","),
+			Team:       team,
 		}
 		log.Println("create mailgun notification", mailgun)
-		err = createNotify(mailgun.Name, MailGun, mailgun)
+		id, err = createNotify(mailgun.Name, MailGun, mailgun)
+		notifier = mailgun
 	default:
 		err = errors.New("not implemented")
 	}
@@ -752,6 +1195,7 @@ func createNotification(w http.ResponseWriter, r *http.Request) {
 		displayError(w, err)
 		return
 	}
+	auditChange(r, auditCreate, "notifier", name, id, nil, notifier)
 	reset <- syscall.SIGHUP
 	http.Redirect(w, r, "/notifications/", http.StatusFound)
 }
@@ -768,16 +1212,26 @@ func displayEditnotification(w http.ResponseWriter, r *http.Request) {
 		displayError(w, err)
 		return
 	}
+	if isManagedNotifier(notify.Name) {
+		displayError(w, errManaged)
+		return
+	}
 	table, hidden, err := notificationForm(notifyType, notification)
 	if err != nil {
 		displayError(w, err)
 		return
 	}
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
 	if err := layout("Edit Notification", []g.Node{
 		h.H1(g.Text("Edit Notification")),
 		h.H2(g.Text("Notifications Name: " + notify.Name)),
-		h.Form(h.Method("post"), h.Action("/notifications/edit/"+notify.Name),
+		h.Form(h.Method("post"), h.Action("/notifications/edit/"+n),
 			table,
+			h.Table(teamRow(user, notifierTeam(notification))),
 			hidden,
 			linkButton("/notifications/", "Cancel"),
 			submitButton("Update"),
@@ -788,6 +1242,10 @@ func displayEditnotification(w http.ResponseWriter, r *http.Request) {
 }
 
 func editNotification(w http.ResponseWriter, r *http.Request) {
+	if isManagedNotifier(getNotifierName(r.PathValue("notify"))) {
+		displayError(w, errManaged)
+		return
+	}
 	if err := r.ParseForm(); err != nil {
 		displayError(w, err)
 		return
@@ -867,104 +1325,142 @@ func editEmailNotification(w http.ResponseWriter, _ *http.Request) {
 
 func editSlackNotification(w http.ResponseWriter, r *http.Request) {
 	notification := SlackNotifier{
-		Name:    r.PathValue("notify"),
+		Name:    strings.TrimSpace(r.FormValue("name")),
 		Token:   r.FormValue("token"),
 		Channel: r.FormValue("channel"),
+		Team:    strings.TrimSpace(r.FormValue("team")),
 	}
-	if err := updateNotify(notification.Name, Slack, notification); err != nil {
-		displayError(w, err)
-		return
-	}
-	reset <- syscall.SIGHUP
-	http.Redirect(w, r, "/notifications/", http.StatusFound)
+	saveEditedNotification(w, r, Slack, notification.Name, notification)
 }
 
 func editDiscordNotification(w http.ResponseWriter, r *http.Request) {
 	notification := DisordNotifier{
-		Name: r.PathValue("notify"),
+		Name: strings.TrimSpace(r.FormValue("name")),
 		URL:  r.FormValue("webhook"),
+		Team: strings.TrimSpace(r.FormValue("team")),
 	}
-	if err := updateNotify(notification.Name, Discord, notification); err != nil {
-		displayError(w, err)
-		return
-	}
-	reset <- syscall.SIGHUP
-	http.Redirect(w, r, "/notifications/", http.StatusFound)
+	saveEditedNotification(w, r, Discord, notification.Name, notification)
 }
 
 func editMailgunNotification(w http.ResponseWriter, r *http.Request) {
 	notification := MailGunNotifier{
-		Name:       r.PathValue("notify"),
+		Name:       strings.TrimSpace(r.FormValue("name")),
 		APIKey:     r.FormValue("apikey"),
 		Domain:     r.FormValue("domain"),
 		Recipients: strings.Split(r.FormValue("email"), ","),
+		Team:       strings.TrimSpace(r.FormValue("team")),
+	}
+	saveEditedNotification(w, r, MailGun, notification.Name, notification)
+}
+
+// saveEditedNotification updates the notifier of the request and records the change in the audit log.
+func saveEditedNotification(w http.ResponseWriter, r *http.Request, kind NotifyType, name string, notification any) {
+	id := r.PathValue("notify")
+	_, before, err := getNotify(id)
+	if err != nil {
+		displayError(w, err)
+		return
 	}
-	if err := updateNotify(notification.Name, Slack, notification); err != nil {
+	if err := updateNotify(id, kind, notification); err != nil {
 		displayError(w, err)
 		return
 	}
+	auditChange(r, auditUpdate, "notifier", name, id, before, notification)
 	reset <- syscall.SIGHUP
 	http.Redirect(w, r, "/notifications/", http.StatusFound)
 }
 
 func details(w http.ResponseWriter, r *http.Request) {
+	renderDetails(w, r, nil)
+}
+
+// renderDetails displays the details page of a monitor with optional extra content.
+func renderDetails(w http.ResponseWriter, r *http.Request, extra g.Node) {
 	site := r.PathValue("site")
 	monitor, err := getMonitor(site)
 	if err != nil {
 		displayError(w, err)
 		return
 	}
-	history, err := getHistory([]string{"history", site}, all)
-	if err != nil {
+	// averages and uptime come from rollups; raw history is read for the status changes of the last day only
+	history, err := getHistory([]string{"history", site}, day)
+	if err != nil && !errors.Is(err, errPath) {
 		displayError(w, err)
 		return
 	}
 	history = compact(history)
-	details, err := getHistoryDetails(monitor.Name, monitor.StatusOK)
+	latest, err := getStatus(monitor.ID)
+	if err != nil && !errors.Is(err, errNoKey) {
+		log.Println("get status", monitor.Name, err)
+	}
+	details, err := getHistoryDetails(monitor.ID)
 	if err != nil {
 		displayError(w, err)
 		return
 	}
+	state, err := getState(monitor.ID)
+	if err != nil {
+		log.Println("get monitor state", monitor.Name, err)
+	}
+	managed := isManagedMonitor(monitor.Name)
 	var certExpiry, currentResponse g.Node
-	if len(history) > 0 {
-		currentResponse = h.Td(g.Text(history[0].ResponseTime.Round(time.Millisecond).String()))
-		certExpiry = h.Td(g.Text(strconv.Itoa(history[0].CertExpiry) + " days"))
+	if !latest.Time.IsZero() {
+		currentResponse = h.Td(g.Text(latest.ResponseTime.Round(time.Millisecond).String()))
+		certExpiry = h.Td(g.Text(strconv.Itoa(latest.CertExpiry) + " days"))
 	}
 	if err := layout("Details", []g.Node{
-		h.H2(g.Text(site)),
+		h.H2(g.Text(monitor.Name)),
 		h.P(h.A(h.Href(monitor.URL), g.Text(monitor.URL))),
+		g.If(len(monitor.Parents) > 0,
+			h.P(g.Text("Depends on: "+strings.Join(getMonitorNames(monitor.Parents), ", ")))),
+		g.If(monitor.Team != "", h.P(g.Text("Team: "+monitor.Team))),
+		g.If(managed, h.P(g.Text("Managed by the config file"))),
+		g.If(state.Flapping, h.P(flappingBadge(), g.Text(" since "+state.FlapStart.Local().Format(time.RFC822)))),
 		h.Div(
 			linkButton("/monitor/history/"+site+"/day", "History"),
-			g.If(isAdmin(r),
+			linkButton("/incidents/?monitor="+url.QueryEscape(site), "Incidents"),
+			g.If(canManage(r, monitor.Team) && !managed,
 				g.Group{
-					g.If(monitor.Active, linkButton("/monitor/pause/"+site, "Pause")),
-					g.If(!monitor.Active, linkButton("/monitor/resume/"+site, "Resume")),
+					g.If(monitor.Active, formButton("Pause", "/monitor/pause/"+site)),
+					g.If(!monitor.Active, formButton("Resume", "/monitor/resume/"+site)),
 					linkButton("/monitor/edit/"+site, "Edit"),
 					linkButton("/monitor/delete/"+site, "Delete"),
 				},
 			),
 			linkButton("/", "Home"),
 		),
+		g.If(canManage(r, monitor.Team), checkNowForm(site)),
+		extra,
 		h.Br(),
 		h.Table(
 			h.Tr(
 				h.Th(g.Text("Current Response")),
 				h.Th(g.Text("24 Hour Avg Response")),
 				h.Th(g.Text("30 Day Avg Response")),
+				h.Th(g.Text("30 Day p95 Response")),
 				h.Th(g.Text("24 Hour Uptime")),
 				h.Th(g.Text("30 Day Uptime")),
+				h.Th(g.Text("1 Year Uptime")),
 				h.Th(g.Text("Certificate Expiry")),
 			),
 			h.Tr(
 				currentResponse,
 				h.Td(g.Text(strconv.Itoa(details.Response24)+" ms")),
 				h.Td(g.Text(strconv.Itoa(details.Response30)+" ms")),
+				h.Td(g.Text(details.Month.Percentile(95).Round(time.Millisecond).String())),
 				h.Td(g.Text(strconv.FormatFloat(details.Uptime24, 'f', 2, 64)+" %")),
 				h.Td(g.Text(strconv.FormatFloat(details.Uptime30, 'f', 2, 64)+" %")),
+				h.Td(g.Text(strconv.FormatFloat(details.Year.Uptime(), 'f', 3, 64)+" %")),
 				certExpiry,
 			),
 		),
 		h.Br(),
+		timingTable(latest),
+		locationTable(monitor),
+		h.Br(),
+		scheduleTable(monitor, state),
+		h.Br(),
+		h.H3(g.Text("Status Changes, Last 24 Hours")),
 		compactHistoryTable(history, monitor.StatusOK),
 	}).Render(w); err != nil {
 		log.Println("render err", err)
@@ -972,35 +1468,45 @@ func details(w http.ResponseWriter, r *http.Request) {
 }
 
 func pauseMonitor(w http.ResponseWriter, r *http.Request) {
-	site := r.PathValue("site")
-	monitor, err := getMonitor(site)
+	monitor, err := getMonitor(r.PathValue("site"))
 	if err != nil {
 		displayError(w, err)
 		return
 	}
+	if isManagedMonitor(monitor.Name) {
+		displayError(w, errManaged)
+		return
+	}
+	before := monitor
 	monitor.Active = false
 	if err := saveMonitor(monitor, true); err != nil {
 		displayError(w, err)
 		return
 	}
+	auditChange(r, auditPause, "monitor", monitor.Name, monitor.ID, before, monitor)
 	reset <- syscall.SIGHUP
-	details(w, r)
+	http.Redirect(w, r, "/monitor/details/"+monitor.ID, http.StatusFound)
 }
 
 func resumeMonitor(w http.ResponseWriter, r *http.Request) {
-	site := r.PathValue("site")
-	monitor, err := getMonitor(site)
+	monitor, err := getMonitor(r.PathValue("site"))
 	if err != nil {
 		displayError(w, err)
 		return
 	}
+	if isManagedMonitor(monitor.Name) {
+		displayError(w, errManaged)
+		return
+	}
+	before := monitor
 	monitor.Active = true
 	if err := saveMonitor(monitor, true); err != nil {
 		displayError(w, err)
 		return
 	}
+	auditChange(r, auditResume, "monitor", monitor.Name, monitor.ID, before, monitor)
 	reset <- syscall.SIGHUP
-	details(w, r)
+	http.Redirect(w, r, "/monitor/details/"+monitor.ID, http.StatusFound)
 }
 
 func purgeHistory(w http.ResponseWriter, r *http.Request) {
@@ -1010,5 +1516,1193 @@ func purgeHistory(w http.ResponseWriter, r *http.Request) {
 		displayError(w, err)
 		return
 	}
+	recordAudit(r, AuditEntry{Action: auditPurge, Kind: "history", Target: getMonitorName(site), TargetID: site,
+		Detail: "records before " + date})
 	http.Redirect(w, r, r.Referer(), http.StatusFound)
 }
+
+func maintenancePage(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	editor := user.can(roleEditor)
+	windows, err := getMaintenances()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	now := time.Now()
+	rows := []g.Node{}
+	for _, window := range windows {
+		repeat := string(window.Repeat)
+		if window.Repeat == Once {
+			repeat = "once"
+		}
+		row := h.Tr(
+			h.Td(g.Text(window.Name)),
+			h.Td(g.Text(strings.Join(getMonitorNames(window.Monitors), ", "))),
+			h.Td(g.Text(strings.Join(window.Groups, ", "))),
+			h.Td(g.Text(window.Start.Local().Format(time.RFC822))),
+			h.Td(g.Text(window.Duration.String())),
+			h.Td(g.Text(repeat)),
+			h.Td(g.If(window.active(now), maintenanceBadge())),
+			g.If(editor, h.Td(g.If(user.managesAll(windowTeams(window)),
+				formButton("Delete", "/maintenance/delete/"+window.ID)))),
+		)
+		rows = append(rows, row)
+	}
+	if err := layout("Maintenance", []g.Node{
+		h.H1(g.Text("Maintenance Windows")),
+		g.If(editor, linkButton("/maintenance/new", "New Maintenance Window")),
+		linkButton("/", "Home"),
+		h.Br(), h.Br(),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("Name")),
+				h.Th(g.Text("Monitors")),
+				h.Th(g.Text("Groups")),
+				h.Th(g.Text("Start")),
+				h.Th(g.Text("Duration")),
+				h.Th(g.Text("Repeat")),
+				h.Th(g.Text("Status")),
+				g.If(editor, h.Th(g.Text("Actions"))),
+			),
+			g.Group(rows),
+		),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func newMaintenance(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	monitors, err := getMonitors()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	monitorCheckboxes := make([]g.Node, 0, len(monitors))
+	for _, m := range monitors {
+		if !user.manages(m.Team) {
+			continue
+		}
+		monitorCheckboxes = append(monitorCheckboxes,
+			h.Input(h.Type("checkbox"), h.Name("monitor"), h.Value(m.ID)),
+			g.Text(m.Name),
+		)
+	}
+	if err := layout("New Maintenance", []g.Node{
+		h.H2(g.Text("Create Maintenance Window")),
+		h.Form(
+			h.Method("post"),
+			h.Action("/maintenance/new"),
+			h.Table(
+				inputTableRow("Name", "name", "text", "", "60"),
+				inputTableRow("Start", "start", "datetime-local", "", "60"),
+				inputTableRow("Duration (e.g. 2h30m)", "duration", "text", "1h", "60"),
+				radioGroup("Repeat", "repeat", []Radio{
+					{"", "Once", true},
+					{"daily", "Daily", false},
+					{"weekly", "Weekly", false},
+					{"monthly", "Monthly", false},
+				}),
+				h.Tr(
+					h.Td(h.Label(g.Text("Monitors"))),
+					h.Td(g.Group(monitorCheckboxes)),
+				),
+				inputTableRow("Groups (comma separated)", "groups", "text", "", "60"),
+			),
+			linkButton("/maintenance/", "Cancel"),
+			submitButton("Create"),
+		),
+	}).Render(w); err != nil {
+		log.Println("render error", err)
+	}
+}
+
+func createMaintenance(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		displayError(w, err)
+		return
+	}
+	start, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("start"), time.Local)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	duration, err := time.ParseDuration(r.FormValue("duration"))
+	if err != nil || duration <= 0 {
+		displayError(w, errors.New("invalid duration "+r.FormValue("duration")))
+		return
+	}
+	window := Maintenance{
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		Monitors: r.Form["monitor"],
+		Start:    start,
+		Duration: duration,
+		Repeat:   Recurrence(r.FormValue("repeat")),
+	}
+	if !window.Repeat.valid() {
+		http.Error(w, "invalid repeat "+string(window.Repeat), http.StatusBadRequest)
+		return
+	}
+	for group := range strings.SplitSeq(r.FormValue("groups"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			window.Groups = append(window.Groups, group)
+		}
+	}
+	if window.Name == "" {
+		displayError(w, errors.New("name is required"))
+		return
+	}
+	if len(window.Monitors) == 0 && len(window.Groups) == 0 {
+		displayError(w, errors.New("select at least one monitor or group"))
+		return
+	}
+	if window.ID, err = newID(); err != nil {
+		displayError(w, err)
+		return
+	}
+	log.Println("create maintenance window", window)
+	if err := saveMaintenance(window); err != nil {
+		displayError(w, err)
+		return
+	}
+	auditChange(r, auditCreate, "maintenance", window.Name, window.ID, nil, window)
+	http.Redirect(w, r, "/maintenance/", http.StatusFound)
+}
+
+func deleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("window")
+	window, err := getMaintenance(id)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	log.Println("delete maintenance window", window.Name)
+	if err := removeMaintenance(id); err != nil {
+		displayError(w, err)
+		return
+	}
+	auditChange(r, auditDelete, "maintenance", window.Name, id, window, nil)
+	http.Redirect(w, r, "/maintenance/", http.StatusFound)
+}
+
+// CheckResult represents the result of an on demand check.
+type CheckResult struct {
+	Status   Status
+	Passed   bool
+	Recorded bool
+	Notified bool
+}
+
+func checkNow(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	monitor, err := getMonitor(site)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		displayError(w, err)
+		return
+	}
+	result := CheckResult{
+		Recorded: r.FormValue("record") == "on",
+	}
+	result.Notified = result.Recorded && r.FormValue("notify") == "on"
+	log.Println("check now", site, "record", result.Recorded, "notify", result.Notified)
+	result.Status = monitor.Check(r.Context())
+	if result.Recorded {
+		result.Status = monitor.record(r.Context(), result.Status,
+			recordOptions{Notify: result.Notified})
+	}
+	result.Passed = result.Status.StatusCode == monitor.StatusOK
+	if r.URL.Query().Get("format") == "json" || r.Header.Get("Accept") == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Println("encode check result", err)
+		}
+		return
+	}
+	renderDetails(w, r, checkResultTable(result, monitor.StatusOK))
+}
+
+func agentsPage(w http.ResponseWriter, _ *http.Request) {
+	renderAgents(w, nil)
+}
+
+// renderAgents displays the agents page with optional extra content.
+func renderAgents(w http.ResponseWriter, extra g.Node) {
+	agents, err := getAgents()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	rows := []g.Node{}
+	for _, agent := range agents {
+		lastSeen := "never"
+		if !agent.LastSeen.IsZero() {
+			lastSeen = agent.LastSeen.Local().Format(time.RFC822)
+		}
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(agent.Name)),
+			h.Td(g.Text(agent.Location)),
+			h.Td(g.Text(lastSeen)),
+			h.Td(formButton("Delete", "/agents/delete/"+agent.Name)),
+		))
+	}
+	if err := layout("Agents", []g.Node{
+		h.H1(g.Text("Remote Agents")),
+		linkButton("/", "Home"),
+		extra,
+		h.Br(), h.Br(),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("Name")),
+				h.Th(g.Text("Location")),
+				h.Th(g.Text("Last Seen")),
+				h.Th(g.Text("Actions")),
+			),
+			g.Group(rows),
+		),
+		h.Br(),
+		h.Form(
+			h.Method("post"),
+			h.Action("/agents/new"),
+			h.Table(
+				inputTableRow("Name", "name", "text", "", "40"),
+				inputTableRow("Location", "location", "text", "", "40"),
+			),
+			submitButton("Create Agent"),
+		),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func createAgent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		displayError(w, err)
+		return
+	}
+	agent := Agent{
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		Location: strings.TrimSpace(r.FormValue("location")),
+		Created:  time.Now(),
+	}
+	if agent.Name == "" || agent.Location == "" || agent.Location == localLocation {
+		displayError(w, errors.New("name and location are required; location may not be "+localLocation))
+		return
+	}
+	token, hash, err := newAgentToken()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	agent.TokenHash = hash
+	if err := saveAgent(agent, false); err != nil {
+		displayError(w, err)
+		return
+	}
+	log.Println("created agent", agent.Name, agent.Location)
+	auditChange(r, auditCreate, "agent", agent.Name, "", nil, agent)
+	renderAgents(w, h.Div(
+		h.H3(g.Text("Agent "+agent.Name+" created")),
+		h.P(g.Text("Token (shown only once): "), h.Code(g.Text(token))),
+		h.P(h.Code(g.Text("uptime agent -server <url> -token "+token))),
+	))
+}
+
+func deleteAgent(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	before, err := getAgent(name)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	log.Println("delete agent", name)
+	if err := removeAgent(name); err != nil {
+		displayError(w, err)
+		return
+	}
+	auditChange(r, auditDelete, "agent", name, "", before, nil)
+	http.Redirect(w, r, "/agents/", http.StatusFound)
+}
+
+func tokensPage(w http.ResponseWriter, r *http.Request) {
+	renderTokens(w, r, nil)
+}
+
+// renderTokens displays the api tokens of the user, or of all users for admins, with optional extra content.
+func renderTokens(w http.ResponseWriter, r *http.Request, extra g.Node) {
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	admin := user.can(roleAdmin)
+	tokens, err := getAPITokens()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	rows := []g.Node{}
+	for _, token := range tokens {
+		if token.User != user.Name && !admin {
+			continue
+		}
+		expires, lastUsed := "never", "never"
+		if !token.Expires.IsZero() {
+			expires = token.Expires.Local().Format(time.RFC822)
+		}
+		if !token.LastUsed.IsZero() {
+			lastUsed = token.LastUsed.Local().Format(time.RFC822)
+		}
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(token.Name)),
+			g.If(admin, h.Td(g.Text(token.User))),
+			h.Td(g.Text(strings.Join(token.Scopes, ", "))),
+			h.Td(g.Text(token.Created.Local().Format(time.RFC822))),
+			h.Td(g.Text(expires), g.If(token.expired(time.Now()), g.Text(" (expired)"))),
+			h.Td(g.Text(lastUsed)),
+			h.Td(formButton("Revoke", "/tokens/delete/"+token.ID)),
+		))
+	}
+	scopeBoxes := []g.Node{}
+	for _, scope := range scopes {
+		denied := (slices.Contains(writeScopes, scope) && !user.can(roleEditor)) ||
+			(slices.Contains(adminScopes, scope) && !user.can(roleAdmin))
+		scopeBoxes = append(scopeBoxes,
+			h.Input(h.Type("checkbox"), h.Name("scope"), h.Value(scope),
+				// admin scopes are granted only when asked for
+				g.If(!denied && !slices.Contains(adminScopes, scope), h.Checked()),
+				g.If(denied, h.Disabled())),
+			g.Text(scope),
+		)
+	}
+	lifetimes := []g.Node{}
+	for _, days := range tokenLifetimes {
+		label := strconv.Itoa(days) + " days"
+		if days == 0 {
+			label = "never"
+		}
+		lifetimes = append(lifetimes, h.Option(h.Value(strconv.Itoa(days)), g.Text(label)))
+	}
+	if err := layout("API Tokens", []g.Node{
+		h.H1(g.Text("API Tokens")),
+		linkButton("/", "Home"),
+		extra,
+		h.Br(), h.Br(),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("Name")),
+				g.If(admin, h.Th(g.Text("User"))),
+				h.Th(g.Text("Scopes")),
+				h.Th(g.Text("Created")),
+				h.Th(g.Text("Expires")),
+				h.Th(g.Text("Last Used")),
+				h.Th(g.Text("Actions")),
+			),
+			g.Group(rows),
+		),
+		h.Br(),
+		h.Form(
+			h.Method("post"),
+			h.Action("/tokens/new"),
+			h.Table(
+				inputTableRow("Name", "name", "text", "", "40"),
+				h.Tr(
+					h.Td(h.Label(g.Text("Scopes"))),
+					h.Td(g.Group(scopeBoxes)),
+				),
+				h.Tr(
+					h.Td(h.Label(h.For("expires"), g.Text("Expires"))),
+					h.Td(h.Select(h.Name("expires"), h.ID("expires"), g.Group(lifetimes))),
+				),
+			),
+			submitButton("Create Token"),
+		),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func createToken(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		displayError(w, err)
+		return
+	}
+	days, err := strconv.Atoi(r.FormValue("expires"))
+	if err != nil || !slices.Contains(tokenLifetimes, days) {
+		displayError(w, errors.New("invalid expiry "+r.FormValue("expires")))
+		return
+	}
+	var expires time.Time
+	if days > 0 {
+		expires = time.Now().AddDate(0, 0, days)
+	}
+	token, secret, err := newAPIToken(user, r.FormValue("name"), r.Form["scope"], expires)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	auditChange(r, auditCreate, "token", token.Name, token.ID, nil, token)
+	renderTokens(w, r, h.Div(
+		h.H3(g.Text("Token "+token.Name+" created")),
+		h.P(g.Text("Token (shown only once): "), h.Code(g.Text(secret))),
+		h.P(h.Code(g.Text("curl -H 'Authorization: Bearer "+secret+"' <url>/api/v1/status"))),
+	))
+}
+
+func revokeToken(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	token, err := getAPIToken(r.PathValue("token"))
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if token.User != user.Name && !user.can(roleAdmin) {
+		forbidden(w, errors.New("admin access required"))
+		return
+	}
+	if err := removeAPITokens(token.ID); err != nil {
+		displayError(w, err)
+		return
+	}
+	auditChange(r, auditDelete, "token", token.Name, token.ID, token, nil)
+	http.Redirect(w, r, "/tokens/", http.StatusFound)
+}
+
+func incidentsPage(w http.ResponseWriter, r *http.Request) {
+	site := r.URL.Query().Get("monitor")
+	incidents, err := getIncidents(site)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	title := "Incidents"
+	if site != "" {
+		title = "Incidents: " + getMonitorName(site)
+	}
+	rows := []g.Node{}
+	for _, incident := range incidents {
+		id := strconv.FormatUint(incident.ID, 10)
+		end := "ongoing"
+		if !incident.Open() {
+			end = incident.End.Local().Format(time.RFC822)
+		}
+		rows = append(rows, h.Tr(
+			h.Td(h.A(h.Href("/incidents/"+id), g.Text(id))),
+			h.Td(h.A(h.Href("/monitor/details/"+incident.MonitorID), g.Text(incident.Monitor))),
+			h.Td(g.Text(incident.Start.Local().Format(time.RFC822))),
+			h.Td(g.Text(end)),
+			h.Td(g.Text(incident.Duration().String())),
+			h.Td(g.Text(incident.Cause)),
+			h.Td(g.Text(incident.AckBy)),
+			h.Td(g.Text(incident.Assignee)),
+		))
+	}
+	if err := layout("Incidents", []g.Node{
+		h.H1(g.Text(title)),
+		g.If(site != "", linkButton("/monitor/details/"+site, "Details")),
+		g.If(site != "", linkButton("/incidents/", "All Incidents")),
+		linkButton("/", "Home"),
+		h.Br(), h.Br(),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("ID")),
+				h.Th(g.Text("Monitor")),
+				h.Th(g.Text("Start")),
+				h.Th(g.Text("End")),
+				h.Th(g.Text("Duration")),
+				h.Th(g.Text("Cause")),
+				h.Th(g.Text("Acknowledged By")),
+				h.Th(g.Text("Assignee")),
+			),
+			g.Group(rows),
+		),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func incidentDetails(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	incident, err := getIncident(id)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	end := "ongoing"
+	if !incident.Open() {
+		end = incident.End.Local().Format(time.RFC822)
+	}
+	users := []g.Node{h.Option(h.Value(""), g.Text("unassigned"))}
+	for _, user := range getUsers() {
+		users = append(users, h.Option(h.Value(user.Name), g.Text(user.Name),
+			g.If(user.Name == incident.Assignee, h.Selected())))
+	}
+	// the monitor may have been deleted since
+	monitor, _ := getMonitor(incident.MonitorID)
+	manages := canManage(r, monitor.Team)
+	acked := "no"
+	if incident.Acked() {
+		acked = incident.AckBy + " at " + incident.Acknowledged.Local().Format(time.RFC822)
+	}
+	notes := []g.Node{}
+	for _, note := range incident.Notes {
+		notes = append(notes, h.Tr(
+			h.Td(g.Text(note.Time.Local().Format(time.RFC822))),
+			h.Td(g.Text(note.User)),
+			h.Td(g.Text(note.Text)),
+		))
+	}
+	rows := []g.Node{}
+	for _, n := range incident.Notifications {
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(n.Time.Local().Format(time.RFC822))),
+			h.Td(g.Text(strings.Join(n.Notifiers, ", "))),
+			h.Td(g.Text(n.Message)),
+		))
+	}
+	if err := layout("Incident", []g.Node{
+		h.H1(g.Text("Incident " + r.PathValue("id"))),
+		linkButton("/incidents/?monitor="+url.QueryEscape(incident.MonitorID), "Monitor Incidents"),
+		linkButton("/incidents/", "All Incidents"),
+		linkButton("/", "Home"),
+		h.Br(), h.Br(),
+		h.Table(
+			h.Tr(h.Th(g.Text("Monitor")), h.Td(h.A(h.Href("/monitor/details/"+incident.MonitorID), g.Text(incident.Monitor)))),
+			h.Tr(h.Th(g.Text("Start")), h.Td(g.Text(incident.Start.Local().Format(time.RFC822)))),
+			h.Tr(h.Th(g.Text("End")), h.Td(g.Text(end))),
+			h.Tr(h.Th(g.Text("Duration")), h.Td(g.Text(incident.Duration().String()))),
+			h.Tr(h.Th(g.Text("Cause")), h.Td(g.Text(incident.Cause))),
+			h.Tr(h.Th(g.Text("Acknowledged")), h.Td(g.Text(acked))),
+			h.Tr(h.Th(g.Text("Assignee")), h.Td(g.Text(incident.Assignee))),
+			g.If(incident.ResolvedBy != "", h.Tr(h.Th(g.Text("Resolved By")), h.Td(g.Text(incident.ResolvedBy)))),
+		),
+		h.Br(),
+		g.If(manages && incident.Open() && !incident.Acked(),
+			formButton("Acknowledge", "/incidents/"+r.PathValue("id")+"/ack")),
+		g.If(manages && incident.Open(), formButton("Resolve", "/incidents/"+r.PathValue("id")+"/resolve")),
+		g.If(manages, h.Form(
+			h.Method("post"),
+			h.Action("/incidents/"+r.PathValue("id")+"/assign"),
+			h.Select(h.Name("assignee"), g.Group(users)),
+			submitButton("Assign"),
+		)),
+		h.H3(g.Text("Notes")),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("Time")),
+				h.Th(g.Text("User")),
+				h.Th(g.Text("Note")),
+			),
+			g.Group(notes),
+		),
+		g.If(manages, h.Form(
+			h.Method("post"),
+			h.Action("/incidents/"+r.PathValue("id")+"/note"),
+			h.Textarea(h.Name("note"), h.Rows("3"), h.Cols("60"), h.Required()),
+			h.Br(),
+			submitButton("Add Note"),
+		)),
+		h.H3(g.Text("Notifications")),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("Time")),
+				h.Th(g.Text("Notifiers")),
+				h.Th(g.Text("Message")),
+			),
+			g.Group(rows),
+		),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+// incidentAction performs an action on the incident named in the request path on behalf of the session user.
+func incidentAction(w http.ResponseWriter, r *http.Request, action func(id uint64, user string) error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	user, err := sessionUser(r)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if err := action(id, user.Name); err != nil {
+		displayError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/incidents/"+r.PathValue("id"), http.StatusFound)
+}
+
+func ackIncident(w http.ResponseWriter, r *http.Request) {
+	incidentAction(w, r, func(id uint64, user string) error {
+		_, err := acknowledgeIncident(id, user)
+		return err
+	})
+}
+
+func closeIncident(w http.ResponseWriter, r *http.Request) {
+	incidentAction(w, r, func(id uint64, user string) error {
+		_, err := resolveIncident(id, user)
+		return err
+	})
+}
+
+func assignIncident(w http.ResponseWriter, r *http.Request) {
+	incidentAction(w, r, func(id uint64, user string) error {
+		_, err := updateIncident(id, func(incident *Incident) error {
+			incident.Assignee = r.FormValue("assignee")
+			log.Println("incident", id, "assigned to", incident.Assignee, "by", user)
+			return nil
+		})
+		return err
+	})
+}
+
+func addIncidentNote(w http.ResponseWriter, r *http.Request) {
+	incidentAction(w, r, func(id uint64, user string) error {
+		text := strings.TrimSpace(r.FormValue("note"))
+		if text == "" {
+			return errors.New("note is empty")
+		}
+		_, err := updateIncident(id, func(incident *Incident) error {
+			incident.Notes = append(incident.Notes, IncidentNote{Time: time.Now(), User: user, Text: text})
+			return nil
+		})
+		return err
+	})
+}
+
+// signedIncident asks for confirmation of an action from a signed link so that link previews
+// in chat and mail clients do not acknowledge incidents.
+func signedIncident(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	action := r.PathValue("action")
+	if err := verifyIncidentLink(id, action, r.URL.Query()); err != nil {
+		displayError(w, err)
+		return
+	}
+	incident, err := getIncident(id)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if err := layout("Incident", []g.Node{
+		h.H2(g.Text("Incident " + r.PathValue("id") + ": " + incident.Monitor)),
+		h.P(g.Text(incident.Cause + ", started " + incident.Start.Local().Format(time.RFC822))),
+		h.Form(
+			h.Method("post"),
+			h.Action(r.URL.RequestURI()),
+			submitButton(action),
+		),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func signedIncidentAction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	action := r.PathValue("action")
+	if err := verifyIncidentLink(id, action, r.URL.Query()); err != nil {
+		displayError(w, err)
+		return
+	}
+	var incident Incident
+	if action == actionAck {
+		incident, err = acknowledgeIncident(id, "signed link")
+	} else {
+		incident, err = resolveIncident(id, "signed link")
+	}
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	if err := layout("Incident", []g.Node{
+		h.H2(g.Text("Incident " + r.PathValue("id") + ": " + incident.Monitor)),
+		h.P(g.Text("incident " + action + " recorded")),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func databasePage(w http.ResponseWriter, _ *http.Request) {
+	settings, err := getSettings()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	counts, err := historyCounts()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	monitors, err := getMonitors()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	rows := []g.Node{}
+	for _, monitor := range monitors {
+		retention := "forever"
+		if value := monitor.retention(settings); value > 0 {
+			retention = monitor.Retention
+			if retention == "" {
+				retention = settings.Retention + " (global)"
+			}
+		}
+		rows = append(rows, h.Tr(
+			h.Td(g.Text(monitor.Name)),
+			h.Td(g.Text(strconv.Itoa(counts[monitor.ID]))),
+			h.Td(g.Text(retention)),
+		))
+	}
+	backups, err := listBackups(settings.backupDir())
+	if err != nil {
+		log.Println("list backups", err)
+	}
+	var changes []configChange
+	var configErr error
+	configState, err := getConfigState()
+	if err != nil {
+		log.Println("get config state", err)
+	}
+	if file := configFile(); file != "" {
+		var config Config
+		if config, configErr = readConfig(file); configErr == nil {
+			changes, configErr = planConfig(config)
+		}
+	}
+	lastRun, duration, pruned := lastJanitorRun()
+	janitor := "not yet run"
+	if !lastRun.IsZero() {
+		janitor = lastRun.Local().Format(time.RFC822) + ", pruned " + strconv.Itoa(pruned) +
+			" records in " + duration.Round(time.Millisecond).String()
+	}
+	if err := layout("Database", []g.Node{
+		h.H1(g.Text("Database")),
+		linkButton("/", "Home"),
+		h.Br(), h.Br(),
+		h.Table(
+			h.Tr(h.Th(g.Text("File")), h.Td(g.Text(db.Path()))),
+			h.Tr(h.Th(g.Text("Size")), h.Td(g.Text(strconv.FormatFloat(float64(dbSize())/(1<<20), 'f', 2, 64)+" MiB"))),
+			h.Tr(h.Th(g.Text("Last Pruning")), h.Td(g.Text(janitor))),
+		),
+		h.Br(),
+		h.Form(
+			h.Method("post"),
+			h.Action("/database/retention"),
+			h.Table(
+				inputTableRow("Global History Retention (e.g. 30d, empty keeps forever)", "retention", "text",
+					settings.Retention, "20"),
+			),
+			submitButton("Save"),
+		),
+		formButton("Prune Now", "/database/prune"),
+		h.Br(),
+		h.Table(
+			h.Tr(
+				h.Th(g.Text("Monitor")),
+				h.Th(g.Text("History Records")),
+				h.Th(g.Text("Retention")),
+			),
+			g.Group(rows),
+		),
+		h.H2(g.Text("Backups")),
+		linkButton("/database/backup", "Download Backup"),
+		formButton("Backup Now", "/database/backup"),
+		h.Form(
+			h.Method("post"),
+			h.Action("/database/backup/settings"),
+			h.Table(
+				inputTableRow("Backup Interval (e.g. 1d, empty disables scheduled backups)", "interval", "text",
+					settings.BackupInterval, "20"),
+				inputTableRow("Backups Kept", "keep", "number", strconv.Itoa(settings.backupKeep()), "20"),
+				inputTableRow("Backup Directory", "dir", "text", settings.backupDir(), "40"),
+			),
+			submitButton("Save"),
+		),
+		backupTable(backups),
+		h.H2(g.Text("Export and Import")),
+		linkButton("/database/export", "Export Monitors and Notifiers"),
+		linkButton("/database/export?redact=on", "Export With Credentials Redacted"),
+		h.Form(
+			h.Method("post"),
+			h.Action("/database/import"),
+			h.EncType("multipart/form-data"),
+			h.Table(
+				h.Tr(
+					h.Td(h.Label(h.For("file"), g.Text("Export File"))),
+					h.Td(h.Input(h.Type("file"), h.Name("file"), h.Accept(".json"), h.Required())),
+				),
+				radioGroup("Existing Names", "conflict", []Radio{
+					{conflictSkip, "Skip", true},
+					{conflictOverwrite, "Overwrite", false},
+					{conflictRename, "Import With New Name", false},
+				}),
+			),
+			submitButton("Import"),
+		),
+		h.H2(g.Text("Import From Other Tools")),
+		h.Form(
+			h.Method("post"),
+			h.Action("/database/import/foreign"),
+			h.EncType("multipart/form-data"),
+			h.Table(
+				radioGroup("Format", "format", []Radio{
+					{formatKuma, "Uptime Kuma Backup (JSON)", true},
+					{formatGatus, "Gatus Config (YAML)", false},
+					{formatBlackbox, "Prometheus Config With blackbox_exporter Jobs (YAML)", false},
+				}),
+				h.Tr(
+					h.Td(h.Label(h.For("file"), g.Text("File"))),
+					h.Td(h.Input(h.Type("file"), h.Name("file"), h.Accept(".json,.yaml,.yml"), h.Required())),
+				),
+				h.Tr(
+					h.Td(h.Label(h.For("modules"), g.Text("blackbox_exporter Config (optional)"))),
+					h.Td(h.Input(h.Type("file"), h.Name("modules"), h.Accept(".yaml,.yml"))),
+				),
+				radioGroup("Existing Names", "conflict", []Radio{
+					{conflictSkip, "Skip", true},
+					{conflictOverwrite, "Overwrite", false},
+					{conflictRename, "Import With New Name", false},
+				}),
+			),
+			submitButton("Import"),
+		),
+		h.H2(g.Text("Config File")),
+		configTable(configFile(), configState, changes, configErr),
+		g.If(configFile() != "" && configErr == nil && len(changes) > 0, formButton("Apply Config", "/database/config")),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func updateRetention(w http.ResponseWriter, r *http.Request) {
+	settings, err := getSettings()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	before := settings
+	settings.Retention = strings.TrimSpace(r.FormValue("retention"))
+	if settings.Retention != "" {
+		if _, err := parseRetention(settings.Retention); err != nil {
+			displayError(w, err)
+			return
+		}
+	}
+	if err := saveSettings(settings); err != nil {
+		displayError(w, err)
+		return
+	}
+	log.Println("global history retention", settings.Retention)
+	auditChange(r, auditUpdate, "settings", "retention", "", before, settings)
+	http.Redirect(w, r, "/database/", http.StatusFound)
+}
+
+func pruneNow(w http.ResponseWriter, r *http.Request) {
+	pruned := pruneExpired(r.Context())
+	recordAudit(r, AuditEntry{Action: auditPurge, Kind: "history", Target: "all monitors",
+		Detail: strconv.Itoa(pruned) + " expired records pruned"})
+	http.Redirect(w, r, "/database/", http.StatusFound)
+}
+
+func applyConfigNow(w http.ResponseWriter, r *http.Request) {
+	changes, err := reconcileConfig()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	applied := make([]string, 0, len(changes))
+	for _, change := range changes {
+		applied = append(applied, change.String())
+	}
+	recordAudit(r, AuditEntry{Action: auditApply, Kind: "config", Target: configFile(),
+		Detail: strings.Join(applied, "; ")})
+	reset <- syscall.SIGHUP
+	http.Redirect(w, r, "/database/", http.StatusFound)
+}
+
+func exportData(w http.ResponseWriter, r *http.Request) {
+	doc, err := exportConfig(r.FormValue("redact") == "on")
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="uptime-export-`+
+		time.Now().Format(backupTimeFormat)+`.json"`)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		log.Println("export", err)
+	}
+}
+
+func importData(w http.ResponseWriter, r *http.Request) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxBodySize))
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	report, err := importConfig(data, r.FormValue("conflict"))
+	displayImportReport(w, r, "export", report, err)
+}
+
+func importForeignData(w http.ResponseWriter, r *http.Request) {
+	files := [][]byte{}
+	for _, field := range []string{"file", "modules"} {
+		file, _, err := r.FormFile(field)
+		if errors.Is(err, http.ErrMissingFile) && field == "modules" {
+			files = append(files, nil)
+			continue
+		}
+		if err != nil {
+			displayError(w, err)
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxBodySize))
+		file.Close()
+		if err != nil {
+			displayError(w, err)
+			return
+		}
+		files = append(files, data)
+	}
+	report, err := importForeign(r.FormValue("format"), files[0], files[1], r.FormValue("conflict"))
+	displayImportReport(w, r, r.FormValue("format"), report, err)
+}
+
+// displayImportReport restarts the monitors when anything was imported, records the import in the audit
+// log and shows the import report.
+func displayImportReport(w http.ResponseWriter, r *http.Request, source string, report []string, err error) {
+	if len(report) > 0 {
+		reset <- syscall.SIGHUP
+	}
+	if err != nil {
+		report = append(report, "import stopped: "+err.Error())
+	}
+	recordAudit(r, AuditEntry{Action: auditImport, Kind: "config", Target: source, Detail: strings.Join(report, "; ")})
+	items := []g.Node{}
+	for _, line := range report {
+		log.Println("import:", line)
+		items = append(items, h.Li(g.Text(line)))
+	}
+	if err := layout("Import", []g.Node{
+		h.H1(g.Text("Import")),
+		g.If(len(items) == 0, h.P(g.Text("Nothing to import"))),
+		h.Ul(items...),
+		linkButton("/database/", "Database"),
+		linkButton("/", "Home"),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func exportMonitorHistory(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	format := r.PathValue("format")
+	monitor, err := getMonitor(site)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	contentType := map[string]string{"csv": "text/csv", "ndjson": "application/x-ndjson"}[format]
+	if contentType == "" {
+		displayError(w, errors.New("invalid history format "+format))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+monitor.Name+"-history."+format+`"`)
+	if err := exportHistory(w, site, format); err != nil {
+		log.Println("export history", site, err)
+	}
+}
+
+func importMonitorHistory(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	defer file.Close()
+	added, skipped, err := importHistory(file, site)
+	log.Println("import history", site, added, "added", skipped, "skipped", err)
+	recordAudit(r, AuditEntry{Action: auditImport, Kind: "history", Target: getMonitorName(site), TargetID: site,
+		Detail: strconv.Itoa(added) + " records added, " + strconv.Itoa(skipped) + " skipped"})
+	if err != nil {
+		displayError(w, fmt.Errorf("imported %d records before error: %w", added, err))
+		return
+	}
+	if err := layout("Import History", []g.Node{
+		h.H1(g.Text("Import History")),
+		h.P(g.Text(strconv.Itoa(added) + " records added to " + getMonitorName(site) + ", " + strconv.Itoa(skipped) +
+			" records at the time of an existing record skipped")),
+		linkButton("/monitor/history/"+site+"/day", "History"),
+		linkButton("/", "Home"),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func downloadBackup(w http.ResponseWriter, r *http.Request) {
+	name := backupName(time.Now())
+	// recorded before the download, which may fail part way after handing out data
+	recordAudit(r, AuditEntry{Action: auditBackup, Kind: "database", Target: name, Detail: "download"})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if _, err := writeBackup(w); err != nil {
+		log.Println("backup", err)
+		// break the connection so that the client does not take a truncated backup for a complete one
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func backupNow(w http.ResponseWriter, r *http.Request) {
+	settings, err := getSettings()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	file, err := createBackup(settings.backupDir())
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	log.Println("database backed up to", file)
+	recordAudit(r, AuditEntry{Action: auditBackup, Kind: "database", Target: filepath.Base(file),
+		Detail: "saved to " + settings.backupDir()})
+	if err := rotateBackups(settings.backupDir(), settings.backupKeep()); err != nil {
+		log.Println("rotate backups", err)
+	}
+	http.Redirect(w, r, "/database/", http.StatusFound)
+}
+
+func updateBackupSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := getSettings()
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	before := settings
+	settings.BackupInterval = strings.TrimSpace(r.FormValue("interval"))
+	if settings.BackupInterval != "" {
+		if _, err := parseRetention(settings.BackupInterval); err != nil {
+			displayError(w, errors.New("invalid backup interval "+settings.BackupInterval))
+			return
+		}
+	}
+	keep, err := strconv.Atoi(r.FormValue("keep"))
+	if err != nil || keep < 1 {
+		displayError(w, errors.New("backups kept must be at least 1"))
+		return
+	}
+	settings.BackupKeep = keep
+	settings.BackupDir = strings.TrimSpace(r.FormValue("dir"))
+	if settings.BackupDir == filepath.Join(dataDir(), "backups") {
+		settings.BackupDir = ""
+	}
+	if err := saveSettings(settings); err != nil {
+		displayError(w, err)
+		return
+	}
+	log.Println("backup settings", settings.BackupInterval, settings.BackupKeep, settings.backupDir())
+	auditChange(r, auditUpdate, "settings", "backups", "", before, settings)
+	http.Redirect(w, r, "/database/", http.StatusFound)
+}
+
+// auditPageSize is the number of audit entries shown on the audit page; exports have no limit.
+const auditPageSize = 500
+
+func auditPage(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	entries, err := getAuditEntries(filter, auditPageSize)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	query := r.URL.Query().Encode()
+	if err := layout("Audit Log", []g.Node{
+		h.H1(g.Text("Audit Log")),
+		linkButton("/", "Home"),
+		linkButton("/audit/export/csv?"+query, "Export CSV"),
+		linkButton("/audit/export/ndjson?"+query, "Export NDJSON"),
+		h.Br(), h.Br(),
+		auditFilterForm(r.URL.Query()),
+		g.If(len(entries) == auditPageSize,
+			h.P(g.Text("Showing the latest "+strconv.Itoa(auditPageSize)+" entries; export to see all"))),
+		auditTable(entries),
+	}).Render(w); err != nil {
+		log.Println("render err", err)
+	}
+}
+
+func exportAuditLog(w http.ResponseWriter, r *http.Request) {
+	format := r.PathValue("format")
+	contentType := map[string]string{"csv": "text/csv", "ndjson": "application/x-ndjson"}[format]
+	if contentType == "" {
+		displayError(w, errors.New("invalid audit format "+format))
+		return
+	}
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	entries, err := getAuditEntries(filter, 0)
+	if err != nil {
+		displayError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="uptime-audit-`+
+		time.Now().Format(backupTimeFormat)+"."+format+`"`)
+	if err := exportAudit(w, entries, format); err != nil {
+		log.Println("export audit log", err)
+	}
+}
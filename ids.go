@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// newID returns a random ID for a monitor or notifier.
+func newID() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// legacyID returns the ID given to a monitor, notifier or maintenance window that was keyed by name before
+// IDs were introduced. It is derived from the name, so data kept in either storage backend migrates to the
+// same ID.
+func legacyID(kind, name string) string {
+	sum := sha256.Sum256([]byte(kind + "/" + name))
+	return hex.EncodeToString(sum[:8])
+}
+
+// legacyIDs returns the legacy IDs of a list of names.
+func legacyIDs(kind string, names []string) []string {
+	if names == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		ids = append(ids, legacyID(kind, name))
+	}
+	return ids
+}
+
+// notifierName returns the name in the data of a notifier.
+func notifierName(data []byte) string {
+	var notifier struct{ Name string }
+	if err := json.Unmarshal(data, &notifier); err != nil {
+		return ""
+	}
+	return notifier.Name
+}
+
+// setNotifierName returns the data of a notifier with its name replaced.
+func setNotifierName(data []byte, name string) ([]byte, error) {
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["name"] = name
+	return json.Marshal(fields)
+}
+
+// getNotifierName returns the name of the notifier with the given ID; empty if there is none.
+func getNotifierName(id string) string {
+	_, data, err := getNotify(id)
+	if err != nil {
+		return ""
+	}
+	return notifierName(data)
+}
+
+// getMonitorName returns the name of the monitor with the given ID; empty if there is none.
+func getMonitorName(id string) string {
+	monitor, err := getMonitor(id)
+	if err != nil {
+		return ""
+	}
+	return monitor.Name
+}
+
+// getMonitorNames returns the names of the monitors with the given IDs; unknown IDs are dropped.
+func getMonitorNames(ids []string) []string {
+	monitors, err := getMonitors()
+	if err != nil {
+		log.Println("get monitors", err)
+	}
+	names := map[string]string{}
+	for _, monitor := range monitors {
+		names[monitor.ID] = monitor.Name
+	}
+	return mapNames(ids, names)
+}
+
+// catalog maps the IDs of monitors and notifiers to their names and back, for the config file and
+// imports, which refer to monitors and notifiers by name.
+type catalog struct {
+	monitorNames  map[string]string // by ID
+	monitorIDs    map[string]string // by name
+	notifierNames map[string]string // by ID
+	notifierIDs   map[string]string // by name
+}
+
+// loadCatalog returns the catalog of all monitors and notifiers.
+func loadCatalog() (catalog, error) {
+	c := catalog{
+		monitorNames:  map[string]string{},
+		monitorIDs:    map[string]string{},
+		notifierNames: map[string]string{},
+		notifierIDs:   map[string]string{},
+	}
+	monitors, err := getMonitors()
+	if err != nil {
+		return c, err
+	}
+	for _, monitor := range monitors {
+		c.monitorNames[monitor.ID] = monitor.Name
+		c.monitorIDs[monitor.Name] = monitor.ID
+	}
+	ids, err := store.Notifiers()
+	if err != nil {
+		return c, err
+	}
+	for _, id := range ids {
+		_, data, err := store.Notifier(id)
+		if err != nil {
+			return c, err
+		}
+		name := notifierName(data)
+		c.notifierNames[id] = name
+		c.notifierIDs[name] = id
+	}
+	return c, nil
+}
+
+// addMonitor records the ID of a monitor by name, assigning a new ID if the name is not known.
+func (c catalog) addMonitor(name string) (string, error) {
+	if id, ok := c.monitorIDs[name]; ok {
+		return id, nil
+	}
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	c.monitorNames[id] = name
+	c.monitorIDs[name] = id
+	return id, nil
+}
+
+// addNotifier records the ID of a notifier by name, assigning a new ID if the name is not known.
+func (c catalog) addNotifier(name string) (string, error) {
+	if id, ok := c.notifierIDs[name]; ok {
+		return id, nil
+	}
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	c.notifierNames[id] = name
+	c.notifierIDs[name] = id
+	return id, nil
+}
+
+// named returns the monitor with its parents and notifiers referred to by name.
+func (c catalog) named(m Monitor) Monitor {
+	m.Parents = mapNames(m.Parents, c.monitorNames)
+	m.Notifiers = mapNames(m.Notifiers, c.notifierNames)
+	m.EscalateTo = mapNames(m.EscalateTo, c.notifierNames)
+	return m
+}
+
+// identified returns the monitor, with parents and notifiers referred to by name, with its ID set and its
+// parents and notifiers referred to by ID.
+func (c catalog) identified(m Monitor) (Monitor, error) {
+	var ok bool
+	if m.ID, ok = c.monitorIDs[m.Name]; !ok {
+		return m, errors.New("no ID for monitor " + m.Name)
+	}
+	var err error
+	if m.Parents, err = mapIDs(m.Parents, c.monitorIDs, "parent monitor"); err != nil {
+		return m, err
+	}
+	if m.Notifiers, err = mapIDs(m.Notifiers, c.notifierIDs, "notifier"); err != nil {
+		return m, err
+	}
+	m.EscalateTo, err = mapIDs(m.EscalateTo, c.notifierIDs, "notifier")
+	return m, err
+}
+
+// mapNames replaces IDs by names; unknown IDs are dropped.
+func mapNames(ids []string, names map[string]string) []string {
+	if ids == nil {
+		return nil
+	}
+	mapped := []string{}
+	for _, id := range ids {
+		if name, ok := names[id]; ok {
+			mapped = append(mapped, name)
+		}
+	}
+	return mapped
+}
+
+// mapIDs replaces names by IDs.
+func mapIDs(names []string, ids map[string]string, kind string) ([]string, error) {
+	if names == nil {
+		return nil, nil
+	}
+	mapped := make([]string, 0, len(names))
+	for _, name := range names {
+		id, ok := ids[name]
+		if !ok {
+			return nil, errors.New("no such " + kind + " " + name)
+		}
+		mapped = append(mapped, id)
+	}
+	return mapped, nil
+}
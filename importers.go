@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formats of other uptime tools that can be imported.
+const (
+	formatKuma     = "kuma"
+	formatGatus    = "gatus"
+	formatBlackbox = "blackbox"
+)
+
+var gatusStatus = regexp.MustCompile(`^\[STATUS\]\s*==\s*(\d+)$`)
+
+// importForeign translates the configuration of another uptime tool and imports the result with the given
+// conflict handling. The report lists what was imported and everything that could not be mapped.
+func importForeign(format string, data, extra []byte, conflict string) ([]string, error) {
+	var doc exportDocument
+	var unmapped []string
+	var err error
+	switch format {
+	case formatKuma:
+		doc, unmapped, err = convertKuma(data)
+	case formatGatus:
+		doc, unmapped, err = convertGatus(data)
+	case formatBlackbox:
+		doc, unmapped, err = convertBlackbox(data, extra)
+	default:
+		return nil, errors.New("unknown import format " + format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.Version = exportVersion
+	// monitors that fail validation would stop the whole import
+	monitors := []Monitor{}
+	for _, monitor := range doc.Monitors {
+		if err := validateConfigMonitor(monitor); err != nil {
+			unmapped = append(unmapped, "monitor "+monitor.Name+": "+err.Error())
+			continue
+		}
+		monitors = append(monitors, monitor)
+	}
+	doc.Monitors = monitors
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	report, err := importConfig(raw, conflict)
+	for _, line := range unmapped {
+		report = append(report, "not imported: "+line)
+	}
+	return report, err
+}
+
+// durationString formats a duration in the largest whole unit, e.g. 1m rather than 1m0s.
+func durationString(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	case d%time.Minute == 0:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	default:
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+	}
+}
+
+// kumaBool decodes the booleans of Uptime Kuma backups, which are written as true/false or 1/0.
+type kumaBool bool
+
+func (b *kumaBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", "1":
+		*b = true
+	case "false", "0", "null":
+		*b = false
+	default:
+		return errors.New("invalid boolean " + string(data))
+	}
+	return nil
+}
+
+// kumaBackup is the part of an Uptime Kuma JSON backup that is imported.
+type kumaBackup struct {
+	Version          string `json:"version"`
+	NotificationList []struct {
+		ID     int    `json:"id"`
+		Name   string `json:"name"`
+		Config string `json:"config"`
+	} `json:"notificationList"`
+	MonitorList []struct {
+		ID                  int             `json:"id"`
+		Name                string          `json:"name"`
+		Type                string          `json:"type"`
+		URL                 string          `json:"url"`
+		Method              string          `json:"method"`
+		Interval            int             `json:"interval"`
+		RetryInterval       int             `json:"retryInterval"`
+		MaxRetries          int             `json:"maxretries"`
+		Timeout             float64         `json:"timeout"`
+		Active              kumaBool        `json:"active"`
+		UpsideDown          kumaBool        `json:"upsideDown"`
+		Keyword             string          `json:"keyword"`
+		Parent              *int            `json:"parent"`
+		AcceptedStatusCodes []string        `json:"accepted_statuscodes"`
+		NotificationIDList  map[string]bool `json:"notificationIDList"`
+	} `json:"monitorList"`
+}
+
+// convertKuma translates an Uptime Kuma JSON backup. Group monitors become the group of their children.
+func convertKuma(data []byte) (exportDocument, []string, error) {
+	doc := exportDocument{}
+	unmapped := []string{}
+	var backup kumaBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return doc, nil, err
+	}
+	if backup.MonitorList == nil && backup.NotificationList == nil {
+		return doc, nil, errors.New("not an Uptime Kuma backup")
+	}
+	notifiers := map[string]string{}
+	for _, notification := range backup.NotificationList {
+		config := map[string]any{}
+		if err := json.Unmarshal([]byte(notification.Config), &config); err != nil {
+			unmapped = append(unmapped, "notification "+notification.Name+": "+err.Error())
+			continue
+		}
+		text := func(key string) string {
+			value, _ := config[key].(string)
+			return value
+		}
+		fields := map[string]any{"name": notification.Name}
+		switch kind := text("type"); kind {
+		case "discord":
+			fields["type"] = string(Discord)
+			fields["url"] = text("discordWebhookUrl")
+		case "mailgun":
+			fields["type"] = string(MailGun)
+			fields["api_key"] = text("mailgunApiKey")
+			fields["domain"] = text("mailgunDomain")
+			fields["recipients"] = strings.Split(text("mailgunToEmail"), ",")
+		default:
+			unmapped = append(unmapped, "notification "+notification.Name+": type "+kind+" is not supported")
+			continue
+		}
+		notifiers[strconv.Itoa(notification.ID)] = notification.Name
+		doc.Notifiers = append(doc.Notifiers, fields)
+	}
+	groups := map[int]string{}
+	for _, m := range backup.MonitorList {
+		if m.Type == "group" {
+			groups[m.ID] = m.Name
+		}
+	}
+	for _, m := range backup.MonitorList {
+		if m.Type == "group" {
+			continue
+		}
+		if m.Type != "http" && m.Type != "keyword" {
+			unmapped = append(unmapped, "monitor "+m.Name+": type "+m.Type+" is not supported")
+			continue
+		}
+		monitor := Monitor{
+			Name:     m.Name,
+			Type:     HTTP,
+			URL:      m.URL,
+			Freq:     durationString(time.Duration(max(m.Interval, 20)) * time.Second),
+			Timeout:  durationString(time.Duration(m.Timeout * float64(time.Second))),
+			StatusOK: http.StatusOK,
+			Active:   bool(m.Active),
+		}
+		if m.Timeout <= 0 {
+			monitor.Timeout = "5s"
+		}
+		if m.RetryInterval > 0 && m.RetryInterval != m.Interval {
+			monitor.DownFreq = durationString(time.Duration(m.RetryInterval) * time.Second)
+		}
+		if m.Parent != nil {
+			monitor.Group = groups[*m.Parent]
+		}
+		for id, enabled := range m.NotificationIDList {
+			if name, ok := notifiers[id]; ok && enabled {
+				monitor.Notifiers = append(monitor.Notifiers, name)
+			}
+		}
+		slices.Sort(monitor.Notifiers)
+		switch codes := m.AcceptedStatusCodes; {
+		case len(codes) == 0, len(codes) == 1 && codes[0] == "200-299":
+		case len(codes) == 1 && !strings.Contains(codes[0], "-"):
+			code, err := strconv.Atoi(codes[0])
+			if err != nil {
+				unmapped = append(unmapped, "monitor "+m.Name+": accepted status codes "+codes[0]+" (imported as 200)")
+				break
+			}
+			monitor.StatusOK = code
+		default:
+			unmapped = append(unmapped, "monitor "+m.Name+": accepted status codes "+strings.Join(codes, ", ")+
+				" (imported as 200)")
+		}
+		if m.Type == "keyword" {
+			unmapped = append(unmapped, "monitor "+m.Name+": keyword "+m.Keyword+" is not checked")
+		}
+		if m.Method != "" && m.Method != http.MethodGet {
+			unmapped = append(unmapped, "monitor "+m.Name+": method "+m.Method+" (imported as GET)")
+		}
+		if m.MaxRetries > 0 {
+			unmapped = append(unmapped, "monitor "+m.Name+": retries "+strconv.Itoa(m.MaxRetries))
+		}
+		if m.UpsideDown {
+			unmapped = append(unmapped, "monitor "+m.Name+": upside down mode")
+		}
+		doc.Monitors = append(doc.Monitors, monitor)
+	}
+	return doc, unmapped, nil
+}
+
+// gatusConfig is the part of a Gatus config that is imported.
+type gatusConfig struct {
+	Alerting  map[string]map[string]any `yaml:"alerting"`
+	Endpoints []struct {
+		Name       string   `yaml:"name"`
+		Group      string   `yaml:"group"`
+		URL        string   `yaml:"url"`
+		Method     string   `yaml:"method"`
+		Interval   string   `yaml:"interval"`
+		Conditions []string `yaml:"conditions"`
+		Enabled    *bool    `yaml:"enabled"`
+		Client     struct {
+			Timeout string `yaml:"timeout"`
+		} `yaml:"client"`
+		Alerts []struct {
+			Type string `yaml:"type"`
+		} `yaml:"alerts"`
+	} `yaml:"endpoints"`
+}
+
+// convertGatus translates a Gatus YAML config. Alerting providers become notifiers named gatus-<provider>.
+func convertGatus(data []byte) (exportDocument, []string, error) {
+	doc := exportDocument{}
+	unmapped := []string{}
+	var config gatusConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return doc, nil, err
+	}
+	if config.Endpoints == nil {
+		return doc, nil, errors.New("no endpoints in Gatus config")
+	}
+	providers := []string{}
+	for provider, settings := range config.Alerting {
+		name := "gatus-" + provider
+		webhook, _ := settings["webhook-url"].(string)
+		switch {
+		case provider == "discord" && webhook != "":
+			doc.Notifiers = append(doc.Notifiers, map[string]any{"name": name, "type": string(Discord), "url": webhook})
+			providers = append(providers, provider)
+		default:
+			unmapped = append(unmapped, "alerting provider "+provider+" is not supported")
+		}
+	}
+	for _, endpoint := range config.Endpoints {
+		monitor := Monitor{
+			Name:     endpoint.Name,
+			Type:     HTTP,
+			URL:      endpoint.URL,
+			Group:    endpoint.Group,
+			Freq:     "1m",
+			Timeout:  "10s",
+			StatusOK: http.StatusOK,
+			Active:   endpoint.Enabled == nil || *endpoint.Enabled,
+		}
+		if !strings.HasPrefix(endpoint.URL, "http://") && !strings.HasPrefix(endpoint.URL, "https://") {
+			unmapped = append(unmapped, "endpoint "+endpoint.Name+": url "+endpoint.URL+" is not an http endpoint")
+			continue
+		}
+		if endpoint.Interval != "" {
+			monitor.Freq = endpoint.Interval
+		}
+		if endpoint.Client.Timeout != "" {
+			monitor.Timeout = endpoint.Client.Timeout
+		}
+		for _, condition := range endpoint.Conditions {
+			if match := gatusStatus.FindStringSubmatch(strings.TrimSpace(condition)); match != nil {
+				monitor.StatusOK, _ = strconv.Atoi(match[1])
+				continue
+			}
+			unmapped = append(unmapped, "endpoint "+endpoint.Name+": condition "+condition)
+		}
+		for _, alert := range endpoint.Alerts {
+			if !slices.Contains(providers, alert.Type) {
+				unmapped = append(unmapped, "endpoint "+endpoint.Name+": alert "+alert.Type)
+				continue
+			}
+			if name := "gatus-" + alert.Type; !slices.Contains(monitor.Notifiers, name) {
+				monitor.Notifiers = append(monitor.Notifiers, name)
+			}
+		}
+		if endpoint.Method != "" && endpoint.Method != http.MethodGet {
+			unmapped = append(unmapped, "endpoint "+endpoint.Name+": method "+endpoint.Method+" (imported as GET)")
+		}
+		doc.Monitors = append(doc.Monitors, monitor)
+	}
+	return doc, unmapped, nil
+}
+
+// blackboxModule is a probe module of a blackbox_exporter config.
+type blackboxModule struct {
+	Prober  string `yaml:"prober"`
+	Timeout string `yaml:"timeout"`
+	HTTP    struct {
+		ValidStatusCodes []int  `yaml:"valid_status_codes"`
+		Method           string `yaml:"method"`
+	} `yaml:"http"`
+}
+
+// prometheusConfig is the part of a Prometheus config with blackbox_exporter scrape jobs that is imported.
+type prometheusConfig struct {
+	Global struct {
+		ScrapeInterval string `yaml:"scrape_interval"`
+	} `yaml:"global"`
+	ScrapeConfigs []struct {
+		JobName        string              `yaml:"job_name"`
+		MetricsPath    string              `yaml:"metrics_path"`
+		ScrapeInterval string              `yaml:"scrape_interval"`
+		Params         map[string][]string `yaml:"params"`
+		StaticConfigs  []struct {
+			Targets []string `yaml:"targets"`
+		} `yaml:"static_configs"`
+		FileSDConfigs []any `yaml:"file_sd_configs"`
+	} `yaml:"scrape_configs"`
+}
+
+// convertBlackbox translates the blackbox_exporter probe jobs of a Prometheus config; every static target
+// becomes a monitor grouped by job. The optional blackbox_exporter config supplies the timeouts and status
+// codes of the modules, otherwise modules are assumed to be http probes expecting 2xx.
+func convertBlackbox(prometheus, blackbox []byte) (exportDocument, []string, error) {
+	doc := exportDocument{}
+	unmapped := []string{}
+	var config prometheusConfig
+	if err := yaml.Unmarshal(prometheus, &config); err != nil {
+		return doc, nil, err
+	}
+	var modules struct {
+		Modules map[string]blackboxModule `yaml:"modules"`
+	}
+	if len(bytes.TrimSpace(blackbox)) > 0 {
+		if err := yaml.Unmarshal(blackbox, &modules); err != nil {
+			return doc, nil, err
+		}
+	}
+	if config.ScrapeConfigs == nil {
+		return doc, nil, errors.New("no scrape_configs in Prometheus config")
+	}
+	for _, job := range config.ScrapeConfigs {
+		if job.Params["module"] == nil && job.MetricsPath != "/probe" {
+			continue
+		}
+		moduleName := "http_2xx"
+		if len(job.Params["module"]) > 0 {
+			moduleName = job.Params["module"][0]
+		}
+		module, ok := modules.Modules[moduleName]
+		switch {
+		case !ok && modules.Modules != nil:
+			unmapped = append(unmapped, "job "+job.JobName+": module "+moduleName+" not in blackbox config")
+			continue
+		case !ok:
+			module = blackboxModule{Prober: "http"}
+		case module.Prober != "http":
+			unmapped = append(unmapped, "job "+job.JobName+": prober "+module.Prober+" is not supported")
+			continue
+		}
+		interval := job.ScrapeInterval
+		if interval == "" {
+			interval = config.Global.ScrapeInterval
+		}
+		if interval == "" {
+			interval = "1m"
+		}
+		statusOK := http.StatusOK
+		switch codes := module.HTTP.ValidStatusCodes; len(codes) {
+		case 0:
+		case 1:
+			statusOK = codes[0]
+		default:
+			valid := []string{}
+			for _, code := range codes {
+				valid = append(valid, strconv.Itoa(code))
+			}
+			unmapped = append(unmapped, "job "+job.JobName+": valid status codes "+strings.Join(valid, ", ")+
+				" (imported as "+valid[0]+")")
+			statusOK = codes[0]
+		}
+		if module.HTTP.Method != "" && module.HTTP.Method != http.MethodGet {
+			unmapped = append(unmapped, "job "+job.JobName+": method "+module.HTTP.Method+" (imported as GET)")
+		}
+		if job.FileSDConfigs != nil {
+			unmapped = append(unmapped, "job "+job.JobName+": file_sd_configs targets")
+		}
+		timeout := module.Timeout
+		if timeout == "" {
+			timeout = "5s"
+		}
+		for _, static := range job.StaticConfigs {
+			for _, target := range static.Targets {
+				url := target
+				if !strings.Contains(url, "://") {
+					url = "http://" + url
+				}
+				doc.Monitors = append(doc.Monitors, Monitor{
+					Name:     targetName(target),
+					Type:     HTTP,
+					URL:      url,
+					Group:    job.JobName,
+					Freq:     interval,
+					Timeout:  timeout,
+					StatusOK: statusOK,
+					Active:   true,
+				})
+			}
+		}
+	}
+	if doc.Monitors == nil && len(unmapped) == 0 {
+		return doc, nil, errors.New("no blackbox_exporter probe jobs in Prometheus config")
+	}
+	return doc, unmapped, nil
+}
+
+// targetName names the monitor of a probe target by its host and path; slashes would break monitor urls.
+func targetName(target string) string {
+	_, name, ok := strings.Cut(target, "://")
+	if !ok {
+		name = target
+	}
+	return strings.ReplaceAll(strings.TrimSuffix(name, "/"), "/", "-")
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationString(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    string
+	}{
+		{60, "1m"},
+		{3600, "1h"},
+		{90, "90s"},
+		{5400, "90m"},
+		{0.5, "0.5s"},
+		{20, "20s"},
+	}
+	for _, tt := range tests {
+		if got := durationString(seconds(tt.seconds)); got != tt.want {
+			t.Errorf("durationString(%vs) = %q, want %q", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestTargetName(t *testing.T) {
+	tests := map[string]string{
+		"example.com":                 "example.com",
+		"https://example.com/":        "example.com",
+		"https://example.com/api/v1":  "example.com-api-v1",
+		"http://example.com:8080/app": "example.com:8080-app",
+	}
+	for target, want := range tests {
+		if got := targetName(target); got != want {
+			t.Errorf("targetName(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestConvertKuma(t *testing.T) {
+	backup := `{"version": "1.23.0",
+"notificationList": [
+	{"id": 1, "name": "chat", "config": "{\"type\":\"discord\",\"discordWebhookUrl\":\"https://discord.example.com/hook\"}"},
+	{"id": 2, "name": "pager", "config": "{\"type\":\"pagerduty\"}"}
+],
+"monitorList": [
+	{"id": 1, "name": "services", "type": "group", "active": 1},
+	{"id": 2, "name": "api", "type": "http", "url": "https://api.example.com", "interval": 60, "retryInterval": 20,
+		"timeout": 48, "active": 1, "parent": 1, "accepted_statuscodes": ["200-299"],
+		"notificationIDList": {"1": true, "2": true}},
+	{"id": 3, "name": "login", "type": "keyword", "url": "https://example.com/login", "interval": 10,
+		"retryInterval": 10, "timeout": 0, "active": false, "keyword": "Sign in", "method": "POST",
+		"accepted_statuscodes": ["301"], "maxretries": 2, "upsideDown": true},
+	{"id": 4, "name": "dns", "type": "dns", "active": true},
+	{"id": 5, "name": "codes", "type": "http", "url": "https://example.com", "interval": 300, "active": true,
+		"accepted_statuscodes": ["200-299", "300-399"]}
+]}`
+	doc, unmapped, err := convertKuma([]byte(backup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Monitor{
+		{Name: "api", Type: HTTP, URL: "https://api.example.com", Freq: "1m", Timeout: "48s", DownFreq: "20s",
+			StatusOK: 200, Active: true, Group: "services", Notifiers: []string{"chat"}},
+		{Name: "login", Type: HTTP, URL: "https://example.com/login", Freq: "20s", Timeout: "5s", StatusOK: 301},
+		{Name: "codes", Type: HTTP, URL: "https://example.com", Freq: "5m", Timeout: "5s", StatusOK: 200, Active: true},
+	}
+	if len(doc.Monitors) != len(want) {
+		t.Fatalf("convertKuma() monitors %+v, want %+v", doc.Monitors, want)
+	}
+	for i := range want {
+		if fields := changedFields(doc.Monitors[i], want[i]); len(fields) > 0 {
+			t.Errorf("monitor %s differs in %v: %+v", want[i].Name, fields, doc.Monitors[i])
+		}
+	}
+	if len(doc.Notifiers) != 1 || doc.Notifiers[0]["url"] != "https://discord.example.com/hook" {
+		t.Errorf("convertKuma() notifiers %v, want the discord notifier", doc.Notifiers)
+	}
+	wantUnmapped := []string{
+		"notification pager: type pagerduty is not supported",
+		"monitor login: keyword Sign in is not checked",
+		"monitor login: method POST (imported as GET)",
+		"monitor login: retries 2",
+		"monitor login: upside down mode",
+		"monitor dns: type dns is not supported",
+		"monitor codes: accepted status codes 200-299, 300-399 (imported as 200)",
+	}
+	if !slices.Equal(unmapped, wantUnmapped) {
+		t.Errorf("convertKuma() unmapped\n%s\nwant\n%s", strings.Join(unmapped, "\n"), strings.Join(wantUnmapped, "\n"))
+	}
+	for _, invalid := range []string{`{}`, `[]`, `{"monitorList": [{"active": "yes"}]}`} {
+		if _, _, err := convertKuma([]byte(invalid)); err == nil {
+			t.Errorf("convertKuma(%s) converted an invalid backup", invalid)
+		}
+	}
+}
+
+func TestConvertGatus(t *testing.T) {
+	config := `
+alerting:
+  discord:
+    webhook-url: https://discord.example.com/hook
+  slack:
+    webhook-url: https://hooks.slack.com/x
+endpoints:
+  - name: api
+    group: core
+    url: https://api.example.com/health
+    interval: 30s
+    client:
+      timeout: 3s
+    conditions:
+      - "[STATUS] == 204"
+      - "[RESPONSE_TIME] < 300"
+    alerts:
+      - type: discord
+      - type: discord
+      - type: slack
+  - name: ping
+    url: icmp://10.0.0.1
+  - name: form
+    url: http://example.com/form
+    method: POST
+    enabled: false
+`
+	doc, unmapped, err := convertGatus([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Monitor{
+		{Name: "api", Type: HTTP, URL: "https://api.example.com/health", Group: "core", Freq: "30s", Timeout: "3s",
+			StatusOK: 204, Active: true, Notifiers: []string{"gatus-discord"}},
+		{Name: "form", Type: HTTP, URL: "http://example.com/form", Freq: "1m", Timeout: "10s", StatusOK: 200},
+	}
+	if len(doc.Monitors) != len(want) {
+		t.Fatalf("convertGatus() monitors %+v, want %+v", doc.Monitors, want)
+	}
+	for i := range want {
+		if fields := changedFields(doc.Monitors[i], want[i]); len(fields) > 0 {
+			t.Errorf("monitor %s differs in %v: %+v", want[i].Name, fields, doc.Monitors[i])
+		}
+	}
+	if len(doc.Notifiers) != 1 || doc.Notifiers[0]["name"] != "gatus-discord" {
+		t.Errorf("convertGatus() notifiers %v, want gatus-discord", doc.Notifiers)
+	}
+	wantUnmapped := []string{
+		"alerting provider slack is not supported",
+		"endpoint api: condition [RESPONSE_TIME] < 300",
+		"endpoint api: alert slack",
+		"endpoint ping: url icmp://10.0.0.1 is not an http endpoint",
+		"endpoint form: method POST (imported as GET)",
+	}
+	if !slices.Equal(unmapped, wantUnmapped) {
+		t.Errorf("convertGatus() unmapped\n%s\nwant\n%s", strings.Join(unmapped, "\n"), strings.Join(wantUnmapped, "\n"))
+	}
+	if _, _, err := convertGatus([]byte("alerting: {}\n")); err == nil {
+		t.Error("converted a Gatus config without endpoints")
+	}
+}
+
+func TestConvertBlackbox(t *testing.T) {
+	prometheus := `
+global:
+  scrape_interval: 30s
+scrape_configs:
+  - job_name: node
+    static_configs:
+      - targets: [localhost:9100]
+  - job_name: websites
+    metrics_path: /probe
+    scrape_interval: 1m
+    params:
+      module: [http_post]
+    static_configs:
+      - targets: [https://example.com/, example.org/api]
+    file_sd_configs:
+      - files: [targets.yml]
+  - job_name: defaults
+    metrics_path: /probe
+    static_configs:
+      - targets: [https://status.example.com]
+  - job_name: icmp
+    params:
+      module: [icmp]
+    static_configs:
+      - targets: [10.0.0.1]
+`
+	blackbox := `
+modules:
+  http_post:
+    prober: http
+    timeout: 3s
+    http:
+      method: POST
+      valid_status_codes: [201, 202]
+  http_2xx:
+    prober: http
+  icmp:
+    prober: icmp
+`
+	tests := []struct {
+		name     string
+		blackbox string
+		want     []Monitor
+		unmapped []string
+	}{
+		{"with blackbox config", blackbox, []Monitor{
+			{Name: "example.com", Type: HTTP, URL: "https://example.com/", Group: "websites", Freq: "1m",
+				Timeout: "3s", StatusOK: 201, Active: true},
+			{Name: "example.org-api", Type: HTTP, URL: "http://example.org/api", Group: "websites", Freq: "1m",
+				Timeout: "3s", StatusOK: 201, Active: true},
+			{Name: "status.example.com", Type: HTTP, URL: "https://status.example.com", Group: "defaults",
+				Freq: "30s", Timeout: "5s", StatusOK: 200, Active: true},
+		}, []string{
+			"job websites: valid status codes 201, 202 (imported as 201)",
+			"job websites: method POST (imported as GET)",
+			"job websites: file_sd_configs targets",
+			"job icmp: prober icmp is not supported",
+		}},
+		{"without blackbox config", "", []Monitor{
+			{Name: "example.com", Type: HTTP, URL: "https://example.com/", Group: "websites", Freq: "1m",
+				Timeout: "5s", StatusOK: 200, Active: true},
+			{Name: "example.org-api", Type: HTTP, URL: "http://example.org/api", Group: "websites", Freq: "1m",
+				Timeout: "5s", StatusOK: 200, Active: true},
+			{Name: "status.example.com", Type: HTTP, URL: "https://status.example.com", Group: "defaults",
+				Freq: "30s", Timeout: "5s", StatusOK: 200, Active: true},
+			{Name: "10.0.0.1", Type: HTTP, URL: "http://10.0.0.1", Group: "icmp", Freq: "30s", Timeout: "5s",
+				StatusOK: 200, Active: true},
+		}, []string{"job websites: file_sd_configs targets"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, unmapped, err := convertBlackbox([]byte(prometheus), []byte(tt.blackbox))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(doc.Monitors) != len(tt.want) {
+				t.Fatalf("convertBlackbox() monitors %+v, want %+v", doc.Monitors, tt.want)
+			}
+			for i := range tt.want {
+				if fields := changedFields(doc.Monitors[i], tt.want[i]); len(fields) > 0 {
+					t.Errorf("monitor %s differs in %v: %+v", tt.want[i].Name, fields, doc.Monitors[i])
+				}
+			}
+			if !slices.Equal(unmapped, tt.unmapped) {
+				t.Errorf("convertBlackbox() unmapped %q, want %q", unmapped, tt.unmapped)
+			}
+		})
+	}
+	if _, _, err := convertBlackbox([]byte("global: {}\n"), nil); err == nil {
+		t.Error("converted a Prometheus config without scrape configs")
+	}
+	if _, _, err := convertBlackbox([]byte("scrape_configs:\n  - job_name: node\n"), nil); err == nil {
+		t.Error("converted a Prometheus config without probe jobs")
+	}
+}
+
+func TestImportForeign(t *testing.T) {
+	testDB(t, backendBolt)
+	config := `
+endpoints:
+  - name: api
+    url: https://api.example.com
+  - name: slow
+    url: https://slow.example.com
+    interval: sometimes
+`
+	report, err := importForeign(formatGatus, []byte(config), nil, conflictSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 2 || report[0] != "created monitor api" || !strings.HasPrefix(report[1], "not imported: monitor slow") {
+		t.Errorf("importForeign() report %q", report)
+	}
+	if report, err := importForeign(formatGatus, []byte(config), nil, conflictSkip); err != nil ||
+		report[0] != "skipped monitor api: exists" {
+		t.Errorf("repeated importForeign() = %q, %v", report, err)
+	}
+	if _, err := importForeign("nagios", nil, nil, conflictSkip); err == nil {
+		t.Error("imported an unknown format")
+	}
+}
+
+// seconds returns the duration of a number of seconds.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// incident actions available from signed links.
+const (
+	actionAck     = "ack"
+	actionResolve = "resolve"
+)
+
+var (
+	errIncidentClosed = errors.New("incident is closed")
+	errInvalidLink    = errors.New("invalid or expired link")
+)
+
+// Incident represents a period during which a monitor was down.
+type Incident struct {
+	ID            uint64
+	MonitorID     string
+	Monitor       string // name of the monitor when the incident opened
+	Start         time.Time
+	End           time.Time
+	Cause         string
+	Notifications []IncidentNotification
+
+	Acknowledged time.Time
+	AckBy        string
+	Assignee     string
+	ResolvedBy   string // set when resolved manually rather than by recovery
+	Escalated    bool
+	LastAlert    time.Time
+	Notes        []IncidentNote
+}
+
+// IncidentNote represents a timestamped note added to an incident.
+type IncidentNote struct {
+	Time time.Time
+	User string
+	Text string
+}
+
+// IncidentNotification represents a notification sent during an incident.
+type IncidentNotification struct {
+	Time      time.Time
+	Message   string
+	Notifiers []string // names of the notifiers
+}
+
+// Open reports whether the incident is ongoing.
+func (i Incident) Open() bool {
+	return i.End.IsZero()
+}
+
+// Acked reports whether the incident has been acknowledged.
+func (i Incident) Acked() bool {
+	return !i.Acknowledged.IsZero()
+}
+
+// Duration returns the length of the incident; ongoing incidents are measured to now.
+func (i Incident) Duration() time.Duration {
+	if i.Open() {
+		return time.Since(i.Start).Round(time.Second)
+	}
+	return i.End.Sub(i.Start).Round(time.Second)
+}
+
+// trackIncident opens an incident when the monitor goes down and closes it when the monitor recovers.
+// It returns the open incident, if any, and the incident closed by this status, if any.
+func (m *Monitor) trackIncident(status Status) (*Incident, *Incident) {
+	state, err := getState(m.ID)
+	if err != nil {
+		log.Println("get monitor state", m.Name, err)
+		return nil, nil
+	}
+	down := status.StatusCode != m.StatusOK
+	switch {
+	case state.Incident == 0 && down && !status.Maintenance && !status.Unreachable:
+		incident := Incident{
+			MonitorID: m.ID,
+			Monitor:   m.Name,
+			Start:     status.Time,
+			Cause:     status.Status,
+			LastAlert: status.Time,
+		}
+		if err := saveIncident(&incident); err != nil {
+			log.Println("open incident", m.Name, err)
+			return nil, nil
+		}
+		state.Incident = incident.ID
+		if err := saveState(m.ID, state); err != nil {
+			log.Println("save monitor state", m.Name, err)
+		}
+		log.Println("opened incident", incident.ID, m.Name, incident.Cause)
+		return &incident, nil
+	case state.Incident != 0 && !down:
+		id := state.Incident
+		state.Incident = 0
+		if err := saveState(m.ID, state); err != nil {
+			log.Println("save monitor state", m.Name, err)
+		}
+		incident, err := updateIncident(id, func(incident *Incident) error {
+			if !incident.Open() {
+				return errIncidentClosed
+			}
+			incident.End = status.Time
+			return nil
+		})
+		if errors.Is(err, errIncidentClosed) {
+			// resolved manually while down
+			return nil, nil
+		}
+		if err != nil {
+			log.Println("close incident", m.Name, err)
+			return nil, nil
+		}
+		log.Println("closed incident", incident.ID, m.Name, "down for", incident.Duration())
+		return nil, &incident
+	case state.Incident != 0:
+		incident, err := getIncident(state.Incident)
+		if err != nil {
+			log.Println("get incident", m.Name, err)
+			return nil, nil
+		}
+		if !incident.Open() {
+			return nil, nil
+		}
+		return &incident, nil
+	default:
+		return nil, nil
+	}
+}
+
+// incidentLocks serializes updates of each incident: the scheduler, the web UI and signed links may update
+// an incident at the same time.
+var incidentLocks = struct {
+	sync.Mutex
+	locks map[uint64]*sync.Mutex
+}{locks: map[uint64]*sync.Mutex{}}
+
+// updateIncident applies change to the saved incident with the given ID under its lock and saves it; the
+// incident is not saved if change returns an error.
+func updateIncident(id uint64, change func(*Incident) error) (Incident, error) {
+	incidentLocks.Lock()
+	lock, ok := incidentLocks.locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		incidentLocks.locks[id] = lock
+	}
+	incidentLocks.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+	incident, err := getIncident(id)
+	if err != nil {
+		return incident, err
+	}
+	if err := change(&incident); err != nil {
+		return incident, err
+	}
+	return incident, saveIncident(&incident)
+}
+
+// logIncidentNotification records a notification sent for an incident.
+func logIncidentNotification(incident *Incident, message string, notifiers []string) {
+	if incident == nil || len(notifiers) == 0 {
+		return
+	}
+	if _, err := updateIncident(incident.ID, func(current *Incident) error {
+		current.Notifications = append(current.Notifications, IncidentNotification{
+			Time:      time.Now(),
+			Message:   message,
+			Notifiers: notifiers,
+		})
+		return nil
+	}); err != nil {
+		log.Println("save incident", incident.ID, err)
+	}
+}
+
+// remindIncident sends repeat and escalation notifications for an unacknowledged open incident.
+func (m *Monitor) remindIncident(ctx context.Context, status Status) {
+	repeat, _ := time.ParseDuration(m.RepeatAlert)
+	escalate, _ := time.ParseDuration(m.EscalateAfter)
+	if repeat <= 0 && (escalate <= 0 || len(m.EscalateTo) == 0) {
+		return
+	}
+	state, err := getState(m.ID)
+	if err != nil || state.Incident == 0 {
+		return
+	}
+	incident, err := getIncident(state.Incident)
+	if err != nil {
+		log.Println("get incident", m.Name, err)
+		return
+	}
+	if !incident.Open() || incident.Acked() {
+		return
+	}
+	now := status.Time
+	message := m.Name + " still down after " + now.Sub(incident.Start).Round(time.Second).String() +
+		": " + status.Status
+	if escalate > 0 && len(m.EscalateTo) > 0 && !incident.Escalated && now.Sub(incident.Start) >= escalate {
+		escalation := *m
+		escalation.Notifiers = m.EscalateTo
+		log.Println("escalating incident", incident.ID, m.Name)
+		sent := escalation.sendMessageNotification(ctx, "Uptime Escalation", message+incident.links())
+		// the incident may have been acknowledged or resolved while sending
+		if _, err := updateIncident(incident.ID, func(current *Incident) error {
+			current.Escalated = true
+			current.LastAlert = now
+			return nil
+		}); err != nil {
+			log.Println("save incident", incident.ID, err)
+		}
+		logIncidentNotification(&incident, "escalated: "+message, sent)
+		return
+	}
+	if repeat > 0 && now.Sub(incident.LastAlert) >= repeat {
+		log.Println("repeat alert for incident", incident.ID, m.Name)
+		sent := m.sendMessageNotification(ctx, "Uptime Alert Repeat", message+incident.links())
+		if _, err := updateIncident(incident.ID, func(current *Incident) error {
+			current.LastAlert = now
+			return nil
+		}); err != nil {
+			log.Println("save incident", incident.ID, err)
+		}
+		logIncidentNotification(&incident, "repeat: "+message, sent)
+	}
+}
+
+// acknowledgeIncident marks an open incident as acknowledged, stopping repeat and escalation notifications.
+func acknowledgeIncident(id uint64, user string) (Incident, error) {
+	return updateIncident(id, func(incident *Incident) error {
+		if !incident.Open() {
+			return errIncidentClosed
+		}
+		if !incident.Acked() {
+			incident.Acknowledged = time.Now()
+			incident.AckBy = user
+			log.Println("incident", id, "acknowledged by", user)
+		}
+		return nil
+	})
+}
+
+// resolveIncident closes an open incident by hand. Notifications for the outage are not
+// resumed; a new incident is opened if the monitor goes down again after recovering.
+func resolveIncident(id uint64, user string) (Incident, error) {
+	return updateIncident(id, func(incident *Incident) error {
+		if !incident.Open() {
+			return errIncidentClosed
+		}
+		incident.End = time.Now()
+		incident.ResolvedBy = user
+		if !incident.Acked() {
+			incident.Acknowledged = incident.End
+			incident.AckBy = user
+		}
+		log.Println("incident", id, "resolved by", user)
+		return nil
+	})
+}
+
+// incidentBaseURL returns the external url of the web server used for links in notifications.
+func incidentBaseURL() string {
+	return strings.TrimSuffix(os.Getenv("UPTIME_URL"), "/")
+}
+
+// signIncident returns the signature of an incident action link.
+func signIncident(id uint64, action string, expires int64) (string, error) {
+	key, err := getSecret("incident")
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.FormatUint(id, 10) + ":" + action + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// incidentLink returns a signed link to perform action on the incident without logging in.
+func incidentLink(id uint64, action string) (string, error) {
+	base := incidentBaseURL()
+	if base == "" {
+		return "", errors.New("UPTIME_URL not set")
+	}
+	expires := time.Now().Add(incidentLinkLifetime).Unix()
+	sig, err := signIncident(id, action, expires)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("sig", sig)
+	return base + "/incident/" + strconv.FormatUint(id, 10) + "/" + action + "?" + query.Encode(), nil
+}
+
+// verifyIncidentLink confirms that a signed link is valid and has not expired.
+func verifyIncidentLink(id uint64, action string, query url.Values) error {
+	if action != actionAck && action != actionResolve {
+		return errInvalidLink
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return errInvalidLink
+	}
+	expected, err := signIncident(id, action, expires)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expected), []byte(query.Get("sig"))) {
+		return errInvalidLink
+	}
+	return nil
+}
+
+// links returns the text of the signed ack and resolve links of the incident for use in notifications.
+func (i Incident) links() string {
+	if incidentBaseURL() == "" || !i.Open() {
+		return ""
+	}
+	ack, err := incidentLink(i.ID, actionAck)
+	if err != nil {
+		log.Println("incident link", i.ID, err)
+		return ""
+	}
+	resolve, err := incidentLink(i.ID, actionResolve)
+	if err != nil {
+		log.Println("incident link", i.ID, err)
+		return ""
+	}
+	return "\nacknowledge: " + ack + "\nresolve: " + resolve
+}
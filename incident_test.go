@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIncidentDuration(t *testing.T) {
+	start := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	closed := Incident{Start: start, End: start.Add(14*time.Minute + 32*time.Second + 400*time.Millisecond)}
+	if got := closed.Duration(); got != 14*time.Minute+32*time.Second {
+		t.Errorf("Duration() = %v, want 14m32s", got)
+	}
+	open := Incident{Start: time.Now().Add(-time.Hour)}
+	if got := open.Duration(); got < time.Hour || got > time.Hour+time.Minute {
+		t.Errorf("Duration() of open incident = %v, want about 1h", got)
+	}
+}
+
+func TestTrackIncident(t *testing.T) {
+	testDB(t, backendBolt)
+	m := Monitor{ID: "m1", Name: "site", StatusOK: 200}
+	start := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	up := Status{StatusCode: 200, Status: "200 OK"}
+	down := Status{StatusCode: 503, Status: "503 Service Unavailable"}
+	maintenance := down
+	maintenance.Maintenance = true
+	unreachable := down
+	unreachable.Unreachable = true
+	tests := []struct {
+		name   string
+		status Status
+		open   bool
+		closed bool
+	}{
+		{"up", up, false, false},
+		{"down in maintenance", maintenance, false, false},
+		{"down behind a down parent", unreachable, false, false},
+		{"goes down", down, true, false},
+		{"still down", down, true, false},
+		{"recovers", up, false, true},
+		{"stays up", up, false, false},
+		{"down again", down, true, false},
+	}
+	var first uint64
+	for i, tt := range tests {
+		tt.status.Time = start.Add(time.Duration(i) * time.Minute)
+		open, closed := m.trackIncident(tt.status)
+		if (open != nil) != tt.open || (closed != nil) != tt.closed {
+			t.Fatalf("%s: trackIncident() open %v closed %v, want %v %v", tt.name, open, closed, tt.open, tt.closed)
+		}
+		switch {
+		case open != nil && first == 0:
+			first = open.ID
+		case open != nil && tt.name == "down again" && open.ID == first:
+			t.Errorf("%s: reopened incident %d", tt.name, first)
+		case closed != nil:
+			if closed.ID != first || closed.Duration() != 2*time.Minute || closed.Cause != down.Status {
+				t.Errorf("%s: closed %+v, want incident %d of 2m", tt.name, closed, first)
+			}
+		}
+	}
+	incidents, err := getIncidents(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incidents) != 2 {
+		t.Errorf("%d incidents, want 2", len(incidents))
+	}
+}
+
+func TestTrackIncidentResolvedByHand(t *testing.T) {
+	testDB(t, backendBolt)
+	m := Monitor{ID: "m1", Name: "site", StatusOK: 200}
+	now := time.Now()
+	open, _ := m.trackIncident(Status{Time: now, StatusCode: 503})
+	if open == nil {
+		t.Fatal("no incident opened")
+	}
+	if _, err := resolveIncident(open.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if open, closed := m.trackIncident(Status{Time: now.Add(time.Minute), StatusCode: 503}); open != nil || closed != nil {
+		t.Errorf("after manual resolve, still down: open %v closed %v, want none", open, closed)
+	}
+	if open, closed := m.trackIncident(Status{Time: now.Add(2 * time.Minute), StatusCode: 200}); open != nil || closed != nil {
+		t.Errorf("after manual resolve, recovered: open %v closed %v, want none", open, closed)
+	}
+	if open, _ := m.trackIncident(Status{Time: now.Add(3 * time.Minute), StatusCode: 503}); open == nil {
+		t.Error("no new incident after recovery")
+	}
+}
+
+func TestVerifyIncidentLink(t *testing.T) {
+	testDB(t, backendBolt)
+	t.Setenv("UPTIME_URL", "https://uptime.example.com/")
+	link, err := incidentLink(7, actionAck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Path != "/incident/7/ack" {
+		t.Errorf("incidentLink() path %q, want /incident/7/ack", parsed.Path)
+	}
+	valid := parsed.Query()
+	expired := url.Values{"expires": {strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)}}
+	sig, err := signIncident(7, actionAck, time.Now().Add(-time.Minute).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.Set("sig", sig)
+	extended := url.Values{"expires": {strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)}, "sig": valid["sig"]}
+	tests := []struct {
+		name   string
+		id     uint64
+		action string
+		query  url.Values
+		err    bool
+	}{
+		{"valid", 7, actionAck, valid, false},
+		{"other incident", 8, actionAck, valid, true},
+		{"other action", 7, actionResolve, valid, true},
+		{"unknown action", 7, "delete", valid, true},
+		{"expired", 7, actionAck, expired, true},
+		{"changed expiry", 7, actionAck, extended, true},
+		{"missing signature", 7, actionAck, url.Values{"expires": valid["expires"]}, true},
+		{"missing expiry", 7, actionAck, url.Values{"sig": valid["sig"]}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyIncidentLink(tt.id, tt.action, tt.query)
+			if (err != nil) != tt.err {
+				t.Errorf("verifyIncidentLink() error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAcknowledgeIncident(t *testing.T) {
+	testDB(t, backendBolt)
+	incident := Incident{MonitorID: "m1", Start: time.Now()}
+	if err := saveIncident(&incident); err != nil {
+		t.Fatal(err)
+	}
+	acked, err := acknowledgeIncident(incident.ID, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acked.Acked() || acked.AckBy != "alice" {
+		t.Errorf("acknowledged by %q at %v, want alice", acked.AckBy, acked.Acknowledged)
+	}
+	again, err := acknowledgeIncident(incident.ID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.AckBy != "alice" || !again.Acknowledged.Equal(acked.Acknowledged) {
+		t.Errorf("second acknowledgement changed it to %q at %v", again.AckBy, again.Acknowledged)
+	}
+	resolved, err := resolveIncident(incident.ID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Open() || resolved.ResolvedBy != "bob" || resolved.AckBy != "alice" {
+		t.Errorf("resolved %+v, want closed by bob and acknowledged by alice", resolved)
+	}
+	if _, err := acknowledgeIncident(incident.ID, "bob"); !errors.Is(err, errIncidentClosed) {
+		t.Errorf("acknowledge closed incident error = %v, want %v", err, errIncidentClosed)
+	}
+	if _, err := resolveIncident(incident.ID, "bob"); !errors.Is(err, errIncidentClosed) {
+		t.Errorf("resolve closed incident error = %v, want %v", err, errIncidentClosed)
+	}
+}
+
+func TestResolveUnacknowledgedIncident(t *testing.T) {
+	testDB(t, backendBolt)
+	incident := Incident{MonitorID: "m1", Start: time.Now()}
+	if err := saveIncident(&incident); err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := resolveIncident(incident.ID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.AckBy != "bob" || !resolved.Acknowledged.Equal(resolved.End) {
+		t.Errorf("resolved %+v, want acknowledged by bob when resolved", resolved)
+	}
+}
+
+func TestRemindIncidentUpdatedWhileSending(t *testing.T) {
+	tests := []struct {
+		name     string
+		monitor  Monitor
+		update   func(id uint64) (Incident, error)
+		resolved bool
+	}{
+		{"repeat acknowledged", Monitor{RepeatAlert: "1m", Notifiers: []string{"n1"}},
+			func(id uint64) (Incident, error) { return acknowledgeIncident(id, "alice") }, false},
+		{"repeat resolved", Monitor{RepeatAlert: "1m", Notifiers: []string{"n1"}},
+			func(id uint64) (Incident, error) { return resolveIncident(id, "alice") }, true},
+		{"escalation acknowledged", Monitor{EscalateAfter: "1m", EscalateTo: []string{"n1"}},
+			func(id uint64) (Incident, error) { return acknowledgeIncident(id, "alice") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t, backendBolt)
+			var id uint64
+			// the on-call engineer acts on the incident while the reminder is sent
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if _, err := tt.update(id); err != nil {
+					t.Error(err)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+			if err := store.CreateNotifier("n1", Discord, []byte(`{"name":"chat","url":"`+server.URL+`"}`)); err != nil {
+				t.Fatal(err)
+			}
+			m := tt.monitor
+			m.ID, m.Name, m.StatusOK = "m1", "site", 200
+			start := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+			down := Status{StatusCode: 503, Status: "503 Service Unavailable", Time: start}
+			open, _ := m.trackIncident(down)
+			if open == nil {
+				t.Fatal("no incident opened")
+			}
+			id = open.ID
+			down.Time = start.Add(2 * time.Minute)
+			m.remindIncident(context.Background(), down)
+			incident, err := getIncident(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if incident.AckBy != "alice" || incident.Open() == tt.resolved {
+				t.Errorf("incident %+v lost the update made while sending", incident)
+			}
+			if !incident.LastAlert.Equal(down.Time) || len(incident.Notifications) != 1 {
+				t.Errorf("last alert %v with %d notifications, want %v and 1", incident.LastAlert,
+					len(incident.Notifications), down.Time)
+			}
+			if escalated := len(m.EscalateTo) > 0; incident.Escalated != escalated {
+				t.Errorf("escalated %v, want %v", incident.Escalated, escalated)
+			}
+		})
+	}
+}
+
+func TestRecordAcknowledgedIncident(t *testing.T) {
+	tests := []struct {
+		name  string
+		acked bool
+		sent  int32
+	}{
+		{"unacknowledged", false, 2},
+		{"acknowledged", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t, backendBolt)
+			var sent atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				sent.Add(1)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+			if err := store.CreateNotifier("n1", Discord, []byte(`{"name":"chat","url":"`+server.URL+`"}`)); err != nil {
+				t.Fatal(err)
+			}
+			m := Monitor{ID: "m1", Name: "site", Type: HTTP, Freq: "1m", StatusOK: http.StatusOK, Active: true,
+				Notifiers: []string{"n1"}}
+			if err := store.SaveMonitor(m, false); err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			options := recordOptions{Notify: true}
+			m.record(context.Background(), Status{Time: now, StatusCode: http.StatusBadGateway,
+				Status: "502 Bad Gateway"}, options)
+			state, err := getState(m.ID)
+			if err != nil || state.Incident == 0 {
+				t.Fatalf("no incident opened: %v", err)
+			}
+			if tt.acked {
+				if _, err := acknowledgeIncident(state.Incident, "alice"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the cause changes while still down
+			m.record(context.Background(), Status{Time: now.Add(time.Minute), StatusCode: http.StatusServiceUnavailable,
+				Status: "503 Service Unavailable"}, options)
+			if got := sent.Load(); got != tt.sent {
+				t.Errorf("sent %d notifications, want %d", got, tt.sent)
+			}
+		})
+	}
+}
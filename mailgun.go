@@ -18,6 +18,7 @@ type MailGunNotifier struct {
 	APIKey     string   `json:"api_key,omitempty"`
 	Recipients []string `json:"recipients,omitempty"`
 	Domain     string   `json:"domain,omitempty"`
+	Team       string   `json:"team,omitempty"`
 }
 
 // MailGunMessage represents an email to be sent to mailgun server.
@@ -85,6 +86,14 @@ func sendMailGunCertExpiryNotification(ctx context.Context, notification []byte,
 			status.Site, status.URL, status.CertExpiry)))
 }
 
+func sendMailGunMessageNotification(ctx context.Context, notification []byte, title, message string) error {
+	var mailgun MailGunNotifier
+	if err := json.Unmarshal(notification, &mailgun); err != nil {
+		return err
+	}
+	return mailgun.SendNotification(ctx, title+"\n"+message)
+}
+
 func (m *MailGunNotifier) form(msg string) (string, io.Reader, error) {
 	body := new(bytes.Buffer)
 	writer := multipart.NewWriter(body)
@@ -3,6 +3,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
@@ -15,24 +16,70 @@ var reset chan os.Signal
 func main() {
 	// setup logging
 	log.SetFlags(log.Lshortfile) // systemd adds timestamps.
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		if err := runAgent(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		if err := runBackup(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := runRestore(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	// open database
 	if err := openDB(); err != nil {
+		if errors.Is(err, errDryRun) {
+			log.Println(err)
+			db.Close()
+			return
+		}
 		log.Fatal(err)
 	}
 	defer db.Close()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := openStore(); err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if _, err := reconcileConfig(); err != nil {
+		log.Fatal("config ", err)
+	}
 	// signals, waitgroups and contexts
 	wgMonitors := &sync.WaitGroup{}
 	wgWeb := &sync.WaitGroup{}
+	wgJanitor := &sync.WaitGroup{}
 	quit := make(chan os.Signal, 1)
 	reset = make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
 	signal.Notify(reset, syscall.SIGHUP)
 	ctxMonitors, cancelMonitors := context.WithCancel(context.Background())
 	ctxWeb, cancelWeb := context.WithCancel(context.Background())
+	ctxJanitor, cancelJanitor := context.WithCancel(context.Background())
 	// start goroutines
 	startMonitors(ctxMonitors, wgMonitors)
 	wgWeb.Add(1)
 	go web(ctxWeb, wgWeb)
+	wgJanitor.Add(1)
+	go janitor(ctxJanitor, wgJanitor)
 	// wait for signals
 	for {
 		select {
@@ -40,11 +87,16 @@ func main() {
 			log.Println("quitting ...")
 			cancelMonitors()
 			cancelWeb()
+			cancelJanitor()
 			wgMonitors.Wait()
 			wgWeb.Wait()
+			wgJanitor.Wait()
 			return
 		case <-reset:
 			log.Println("reset monitors")
+			if _, err := reconcileConfig(); err != nil {
+				log.Println("config", err)
+			}
 			cancelMonitors()
 			wgMonitors.Wait()
 			ctx, cancel := context.WithCancel(context.Background())
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/devilcove/cookie"
+)
+
+// testDB opens a new database and store of the given backend in a temporary directory for the test.
+func testDB(t *testing.T, backend string) {
+	t.Helper()
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("UPTIME_STORE", backend)
+	reset = make(chan os.Signal, 100)
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	if err := openStore(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+		db.Close()
+	})
+}
+
+// testCookie creates the session cookie; it is created once for all tests.
+func testCookie(t *testing.T) {
+	t.Helper()
+	if err := cookie.New(cookieName, cookieAge); err != nil && !errors.Is(err, cookie.ErrExists) {
+		t.Fatal(err)
+	}
+}
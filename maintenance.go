@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"time"
+)
+
+// Recurrence represents how often a maintenance window repeats.
+type Recurrence string
+
+// Maintenance recurrences.
+const (
+	Once    Recurrence = ""        // one-off.
+	Daily   Recurrence = "daily"   // every day.
+	Weekly  Recurrence = "weekly"  // every week.
+	Monthly Recurrence = "monthly" // every month.
+)
+
+// valid reports whether r is one of the maintenance recurrences.
+func (r Recurrence) valid() bool {
+	return slices.Contains([]Recurrence{Once, Daily, Weekly, Monthly}, r)
+}
+
+// Maintenance represents a scheduled maintenance window for monitors or groups of monitors.
+type Maintenance struct {
+	ID       string `json:",omitempty"` // immutable, used in database keys and urls
+	Name     string
+	Monitors []string // monitor IDs
+	Groups   []string
+	Start    time.Time
+	Duration time.Duration
+	Repeat   Recurrence
+}
+
+// occurrence returns the start of the most recent window at or before t.
+func (w Maintenance) occurrence(t time.Time) time.Time {
+	if t.Before(w.Start) {
+		return w.Start
+	}
+	switch w.Repeat {
+	case Daily:
+		days := int(t.Sub(w.Start).Hours() / 24)
+		start := w.Start.AddDate(0, 0, days)
+		if start.After(t) {
+			start = start.AddDate(0, 0, -1)
+		}
+		return start
+	case Weekly:
+		weeks := int(t.Sub(w.Start).Hours() / 24 / 7)
+		start := w.Start.AddDate(0, 0, weeks*7)
+		if start.After(t) {
+			start = start.AddDate(0, 0, -7)
+		}
+		return start
+	case Monthly:
+		months := (t.Year()-w.Start.Year())*12 + int(t.Month()-w.Start.Month())
+		start := w.Start.AddDate(0, months, 0)
+		if start.After(t) {
+			start = w.Start.AddDate(0, months-1, 0)
+		}
+		return start
+	default:
+		return w.Start
+	}
+}
+
+// active reports whether the window is in effect at time t.
+func (w Maintenance) active(t time.Time) bool {
+	start := w.occurrence(t)
+	return !t.Before(start) && t.Before(start.Add(w.Duration))
+}
+
+// targets reports whether the window applies to the monitor.
+func (w Maintenance) targets(m Monitor) bool {
+	return slices.Contains(w.Monitors, m.ID) || (m.Group != "" && slices.Contains(w.Groups, m.Group))
+}
+
+// inMaintenance reports whether the monitor is in a maintenance window at time t.
+func (m *Monitor) inMaintenance(t time.Time) bool {
+	windows, err := getMaintenances()
+	if err != nil {
+		log.Println("get maintenance windows", err)
+		return false
+	}
+	for _, w := range windows {
+		if w.targets(*m) && w.active(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceActive(t *testing.T) {
+	start := time.Date(2026, 1, 5, 22, 0, 0, 0, time.UTC) // a Monday
+	window := func(repeat Recurrence) Maintenance {
+		return Maintenance{Start: start, Duration: 2 * time.Hour, Repeat: repeat}
+	}
+	tests := []struct {
+		name   string
+		window Maintenance
+		time   time.Time
+		want   bool
+	}{
+		{"before start", window(Once), start.Add(-time.Minute), false},
+		{"at start", window(Once), start, true},
+		{"during", window(Once), start.Add(119 * time.Minute), true},
+		{"at end", window(Once), start.Add(2 * time.Hour), false},
+		{"once does not repeat", window(Once), start.AddDate(0, 0, 1), false},
+		{"daily next day", window(Daily), start.AddDate(0, 0, 1).Add(time.Hour), true},
+		{"daily across midnight", window(Daily), start.AddDate(0, 0, 3).Add(90 * time.Minute), true},
+		{"daily between windows", window(Daily), start.AddDate(0, 0, 1).Add(-time.Hour), false},
+		{"weekly next week", window(Weekly), start.AddDate(0, 0, 7).Add(time.Hour), true},
+		{"weekly other day", window(Weekly), start.AddDate(0, 0, 8).Add(time.Hour), false},
+		{"weekly before next week", window(Weekly), start.AddDate(0, 0, 7).Add(-time.Minute), false},
+		{"monthly next month", window(Monthly), start.AddDate(0, 1, 0).Add(time.Hour), true},
+		{"monthly next year", window(Monthly), start.AddDate(1, 0, 0), true},
+		{"monthly early in month", window(Monthly), start.AddDate(0, 2, -2), false},
+		{"monthly other day", window(Monthly), start.AddDate(0, 1, 1).Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.active(tt.time); got != tt.want {
+				t.Errorf("active(%v) = %v, want %v (occurrence %v)", tt.time, got, tt.want,
+					tt.window.occurrence(tt.time))
+			}
+		})
+	}
+}
+
+func TestMaintenanceTargets(t *testing.T) {
+	window := Maintenance{Monitors: []string{"m1"}, Groups: []string{"db"}}
+	tests := []struct {
+		name    string
+		monitor Monitor
+		want    bool
+	}{
+		{"listed monitor", Monitor{ID: "m1"}, true},
+		{"group", Monitor{ID: "m2", Group: "db"}, true},
+		{"other group", Monitor{ID: "m3", Group: "web"}, false},
+		{"no group", Monitor{ID: "m4"}, false},
+	}
+	for _, tt := range tests {
+		if got := window.targets(tt.monitor); got != tt.want {
+			t.Errorf("%s: targets() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInMaintenance(t *testing.T) {
+	testDB(t, backendBolt)
+	now := time.Now()
+	for _, window := range []Maintenance{
+		{ID: "w1", Name: "upgrade", Monitors: []string{"m1"}, Start: now.Add(-time.Minute), Duration: time.Hour},
+		{ID: "w2", Name: "upgrade", Groups: []string{"db"}, Start: now.Add(time.Hour), Duration: time.Hour},
+	} {
+		if err := saveMaintenance(window); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		monitor Monitor
+		time    time.Time
+		want    bool
+	}{
+		{Monitor{ID: "m1"}, now, true},
+		{Monitor{ID: "m1"}, now.Add(time.Hour), false},
+		{Monitor{ID: "m2", Group: "db"}, now, false},
+		{Monitor{ID: "m2", Group: "db"}, now.Add(90 * time.Minute), true},
+	}
+	for _, tt := range tests {
+		if got := tt.monitor.inMaintenance(tt.time); got != tt.want {
+			t.Errorf("%s in maintenance at %v = %v, want %v", tt.monitor.ID, tt.time, got, tt.want)
+		}
+	}
+}
+
+func TestCreateMaintenanceRepeat(t *testing.T) {
+	testDB(t, backendBolt)
+	tests := []struct {
+		repeat string
+		want   int
+	}{
+		{"", http.StatusFound},
+		{"daily", http.StatusFound},
+		{"weekly", http.StatusFound},
+		{"monthly", http.StatusFound},
+		{"yearly", http.StatusBadRequest},
+		{"Daily", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repeat, func(t *testing.T) {
+			form := url.Values{"name": {"deploy " + tt.repeat}, "groups": {"web"}, "start": {"2026-01-05T02:00"},
+				"duration": {"1h"}, "repeat": {tt.repeat}}
+			r := httptest.NewRequest(http.MethodPost, "/maintenance/", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			createMaintenance(w, r)
+			if w.Code != tt.want {
+				t.Errorf("createMaintenance() with repeat %q = %d, want %d", tt.repeat, w.Code, tt.want)
+			}
+		})
+	}
+	windows, err := getMaintenances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 4 {
+		t.Errorf("saved %d windows, want 4", len(windows))
+	}
+}
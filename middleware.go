@@ -44,6 +44,30 @@ func auth(next http.Handler) http.Handler {
 	})
 }
 
+// firstRun redirects every page to the setup wizard until a user exists.
+func firstRun(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/setup", "/styles.css", "/favicon.ico":
+		default:
+			if needsSetup() {
+				http.Redirect(w, r, "/setup", http.StatusFound)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// saveSession logs in a user by saving the session cookie.
+func saveSession(w http.ResponseWriter, user SessionUser) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return cookie.Save(w, cookieName, data)
+}
+
 func sessionUser(r *http.Request) (User, error) {
 	user := User{}
 	data, err := cookie.Get(r, cookieName)
@@ -55,9 +79,5 @@ func sessionUser(r *http.Request) (User, error) {
 }
 
 func isAdmin(r *http.Request) bool {
-	user, err := sessionUser(r)
-	if err != nil {
-		return false
-	}
-	return user.Admin
+	return hasRole(r, roleAdmin)
 }
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// errDryRun is returned by openDB after a dry run of pending schema migrations.
+var errDryRun = errors.New("schema migration dry run complete")
+
+// migration upgrades the database from version-1 to version.
+type migration struct {
+	version     int
+	description string
+	apply       func(tx *bbolt.Tx) (int, error) // returns the number of records changed
+}
+
+// migrations are applied in order; append new migrations with the next version number and never
+// change or remove a released one.
+var migrations = []migration{
+	{1, "rewrite user records written by the helper with lowercase keys", migrateUserKeys},
+	{2, "key monitors and notifiers by ID instead of name", migrateIDs},
+	{3, "key history by UTC time", migrateHistoryKeys},
+	{4, "key maintenance windows by ID instead of name", migrateMaintenanceIDs},
+	{5, "key history by UTC time to the nanosecond", migrateHistoryNanos},
+}
+
+// schemaVersion returns the current schema version; the version of the running program.
+func schemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// getSchemaVersion returns the schema version of the database; 0 if not set.
+func getSchemaVersion(tx *bbolt.Tx) (int, error) {
+	bucket := tx.Bucket([]byte("meta"))
+	if bucket == nil {
+		return 0, nil
+	}
+	value := bucket.Get([]byte("schema"))
+	if value == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(value))
+}
+
+func setSchemaVersion(tx *bbolt.Tx, version int) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte("meta"))
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte("schema"), []byte(strconv.Itoa(version)))
+}
+
+// migrateSchema applies pending migrations. With UPTIME_MIGRATE_DRY_RUN set, the migrations are run and
+// rolled back and errDryRun is returned. Unless UPTIME_MIGRATE_BACKUP is false, the database is copied
+// to uptime.db.<version>.<time>.bak before migrating, unless it is new.
+func migrateSchema() error {
+	dryRun, _ := strconv.ParseBool(os.Getenv("UPTIME_MIGRATE_DRY_RUN"))
+	backup := true
+	if value, ok := os.LookupEnv("UPTIME_MIGRATE_BACKUP"); ok {
+		backup, _ = strconv.ParseBool(value)
+	}
+	var current int
+	empty := true
+	if err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		current, err = getSchemaVersion(tx)
+		first, _ := tx.Cursor().First()
+		empty = first == nil
+		return err
+	}); err != nil {
+		return err
+	}
+	if current > schemaVersion() {
+		return errors.New("database schema version " + strconv.Itoa(current) +
+			" is newer than supported version " + strconv.Itoa(schemaVersion()))
+	}
+	if current == schemaVersion() {
+		if dryRun {
+			log.Println("schema version", current, "is current, no migrations pending")
+			return errDryRun
+		}
+		return nil
+	}
+	if backup && !dryRun && !empty {
+		file := db.Path() + "." + strconv.Itoa(current) + "." + time.Now().Format("20060102150405") + ".bak"
+		if err := db.View(func(tx *bbolt.Tx) error {
+			return tx.CopyFile(file, 0o600)
+		}); err != nil {
+			return errors.New("backup before migration: " + err.Error())
+		}
+		log.Println("database backed up to", file)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		err := db.Update(func(tx *bbolt.Tx) error {
+			changed, err := m.apply(tx)
+			if err != nil {
+				return err
+			}
+			log.Println("schema migration", m.version, m.description+":", changed, "records changed")
+			if dryRun {
+				return errDryRun
+			}
+			return setSchemaVersion(tx, m.version)
+		})
+		if dryRun && errors.Is(err, errDryRun) {
+			// later migrations may depend on this one, so they cannot be tried
+			log.Println("dry run: migration", m.version, "rolled back; later migrations not tried")
+			return errDryRun
+		}
+		if err != nil {
+			return errors.New("schema migration " + strconv.Itoa(m.version) + ": " + err.Error())
+		}
+	}
+	log.Println("database schema migrated from version", current, "to", schemaVersion())
+	return nil
+}
+
+// migrateUserKeys rewrites user records in the field names of User.
+func migrateUserKeys(tx *bbolt.Tx) (int, error) {
+	bucket := tx.Bucket([]byte("users"))
+	if bucket == nil {
+		return 0, nil
+	}
+	updated := map[string][]byte{}
+	if err := bucket.ForEach(func(k, v []byte) error {
+		var user User
+		if err := json.Unmarshal(v, &user); err != nil {
+			return errors.New("user " + string(k) + ": " + err.Error())
+		}
+		user.Name = string(k)
+		bytes, err := json.Marshal(&user)
+		if err != nil {
+			return err
+		}
+		if string(bytes) != string(v) {
+			updated[string(k)] = bytes
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	for k, v := range updated {
+		if err := bucket.Put([]byte(k), v); err != nil {
+			return 0, err
+		}
+	}
+	return len(updated), nil
+}
+
+// migrateIDs rekeys monitors and notifiers, and the status, history, rollups, location results and state of
+// monitors, from their names to IDs and rewrites the references of monitors, incidents and maintenance
+// windows. IDs are derived from the names by legacyID, so the sqlite store migrates to the same IDs.
+func migrateIDs(tx *bbolt.Tx) (int, error) {
+	monitorID := func(name string) string { return legacyID("monitor", name) }
+	notifierID := func(name string) string { return legacyID("notifier", name) }
+	changed := 0
+	rewrites := []struct {
+		bucket string
+		rekey  bool
+		apply  func(key string, value []byte) ([]byte, error)
+	}{
+		{"monitors", true, func(key string, value []byte) ([]byte, error) {
+			var monitor Monitor
+			if err := json.Unmarshal(value, &monitor); err != nil {
+				return nil, err
+			}
+			monitor.ID = monitorID(key)
+			monitor.Parents = legacyIDs("monitor", monitor.Parents)
+			monitor.Notifiers = legacyIDs("notifier", monitor.Notifiers)
+			monitor.EscalateTo = legacyIDs("notifier", monitor.EscalateTo)
+			return json.Marshal(monitor)
+		}},
+		{"status", true, func(key string, value []byte) ([]byte, error) {
+			var status Status
+			if err := json.Unmarshal(value, &status); err != nil {
+				return nil, err
+			}
+			status.MonitorID = monitorID(key)
+			return json.Marshal(status)
+		}},
+		{"state", true, func(_ string, value []byte) ([]byte, error) {
+			return value, nil
+		}},
+		{"incidents", false, func(_ string, value []byte) ([]byte, error) {
+			var incident Incident
+			if err := json.Unmarshal(value, &incident); err != nil {
+				return nil, err
+			}
+			incident.MonitorID = monitorID(incident.Monitor)
+			return json.Marshal(incident)
+		}},
+		{"maintenance", false, func(_ string, value []byte) ([]byte, error) {
+			var window Maintenance
+			if err := json.Unmarshal(value, &window); err != nil {
+				return nil, err
+			}
+			window.Monitors = legacyIDs("monitor", window.Monitors)
+			return json.Marshal(window)
+		}},
+	}
+	for _, rewrite := range rewrites {
+		bucket := tx.Bucket([]byte(rewrite.bucket))
+		if bucket == nil {
+			continue
+		}
+		updated := map[string][]byte{}
+		keys := map[string]string{}
+		if err := bucket.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+			value, err := rewrite.apply(string(k), v)
+			if err != nil {
+				return errors.New(rewrite.bucket + " " + string(k) + ": " + err.Error())
+			}
+			key := string(k)
+			if rewrite.rekey {
+				key = monitorID(key)
+			}
+			updated[key] = value
+			keys[key] = string(k)
+			return nil
+		}); err != nil {
+			return changed, err
+		}
+		for key, value := range updated {
+			if err := bucket.Delete([]byte(keys[key])); err != nil {
+				return changed, err
+			}
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return changed, err
+			}
+		}
+		changed += len(updated)
+	}
+	if notify := tx.Bucket([]byte("notify")); notify != nil {
+		// the name of a notifier was its key; it is now kept in its data
+		if err := notify.ForEachBucket(func(k []byte) error {
+			bucket := notify.Bucket(k)
+			if notifierName(bucket.Get([]byte("data"))) == string(k) {
+				return nil
+			}
+			data, err := setNotifierName(bucket.Get([]byte("data")), string(k))
+			if err != nil {
+				return errors.New("notifier " + string(k) + ": " + err.Error())
+			}
+			return bucket.Put([]byte("data"), data)
+		}); err != nil {
+			return changed, err
+		}
+	}
+	for _, name := range []string{"history", "rollups", "locations", "notify"} {
+		id := monitorID
+		if name == "notify" {
+			id = notifierID
+		}
+		n, err := rekeyBuckets(tx.Bucket([]byte(name)), id)
+		if err != nil {
+			return changed, errors.New(name + ": " + err.Error())
+		}
+		changed += n
+	}
+	return changed, nil
+}
+
+// migrateHistoryKeys rekeys history records saved under local times with an offset by their UTC time, so
+// that keys sort in time order.
+func migrateHistoryKeys(tx *bbolt.Tx) (int, error) {
+	history := tx.Bucket([]byte("history"))
+	if history == nil {
+		return 0, nil
+	}
+	changed := 0
+	err := history.ForEachBucket(func(id []byte) error {
+		bucket := history.Bucket(id)
+		updated := map[string][]byte{}
+		if err := bucket.ForEach(func(k, _ []byte) error {
+			t, err := time.Parse(time.RFC3339, string(k))
+			if err != nil {
+				return errors.New("history " + string(id) + ": " + err.Error())
+			}
+			if key := []byte(t.UTC().Format(time.RFC3339)); string(key) != string(k) {
+				updated[string(k)] = key
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for old, key := range updated {
+			value := slices.Clone(bucket.Get([]byte(old)))
+			if err := bucket.Put(key, value); err != nil {
+				return err
+			}
+			if err := bucket.Delete([]byte(old)); err != nil {
+				return err
+			}
+		}
+		changed += len(updated)
+		return nil
+	})
+	return changed, err
+}
+
+// migrateHistoryNanos rekeys history records from their UTC time in seconds to the full time of the check
+// result, as kept in the record, so that results within the same second no longer replace each other.
+func migrateHistoryNanos(tx *bbolt.Tx) (int, error) {
+	history := tx.Bucket([]byte("history"))
+	if history == nil {
+		return 0, nil
+	}
+	changed := 0
+	err := history.ForEachBucket(func(id []byte) error {
+		bucket := history.Bucket(id)
+		updated := map[string][]byte{}
+		if err := bucket.ForEach(func(k, v []byte) error {
+			var status Status
+			if err := json.Unmarshal(v, &status); err != nil {
+				return errors.New("history " + string(id) + " " + string(k) + ": " + err.Error())
+			}
+			if key := historyKey(status.Time); string(key) != string(k) {
+				updated[string(k)] = key
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for old, key := range updated {
+			value := slices.Clone(bucket.Get([]byte(old)))
+			if err := bucket.Delete([]byte(old)); err != nil {
+				return err
+			}
+			if err := bucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+		changed += len(updated)
+		return nil
+	})
+	return changed, err
+}
+
+// migrateMaintenanceIDs rekeys maintenance windows from their names to IDs derived from the names by
+// legacyID.
+func migrateMaintenanceIDs(tx *bbolt.Tx) (int, error) {
+	bucket := tx.Bucket([]byte("maintenance"))
+	if bucket == nil {
+		return 0, nil
+	}
+	updated := map[string][]byte{}
+	if err := bucket.ForEach(func(k, v []byte) error {
+		var window Maintenance
+		if err := json.Unmarshal(v, &window); err != nil {
+			return errors.New("maintenance " + string(k) + ": " + err.Error())
+		}
+		if window.ID != "" {
+			return nil
+		}
+		window.ID = legacyID("maintenance", string(k))
+		value, err := json.Marshal(window)
+		if err != nil {
+			return err
+		}
+		updated[string(k)] = value
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	for name, value := range updated {
+		if err := bucket.Delete([]byte(name)); err != nil {
+			return 0, err
+		}
+		if err := bucket.Put([]byte(legacyID("maintenance", name)), value); err != nil {
+			return 0, err
+		}
+	}
+	return len(updated), nil
+}
+
+// rekeyBuckets moves the nested buckets of parent to the keys returned by id; other keys are left alone.
+func rekeyBuckets(parent *bbolt.Bucket, id func(string) string) (int, error) {
+	if parent == nil {
+		return 0, nil
+	}
+	keys := []string{}
+	if err := parent.ForEachBucket(func(k []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		bucket, err := parent.CreateBucket([]byte(id(key)))
+		if err != nil {
+			return 0, errors.New(key + ": " + err.Error())
+		}
+		if err := copyBucket(bucket, parent.Bucket([]byte(key))); err != nil {
+			return 0, errors.New(key + ": " + err.Error())
+		}
+		if err := parent.DeleteBucket([]byte(key)); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// copyBucket copies the keys and nested buckets of src to dst.
+func copyBucket(dst, src *bbolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		child, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(child, src.Bucket(k))
+	})
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// putRaw saves a raw value in the named top level bucket.
+func putRaw(t *testing.T, bucket, key, value string) {
+	t.Helper()
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), []byte(value))
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// schema returns the schema version of the database.
+func schema(t *testing.T) int {
+	t.Helper()
+	var version int
+	if err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		version, err = getSchemaVersion(tx)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func setSchema(t *testing.T, version int) {
+	t.Helper()
+	if err := db.Update(func(tx *bbolt.Tx) error { return setSchemaVersion(tx, version) }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateUserKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    User
+		changed int
+	}{
+		{"helper", `{"name":"admin","pass":"hash","admin":true}`, User{Name: "admin", Pass: "hash", Admin: true}, 1},
+		{"current", `{"Name":"admin","Pass":"hash","Role":"editor"}`, User{Name: "admin", Pass: "hash", Role: roleEditor}, 0},
+		{"name from key", `{"Pass":"hash"}`, User{Name: "admin", Pass: "hash"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t, backendBolt)
+			putRaw(t, "users", "admin", tt.value)
+			var changed int
+			if err := db.Update(func(tx *bbolt.Tx) error {
+				var err error
+				changed, err = migrateUserKeys(tx)
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if changed != tt.changed {
+				t.Errorf("migrateUserKeys() changed %d, want %d", changed, tt.changed)
+			}
+			got, err := store.User("admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want.Name || got.Pass != tt.want.Pass || got.Admin != tt.want.Admin ||
+				got.Role != tt.want.Role {
+				t.Errorf("migrated user %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateSchema(t *testing.T) {
+	testDB(t, backendBolt)
+	if got := schema(t); got != schemaVersion() {
+		t.Fatalf("new database schema version %d, want %d", got, schemaVersion())
+	}
+	helperUser := `{"name":"admin","pass":"hash","admin":true}`
+	putRaw(t, "users", "admin", helperUser)
+	setSchema(t, 0)
+
+	t.Setenv("UPTIME_MIGRATE_DRY_RUN", "true")
+	if err := migrateSchema(); !errors.Is(err, errDryRun) {
+		t.Fatalf("dry run error = %v, want %v", err, errDryRun)
+	}
+	if got := schema(t); got != 0 {
+		t.Errorf("schema version %d after dry run, want 0", got)
+	}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		if value := tx.Bucket([]byte("users")).Get([]byte("admin")); string(value) != helperUser {
+			t.Errorf("dry run changed user to %s", value)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("UPTIME_MIGRATE_DRY_RUN", "false")
+	if err := migrateSchema(); err != nil {
+		t.Fatal(err)
+	}
+	if got := schema(t); got != schemaVersion() {
+		t.Errorf("schema version %d after migration, want %d", got, schemaVersion())
+	}
+	user, err := store.User("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "admin" || user.Pass != "hash" || !user.Admin {
+		t.Errorf("migrated user %+v", user)
+	}
+	backups, err := filepath.Glob(db.Path() + ".0.*.bak")
+	if err != nil || len(backups) != 1 {
+		t.Errorf("backups before migration %v, %v, want one", backups, err)
+	}
+
+	setSchema(t, schemaVersion()+1)
+	if err := migrateSchema(); err == nil {
+		t.Error("migrated a database of a newer schema version")
+	}
+}
+
+func TestMigrateSchemaWithoutBackup(t *testing.T) {
+	testDB(t, backendBolt)
+	putRaw(t, "users", "admin", `{"name":"admin","pass":"hash"}`)
+	setSchema(t, 1)
+	t.Setenv("UPTIME_MIGRATE_BACKUP", "false")
+	if err := migrateSchema(); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := filepath.Glob(db.Path() + ".*.bak"); len(backups) != 0 {
+		t.Errorf("backups %v, want none", backups)
+	}
+	if got := schema(t); got != schemaVersion() {
+		t.Errorf("schema version %d, want %d", got, schemaVersion())
+	}
+}
+
+func TestMigrateHistoryKeys(t *testing.T) {
+	testDB(t, backendBolt)
+	keys := []string{"2026-01-05T13:30:00+01:00", "2026-01-05T12:45:00Z", "2026-01-05T08:00:00-05:00"}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		bucket := createBucket([]string{"history", "m1"}, tx)
+		for _, key := range keys {
+			if err := bucket.Put([]byte(key), []byte(`{"Time":"`+key+`"}`)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var changed int
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		changed, err = migrateHistoryKeys(tx)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Errorf("migrateHistoryKeys() changed %d, want 2", changed)
+	}
+	got := []string{}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return getBucket([]string{"history", "m1"}, tx).ForEach(func(k, v []byte) error {
+			got = append(got, string(k)+" "+string(v))
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`2026-01-05T12:30:00Z {"Time":"2026-01-05T13:30:00+01:00"}`,
+		`2026-01-05T12:45:00Z {"Time":"2026-01-05T12:45:00Z"}`,
+		`2026-01-05T13:00:00Z {"Time":"2026-01-05T08:00:00-05:00"}`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("history after migration %q, want %q", got, want)
+	}
+}
+
+func TestMigrateHistoryNanos(t *testing.T) {
+	testDB(t, backendBolt)
+	putPath(t, []string{"history", "m1"}, "2026-01-05T12:30:00Z", `{"Time":"2026-01-05T12:30:00.25Z"}`)
+	putPath(t, []string{"history", "m1"}, "2026-01-05T12:45:00Z", `{"Time":"2026-01-05T12:45:00Z"}`)
+	putPath(t, []string{"history", "m2"}, "2026-01-05T13:00:00.000000000Z", `{"Time":"2026-01-05T13:00:00Z"}`)
+	var changed int
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		changed, err = migrateHistoryNanos(tx)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Errorf("migrateHistoryNanos() changed %d, want 2", changed)
+	}
+	got := []string{}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("history")).ForEachBucket(func(id []byte) error {
+			return getBucket([]string{"history", string(id)}, tx).ForEach(func(k, _ []byte) error {
+				got = append(got, string(id)+" "+string(k))
+				return nil
+			})
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"m1 2026-01-05T12:30:00.250000000Z",
+		"m1 2026-01-05T12:45:00.000000000Z",
+		"m2 2026-01-05T13:00:00.000000000Z",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("history after migration %q, want %q", got, want)
+	}
+}
+
+// putPath saves a raw value in the bucket at path, creating the buckets as needed.
+func putPath(t *testing.T, path []string, key, value string) {
+	t.Helper()
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		return createBucket(path, tx).Put([]byte(key), []byte(value))
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateIDs(t *testing.T) {
+	testDB(t, backendBolt)
+	putRaw(t, "monitors", "api", `{"Name":"api","StatusOK":200,"Notifiers":["ops"],"EscalateTo":["pager"]}`)
+	putRaw(t, "monitors", "web", `{"Name":"web","StatusOK":200,"Parents":["api"]}`)
+	putRaw(t, "status", "api", `{"Site":"api","StatusCode":200}`)
+	putRaw(t, "state", "api", `{"Incident":1}`)
+	putRaw(t, "incidents", string(itob(1)), `{"ID":1,"Monitor":"api","Start":"2026-01-05T12:00:00Z"}`)
+	putRaw(t, "maintenance", "weekly", `{"Name":"weekly","Monitors":["api","web"]}`)
+	putPath(t, []string{"history", "api"}, "2026-01-05T12:00:00Z", `{"Site":"api","Time":"2026-01-05T12:00:00Z"}`)
+	putPath(t, []string{"rollups", "api", rollupHour}, "2026-01-05T12:00:00Z", `{"Count":1}`)
+	putRaw(t, "rollups", "version", rollupVersion)
+	putPath(t, []string{"locations", "api"}, "eu", `{"Site":"api","Location":"eu"}`)
+	putPath(t, []string{"notify", "ops"}, "type", string(Slack))
+	putPath(t, []string{"notify", "ops"}, "data", `{"token":"secret"}`)
+	putPath(t, []string{"notify", "pager"}, "type", string(Slack))
+	putPath(t, []string{"notify", "pager"}, "data", `{"name":"pager"}`)
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := migrateIDs(tx)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	api, web := legacyID("monitor", "api"), legacyID("monitor", "web")
+	ops, pager := legacyID("notifier", "ops"), legacyID("notifier", "pager")
+	monitor, err := getMonitor(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if monitor.ID != api || !slices.Equal(monitor.Notifiers, []string{ops}) || !slices.Equal(monitor.EscalateTo, []string{pager}) {
+		t.Errorf("migrated api %+v, want notifiers by ID", monitor)
+	}
+	if monitor, err := getMonitor(web); err != nil || !slices.Equal(monitor.Parents, []string{api}) {
+		t.Errorf("migrated web %+v, %v, want parent by ID", monitor, err)
+	}
+	if status, err := store.Status(api); err != nil || status.MonitorID != api {
+		t.Errorf("migrated status %+v, %v", status, err)
+	}
+	if state, err := getState(api); err != nil || state.Incident != 1 {
+		t.Errorf("migrated state %+v, %v", state, err)
+	}
+	if incidents, err := getIncidents(api); err != nil || len(incidents) != 1 {
+		t.Errorf("migrated incidents %+v, %v, want one of api", incidents, err)
+	}
+	if last, err := store.LastHistory(api); err != nil || last.Site != "api" {
+		t.Errorf("migrated history %+v, %v", last, err)
+	}
+	if statuses, err := getLocationStatuses(api); err != nil || len(statuses) != 1 {
+		t.Errorf("migrated location results %+v, %v", statuses, err)
+	}
+	if name := getNotifierName(ops); name != "ops" {
+		t.Errorf("migrated notifier named %q, want ops", name)
+	}
+	if kind, data, err := store.Notifier(ops); err != nil || kind != Slack || !strings.Contains(string(data), "secret") {
+		t.Errorf("migrated notifier %s %s, %v", kind, data, err)
+	}
+	if name := getNotifierName(pager); name != "pager" {
+		t.Errorf("migrated notifier named %q, want pager", name)
+	}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		if getBucket([]string{"rollups", api, rollupHour}, tx) == nil {
+			t.Error("rollups not moved")
+		}
+		if string(tx.Bucket([]byte("rollups")).Get([]byte("version"))) != rollupVersion {
+			t.Error("rollup version lost")
+		}
+		for _, bucket := range []string{"monitors", "status", "state", "history", "locations"} {
+			if value := tx.Bucket([]byte(bucket)).Get([]byte("api")); value != nil {
+				t.Errorf("api left in %s", bucket)
+			}
+			if nested := tx.Bucket([]byte(bucket)).Bucket([]byte("api")); nested != nil {
+				t.Errorf("api bucket left in %s", bucket)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := migrateMaintenanceIDs(tx)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	window, err := getMaintenance(legacyID("maintenance", "weekly"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if window.Name != "weekly" || !slices.Equal(window.Monitors, []string{api, web}) {
+		t.Errorf("migrated maintenance window %+v, want monitors by ID", window)
+	}
+}
+
+func TestLegacyID(t *testing.T) {
+	if legacyID("monitor", "api") == legacyID("notifier", "api") {
+		t.Error("monitors and notifiers of the same name share a legacy ID")
+	}
+	if id := legacyID("monitor", "api"); len(id) != 16 || id != legacyID("monitor", "api") {
+		t.Errorf("legacyID() = %q, want a stable 16 character ID", id)
+	}
+	if ids := legacyIDs("monitor", nil); ids != nil {
+		t.Errorf("legacyIDs(nil) = %v, want nil", ids)
+	}
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -16,76 +16,135 @@ func startMonitors(ctx context.Context, wg *sync.WaitGroup) {
 	monitorers, err := getMonitors()
 	if err != nil {
 		log.Println("get monitors", err)
-	} else {
-		log.Println("starting monitors")
-		for _, m := range monitorers {
-			if !m.Active {
-				continue
-			}
-			wg.Add(1)
-			go monitor(ctx, wg, &m)
+		return
+	}
+	log.Println("starting monitors")
+	active := []Monitor{}
+	for _, m := range monitorers {
+		if m.Active {
+			active = append(active, m)
 		}
 	}
+	checks.start(ctx, wg, active)
 }
 
-func monitor(ctx context.Context, wg *sync.WaitGroup, monitor *Monitor) {
-	defer wg.Done()
-	frequency, err := time.ParseDuration(monitor.Freq)
-	if err != nil {
-		log.Printf("invalid frequency for monitor %s, %s, %v", monitor.Name, monitor.Freq, err)
-		return
-	}
-	timer := time.NewTimer(time.Second)
-	ticker := time.NewTicker(frequency)
-	defer ticker.Stop()
-	log.Println("starting monitor", monitor.Name)
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println(monitor.Name, "shutting down")
-			return
-		case <-ticker.C:
-			monitor.updateStatus(ctx)
-		case <-timer.C:
-			monitor.updateStatus(ctx)
-		}
+// recordLocks serializes the recording of results per monitor: status, flap and incident state are read
+// and saved in separate transactions, and a check now may run while the scheduler checks the monitor.
+var recordLocks = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: map[string]*sync.Mutex{}}
+
+// lockRecord locks the recording of results of the monitor with the given ID and returns the unlock func.
+func lockRecord(id string) func() {
+	recordLocks.Lock()
+	lock, ok := recordLocks.locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		recordLocks.locks[id] = lock
 	}
+	recordLocks.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// recordOptions controls how a check result is processed.
+type recordOptions struct {
+	Notify bool // send notifications for the result
 }
 
 func (m *Monitor) updateStatus(ctx context.Context) {
+	m.record(ctx, m.Check(ctx), recordOptions{Notify: true})
+}
+
+// record saves a check result to status and history and sends any resulting notifications.
+func (m *Monitor) record(ctx context.Context, newStatus Status, options recordOptions) Status {
+	unlock := lockRecord(m.ID)
+	defer unlock()
 	var same bool
-	newStatus := m.Check(ctx)
-	oldStatus, err := getStatus(m.Name)
+	newStatus = m.consensus(newStatus)
+	newStatus.MonitorID = m.ID
+	newStatus.Maintenance = m.inMaintenance(newStatus.Time)
+	if newStatus.StatusCode != m.StatusOK {
+		if parent := m.downParent(ctx); parent != "" {
+			newStatus.Unreachable = true
+			newStatus.Status = "unreachable (parent " + parent + " down)"
+		}
+	}
+	oldStatus, err := getStatus(m.ID)
 	if err != nil {
 		log.Println("get old Status", m.Name, err)
 	}
-	if newStatus.Status == oldStatus.Status {
+	flapping := false
+	if !newStatus.Maintenance && !newStatus.Unreachable {
+		flapping = m.detectFlapping(ctx, oldStatus, newStatus, options.Notify)
+	}
+	if newStatus.Status == oldStatus.Status && newStatus.Maintenance == oldStatus.Maintenance {
 		same = true
-		if newStatus.Time.Sub(oldStatus.Time) < time.Hour {
-			log.Println("no change in last hour ... skipping", m.Name)
-			return
+		if options.Notify && !newStatus.Maintenance && !newStatus.Unreachable && !flapping &&
+			newStatus.StatusCode != m.StatusOK {
+			m.remindIncident(ctx, newStatus)
 		}
-	} else {
-		log.Println("status change", m.Name, "monitor status", oldStatus.Status, "checked status", newStatus.Status)
-		m.sendStatusNotification(ctx, newStatus)
 	}
-	if newStatus.CertExpiry < 10 && same {
-		m.sendCertExpiryNotification(ctx, newStatus)
+	incident, closed := m.trackIncident(newStatus)
+	notifyStatus := func(status Status) {
+		if closed != nil {
+			status.Status += " (down for " + closed.Duration().String() + ")"
+			incident = closed
+		}
+		message := status.Status
+		if incident != nil && closed == nil {
+			status.Status += incident.links()
+		}
+		var sent []string
+		if children := dependents(m.ID); len(children) > 0 {
+			sent = m.sendRootCauseNotification(ctx, status, children)
+		} else {
+			sent = m.sendStatusNotification(ctx, status)
+		}
+		logIncidentNotification(incident, message, sent)
 	}
-	bytes, err := json.Marshal(&newStatus)
-	if err != nil {
-		log.Println("json err", err)
-		return
+	switch {
+	case !options.Notify:
+		if newStatus.Status != oldStatus.Status {
+			log.Println("status change, notifications not requested", m.Name, newStatus.Status)
+		}
+	case newStatus.Maintenance:
+		if newStatus.Status != oldStatus.Status {
+			log.Println("status change during maintenance, notification suppressed", m.Name, newStatus.Status)
+		}
+	case flapping:
+		if newStatus.Status != oldStatus.Status {
+			log.Println("monitor flapping, notification held", m.Name, newStatus.Status)
+		}
+	case newStatus.Unreachable:
+		if newStatus.Status != oldStatus.Status {
+			log.Println("parent down, notification suppressed", m.Name, newStatus.Status)
+		}
+	case newStatus.Status != oldStatus.Status && oldStatus.Unreachable && newStatus.StatusCode == m.StatusOK:
+		log.Println("recovered while unreachable, notification suppressed", m.Name, newStatus.Status)
+	case newStatus.Status != oldStatus.Status && newStatus.StatusCode != m.StatusOK &&
+		oldStatus.StatusCode != m.StatusOK && incident != nil && incident.Acked():
+		log.Println("still down, incident acknowledged, notification suppressed", m.Name, newStatus.Status)
+	case newStatus.Status != oldStatus.Status:
+		log.Println("status change", m.Name, "monitor status", oldStatus.Status, "checked status", newStatus.Status)
+		notifyStatus(newStatus)
+	case oldStatus.Maintenance && newStatus.StatusCode != m.StatusOK:
+		log.Println("still down after maintenance", m.Name, newStatus.Status)
+		notifyStatus(newStatus)
+	}
+	if newStatus.CertExpiry < 10 && same && !newStatus.Maintenance && options.Notify {
+		m.certExpiryReminder(ctx, newStatus)
 	}
-	if err = addKey(m.Name, []string{"status"}, bytes); err != nil {
+	if err := saveStatus(newStatus); err != nil {
 		log.Println("update database", m.Name, err)
-		return
+		return newStatus
 	}
-	if err = addKey(newStatus.Time.Format(time.RFC3339),
-		[]string{"history", m.Name}, bytes); err != nil {
+	if err := addHistory(m.ID, newStatus, m.StatusOK); err != nil {
 		log.Println("update history", m.Name, err)
 	}
 	log.Println("status updated", m.Name, newStatus.Status)
+	return newStatus
 }
 
 func (m *Monitor) checkHTTP(ctx context.Context) Status {
@@ -94,9 +153,10 @@ func (m *Monitor) checkHTTP(ctx context.Context) Status {
 		version = info.Main.Version
 	}
 	status := Status{
-		Site: m.Name,
-		URL:  m.URL,
-		Time: time.Now(),
+		MonitorID: m.ID,
+		Site:      m.Name,
+		URL:       m.URL,
+		Time:      time.Now(),
 	}
 	if m.Type != HTTP {
 		status.Status = "wrong type for http check" + string(m.Type)
@@ -113,13 +173,20 @@ func (m *Monitor) checkHTTP(ctx context.Context) Status {
 		return status
 	}
 	req.Header.Set("User-Agent", "Devilcove/Uptime ("+version+")")
-	client := http.Client{Timeout: timeout}
-	// client := http.Client{Timeout: timeout}
+	// a new connection for each check, so that DNS, connection and TLS failures and certificate renewals are seen
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	defer transport.CloseIdleConnections()
+	client := http.Client{Timeout: timeout, Transport: transport}
 	var resp *http.Response
+	var trace *tracer
+	var start time.Time
 	// check a couple of times, eliminate transitory errors.
 	for range 3 {
-		resp, err = client.Do(req)
-		status.ResponseTime = time.Since(status.Time)
+		trace = &tracer{}
+		start = time.Now()
+		resp, err = client.Do(req.WithContext(trace.context(ctx)))
+		status.ResponseTime = time.Since(start)
 		if err == nil {
 			break
 		}
@@ -136,11 +203,19 @@ func (m *Monitor) checkHTTP(ctx context.Context) Status {
 		return status
 	}
 	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodySize)); err != nil {
+		log.Println("read body", req.URL, err)
+	}
+	done := time.Now()
+	status.Timing = trace.timing(done)
+	status.ResponseTime = done.Sub(start)
 	status.Status = resp.Status
 	status.StatusCode = resp.StatusCode
-	if len(resp.TLS.PeerCertificates) > 0 {
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
 		cert := resp.TLS.PeerCertificates[0]
 		status.CertExpiry = int(time.Until(cert.NotAfter).Hours() / 24)
+		status.CertNotAfter = cert.NotAfter
+		status.CertIssuer = cert.Issuer.String()
 	}
 	return status
 }
@@ -156,12 +231,15 @@ func (m *Monitor) Check(ctx context.Context) Status {
 	}
 }
 
-func (m *Monitor) sendStatusNotification(ctx context.Context, status Status) {
+// sendStatusNotification sends a status notification to each of the monitor's notifiers and returns
+// the names of those successfully notified.
+func (m *Monitor) sendStatusNotification(ctx context.Context, status Status) []string {
+	sent := []string{}
 	for _, n := range m.Notifiers {
 		kind, notification, err := getNotify(n)
 		if err != nil {
 			log.Println("get notification for monitor", m.Name, n, err)
-			return
+			return sent
 		}
 		switch kind {
 		case Slack:
@@ -175,9 +253,29 @@ func (m *Monitor) sendStatusNotification(ctx context.Context, status Status) {
 		}
 		if err != nil {
 			log.Println("send status notification", err)
+			continue
 		}
+		sent = append(sent, notifierName(notification))
 		log.Println("sent", kind, "status nofication for", status.Site, status.URL, status.Status)
 	}
+	return sent
+}
+
+// certExpiryReminder sends a certificate expiry notification at most once per certNotifyInterval.
+func (m *Monitor) certExpiryReminder(ctx context.Context, status Status) {
+	state, err := getState(m.ID)
+	if err != nil {
+		log.Println("get monitor state", m.Name, err)
+		return
+	}
+	if status.Time.Sub(state.CertNotified) < certNotifyInterval {
+		return
+	}
+	m.sendCertExpiryNotification(ctx, status)
+	state.CertNotified = status.Time
+	if err := saveState(m.ID, state); err != nil {
+		log.Println("save monitor state", m.Name, err)
+	}
 }
 
 func (m *Monitor) sendCertExpiryNotification(ctx context.Context, status Status) {
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// janitorStatus records the outcome of the most recent janitor run.
+type janitorStatus struct {
+	lock     sync.Mutex
+	lastRun  time.Time
+	duration time.Duration
+	pruned   int
+}
+
+var janitorRuns janitorStatus
+
+// retention returns how long raw history of the monitor is kept; zero keeps history forever.
+func (m *Monitor) retention(settings Settings) time.Duration {
+	value := settings.Retention
+	if m.Retention != "" {
+		value = m.Retention
+	}
+	if value == "" {
+		return 0
+	}
+	retention, err := parseRetention(value)
+	if err != nil {
+		log.Println("invalid retention", m.Name, value)
+		return 0
+	}
+	return retention
+}
+
+// parseRetention parses a retention period; in addition to time.ParseDuration units, d is accepted for days.
+func parseRetention(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.New("invalid retention " + value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention <= 0 {
+		return 0, errors.New("invalid retention " + value)
+	}
+	return retention, nil
+}
+
+// janitor periodically prunes history older than the retention period and takes scheduled backups.
+func janitor(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	log.Println("starting janitor")
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("janitor stopped")
+			return
+		case <-timer.C:
+			pruneExpired(ctx)
+			scheduledBackup()
+			timer.Reset(janitorInterval)
+		}
+	}
+}
+
+// pruneExpired deletes expired history of all monitors and returns the number of records deleted.
+func pruneExpired(ctx context.Context) int {
+	start := time.Now()
+	settings, err := getSettings()
+	if err != nil {
+		log.Println("get settings", err)
+		return 0
+	}
+	monitors, err := getMonitors()
+	if err != nil {
+		log.Println("get monitors", err)
+		return 0
+	}
+	total := 0
+	for _, m := range monitors {
+		retention := m.retention(settings)
+		if retention == 0 {
+			continue
+		}
+		pruned := 0
+		before := start.Add(-retention)
+		for ctx.Err() == nil {
+			n, err := pruneHistory(m.ID, before, janitorBatch)
+			if err != nil {
+				log.Println("prune history", m.Name, err)
+				break
+			}
+			pruned += n
+			if n < janitorBatch {
+				break
+			}
+		}
+		if pruned > 0 {
+			log.Println("pruned", pruned, "history records of", m.Name, "older than", before.Format(time.RFC3339))
+		}
+		total += pruned
+	}
+	janitorRuns.lock.Lock()
+	janitorRuns.lastRun = start
+	janitorRuns.duration = time.Since(start)
+	janitorRuns.pruned = total
+	janitorRuns.lock.Unlock()
+	log.Println("janitor pruned", total, "history records in", time.Since(start).Round(time.Millisecond))
+	return total
+}
+
+// lastJanitorRun returns the time, duration and number of records pruned by the most recent janitor run.
+func lastJanitorRun() (time.Time, time.Duration, int) {
+	janitorRuns.lock.Lock()
+	defer janitorRuns.lock.Unlock()
+	return janitorRuns.lastRun, janitorRuns.duration, janitorRuns.pruned
+}
+
+// dbSize returns the size in bytes of the database files: uptime.db and, with the sqlite store,
+// uptime.sqlite and its write-ahead log.
+func dbSize() int64 {
+	files := []string{db.Path()}
+	if _, ok := store.(*sqliteStore); ok {
+		file := filepath.Join(dataDir(), sqliteFile)
+		files = append(files, file, file+"-wal")
+	}
+	var size int64
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Println("stat database", err)
+			}
+			continue
+		}
+		size += info.Size()
+	}
+	return size
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"1d", 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"0d", 0, true},
+		{"-1d", 0, true},
+		{"0s", 0, true},
+		{"-1h", 0, true},
+		{"1.5d", 0, true},
+		{"d", 0, true},
+		{"forever", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseRetention(tt.value)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseRetention(%q) error = %v, want error %v", tt.value, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("parseRetention(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonitorRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  string
+		monitor string
+		want    time.Duration
+	}{
+		{"forever", "", "", 0},
+		{"global", "30d", "", 30 * 24 * time.Hour},
+		{"monitor", "", "7d", 7 * 24 * time.Hour},
+		{"monitor overrides global", "30d", "48h", 48 * time.Hour},
+		{"invalid keeps forever", "30d", "soon", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Monitor{Name: tt.name, Retention: tt.monitor}
+			if got := m.retention(Settings{Retention: tt.global}); got != tt.want {
+				t.Errorf("retention() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	for _, backend := range []string{backendBolt, backendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			testDB(t, backend)
+			if err := saveSettings(Settings{Retention: "1d"}); err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now().UTC().Truncate(time.Second)
+			monitors := []struct {
+				monitor Monitor
+				kept    int
+			}{
+				{Monitor{ID: "global", Name: "global", StatusOK: 200}, 24},
+				{Monitor{ID: "own", Name: "own", StatusOK: 200, Retention: "12h"}, 12},
+			}
+			// more expired records than a single batch
+			records := janitorBatch + 48
+			for _, m := range monitors {
+				if err := saveMonitor(m.monitor, false); err != nil {
+					t.Fatal(err)
+				}
+				history := make([]Status, 0, records)
+				for i := records; i > 0; i-- {
+					history = append(history, Status{
+						MonitorID:  m.monitor.ID,
+						Time:       now.Add(-time.Duration(i)*time.Hour + time.Minute),
+						StatusCode: 200,
+					})
+				}
+				if err := store.AddHistory(m.monitor.ID, 200, history...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := 2*records - monitors[0].kept - monitors[1].kept
+			if got := pruneExpired(context.Background()); got != want {
+				t.Errorf("pruneExpired() = %d, want %d", got, want)
+			}
+			counts, err := historyCounts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range monitors {
+				if counts[m.monitor.ID] != m.kept {
+					t.Errorf("%s kept %d records, want %d", m.monitor.Name, counts[m.monitor.ID], m.kept)
+				}
+			}
+			if got := pruneExpired(context.Background()); got != 0 {
+				t.Errorf("second pruneExpired() = %d, want 0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Role is the access level of a user.
+type Role string
+
+// User roles, from least to most access.
+const (
+	roleViewer Role = "viewer" // view status, history, incidents and notifiers
+	roleEditor Role = "editor" // also manage monitors, notifiers, maintenance windows and incidents of their teams
+	roleAdmin  Role = "admin"  // also manage users, settings, the database, agents and the audit log
+)
+
+var roles = []Role{roleViewer, roleEditor, roleAdmin}
+
+// parseRole returns the role with the given name.
+func parseRole(name string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	if !slices.Contains(roles, role) {
+		return "", errors.New("invalid role " + name)
+	}
+	return role, nil
+}
+
+// role returns the role of the user. Users saved before roles existed are admins or viewers by their
+// Admin flag.
+func (u User) role() Role {
+	switch {
+	case u.Role != "":
+		return u.Role
+	case u.Admin:
+		return roleAdmin
+	default:
+		return roleViewer
+	}
+}
+
+// can reports whether the user has at least the given role.
+func (u User) can(role Role) bool {
+	return slices.Index(roles, u.role()) >= slices.Index(roles, role)
+}
+
+// manages reports whether the user may change monitors and notifiers owned by team. Admins and editors
+// in no team manage everything; other editors manage the entries of their teams only.
+func (u User) manages(team string) bool {
+	switch {
+	case u.can(roleAdmin):
+		return true
+	case !u.can(roleEditor):
+		return false
+	case len(u.Teams) == 0:
+		return true
+	default:
+		return team != "" && slices.Contains(u.Teams, team)
+	}
+}
+
+// managesAll reports whether the user manages every one of the teams.
+func (u User) managesAll(teams []string) bool {
+	for _, team := range teams {
+		if !u.manages(team) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitList splits a comma separated list, dropping blank and repeated entries.
+func splitList(value string) []string {
+	items := []string{}
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" && !slices.Contains(items, item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+type userKey struct{}
+
+// currentUser returns the user of the api token or session, read from the database so that changes to
+// roles and teams apply immediately. The password is cleared.
+func currentUser(r *http.Request) (User, error) {
+	if user, ok := r.Context().Value(userKey{}).(User); ok {
+		return user, nil
+	}
+	session, err := sessionUser(r)
+	if err != nil {
+		return User{}, err
+	}
+	user, err := store.User(session.Name)
+	if err != nil {
+		return User{}, err
+	}
+	user.Pass = ""
+	return user, nil
+}
+
+// hasRole reports whether the user of the request has at least the given role.
+func hasRole(r *http.Request, role Role) bool {
+	user, err := currentUser(r)
+	return err == nil && user.can(role)
+}
+
+// canManage reports whether the user of the request may change monitors and notifiers owned by team.
+func canManage(r *http.Request, team string) bool {
+	user, err := currentUser(r)
+	return err == nil && user.manages(team)
+}
+
+// authorize rejects requests from users without the given role. Below admin, the user must also manage
+// the teams of everything the request acts on; see requestTeams. It is applied to single routes so that
+// path values are available.
+func authorize(role Role) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := currentUser(r)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				displayLogin(w, r)
+				return
+			}
+			if !user.can(role) {
+				forbidden(w, errors.New(string(role)+" access required"))
+				return
+			}
+			if role != roleViewer && !user.can(roleAdmin) {
+				for _, team := range requestTeams(r) {
+					if !user.manages(team) {
+						forbidden(w, teamError(team))
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeTeam rejects requests that assign a monitor or notifier to a team the user does not manage.
+// It is applied to the routes that save monitors and notifiers, after authorize.
+func authorizeTeam(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := currentUser(r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			displayLogin(w, r)
+			return
+		}
+		if team := strings.TrimSpace(r.FormValue("team")); !user.manages(team) {
+			forbidden(w, teamError(team))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeSelf rejects requests on users other than the session user unless the user is an admin.
+func authorizeSelf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := currentUser(r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			displayLogin(w, r)
+			return
+		}
+		if r.PathValue("user") != user.Name && !user.can(roleAdmin) {
+			forbidden(w, errors.New("admin access required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forbidden displays an authorization error.
+func forbidden(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusForbidden)
+	displayError(w, err)
+}
+
+// teamError explains a rejected team.
+func teamError(team string) error {
+	if team == "" {
+		return errors.New("only admins and editors in no team manage monitors and notifiers without a team")
+	}
+	return errors.New("not a member of team " + team)
+}
+
+// requestTeams returns the teams owning what a request acts on: the monitor ({site}), notifier
+// ({notify}), incident ({id}) or maintenance window ({window}) of the path, and the monitors and groups
+// submitted in the form.
+func requestTeams(r *http.Request) []string {
+	teams := []string{}
+	add := func(team string) {
+		if !slices.Contains(teams, team) {
+			teams = append(teams, team)
+		}
+	}
+	if id := r.PathValue("site"); id != "" {
+		if monitor, err := getMonitor(id); err == nil {
+			add(monitor.Team)
+		}
+	}
+	if id := r.PathValue("notify"); id != "" {
+		if _, data, err := getNotify(id); err == nil {
+			add(notifierTeam(data))
+		}
+	}
+	if id, err := strconv.ParseUint(r.PathValue("id"), 10, 64); err == nil {
+		if incident, err := getIncident(id); err == nil {
+			if monitor, err := getMonitor(incident.MonitorID); err == nil {
+				add(monitor.Team)
+			}
+		}
+	}
+	if id := r.PathValue("window"); id != "" {
+		if window, err := getMaintenance(id); err == nil {
+			for _, team := range windowTeams(window) {
+				add(team)
+			}
+		}
+	}
+	if r.Method != http.MethodPost {
+		return teams
+	}
+	if err := r.ParseForm(); err != nil {
+		return teams
+	}
+	window := Maintenance{Monitors: r.Form["monitor"], Groups: splitList(r.FormValue("groups"))}
+	for _, team := range windowTeams(window) {
+		add(team)
+	}
+	return teams
+}
+
+// windowTeams returns the teams of the monitors covered by a maintenance window.
+func windowTeams(window Maintenance) []string {
+	teams := []string{}
+	if len(window.Monitors) == 0 && len(window.Groups) == 0 {
+		return teams
+	}
+	monitors, err := getMonitors()
+	if err != nil {
+		log.Println("get monitors", err)
+		return teams
+	}
+	for _, monitor := range monitors {
+		if window.targets(monitor) && !slices.Contains(teams, monitor.Team) {
+			teams = append(teams, monitor.Team)
+		}
+	}
+	return teams
+}
+
+// notifierTeam returns the team in the data of a notifier.
+func notifierTeam(data []byte) string {
+	var notifier struct{ Team string }
+	if err := json.Unmarshal(data, &notifier); err != nil {
+		return ""
+	}
+	return notifier.Team
+}
+
+// remainingAdmins returns the number of admins other than the named user.
+func remainingAdmins(name string) int {
+	count := 0
+	for _, user := range getUsers() {
+		if user.Name != name && user.can(roleAdmin) {
+			count++
+		}
+	}
+	return count
+}
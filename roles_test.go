@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		name string
+		want Role
+		err  bool
+	}{
+		{"viewer", roleViewer, false},
+		{" Editor ", roleEditor, false},
+		{"ADMIN", roleAdmin, false},
+		{"owner", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseRole(tt.name)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseRole(%q) = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestUserCan(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		want Role // highest role
+	}{
+		{"viewer", User{Role: roleViewer}, roleViewer},
+		{"editor", User{Role: roleEditor}, roleEditor},
+		{"admin", User{Role: roleAdmin}, roleAdmin},
+		{"legacy admin", User{Admin: true}, roleAdmin},
+		{"legacy user", User{}, roleViewer},
+		{"role over legacy flag", User{Admin: true, Role: roleViewer}, roleViewer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, role := range roles {
+				if got, want := tt.user.can(role), slices.Index(roles, role) <= slices.Index(roles, tt.want); got != want {
+					t.Errorf("can(%s) = %v, want %v", role, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestManages(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		team string
+		want bool
+	}{
+		{"admin", User{Role: roleAdmin, Teams: []string{"web"}}, "db", true},
+		{"admin without team", User{Role: roleAdmin}, "", true},
+		{"viewer", User{Role: roleViewer}, "", false},
+		{"viewer in team", User{Role: roleViewer, Teams: []string{"web"}}, "web", false},
+		{"editor in no team", User{Role: roleEditor}, "db", true},
+		{"editor in no team without team", User{Role: roleEditor}, "", true},
+		{"editor in team", User{Role: roleEditor, Teams: []string{"web", "db"}}, "db", true},
+		{"editor in other team", User{Role: roleEditor, Teams: []string{"web"}}, "db", false},
+		{"editor in team without team", User{Role: roleEditor, Teams: []string{"web"}}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.manages(tt.team); got != tt.want {
+				t.Errorf("manages(%q) = %v, want %v", tt.team, got, tt.want)
+			}
+		})
+	}
+	editor := User{Role: roleEditor, Teams: []string{"web", "db"}}
+	if !editor.managesAll([]string{"web", "db"}) || editor.managesAll([]string{"web", "ops"}) || !editor.managesAll(nil) {
+		t.Error("managesAll() does not require every team")
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	if got := splitList(" web, db ,,web, "); !slices.Equal(got, []string{"web", "db"}) {
+		t.Errorf("splitList() = %q, want [web db]", got)
+	}
+	if got := splitList(""); len(got) != 0 {
+		t.Errorf("splitList(\"\") = %q, want none", got)
+	}
+}
+
+// teamFixture saves monitors of the web and db teams and one without a team, an incident of the db
+// monitor and a maintenance window of the web group.
+func teamFixture(t *testing.T) {
+	t.Helper()
+	for _, m := range []Monitor{
+		{ID: "web", Name: "web", Team: "web", Group: "frontend"},
+		{ID: "db", Name: "db", Team: "db"},
+		{ID: "shared", Name: "shared"},
+	} {
+		if err := saveMonitor(m, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.CreateNotifier("n1", Slack, []byte(`{"name":"ops","team":"db"}`)); err != nil {
+		t.Fatal(err)
+	}
+	incident := Incident{MonitorID: "db"}
+	if err := saveIncident(&incident); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveMaintenance(Maintenance{ID: "w1", Name: "deploy", Groups: []string{"frontend"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// asUser returns the request acting as the user, as an api token does.
+func asUser(r *http.Request, user User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+}
+
+func TestAuthorize(t *testing.T) {
+	testDB(t, backendBolt)
+	testCookie(t)
+	teamFixture(t)
+	viewer := User{Name: "viewer", Role: roleViewer}
+	web := User{Name: "web", Role: roleEditor, Teams: []string{"web"}}
+	editor := User{Name: "editor", Role: roleEditor}
+	admin := User{Name: "admin", Role: roleAdmin, Teams: []string{"ops"}}
+	tests := []struct {
+		name string
+		role Role
+		user *User
+		path map[string]string
+		form url.Values
+		want int
+	}{
+		{"not logged in", roleViewer, nil, nil, nil, http.StatusUnauthorized},
+		{"viewer", roleViewer, &viewer, map[string]string{"site": "db"}, nil, http.StatusOK},
+		{"viewer editing", roleEditor, &viewer, nil, nil, http.StatusForbidden},
+		{"editor administering", roleAdmin, &editor, nil, nil, http.StatusForbidden},
+		{"team editor views other team", roleViewer, &web, map[string]string{"site": "db"}, nil, http.StatusOK},
+		{"team editor edits own monitor", roleEditor, &web, map[string]string{"site": "web"}, nil, http.StatusOK},
+		{"team editor edits other team", roleEditor, &web, map[string]string{"site": "db"}, nil, http.StatusForbidden},
+		{"team editor edits monitor without team", roleEditor, &web, map[string]string{"site": "shared"}, nil,
+			http.StatusForbidden},
+		{"team editor edits other notifier", roleEditor, &web, map[string]string{"notify": "n1"}, nil,
+			http.StatusForbidden},
+		{"team editor acks other incident", roleEditor, &web, map[string]string{"id": "1"}, nil, http.StatusForbidden},
+		{"team editor edits own window", roleEditor, &web, map[string]string{"window": "w1"}, nil, http.StatusOK},
+		{"team editor adds other monitor to window", roleEditor, &web, map[string]string{"window": "w1"},
+			url.Values{"monitor": {"db"}}, http.StatusForbidden},
+		{"team editor adds other group", roleEditor, &web, nil, url.Values{"groups": {"frontend, x"}}, http.StatusOK},
+		{"editor in no team", roleEditor, &editor, map[string]string{"site": "db", "notify": "n1"}, nil, http.StatusOK},
+		{"admin outside own team", roleAdmin, &admin, map[string]string{"site": "db"}, nil, http.StatusOK},
+		{"missing monitor", roleEditor, &web, map[string]string{"site": "missing"}, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodGet
+			var body *strings.Reader
+			if tt.form != nil {
+				method = http.MethodPost
+				body = strings.NewReader(tt.form.Encode())
+			} else {
+				body = strings.NewReader("")
+			}
+			r := httptest.NewRequest(method, "/", body)
+			if tt.form != nil {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			for key, value := range tt.path {
+				r.SetPathValue(key, value)
+			}
+			if tt.user != nil {
+				r = asUser(r, *tt.user)
+			}
+			w := httptest.NewRecorder()
+			authorize(tt.role)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("authorize(%s) = %d, want %d", tt.role, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeTeam(t *testing.T) {
+	testDB(t, backendBolt)
+	testCookie(t)
+	tests := []struct {
+		name string
+		user User
+		team string
+		want int
+	}{
+		{"own team", User{Role: roleEditor, Teams: []string{"web"}}, "web", http.StatusOK},
+		{"own team with spaces", User{Role: roleEditor, Teams: []string{"web"}}, " web ", http.StatusOK},
+		{"other team", User{Role: roleEditor, Teams: []string{"web"}}, "db", http.StatusForbidden},
+		{"no team", User{Role: roleEditor, Teams: []string{"web"}}, "", http.StatusForbidden},
+		{"editor in no team", User{Role: roleEditor}, "db", http.StatusOK},
+		{"admin", User{Role: roleAdmin, Teams: []string{"web"}}, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"team": {tt.team}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			authorizeTeam(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, asUser(r, tt.user))
+			if w.Code != tt.want {
+				t.Errorf("authorizeTeam() = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentUserFromSession(t *testing.T) {
+	testDB(t, backendBolt)
+	testCookie(t)
+	if err := store.SaveUser(User{Name: "alice", Pass: "hash", Role: roleEditor}, false); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if err := saveSession(w, SessionUser{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	user, err := currentUser(r)
+	if err != nil || user.Role != roleEditor || user.Pass != "" {
+		t.Fatalf("currentUser() = %+v, %v, want editor without password", user, err)
+	}
+	// role changes apply to existing sessions
+	if err := store.SaveUser(User{Name: "alice", Pass: "hash", Role: roleViewer}, true); err != nil {
+		t.Fatal(err)
+	}
+	if hasRole(r, roleEditor) || !hasRole(r, roleViewer) {
+		t.Error("demoted user keeps the editor role")
+	}
+	if err := store.DeleteUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := currentUser(r); err == nil {
+		t.Error("deleted user still current")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Rollup periods.
+const (
+	rollupHour = "hour"
+	rollupDay  = "day"
+)
+
+// rollupVersion identifies the rollup format; rollups of other versions are rebuilt from history.
+const rollupVersion = "2"
+
+// maxRecordGap is the longest time between check results counted towards availability; longer gaps,
+// such as while a monitor is paused, are treated as unknown.
+const maxRecordGap = 2 * time.Hour
+
+// latency histogram bins grow by rollupBinFactor from 1ms; the last bin holds everything slower.
+const (
+	rollupBinFactor = 1.1
+	rollupBins      = 120
+)
+
+// Rollup represents the aggregated checks of a monitor over an hour or a day.
+type Rollup struct {
+	Start time.Time
+	Count int // checks, excluding maintenance
+	Good  int // checks with the OK status
+	Min   time.Duration
+	Max   time.Duration
+	Sum   time.Duration
+	Bins  map[int]int // latency histogram used for percentiles
+	Up    time.Duration
+	Down  time.Duration
+}
+
+// add includes a check result in the rollup.
+func (r *Rollup) add(status Status, ok int) {
+	if r.Count == 0 || status.ResponseTime < r.Min {
+		r.Min = status.ResponseTime
+	}
+	r.Max = max(r.Max, status.ResponseTime)
+	r.Count++
+	if status.StatusCode == ok {
+		r.Good++
+	}
+	r.Sum += status.ResponseTime
+	if r.Bins == nil {
+		r.Bins = map[int]int{}
+	}
+	r.Bins[latencyBin(status.ResponseTime)]++
+}
+
+// merge combines another rollup into r.
+func (r *Rollup) merge(other Rollup) {
+	if other.Count > 0 && (r.Count == 0 || other.Min < r.Min) {
+		r.Min = other.Min
+	}
+	r.Max = max(r.Max, other.Max)
+	r.Count += other.Count
+	r.Good += other.Good
+	r.Sum += other.Sum
+	r.Up += other.Up
+	r.Down += other.Down
+	if r.Bins == nil {
+		r.Bins = map[int]int{}
+	}
+	for bin, n := range other.Bins {
+		r.Bins[bin] += n
+	}
+}
+
+// Avg returns the mean response time.
+func (r Rollup) Avg() time.Duration {
+	if r.Count == 0 {
+		return 0
+	}
+	return r.Sum / time.Duration(r.Count)
+}
+
+// Uptime returns the time weighted availability as a percentage. The ratio of good checks is used when
+// no time has been recorded.
+func (r Rollup) Uptime() float64 {
+	if r.Up+r.Down > 0 {
+		return float64(r.Up) / float64(r.Up+r.Down) * 100
+	}
+	if r.Count == 0 {
+		return 0
+	}
+	return float64(r.Good) / float64(r.Count) * 100
+}
+
+// Percentile returns an approximation of the given percentile of response time.
+func (r Rollup) Percentile(p float64) time.Duration {
+	if r.Count == 0 {
+		return 0
+	}
+	target := int(math.Ceil(float64(r.Count) * p / 100))
+	seen := 0
+	for bin := range rollupBins {
+		seen += r.Bins[bin]
+		if seen >= target {
+			return min(max(binLimit(bin), r.Min), r.Max)
+		}
+	}
+	return r.Max
+}
+
+// latencyBin returns the histogram bin of a response time.
+func latencyBin(d time.Duration) int {
+	ms := float64(d) / float64(time.Millisecond)
+	if ms <= 1 {
+		return 0
+	}
+	return min(int(math.Ceil(math.Log(ms)/math.Log(rollupBinFactor))), rollupBins-1)
+}
+
+// binLimit returns the upper bound of a histogram bin.
+func binLimit(bin int) time.Duration {
+	return time.Duration(math.Pow(rollupBinFactor, float64(bin)) * float64(time.Millisecond))
+}
+
+// rollupStart returns the start of the period containing t.
+func rollupStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	if period == rollupDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// rollupUpdate applies a change to the rollup of the period containing t.
+type rollupUpdate func(period string, t time.Time, change func(*Rollup)) error
+
+// applyRollup includes a check result in the hourly and daily rollups of a monitor. The time from the
+// previous check result to this one is added to the up or down time of the rollups according to the
+// previous state. A result inserted before next, a result already included, splits the time from previous
+// to next counted when next was included.
+func applyRollup(update rollupUpdate, previous, next *Status, status Status, ok int) error {
+	if next != nil {
+		if err := spanAvailability(update, previous, *next, ok, -1); err != nil {
+			return err
+		}
+		if err := spanAvailability(update, &status, *next, ok, 1); err != nil {
+			return err
+		}
+	}
+	if err := spanAvailability(update, previous, status, ok, 1); err != nil {
+		return err
+	}
+	if status.Maintenance {
+		return nil
+	}
+	for _, period := range []string{rollupHour, rollupDay} {
+		if err := update(period, status.Time, func(rollup *Rollup) {
+			rollup.add(status, ok)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spanAvailability adds (sign 1) or removes (sign -1) the time from previous to status to or from the up or
+// down time of the rollups. Nothing is counted after a maintenance result or over gaps longer than
+// maxRecordGap.
+func spanAvailability(update rollupUpdate, previous *Status, status Status, ok int, sign time.Duration) error {
+	if previous == nil || previous.Maintenance {
+		return nil
+	}
+	if gap := status.Time.Sub(previous.Time); gap <= 0 || gap > maxRecordGap {
+		return nil
+	}
+	return addAvailability(update, *previous, status.Time, ok, sign)
+}
+
+// addAvailability adds the time from the status to until, times sign, to the up or down time of the
+// rollups, split at period boundaries.
+func addAvailability(update rollupUpdate, status Status, until time.Time, ok int, sign time.Duration) error {
+	for _, period := range []string{rollupHour, rollupDay} {
+		for from := status.Time; from.Before(until); {
+			next := rollupStart(period, from).Add(time.Hour)
+			if period == rollupDay {
+				next = rollupStart(period, from).AddDate(0, 0, 1)
+			}
+			to := next
+			if until.Before(next) {
+				to = until
+			}
+			if err := update(period, from, func(rollup *Rollup) {
+				if status.StatusCode == ok {
+					rollup.Up += sign * to.Sub(from)
+				} else {
+					rollup.Down += sign * to.Sub(from)
+				}
+			}); err != nil {
+				return err
+			}
+			from = to
+		}
+	}
+	return nil
+}
+
+// getRollups returns the rollups of the named monitor for the period starting at or after since, oldest first.
+func getRollups(name, period string, since time.Time) ([]Rollup, error) {
+	return store.Rollups(name, period, rollupStart(period, since))
+}
+
+// summarize combines the rollups of the named monitor since the given time.
+func summarize(name string, since time.Time) (Rollup, error) {
+	return summarizeRange(name, since, time.Now())
+}
+
+// summarizeRange combines the rollups of the named monitor that start from since until before until.
+// Hourly rollups are used for spans starting up to a month ago, daily rollups beyond, so the range is
+// rounded to their boundaries.
+func summarizeRange(name string, since, until time.Time) (Rollup, error) {
+	period := rollupHour
+	if time.Since(since) > 31*24*time.Hour {
+		period = rollupDay
+	}
+	rollups, err := getRollups(name, period, since)
+	if err != nil {
+		return Rollup{}, err
+	}
+	total := Rollup{Start: since}
+	for _, rollup := range rollups {
+		if rollup.Start.Before(until) {
+			total.merge(rollup)
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBin(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		want    int
+	}{
+		{0, 0},
+		{500 * time.Microsecond, 0},
+		{time.Millisecond, 0},
+		{1100 * time.Microsecond, 1},
+		{1200 * time.Microsecond, 2},
+		{time.Hour, rollupBins - 1},
+	}
+	for _, tt := range tests {
+		if got := latencyBin(tt.latency); got != tt.want {
+			t.Errorf("latencyBin(%v) = %d, want %d", tt.latency, got, tt.want)
+		}
+	}
+	for _, latency := range []time.Duration{3 * time.Millisecond, 250 * time.Millisecond, 4 * time.Second} {
+		bin := latencyBin(latency)
+		if latency > binLimit(bin)+time.Microsecond || latency <= binLimit(bin-1) {
+			t.Errorf("%v in bin %d from %v to %v", latency, bin, binLimit(bin-1), binLimit(bin))
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	rollup := func(latencies ...time.Duration) Rollup {
+		r := Rollup{}
+		for _, latency := range latencies {
+			r.add(Status{ResponseTime: latency, StatusCode: 200}, 200)
+		}
+		return r
+	}
+	spread := make([]time.Duration, 0, 100)
+	for i := 1; i <= 100; i++ {
+		spread = append(spread, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		name   string
+		rollup Rollup
+		p      float64
+		low    time.Duration
+		high   time.Duration
+	}{
+		{"empty", Rollup{}, 95, 0, 0},
+		{"single", rollup(42 * time.Millisecond), 95, 42 * time.Millisecond, 42 * time.Millisecond},
+		{"p95", rollup(spread...), 95, 95 * time.Millisecond, 105 * time.Millisecond},
+		{"p50", rollup(spread...), 50, 50 * time.Millisecond, 55 * time.Millisecond},
+		{"p100 is max", rollup(spread...), 100, 100 * time.Millisecond, 100 * time.Millisecond},
+		{"p0 is min", rollup(spread...), 0, time.Millisecond, time.Millisecond},
+		{"outlier", rollup(10*time.Millisecond, 10*time.Millisecond, 10*time.Millisecond, 10*time.Millisecond,
+			time.Minute), 80, 10 * time.Millisecond, 11 * time.Millisecond},
+		{"slower than the last bin", rollup(time.Hour, 2*time.Hour), 50, time.Hour, 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rollup.Percentile(tt.p); got < tt.low || got > tt.high {
+				t.Errorf("Percentile(%v) = %v, want %v to %v", tt.p, got, tt.low, tt.high)
+			}
+		})
+	}
+}
+
+func TestRollupAddMerge(t *testing.T) {
+	first, second := Rollup{}, Rollup{}
+	first.add(Status{StatusCode: 200, ResponseTime: 20 * time.Millisecond}, 200)
+	first.add(Status{StatusCode: 503, ResponseTime: 40 * time.Millisecond}, 200)
+	second.add(Status{StatusCode: 200, ResponseTime: 10 * time.Millisecond}, 200)
+	second.add(Status{StatusCode: 200, ResponseTime: 50 * time.Millisecond}, 200)
+	second.Up = 3 * time.Minute
+	second.Down = time.Minute
+	total := Rollup{}
+	total.merge(first)
+	total.merge(second)
+	total.merge(Rollup{})
+	if total.Count != 4 || total.Good != 3 {
+		t.Errorf("merged %d checks, %d good, want 4, 3", total.Count, total.Good)
+	}
+	if total.Min != 10*time.Millisecond || total.Max != 50*time.Millisecond || total.Avg() != 30*time.Millisecond {
+		t.Errorf("merged min %v max %v avg %v, want 10ms 50ms 30ms", total.Min, total.Max, total.Avg())
+	}
+	bins := 0
+	for _, n := range total.Bins {
+		bins += n
+	}
+	if bins != 4 {
+		t.Errorf("merged histogram holds %d checks, want 4", bins)
+	}
+	if got := total.Uptime(); got != 75 {
+		t.Errorf("Uptime() = %v, want time weighted 75", got)
+	}
+	if got := first.Uptime(); got != 50 {
+		t.Errorf("Uptime() = %v, want ratio of good checks 50", got)
+	}
+	if got := (Rollup{}).Uptime(); got != 0 {
+		t.Errorf("Uptime() of empty rollup = %v, want 0", got)
+	}
+}
+
+func TestRollupStart(t *testing.T) {
+	at := time.Date(2026, 1, 5, 23, 30, 15, 0, time.FixedZone("EST", -5*60*60))
+	if got, want := rollupStart(rollupHour, at), time.Date(2026, 1, 6, 4, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("rollupStart(hour) = %v, want %v", got, want)
+	}
+	if got, want := rollupStart(rollupDay, at), time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("rollupStart(day) = %v, want %v", got, want)
+	}
+}
+
+// rollupRecorder collects rollups in memory for applyRollup.
+type rollupRecorder map[string]*Rollup
+
+func (r rollupRecorder) update(period string, t time.Time, change func(*Rollup)) error {
+	start := rollupStart(period, t)
+	key := period + " " + start.Format(time.RFC3339)
+	if r[key] == nil {
+		r[key] = &Rollup{Start: start}
+	}
+	change(r[key])
+	return nil
+}
+
+// availability returns the up and down time of the rollup of the period starting at start.
+func (r rollupRecorder) availability(period string, start time.Time) (time.Duration, time.Duration) {
+	rollup := r[period+" "+start.Format(time.RFC3339)]
+	if rollup == nil {
+		return 0, 0
+	}
+	return rollup.Up, rollup.Down
+}
+
+func TestAddAvailability(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	type span struct {
+		period string
+		start  time.Time
+		up     time.Duration
+		down   time.Duration
+	}
+	tests := []struct {
+		name  string
+		code  int
+		from  time.Time
+		until time.Time
+		want  []span
+	}{
+		{"within an hour", 200, at(5, 12, 10), at(5, 12, 40), []span{
+			{rollupHour, at(5, 12, 0), 30 * time.Minute, 0},
+			{rollupDay, at(5, 0, 0), 30 * time.Minute, 0},
+		}},
+		{"across an hour", 503, at(5, 12, 50), at(5, 13, 20), []span{
+			{rollupHour, at(5, 12, 0), 0, 10 * time.Minute},
+			{rollupHour, at(5, 13, 0), 0, 20 * time.Minute},
+			{rollupDay, at(5, 0, 0), 0, 30 * time.Minute},
+		}},
+		{"across midnight", 200, at(5, 23, 45), at(6, 0, 15), []span{
+			{rollupHour, at(5, 23, 0), 15 * time.Minute, 0},
+			{rollupHour, at(6, 0, 0), 15 * time.Minute, 0},
+			{rollupDay, at(5, 0, 0), 15 * time.Minute, 0},
+			{rollupDay, at(6, 0, 0), 15 * time.Minute, 0},
+		}},
+		{"several hours", 200, at(5, 10, 30), at(5, 13, 0), []span{
+			{rollupHour, at(5, 10, 0), 30 * time.Minute, 0},
+			{rollupHour, at(5, 11, 0), time.Hour, 0},
+			{rollupHour, at(5, 12, 0), time.Hour, 0},
+			{rollupHour, at(5, 13, 0), 0, 0},
+			{rollupDay, at(5, 0, 0), 150 * time.Minute, 0},
+		}},
+		{"ends on the hour", 200, at(5, 11, 30), at(5, 12, 0), []span{
+			{rollupHour, at(5, 11, 0), 30 * time.Minute, 0},
+			{rollupHour, at(5, 12, 0), 0, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollups := rollupRecorder{}
+			status := Status{Time: tt.from, StatusCode: tt.code}
+			if err := addAvailability(rollups.update, status, tt.until, 200, 1); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				up, down := rollups.availability(want.period, want.start)
+				if up != want.up || down != want.down {
+					t.Errorf("%s %v: up %v down %v, want %v %v", want.period, want.start, up, down, want.up, want.down)
+				}
+			}
+			if err := addAvailability(rollups.update, status, tt.until, 200, -1); err != nil {
+				t.Fatal(err)
+			}
+			for key, rollup := range rollups {
+				if rollup.Up != 0 || rollup.Down != 0 {
+					t.Errorf("%s: up %v down %v after removing the span, want none", key, rollup.Up, rollup.Down)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRollup(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 1, 5, hour, minute, 0, 0, time.UTC)
+	}
+	up := func(t time.Time) Status { return Status{Time: t, StatusCode: 200} }
+	down := func(t time.Time) Status { return Status{Time: t, StatusCode: 503} }
+	maintenance := func(t time.Time) Status { return Status{Time: t, StatusCode: 503, Maintenance: true} }
+	// each record is applied with the nearest earlier and later records applied before it
+	tests := []struct {
+		name    string
+		records []Status
+		count   int
+		up      time.Duration
+		down    time.Duration
+	}{
+		{"first record", []Status{up(at(12, 0))}, 1, 0, 0},
+		{"in order", []Status{up(at(12, 0)), down(at(12, 20)), up(at(12, 50))}, 3,
+			20 * time.Minute, 30 * time.Minute},
+		{"inserted between", []Status{up(at(12, 0)), up(at(12, 40)), down(at(12, 20))}, 3,
+			20 * time.Minute, 20 * time.Minute},
+		{"inserted before the first", []Status{down(at(12, 30)), up(at(12, 10))}, 2, 20 * time.Minute, 0},
+		{"after maintenance", []Status{maintenance(at(12, 0)), up(at(12, 30)), up(at(12, 40))}, 2,
+			10 * time.Minute, 0},
+		{"maintenance inserted", []Status{down(at(12, 0)), down(at(12, 40)), maintenance(at(12, 10))}, 2,
+			0, 10 * time.Minute},
+		{"gap", []Status{up(at(9, 0)), down(at(11, 1)), up(at(11, 31))}, 3, 0, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollups := rollupRecorder{}
+			var applied []Status
+			for _, status := range tt.records {
+				var previous, next *Status
+				for i := range applied {
+					switch record := &applied[i]; {
+					case record.Time.Before(status.Time) && (previous == nil || record.Time.After(previous.Time)):
+						previous = record
+					case record.Time.After(status.Time) && (next == nil || record.Time.Before(next.Time)):
+						next = record
+					}
+				}
+				if err := applyRollup(rollups.update, previous, next, status, 200); err != nil {
+					t.Fatal(err)
+				}
+				applied = append(applied, status)
+			}
+			total := rollups[rollupDay+" "+at(0, 0).Format(time.RFC3339)]
+			if total == nil {
+				t.Fatal("no daily rollup")
+			}
+			if total.Count != tt.count || total.Up != tt.up || total.Down != tt.down {
+				t.Errorf("%d checks, up %v, down %v, want %d, %v, %v", total.Count, total.Up, total.Down,
+					tt.count, tt.up, tt.down)
+			}
+		})
+	}
+}
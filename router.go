@@ -4,6 +4,7 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"slices"
 	"time"
 )
 
@@ -15,6 +16,7 @@ type Router struct {
 	*http.ServeMux
 
 	chain http.Handler
+	route []Middleware // applied to each route registered
 }
 
 // DefaultRouter creates a new Router using the default ServeMux.
@@ -54,34 +56,53 @@ func (router *Router) Use(middlewares ...Middleware) {
 	}
 }
 
+// With returns a router that registers routes on the same mux with the middlewares applied to each route.
+// Unlike middlewares of a group, they run after the pattern is matched and see its path values.
+func (router *Router) With(middlewares ...Middleware) *Router {
+	return &Router{
+		ServeMux: router.ServeMux,
+		chain:    router.chain,
+		route:    append(slices.Clone(router.route), middlewares...),
+	}
+}
+
+// handle registers the handler, wrapped in the route middlewares, on given pattern.
+func (router *Router) handle(pattern string, handler http.HandlerFunc) {
+	var next http.Handler = handler
+	for _, m := range slices.Backward(router.route) {
+		next = m(next)
+	}
+	router.Handle(pattern, next)
+}
+
 // All registers the handler for all methods on given pattern.
 func (router *Router) All(pattern string, handler http.HandlerFunc) {
-	router.HandleFunc(pattern, handler)
+	router.handle(pattern, handler)
 }
 
 // Post registers the handler for post requests on given pattern.
 func (router *Router) Post(pattern string, handler http.HandlerFunc) {
-	router.HandleFunc("POST\t"+pattern, handler)
+	router.handle("POST\t"+pattern, handler)
 }
 
 // Get registers the handler for get requests on given pattern.
 func (router *Router) Get(pattern string, handler http.HandlerFunc) {
-	router.HandleFunc("GET\t"+pattern, handler)
+	router.handle("GET\t"+pattern, handler)
 }
 
 // Delete registers the handler for delete requests on given pattern.
 func (router *Router) Delete(pattern string, handler http.HandlerFunc) {
-	router.HandleFunc("DELETE\t"+pattern, handler)
+	router.handle("DELETE\t"+pattern, handler)
 }
 
 // Put registers the handler for Put requests on given pattern.
 func (router *Router) Put(pattern string, handler http.HandlerFunc) {
-	router.HandleFunc("PUT\t"+pattern, handler)
+	router.handle("PUT\t"+pattern, handler)
 }
 
 // Patch registers the handler for patch requests on given pattern.
 func (router *Router) Patch(pattern string, handler http.HandlerFunc) {
-	router.HandleFunc("PATCH\t"+pattern, handler)
+	router.handle("PATCH\t"+pattern, handler)
 }
 
 // ServeHTTP implements the http.Handler interface.
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// maxCronSteps limits the search for a cron fire time inside the check window.
+const maxCronSteps = 10000
+
+var (
+	errSchedule    = errors.New("schedule never permits a check")
+	errWindowTime  = errors.New("invalid window time, expected HH:MM")
+	errFrequency   = errors.New("invalid frequency")
+	errTimeZone    = errors.New("invalid time zone")
+	errCronPattern = errors.New("invalid cron expression")
+)
+
+// location returns the time zone of the schedule; local time if unset.
+func (s Schedule) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s", errTimeZone, s.TimeZone)
+	}
+	return loc, nil
+}
+
+// parseClock converts HH:MM to minutes since midnight.
+func parseClock(clock string) (int, error) {
+	hours, minutes, ok := strings.Cut(clock, ":")
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", errWindowTime, clock)
+	}
+	hh, err := strconv.Atoi(hours)
+	if err != nil || hh < 0 || hh > 23 {
+		return 0, fmt.Errorf("%w: %s", errWindowTime, clock)
+	}
+	mm, err := strconv.Atoi(minutes)
+	if err != nil || mm < 0 || mm > 59 {
+		return 0, fmt.Errorf("%w: %s", errWindowTime, clock)
+	}
+	return hh*60 + mm, nil
+}
+
+// window returns the daily window in minutes; the whole day if unset.
+func (s Schedule) window() (int, int, error) {
+	if s.Start == "" && s.End == "" {
+		return 0, 24 * 60, nil
+	}
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(s.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// validate confirms the schedule can be used.
+func (s Schedule) validate() error {
+	if _, err := s.location(); err != nil {
+		return err
+	}
+	if _, _, err := s.window(); err != nil {
+		return err
+	}
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return fmt.Errorf("%w: %w", errCronPattern, err)
+		}
+	}
+	return nil
+}
+
+// permits reports whether a check may run at time t.
+func (s Schedule) permits(t time.Time) bool {
+	loc, err := s.location()
+	if err != nil {
+		return false
+	}
+	start, end, err := s.window()
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case start == end:
+	case start < end:
+		if minute < start || minute >= end {
+			return false
+		}
+	default: // window wraps past midnight; it belongs to the day it opened
+		if minute < start && minute >= end {
+			return false
+		}
+		if minute < end {
+			day = t.AddDate(0, 0, -1).Weekday()
+		}
+	}
+	return len(s.Days) == 0 || slices.Contains(s.Days, day)
+}
+
+// nextOpening returns the first time after t that the schedule window opens.
+func (s Schedule) nextOpening(t time.Time) (time.Time, error) {
+	loc, err := s.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	start, _, err := s.window()
+	if err != nil {
+		return time.Time{}, err
+	}
+	local := t.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	for i := range 8 {
+		opening := midnight.AddDate(0, 0, i).Add(time.Duration(start) * time.Minute)
+		if opening.After(t) && s.permits(opening) {
+			return opening, nil
+		}
+	}
+	return time.Time{}, errSchedule
+}
+
+// frequency returns the regular check interval of the monitor.
+func (m *Monitor) frequency() (time.Duration, error) {
+	frequency, err := time.ParseDuration(m.Freq)
+	if err != nil || frequency <= 0 {
+		return 0, fmt.Errorf("%w %s", errFrequency, m.Freq)
+	}
+	return frequency, nil
+}
+
+// nextCheck returns the time of the next check after t.
+func (m *Monitor) nextCheck(after time.Time) (time.Time, error) {
+	if fast, ok := m.adaptiveInterval(after); ok {
+		if next := after.Add(fast); m.Schedule.permits(next) {
+			return next, nil
+		}
+	}
+	return m.scheduledCheck(after)
+}
+
+// scheduledCheck returns the time of the next check after t by the cron pattern or frequency of the
+// monitor, within its check window.
+func (m *Monitor) scheduledCheck(after time.Time) (time.Time, error) {
+	if m.Schedule.Cron != "" {
+		return m.nextCron(after)
+	}
+	frequency, err := m.frequency()
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := after.Add(frequency)
+	if m.Schedule.permits(next) {
+		return next, nil
+	}
+	return m.Schedule.nextOpening(next)
+}
+
+// nextCron returns the next time after t matching the cron expression within the schedule window.
+func (m *Monitor) nextCron(after time.Time) (time.Time, error) {
+	loc, err := m.Schedule.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	parsed, err := cron.ParseStandard(m.Schedule.Cron)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %w", errCronPattern, err)
+	}
+	if spec, ok := parsed.(*cron.SpecSchedule); ok {
+		spec.Location = loc
+	}
+	next := after
+	for range maxCronSteps {
+		next = parsed.Next(next)
+		if next.IsZero() {
+			break
+		}
+		if m.Schedule.permits(next) {
+			return next, nil
+		}
+	}
+	return time.Time{}, errSchedule
+}
+
+// describe returns a human readable summary of the schedule.
+func (s Schedule) describe(freq string) string {
+	desc := "every " + freq
+	if s.Cron != "" {
+		desc = "cron " + s.Cron
+	}
+	if s.Start != "" || s.End != "" {
+		desc += " between " + s.Start + " and " + s.End
+	}
+	if len(s.Days) > 0 {
+		days := make([]string, 0, len(s.Days))
+		for _, d := range s.Days {
+			days = append(days, d.String()[:3])
+		}
+		desc += " on " + strings.Join(days, ",")
+	}
+	if s.TimeZone != "" {
+		desc += " (" + s.TimeZone + ")"
+	}
+	return desc
+}
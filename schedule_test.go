@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		clock string
+		want  int
+		err   bool
+	}{
+		{"00:00", 0, false},
+		{"09:05", 545, false},
+		{"9:05", 545, false},
+		{"23:59", 1439, false},
+		{"24:00", 0, true},
+		{"12:60", 0, true},
+		{"-1:00", 0, true},
+		{"1200", 0, true},
+		{"ab:cd", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.clock, func(t *testing.T) {
+			got, err := parseClock(tt.clock)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseClock(%q) error = %v, want error %v", tt.clock, err, tt.err)
+			}
+			if err != nil && !errors.Is(err, errWindowTime) {
+				t.Errorf("parseClock(%q) error = %v, want %v", tt.clock, err, errWindowTime)
+			}
+			if got != tt.want {
+				t.Errorf("parseClock(%q) = %d, want %d", tt.clock, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		err      error
+	}{
+		{"empty", Schedule{}, nil},
+		{"window", Schedule{Start: "09:00", End: "17:00"}, nil},
+		{"cron", Schedule{Cron: "*/5 * * * *", TimeZone: "UTC"}, nil},
+		{"descriptor", Schedule{Cron: "@hourly"}, nil},
+		{"bad time zone", Schedule{TimeZone: "Nowhere/Special"}, errTimeZone},
+		{"bad start", Schedule{Start: "9", End: "17:00"}, errWindowTime},
+		{"missing end", Schedule{Start: "09:00"}, errWindowTime},
+		{"bad cron", Schedule{Cron: "* * *"}, errCronPattern},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.validate()
+			if tt.err == nil && err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("validate() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSchedulePermits(t *testing.T) {
+	// 2026-01-05 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	office := Schedule{TimeZone: "UTC", Start: "09:00", End: "17:00"}
+	night := Schedule{TimeZone: "UTC", Start: "22:00", End: "06:00", Days: []time.Weekday{time.Monday}}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		time     time.Time
+		want     bool
+	}{
+		{"no restriction", Schedule{}, at(5, 3, 0), true},
+		{"before window", office, at(5, 8, 59), false},
+		{"window opens", office, at(5, 9, 0), true},
+		{"in window", office, at(5, 16, 59), true},
+		{"window closes", office, at(5, 17, 0), false},
+		{"equal start and end is all day", Schedule{TimeZone: "UTC", Start: "12:00", End: "12:00"}, at(5, 3, 0), true},
+		{"permitted day", Schedule{TimeZone: "UTC", Days: []time.Weekday{time.Monday}}, at(5, 12, 0), true},
+		{"other day", Schedule{TimeZone: "UTC", Days: []time.Weekday{time.Monday}}, at(6, 12, 0), false},
+		{"wrapping window on its day", night, at(5, 23, 0), true},
+		{"wrapping window after midnight", night, at(6, 3, 0), true},
+		{"wrapping window opened the day before", night, at(5, 3, 0), false},
+		{"outside wrapping window", night, at(5, 12, 0), false},
+		{"wrapping window closes", night, at(6, 6, 0), false},
+		{"time zone", Schedule{TimeZone: "America/New_York", Start: "09:00", End: "17:00"}, at(5, 14, 0), true},
+		{"time zone before window", Schedule{TimeZone: "America/New_York", Start: "09:00", End: "17:00"},
+			at(5, 13, 59), false},
+		{"invalid time zone", Schedule{TimeZone: "Nowhere/Special"}, at(5, 12, 0), false},
+		{"invalid window", Schedule{TimeZone: "UTC", Start: "nine", End: "17:00"}, at(5, 12, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.permits(tt.time); got != tt.want {
+				t.Errorf("permits(%v) = %v, want %v", tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduledCheck(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	office := Schedule{TimeZone: "UTC", Start: "09:00", End: "17:00"}
+	tests := []struct {
+		name    string
+		monitor Monitor
+		after   time.Time
+		want    time.Time
+		err     error
+	}{
+		{"frequency", Monitor{Freq: "5m"}, at(5, 10, 7), at(5, 10, 12), nil},
+		{"frequency in window", Monitor{Freq: "1h", Schedule: office}, at(5, 10, 0), at(5, 11, 0), nil},
+		{"frequency past window", Monitor{Freq: "1h", Schedule: office}, at(5, 16, 30), at(6, 9, 0), nil},
+		{"frequency before window", Monitor{Freq: "30m", Schedule: office}, at(5, 3, 0), at(5, 9, 0), nil},
+		{"frequency to permitted day", Monitor{Freq: "1h", Schedule: Schedule{
+			TimeZone: "UTC", Start: "09:00", End: "17:00", Days: []time.Weekday{time.Wednesday},
+		}}, at(5, 12, 0), at(7, 9, 0), nil},
+		{"cron", Monitor{Schedule: Schedule{TimeZone: "UTC", Cron: "*/15 * * * *"}}, at(5, 10, 7), at(5, 10, 15), nil},
+		{"cron on the minute", Monitor{Schedule: Schedule{TimeZone: "UTC", Cron: "*/15 * * * *"}},
+			at(5, 10, 15), at(5, 10, 30), nil},
+		{"cron ignores frequency", Monitor{Freq: "1m", Schedule: Schedule{TimeZone: "UTC", Cron: "0 * * * *"}},
+			at(5, 10, 7), at(5, 11, 0), nil},
+		{"cron past window", Monitor{Schedule: Schedule{TimeZone: "UTC", Cron: "0 * * * *", Start: "09:00",
+			End: "12:00"}}, at(5, 11, 30), at(6, 9, 0), nil},
+		{"cron on permitted day", Monitor{Schedule: Schedule{TimeZone: "UTC", Cron: "0 12 * * *",
+			Days: []time.Weekday{time.Saturday}}}, at(5, 12, 0), at(10, 12, 0), nil},
+		{"cron in time zone", Monitor{Schedule: Schedule{TimeZone: "America/New_York", Cron: "0 9 * * *"}},
+			at(5, 12, 0), at(5, 14, 0), nil},
+		{"cron in summer time", Monitor{Schedule: Schedule{TimeZone: "America/New_York", Cron: "0 9 * * *"}},
+			time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 7, 1, 13, 0, 0, 0, time.UTC), nil},
+		{"cron never in window", Monitor{Schedule: Schedule{TimeZone: "UTC", Cron: "0 3 * * *", Start: "09:00",
+			End: "17:00"}}, at(5, 12, 0), time.Time{}, errSchedule},
+		{"invalid cron", Monitor{Schedule: Schedule{Cron: "every minute"}}, at(5, 12, 0), time.Time{}, errCronPattern},
+		{"invalid frequency", Monitor{Freq: "often"}, at(5, 12, 0), time.Time{}, errFrequency},
+		{"zero frequency", Monitor{Freq: "0s"}, at(5, 12, 0), time.Time{}, errFrequency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.monitor.scheduledCheck(tt.after)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("scheduledCheck() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scheduledCheck() error = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("scheduledCheck(%v) = %v, want %v", tt.after, got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleDescribe(t *testing.T) {
+	tests := []struct {
+		schedule Schedule
+		want     string
+	}{
+		{Schedule{}, "every 1m"},
+		{Schedule{Cron: "*/5 * * * *"}, "cron */5 * * * *"},
+		{Schedule{Start: "09:00", End: "17:00", Days: []time.Weekday{time.Monday, time.Friday}, TimeZone: "UTC"},
+			"every 1m between 09:00 and 17:00 on Mon,Fri (UTC)"},
+	}
+	for _, tt := range tests {
+		if got := tt.schedule.describe("1m"); got != tt.want {
+			t.Errorf("describe() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// check is a monitor check waiting in the scheduler queue.
+type check struct {
+	monitor *Monitor
+	due     time.Time
+	index   int
+}
+
+// checkQueue is a min heap of checks ordered by due time.
+type checkQueue []*check
+
+func (q checkQueue) Len() int           { return len(q) }
+func (q checkQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+
+func (q checkQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+// Push implements heap.Interface.
+func (q *checkQueue) Push(x any) {
+	item, _ := x.(*check)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+// Pop implements heap.Interface.
+func (q *checkQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
+
+// SchedulerStats represents the load on the check scheduler.
+type SchedulerStats struct {
+	Workers     int
+	HostWorkers int
+	Busy        int
+	QueueDepth  int
+	Lag         time.Duration
+	MaxLag      time.Duration
+	Monitors    int
+}
+
+// scheduler runs monitor checks on a bounded pool of workers. A due check is handed to a worker only
+// when its host is below the per host limit; otherwise it is parked until a check of the host finishes,
+// so that a slow host cannot tie up workers needed by other hosts.
+type scheduler struct {
+	lock        sync.Mutex
+	queue       checkQueue
+	next        map[string]time.Time
+	hosts       map[string]int      // checks running per host
+	parked      map[string][]*check // due checks waiting for their host
+	dispatching *check              // check waiting for a free worker
+	wake        chan struct{}
+	workers     int
+	hostWorkers int
+	busy        int
+	lag         time.Duration
+	maxLag      time.Duration
+}
+
+var checks = newScheduler()
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		next:        map[string]time.Time{},
+		hosts:       map[string]int{},
+		parked:      map[string][]*check{},
+		wake:        make(chan struct{}, 1),
+		workers:     envInt("UPTIME_WORKERS", defaultWorkers),
+		hostWorkers: envInt("UPTIME_HOST_WORKERS", defaultHostWorkers),
+	}
+}
+
+// envInt returns the positive integer value of the named environment variable or def.
+func envInt(name string, def int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 1 {
+		log.Println("invalid value for", name, value, "using", def)
+		return def
+	}
+	return i
+}
+
+// start queues the given monitors and runs the dispatcher and workers until ctx is cancelled.
+func (s *scheduler) start(ctx context.Context, wg *sync.WaitGroup, monitors []Monitor) {
+	now := time.Now()
+	s.lock.Lock()
+	s.queue = checkQueue{}
+	clear(s.next)
+	clear(s.hosts)
+	clear(s.parked)
+	s.dispatching = nil
+	s.busy = 0
+	s.maxLag = 0
+	for _, m := range monitors {
+		due, err := m.startOffset(now)
+		if err != nil {
+			log.Printf("invalid schedule for monitor %s, %s, %v", m.Name, m.Freq, err)
+			continue
+		}
+		heap.Push(&s.queue, &check{monitor: &m, due: due})
+		s.next[m.ID] = due
+		log.Println("starting monitor", m.Name, "first check", due.Format(time.RFC3339))
+	}
+	s.lock.Unlock()
+	jobs := make(chan *check)
+	for range s.workers {
+		wg.Add(1)
+		go s.worker(ctx, wg, jobs)
+	}
+	wg.Add(1)
+	go s.dispatch(ctx, wg, jobs)
+}
+
+// startOffset returns the first check time of a monitor; checks are spread across the monitor's period
+// to avoid every monitor firing at once.
+func (m *Monitor) startOffset(now time.Time) (time.Time, error) {
+	if m.Schedule.Cron != "" {
+		return m.nextCron(now)
+	}
+	frequency, err := m.frequency()
+	if err != nil {
+		return time.Time{}, err
+	}
+	due := now.Add(rand.N(min(frequency, maxStartJitter))) //nolint:gosec
+	if status, err := getStatus(m.ID); err == nil && !status.Time.IsZero() {
+		// keep the phase of a monitor that is not yet due
+		if next := status.Time.Add(frequency); next.After(now) {
+			due = next
+		}
+	}
+	if m.Schedule.permits(due) {
+		return due, nil
+	}
+	return m.Schedule.nextOpening(due)
+}
+
+// dispatch hands due checks to the workers.
+func (s *scheduler) dispatch(ctx context.Context, wg *sync.WaitGroup, jobs chan<- *check) {
+	defer wg.Done()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.lock.Lock()
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			wait = time.Until(s.queue[0].due)
+		}
+		s.lock.Unlock()
+		if wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+				continue
+			case <-timer.C:
+				continue
+			}
+		}
+		s.lock.Lock()
+		item, _ := heap.Pop(&s.queue).(*check)
+		host := hostName(item.monitor)
+		if s.hosts[host] >= s.hostWorkers {
+			s.parked[host] = append(s.parked[host], item)
+			s.lock.Unlock()
+			continue
+		}
+		s.hosts[host]++
+		s.dispatching = item
+		s.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case jobs <- item:
+		}
+		s.lock.Lock()
+		s.dispatching = nil
+		s.lock.Unlock()
+	}
+}
+
+// worker runs checks until ctx is cancelled.
+func (s *scheduler) worker(ctx context.Context, wg *sync.WaitGroup, jobs <-chan *check) {
+	defer wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-jobs:
+			s.run(ctx, item)
+		}
+	}
+}
+
+// run executes a single check, holding a slot of its host taken by dispatch, and requeues the monitor.
+func (s *scheduler) run(ctx context.Context, item *check) {
+	lag := time.Since(item.due)
+	s.lock.Lock()
+	s.busy++
+	s.lag = lag
+	s.maxLag = max(s.maxLag, lag)
+	s.lock.Unlock()
+	if lag > maxCheckLag {
+		log.Println("check lag", item.monitor.Name, lag.Round(time.Millisecond))
+	}
+	item.monitor.updateStatus(ctx)
+	s.release(hostName(item.monitor))
+	s.lock.Lock()
+	s.busy--
+	s.lock.Unlock()
+	next, err := item.monitor.nextCheck(time.Now())
+	if err != nil {
+		log.Println("schedule next check", item.monitor.Name, err)
+		return
+	}
+	s.requeue(item, next)
+}
+
+// requeue returns a check to the queue with a new due time.
+func (s *scheduler) requeue(item *check, due time.Time) {
+	s.lock.Lock()
+	item.due = due
+	heap.Push(&s.queue, item)
+	s.next[item.monitor.ID] = due
+	s.lock.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// release frees a slot of the host and returns the first check parked on it to the queue.
+func (s *scheduler) release(host string) {
+	s.lock.Lock()
+	if s.hosts[host]--; s.hosts[host] <= 0 {
+		delete(s.hosts, host)
+	}
+	parked := s.parked[host]
+	if len(parked) == 0 {
+		s.lock.Unlock()
+		return
+	}
+	heap.Push(&s.queue, parked[0])
+	if s.parked[host] = parked[1:]; len(s.parked[host]) == 0 {
+		delete(s.parked, host)
+	}
+	s.lock.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// hostName returns the host the per host limit of the monitor's checks applies to.
+func hostName(m *Monitor) string {
+	if u, err := url.Parse(m.URL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return m.URL
+}
+
+// nextCheck returns the time of the next scheduled check of the monitor with the given ID.
+func (s *scheduler) nextCheck(id string) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	next, ok := s.next[id]
+	return next, ok
+}
+
+// stats returns the current load on the scheduler.
+func (s *scheduler) stats() SchedulerStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := SchedulerStats{
+		Workers:     s.workers,
+		HostWorkers: s.hostWorkers,
+		Busy:        s.busy,
+		Lag:         s.lag,
+		MaxLag:      s.maxLag,
+		Monitors:    len(s.next),
+	}
+	now := time.Now()
+	for _, item := range s.queue {
+		if !item.due.After(now) {
+			stats.QueueDepth++
+		}
+	}
+	for _, parked := range s.parked {
+		stats.QueueDepth += len(parked)
+	}
+	if s.dispatching != nil {
+		stats.QueueDepth++
+	}
+	return stats
+}
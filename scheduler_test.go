@@ -0,0 +1,165 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnvInt(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		set   bool
+		want  int
+	}{
+		{"unset", "", false, 7},
+		{"set", "3", true, 3},
+		{"zero", "0", true, 7},
+		{"negative", "-2", true, 7},
+		{"not a number", "many", true, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.set {
+				t.Setenv("UPTIME_TEST_INT", tt.value)
+			}
+			if got := envInt("UPTIME_TEST_INT", 7); got != tt.want {
+				t.Errorf("envInt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/health", "example.com"},
+		{"http://example.com:8080/", "example.com"},
+		{"https://[::1]:8443/", "::1"},
+		{"example.com:22", "example.com:22"},
+		{"10.0.0.1", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		if got := hostName(&Monitor{URL: tt.url}); got != tt.want {
+			t.Errorf("hostName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestCheckQueue(t *testing.T) {
+	now := time.Now()
+	queue := checkQueue{}
+	for _, offset := range []time.Duration{3, 1, 4, 1, 5, 9, 2, 6} {
+		heap.Push(&queue, &check{monitor: &Monitor{}, due: now.Add(offset * time.Second)})
+	}
+	previous := time.Time{}
+	for queue.Len() > 0 {
+		item, _ := heap.Pop(&queue).(*check)
+		if item.due.Before(previous) {
+			t.Fatalf("popped %v after %v", item.due, previous)
+		}
+		previous = item.due
+	}
+}
+
+func TestStartOffset(t *testing.T) {
+	testDB(t, backendBolt)
+	now := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	if err := saveStatus(Status{MonitorID: "recent", Time: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStatus(Status{MonitorID: "stale", Time: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		monitor  Monitor
+		from, to time.Time // the offset is in [from, to)
+	}{
+		{"jitter within frequency", Monitor{ID: "new", Freq: "1m"}, now, now.Add(time.Minute)},
+		{"jitter capped", Monitor{ID: "new", Freq: "1h"}, now, now.Add(maxStartJitter)},
+		{"keeps phase", Monitor{ID: "recent", Freq: "10m"}, now.Add(9 * time.Minute),
+			now.Add(9*time.Minute + time.Nanosecond)},
+		{"overdue", Monitor{ID: "stale", Freq: "10m"}, now, now.Add(maxStartJitter)},
+		{"cron", Monitor{ID: "new", Schedule: Schedule{TimeZone: "UTC", Cron: "30 * * * *"}},
+			now.Add(30 * time.Minute), now.Add(30*time.Minute + time.Nanosecond)},
+		{"window", Monitor{ID: "new", Freq: "1m", Schedule: Schedule{TimeZone: "UTC", Start: "13:00", End: "14:00"}},
+			now.Add(time.Hour), now.Add(time.Hour + time.Nanosecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 50 {
+				got, err := tt.monitor.startOffset(now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Before(tt.from) || !got.Before(tt.to) {
+					t.Fatalf("startOffset() = %v, want in [%v, %v)", got, tt.from, tt.to)
+				}
+			}
+		})
+	}
+	if _, err := (&Monitor{ID: "new", Freq: "soon"}).startOffset(now); err == nil {
+		t.Error("startOffset() of an invalid frequency succeeded")
+	}
+}
+
+func TestSchedulerParksBusyHost(t *testing.T) {
+	s := newScheduler()
+	s.hostWorkers = 1
+	now := time.Now()
+	for _, m := range []Monitor{
+		{ID: "a", URL: "https://one.example.com/a"},
+		{ID: "b", URL: "https://one.example.com/b"},
+		{ID: "c", URL: "https://two.example.com/"},
+	} {
+		heap.Push(&s.queue, &check{monitor: &m, due: now})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	jobs := make(chan *check)
+	wg.Add(1)
+	go s.dispatch(ctx, wg, jobs)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	receive := func() *check {
+		t.Helper()
+		select {
+		case item := <-jobs:
+			return item
+		case <-time.After(time.Second):
+			t.Fatal("no check dispatched")
+			return nil
+		}
+	}
+	dispatched := map[string]bool{}
+	for range 2 {
+		dispatched[receive().monitor.ID] = true
+	}
+	if !dispatched["c"] || len(dispatched) != 2 {
+		t.Fatalf("dispatched %v, want c and one of a and b", dispatched)
+	}
+	select {
+	case item := <-jobs:
+		t.Fatalf("dispatched %s while its host is busy", item.monitor.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := s.stats().QueueDepth; got != 1 {
+		t.Errorf("QueueDepth = %d with one parked check, want 1", got)
+	}
+	s.release("one.example.com")
+	item := receive()
+	if dispatched[item.monitor.ID] {
+		t.Errorf("dispatched %s twice", item.monitor.ID)
+	}
+	if got := s.stats().QueueDepth; got != 0 {
+		t.Errorf("QueueDepth = %d after dispatch, want 0", got)
+	}
+}
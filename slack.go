@@ -16,6 +16,7 @@ type SlackNotifier struct {
 	Name    string `json:"name,omitempty"`
 	Token   string `json:"token,omitempty"`
 	Channel string `json:"channel,omitempty"`
+	Team    string `json:"team,omitempty"`
 }
 
 // ChannelResponse represents the slack response to a conversation list request.
@@ -212,3 +213,19 @@ func sendSlackCertExpiryNotification(ctx context.Context, notification []byte, s
 	}
 	return slack.Send(ctx, data)
 }
+
+func sendSlackMessageNotification(ctx context.Context, notification []byte, title, message string) error {
+	var slack SlackNotifier
+	if err := json.Unmarshal(notification, &slack); err != nil {
+		return err
+	}
+	data := SlackMessage{
+		Text: title,
+		Attachments: []Attachment{
+			{
+				Text: message,
+			},
+		},
+	}
+	return slack.Send(ctx, data)
+}
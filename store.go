@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// storage backends.
+const (
+	backendBolt   = "bolt"
+	backendSQLite = "sqlite"
+)
+
+const sqliteFile = "uptime.sqlite"
+
+var errBackend = errors.New("unknown storage backend")
+
+// Store persists monitors, status, history, users and notifiers. Other state (maintenance windows,
+// incidents, monitor state, agents, API tokens, the audit log and settings) is always kept in the bbolt
+// database, so with the sqlite store both files make up the database and backups include both.
+// Monitors and notifiers, and the status and history of monitors, are keyed by their immutable ID.
+type Store interface {
+	Monitors() ([]Monitor, error)
+	Monitor(id string) (Monitor, error)
+	SaveMonitor(monitor Monitor, update bool) error
+	DeleteMonitor(id string) error // also removes the monitor from the parents of other monitors
+
+	Status(id string) (Status, error)
+	SaveStatus(status Status) error
+
+	AddHistory(id string, ok int, statuses ...Status) error             // also updates rollups
+	History(id string, from, to time.Time, limit int) ([]Status, error) // oldest first; limit 0 returns all
+	EachHistory(id string, fn func(Status) error) error                 // oldest first
+	LastHistory(id string) (Status, error)                              // newest record, errNoKey if none
+	PruneHistory(id string, before time.Time, limit int) (int, error)
+	DeleteHistory(id string) error // history, rollups and status
+	HistoryCounts() (map[string]int, error)
+	Rollups(id, period string, since time.Time) ([]Rollup, error)
+
+	Users() ([]User, error)
+	User(name string) (User, error)
+	SaveUser(user User, update bool) error
+	DeleteUser(name string) error
+
+	Notifiers() ([]string, error) // IDs
+	Notifier(id string) (NotifyType, []byte, error)
+	CreateNotifier(id string, kind NotifyType, data []byte) error
+	UpdateNotifier(id string, data []byte) error
+	DeleteNotifier(id string) error // also removes the notifier from monitors
+
+	Close() error
+}
+
+var store Store
+
+// dataDir returns the directory of the database files.
+func dataDir() string {
+	xdg, ok := os.LookupEnv("XDG_DATA_HOME")
+	if !ok {
+		home, _ := os.UserHomeDir()
+		xdg = filepath.Join(home, ".local/share/uptime")
+	}
+	return xdg
+}
+
+// openStore opens the storage backend selected by UPTIME_STORE, bolt by default. openDB must be called first.
+func openStore() error {
+	var err error
+	setupDone.Store(false)
+	store, err = newStore(os.Getenv("UPTIME_STORE"))
+	return err
+}
+
+// newStore opens the named storage backend.
+func newStore(backend string) (Store, error) {
+	switch backend {
+	case "", backendBolt:
+		bolt := &boltStore{db: db}
+		bolt.rebuildRollups()
+		return bolt, nil
+	case backendSQLite:
+		return openSQLite(filepath.Join(dataDir(), sqliteFile))
+	default:
+		return nil, errBackend
+	}
+}
+
+// runMigrate copies monitors, status, history, users and notifiers between storage backends.
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := flags.String("from", backendBolt, "source backend (bolt or sqlite)")
+	to := flags.String("to", backendSQLite, "destination backend (bolt or sqlite)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == *to {
+		return errors.New("source and destination are the same backend")
+	}
+	source, err := newStore(*from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := newStore(*to)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+	return migrate(source, destination)
+}
+
+// migrate copies the contents of one store into another.
+func migrate(source, destination Store) error {
+	users, err := source.Users()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := destination.SaveUser(user, false); err != nil {
+			return errors.New("user " + user.Name + ": " + err.Error())
+		}
+	}
+	log.Println("migrated", len(users), "users")
+	notifiers, err := source.Notifiers()
+	if err != nil {
+		return err
+	}
+	for _, id := range notifiers {
+		kind, data, err := source.Notifier(id)
+		if err != nil {
+			return err
+		}
+		if err := destination.CreateNotifier(id, kind, data); err != nil {
+			return errors.New("notifier " + notifierName(data) + ": " + err.Error())
+		}
+	}
+	log.Println("migrated", len(notifiers), "notifiers")
+	monitors, err := source.Monitors()
+	if err != nil {
+		return err
+	}
+	for _, monitor := range monitors {
+		if err := destination.SaveMonitor(monitor, false); err != nil {
+			return errors.New("monitor " + monitor.Name + ": " + err.Error())
+		}
+		if status, err := source.Status(monitor.ID); err == nil {
+			if err := destination.SaveStatus(status); err != nil {
+				return err
+			}
+		}
+		count := 0
+		batch := make([]Status, 0, migrateBatch)
+		if err := source.EachHistory(monitor.ID, func(status Status) error {
+			batch = append(batch, status)
+			if len(batch) < migrateBatch {
+				return nil
+			}
+			count += len(batch)
+			err := destination.AddHistory(monitor.ID, monitor.StatusOK, batch...)
+			batch = batch[:0]
+			return err
+		}); err != nil {
+			return errors.New("history " + monitor.Name + ": " + err.Error())
+		}
+		if err := destination.AddHistory(monitor.ID, monitor.StatusOK, batch...); err != nil {
+			return err
+		}
+		count += len(batch)
+		log.Println("migrated monitor", monitor.Name, "with", count, "history records")
+	}
+	return nil
+}
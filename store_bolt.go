@@ -0,0 +1,651 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+// boltStore is the default Store, kept in the bbolt database.
+type boltStore struct {
+	db *bbolt.DB
+}
+
+// Monitors returns all monitors.
+func (s *boltStore) Monitors() ([]Monitor, error) {
+	monitors := []Monitor{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("monitors"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var monitor Monitor
+			if err := json.Unmarshal(v, &monitor); err != nil {
+				return err
+			}
+			monitors = append(monitors, monitor)
+			return nil
+		})
+	})
+	return monitors, err
+}
+
+// Monitor returns the monitor with the given ID.
+func (s *boltStore) Monitor(id string) (Monitor, error) {
+	monitor := Monitor{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		value := getKey([]string{"monitors", id}, tx)
+		if len(value) == 0 {
+			return errNoKey
+		}
+		return json.Unmarshal(value, &monitor)
+	})
+	return monitor, err
+}
+
+// SaveMonitor inserts a new monitor or updates an existing one.
+func (s *boltStore) SaveMonitor(monitor Monitor, update bool) error {
+	bytes, err := json.Marshal(monitor)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("monitors"))
+		if err != nil {
+			return err
+		}
+		exists := bucket.Get([]byte(monitor.ID)) != nil
+		if exists && !update {
+			return errKeyExists
+		}
+		if !exists && update {
+			return errNoKey
+		}
+		return bucket.Put([]byte(monitor.ID), bytes)
+	})
+}
+
+// DeleteMonitor deletes the monitor with the given ID and removes it from the parents of other monitors.
+func (s *boltStore) DeleteMonitor(id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("monitors"))
+		if bucket == nil {
+			return errNoKey
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		updated := map[string][]byte{}
+		if err := bucket.ForEach(func(key, v []byte) error {
+			monitor := Monitor{}
+			if err := json.Unmarshal(v, &monitor); err != nil {
+				return fmt.Errorf("unmarshal monitor %s %w", string(key), err)
+			}
+			if !slices.Contains(monitor.Parents, id) {
+				return nil
+			}
+			monitor.Parents = slices.DeleteFunc(monitor.Parents, func(p string) bool {
+				return p == id
+			})
+			bytes, err := json.Marshal(monitor)
+			if err != nil {
+				return fmt.Errorf("marshal monitor %s %w", monitor.Name, err)
+			}
+			updated[string(key)] = bytes
+			return nil
+		}); err != nil {
+			return err
+		}
+		for key, value := range updated {
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns the latest status of the monitor with the given ID.
+func (s *boltStore) Status(id string) (Status, error) {
+	status := Status{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("status"))
+		if bucket == nil {
+			return errNoKey
+		}
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return errNoKey
+		}
+		return json.Unmarshal(value, &status)
+	})
+	return status, err
+}
+
+// SaveStatus saves the latest status of a monitor.
+func (s *boltStore) SaveStatus(status Status) error {
+	bytes, err := json.Marshal(&status)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("status"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(status.MonitorID), bytes)
+	})
+}
+
+// AddHistory saves check results to the history of the monitor with the given ID and updates its rollups.
+func (s *boltStore) AddHistory(id string, ok int, statuses ...Status) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := createBucket([]string{"history", id}, tx)
+		if bucket == nil {
+			return errPath
+		}
+		update := func(period string, t time.Time, change func(*Rollup)) error {
+			return updateBoltRollup(tx, id, period, t, change)
+		}
+		for _, status := range statuses {
+			bytes, err := json.Marshal(&status)
+			if err != nil {
+				return err
+			}
+			key := historyKey(status.Time)
+			previous, next, err := historyNeighbours(bucket, key)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(key, bytes); err != nil {
+				return err
+			}
+			if err := applyRollup(update, previous, next, status, ok); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// historyKey returns the key of a history record; keys are fixed width UTC times to the nanosecond, as in the
+// sqlite store, so that they sort in time order and results within the same second are kept apart.
+func historyKey(t time.Time) []byte {
+	return []byte(t.UTC().Format(sqliteTime))
+}
+
+// historyNeighbours returns the history records before and after key, nil if there are none.
+func historyNeighbours(bucket *bbolt.Bucket, key []byte) (*Status, *Status, error) {
+	decode := func(v []byte) (*Status, error) {
+		status := &Status{}
+		return status, json.Unmarshal(v, status)
+	}
+	var previous, next *Status
+	var err error
+	c := bucket.Cursor()
+	k, v := c.Seek(key)
+	if bytes.Equal(k, key) {
+		k, v = c.Next()
+	}
+	if k != nil {
+		if next, err = decode(v); err != nil {
+			return nil, nil, err
+		}
+	}
+	if k, _ = c.Seek(key); k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	if k != nil {
+		if previous, err = decode(v); err != nil {
+			return nil, nil, err
+		}
+	}
+	return previous, next, nil
+}
+
+// History returns up to limit history records of the monitor with the given ID between from and to; a limit of 0
+// returns all.
+func (s *boltStore) History(id string, from, to time.Time, limit int) ([]Status, error) {
+	history := []Status{}
+	start := historyKey(from)
+	end := historyKey(to)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("history"))
+		if bucket == nil {
+			return errPath
+		}
+		if bucket = bucket.Bucket([]byte(id)); bucket == nil {
+			return errPath
+		}
+		c := bucket.Cursor()
+		for k, v := c.Seek(start); k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
+			if limit > 0 && len(history) == limit {
+				break
+			}
+			var status Status
+			if err := json.Unmarshal(v, &status); err != nil {
+				return err
+			}
+			history = append(history, status)
+		}
+		return nil
+	})
+	return history, err
+}
+
+// EachHistory calls fn for each history record of the monitor with the given ID.
+func (s *boltStore) EachHistory(id string, fn func(Status) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("history"))
+		if bucket == nil {
+			return nil
+		}
+		if bucket = bucket.Bucket([]byte(id)); bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var status Status
+			if err := json.Unmarshal(v, &status); err != nil {
+				return err
+			}
+			return fn(status)
+		})
+	})
+}
+
+// LastHistory returns the newest history record of the monitor with the given ID.
+func (s *boltStore) LastHistory(id string) (Status, error) {
+	status := Status{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("history"))
+		if bucket == nil {
+			return errNoKey
+		}
+		if bucket = bucket.Bucket([]byte(id)); bucket == nil {
+			return errNoKey
+		}
+		k, v := bucket.Cursor().Last()
+		if k == nil {
+			return errNoKey
+		}
+		return json.Unmarshal(v, &status)
+	})
+	return status, err
+}
+
+// PruneHistory deletes up to limit history records of the monitor with the given ID older than before and returns
+// the number deleted; a limit of 0 deletes all. Each call is a single transaction.
+func (s *boltStore) PruneHistory(id string, before time.Time, limit int) (int, error) {
+	stop := historyKey(before)
+	pruned := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		history := tx.Bucket([]byte("history"))
+		if history == nil {
+			return nil
+		}
+		bucket := history.Bucket([]byte(id))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, stop) < 0 && (limit == 0 || pruned < limit); k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			pruned++
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// DeleteHistory deletes the history, rollups and status of the monitor with the given ID.
+func (s *boltStore) DeleteHistory(id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		for _, path := range []string{"history", "rollups"} {
+			bucket := tx.Bucket([]byte(path))
+			if bucket == nil || bucket.Bucket([]byte(id)) == nil {
+				continue
+			}
+			if err := bucket.DeleteBucket([]byte(id)); err != nil {
+				return err
+			}
+		}
+		if bucket := tx.Bucket([]byte("status")); bucket != nil {
+			return bucket.Delete([]byte(id))
+		}
+		return nil
+	})
+}
+
+// HistoryCounts returns the number of history records of each monitor.
+func (s *boltStore) HistoryCounts() (map[string]int, error) {
+	counts := map[string]int{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		history := tx.Bucket([]byte("history"))
+		if history == nil {
+			return nil
+		}
+		return history.ForEachBucket(func(k []byte) error {
+			counts[string(k)] = history.Bucket(k).Stats().KeyN
+			return nil
+		})
+	})
+	return counts, err
+}
+
+// Rollups returns the rollups of the monitor with the given ID for the period starting at or after since.
+func (s *boltStore) Rollups(id, period string, since time.Time) ([]Rollup, error) {
+	rollups := []Rollup{}
+	start := []byte(since.UTC().Format(time.RFC3339))
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("rollups"))
+		if bucket == nil {
+			return nil
+		}
+		if bucket = bucket.Bucket([]byte(id)); bucket == nil {
+			return nil
+		}
+		if bucket = bucket.Bucket([]byte(period)); bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			var rollup Rollup
+			if err := json.Unmarshal(v, &rollup); err != nil {
+				return err
+			}
+			rollups = append(rollups, rollup)
+		}
+		return nil
+	})
+	return rollups, err
+}
+
+// updateBoltRollup applies change to the rollup of the period containing t.
+func updateBoltRollup(tx *bbolt.Tx, id, period string, t time.Time, change func(*Rollup)) error {
+	bucket := createBucket([]string{"rollups", id, period}, tx)
+	if bucket == nil {
+		return errPath
+	}
+	start := rollupStart(period, t)
+	key := []byte(start.Format(time.RFC3339))
+	rollup := Rollup{Start: start}
+	if value := bucket.Get(key); value != nil {
+		if err := json.Unmarshal(value, &rollup); err != nil {
+			return err
+		}
+	}
+	change(&rollup)
+	bytes, err := json.Marshal(rollup)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, bytes)
+}
+
+// rebuildRollups recreates the rollups of monitors from their raw history when they are missing or were
+// built by an earlier version.
+func (s *boltStore) rebuildRollups() {
+	monitors, err := s.Monitors()
+	if err != nil {
+		log.Println("get monitors", err)
+		return
+	}
+	if err := s.db.Update(func(tx *bbolt.Tx) error {
+		rollups := tx.Bucket([]byte("rollups"))
+		if rollups == nil || string(rollups.Get([]byte("version"))) == rollupVersion {
+			return nil
+		}
+		log.Println("rollups out of date, rebuilding")
+		return tx.DeleteBucket([]byte("rollups"))
+	}); err != nil {
+		log.Println("remove rollups", err)
+		return
+	}
+	for _, m := range monitors {
+		var count int
+		if err := s.db.Update(func(tx *bbolt.Tx) error {
+			if rollups := tx.Bucket([]byte("rollups")); rollups != nil && rollups.Bucket([]byte(m.ID)) != nil {
+				return nil
+			}
+			history := tx.Bucket([]byte("history"))
+			if history == nil {
+				return nil
+			}
+			if history = history.Bucket([]byte(m.ID)); history == nil {
+				return nil
+			}
+			update := func(period string, t time.Time, change func(*Rollup)) error {
+				return updateBoltRollup(tx, m.ID, period, t, change)
+			}
+			var previous *Status
+			return history.ForEach(func(_, v []byte) error {
+				var status Status
+				if err := json.Unmarshal(v, &status); err != nil {
+					return err
+				}
+				count++
+				if err := applyRollup(update, previous, nil, status, m.StatusOK); err != nil {
+					return err
+				}
+				previous = &status
+				return nil
+			})
+		}); err != nil {
+			log.Println("rebuild rollups", m.Name, err)
+			continue
+		}
+		if count > 0 {
+			log.Println("rebuilt rollups of", m.Name, "from", count, "history records")
+		}
+	}
+	if err := s.db.Update(func(tx *bbolt.Tx) error {
+		rollups, err := tx.CreateBucketIfNotExists([]byte("rollups"))
+		if err != nil {
+			return err
+		}
+		return rollups.Put([]byte("version"), []byte(rollupVersion))
+	}); err != nil {
+		log.Println("save rollup version", err)
+	}
+}
+
+// Users returns all users.
+func (s *boltStore) Users() ([]User, error) {
+	users := []User{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("users"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var user User
+			if err := json.Unmarshal(v, &user); err != nil {
+				return err
+			}
+			user.Name = string(k)
+			users = append(users, user)
+			return nil
+		})
+	})
+	return users, err
+}
+
+// User returns the named user.
+func (s *boltStore) User(name string) (User, error) {
+	var user User
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("users"))
+		if bucket == nil {
+			return errNoUser
+		}
+		value := bucket.Get([]byte(name))
+		if value == nil {
+			return errNoUser
+		}
+		return json.Unmarshal(value, &user)
+	})
+	return user, err
+}
+
+// SaveUser inserts a new user or updates an existing one; the password must already be hashed.
+func (s *boltStore) SaveUser(user User, update bool) error {
+	bytes, err := json.Marshal(&user)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("users"))
+		if err != nil {
+			return err
+		}
+		exists := bucket.Get([]byte(user.Name)) != nil
+		if exists && !update {
+			return errUser
+		}
+		if !exists && update {
+			return errNoUser
+		}
+		return bucket.Put([]byte(user.Name), bytes)
+	})
+}
+
+// DeleteUser deletes the named user.
+func (s *boltStore) DeleteUser(name string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("users"))
+		if bucket == nil || bucket.Get([]byte(name)) == nil {
+			return errNoUser
+		}
+		return bucket.Delete([]byte(name))
+	})
+}
+
+// Notifiers returns the IDs of all notifiers.
+func (s *boltStore) Notifiers() ([]string, error) {
+	names := []string{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("notify"))
+		if bucket == nil {
+			return berrors.ErrBucketNotFound
+		}
+		return bucket.ForEachBucket(func(k []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	})
+	return names, err
+}
+
+// Notifier returns the type and data of the notifier with the given ID.
+func (s *boltStore) Notifier(id string) (NotifyType, []byte, error) {
+	var notifyType NotifyType
+	var data []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		notifications := tx.Bucket([]byte("notify"))
+		if notifications == nil {
+			return berrors.ErrBucketNotFound
+		}
+		notify := notifications.Bucket([]byte(id))
+		if notify == nil {
+			return berrors.ErrBucketNotFound
+		}
+		notifyType = NotifyType(notify.Get([]byte("type")))
+		data = bytes.Clone(notify.Get([]byte("data")))
+		return nil
+	})
+	return notifyType, data, err
+}
+
+// CreateNotifier inserts a new notifier.
+func (s *boltStore) CreateNotifier(id string, kind NotifyType, data []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("notify"))
+		if err != nil {
+			return err
+		}
+		bucket, err = bucket.CreateBucket([]byte(id))
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte("type"), []byte(kind)); err != nil {
+			return err
+		}
+		return bucket.Put([]byte("data"), data)
+	})
+}
+
+// UpdateNotifier replaces the data of an existing notifier.
+func (s *boltStore) UpdateNotifier(id string, data []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("notify"))
+		if bucket == nil {
+			return fmt.Errorf("%w notify", berrors.ErrBucketNotFound)
+		}
+		bucket = bucket.Bucket([]byte(id))
+		if bucket == nil {
+			return fmt.Errorf("%w %s", berrors.ErrBucketNotFound, id)
+		}
+		return bucket.Put([]byte("data"), data)
+	})
+}
+
+// DeleteNotifier deletes the notifier with the given ID and removes it from the notifiers and escalation
+// notifiers of all monitors.
+func (s *boltStore) DeleteNotifier(id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("notify"))
+		if bucket == nil {
+			return fmt.Errorf("%w nofify", berrors.ErrBucketNotFound)
+		}
+		if err := bucket.DeleteBucket([]byte(id)); err != nil {
+			return fmt.Errorf("delete bucket %s %w", id, err)
+		}
+		bucket = tx.Bucket([]byte("monitors"))
+		if bucket == nil {
+			return nil
+		}
+		updated := map[string][]byte{}
+		if err := bucket.ForEach(func(key, v []byte) error {
+			monitor := Monitor{}
+			if err := json.Unmarshal(v, &monitor); err != nil {
+				return fmt.Errorf("unmarshal monitor %s %w", string(key), err)
+			}
+			deleted := func(n string) bool { return n == id }
+			monitor.Notifiers = slices.DeleteFunc(monitor.Notifiers, deleted)
+			monitor.EscalateTo = slices.DeleteFunc(monitor.EscalateTo, deleted)
+			bytes, err := json.Marshal(monitor)
+			if err != nil {
+				return fmt.Errorf("marshal monitor %s %w", monitor.Name, err)
+			}
+			updated[string(key)] = bytes
+			return nil
+		}); err != nil {
+			return err
+		}
+		for key, value := range updated {
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close does nothing; the bbolt database is shared and closed by main.
+func (s *boltStore) Close() error {
+	return nil
+}
@@ -0,0 +1,694 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the sqlite driver
+)
+
+// sqliteSchema creates the tables of the sqlite store. Frequently queried fields of history are kept
+// in columns for ad-hoc analytics; data holds the complete JSON encoded record. Monitors, status and
+// notifiers are keyed by ID, and the monitor columns of history and rollups hold monitor IDs.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS monitors (id TEXT PRIMARY KEY, data TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS status (id TEXT PRIMARY KEY, data TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS history (
+	monitor TEXT NOT NULL,
+	time TEXT NOT NULL,
+	status_code INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	response_ms REAL NOT NULL,
+	maintenance INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (monitor, time)
+);
+CREATE TABLE IF NOT EXISTS rollups (
+	monitor TEXT NOT NULL,
+	period TEXT NOT NULL,
+	start TEXT NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (monitor, period, start)
+);
+CREATE TABLE IF NOT EXISTS users (name TEXT PRIMARY KEY, data TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS notifiers (id TEXT PRIMARY KEY, type TEXT NOT NULL, data TEXT NOT NULL);
+`
+
+// sqliteVersion is the user_version of a sqlite store with the current schema: 1 after monitors and
+// notifiers were rekeyed by ID, 2 after their name columns were renamed to id.
+const sqliteVersion = 2
+
+// sqliteTime is the format of times in the sqlite store; it sorts lexically.
+const sqliteTime = "2006-01-02T15:04:05.000000000Z"
+
+// sqliteStore is a Store kept in a sqlite database.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// openSQLite opens, creating if needed, the sqlite database in file.
+func openSQLite(file string) (*sqliteStore, error) {
+	conn, err := sql.Open("sqlite", file+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1)
+	if err := migrateSQLite(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log.Println("loaded sqlite file", file)
+	return &sqliteStore{db: conn}, nil
+}
+
+// migrateSQLite creates the tables of a new sqlite store or brings an existing one up to sqliteVersion.
+func migrateSQLite(conn *sql.DB) error {
+	var tables int
+	if err := conn.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'monitors'").
+		Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		_, err := conn.Exec(sqliteSchema + "PRAGMA user_version = " + strconv.Itoa(sqliteVersion) + ";")
+		return err
+	}
+	if err := migrateSQLiteIDs(conn); err != nil {
+		return errors.New("migrate sqlite to IDs: " + err.Error())
+	}
+	if err := migrateSQLiteColumns(conn); err != nil {
+		return errors.New("rename sqlite key columns: " + err.Error())
+	}
+	_, err := conn.Exec(sqliteSchema)
+	return err
+}
+
+// migrateSQLiteColumns renames the name columns of monitors, status and notifiers, which hold IDs since
+// migrateSQLiteIDs, to id.
+func migrateSQLiteColumns(conn *sql.DB) error {
+	var version int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version >= 2 {
+		return nil
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	for _, table := range []string{"monitors", "status", "notifiers"} {
+		if _, err := tx.Exec("ALTER TABLE " + table + " RENAME COLUMN name TO id"); err != nil {
+			return errors.New(table + ": " + err.Error())
+		}
+	}
+	if _, err := tx.Exec("PRAGMA user_version = 2"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateSQLiteIDs rekeys a sqlite store written before monitors and notifiers had IDs from names to the
+// IDs given by legacyID, the same IDs the bbolt schema migration gives them. The user_version of the
+// database records that it is done.
+func migrateSQLiteIDs(conn *sql.DB) error {
+	var version int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version >= 1 {
+		return nil
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	monitorID := func(name string) string { return legacyID("monitor", name) }
+	notifierID := func(name string) string { return legacyID("notifier", name) }
+	rows := map[string]map[string]string{}
+	for _, table := range []string{"monitors", "status", "notifiers"} {
+		rows[table] = map[string]string{}
+		result, err := tx.Query("SELECT name, data FROM " + table)
+		if err != nil {
+			return err
+		}
+		for result.Next() {
+			var name, data string
+			if err := result.Scan(&name, &data); err != nil {
+				result.Close()
+				return err
+			}
+			rows[table][name] = data
+		}
+		result.Close()
+		if err := result.Err(); err != nil {
+			return err
+		}
+	}
+	for name, data := range rows["monitors"] {
+		var monitor Monitor
+		if err := json.Unmarshal([]byte(data), &monitor); err != nil {
+			return errors.New("monitor " + name + ": " + err.Error())
+		}
+		monitor.ID = monitorID(name)
+		monitor.Parents = legacyIDs("monitor", monitor.Parents)
+		monitor.Notifiers = legacyIDs("notifier", monitor.Notifiers)
+		monitor.EscalateTo = legacyIDs("notifier", monitor.EscalateTo)
+		bytes, err := json.Marshal(monitor)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE monitors SET name = ?, data = ? WHERE name = ?",
+			monitor.ID, string(bytes), name); err != nil {
+			return err
+		}
+	}
+	for name, data := range rows["status"] {
+		var status Status
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			return errors.New("status " + name + ": " + err.Error())
+		}
+		status.MonitorID = monitorID(name)
+		bytes, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE status SET name = ?, data = ? WHERE name = ?",
+			status.MonitorID, string(bytes), name); err != nil {
+			return err
+		}
+	}
+	for name, data := range rows["notifiers"] {
+		bytes, err := setNotifierName([]byte(data), name)
+		if err != nil {
+			return errors.New("notifier " + name + ": " + err.Error())
+		}
+		if _, err := tx.Exec("UPDATE notifiers SET name = ?, data = ? WHERE name = ?",
+			notifierID(name), string(bytes), name); err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"history", "rollups"} {
+		result, err := tx.Query("SELECT DISTINCT monitor FROM " + table)
+		if err != nil {
+			return err
+		}
+		names := []string{}
+		for result.Next() {
+			var name string
+			if err := result.Scan(&name); err != nil {
+				result.Close()
+				return err
+			}
+			names = append(names, name)
+		}
+		result.Close()
+		for _, name := range names {
+			if _, err := tx.Exec("UPDATE "+table+" SET monitor = ? WHERE monitor = ?", monitorID(name), name); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.Exec("PRAGMA user_version = 1"); err != nil {
+		return err
+	}
+	if len(rows["monitors"])+len(rows["notifiers"]) > 0 {
+		log.Println("sqlite store rekeyed", len(rows["monitors"]), "monitors and", len(rows["notifiers"]),
+			"notifiers by ID")
+	}
+	return tx.Commit()
+}
+
+// keyColumn returns the key column of table: name for users, id for the others.
+func keyColumn(table string) string {
+	if table == "users" {
+		return "name"
+	}
+	return "id"
+}
+
+// get unmarshals the data column of the row of table with the given key into v.
+func (s *sqliteStore) get(table, key string, v any, missing error) error {
+	var data string
+	err := s.db.QueryRow("SELECT data FROM "+table+" WHERE "+keyColumn(table)+" = ?", key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return missing
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+// save inserts or updates the row of table with the given key.
+func (s *sqliteStore) save(table, key string, v any, update bool, exists, missing error) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO " + table + " (" + keyColumn(table) + ", data) VALUES (?, ?)"
+	args := []any{key, string(data)}
+	if update {
+		query = "UPDATE " + table + " SET data = ? WHERE " + keyColumn(table) + " = ?"
+		args = []any{string(data), key}
+	}
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		if !update && s.exists(table, key) {
+			return exists
+		}
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return missing
+	}
+	return nil
+}
+
+func (s *sqliteStore) exists(table, key string) bool {
+	var n int
+	err := s.db.QueryRow("SELECT count(*) FROM "+table+" WHERE "+keyColumn(table)+" = ?", key).Scan(&n)
+	return err == nil && n > 0
+}
+
+// Monitors returns all monitors.
+func (s *sqliteStore) Monitors() ([]Monitor, error) {
+	rows, err := s.db.Query("SELECT data FROM monitors ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	monitors := []Monitor{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var monitor Monitor
+		if err := json.Unmarshal([]byte(data), &monitor); err != nil {
+			return nil, err
+		}
+		monitors = append(monitors, monitor)
+	}
+	return monitors, rows.Err()
+}
+
+// Monitor returns the monitor with the given ID.
+func (s *sqliteStore) Monitor(id string) (Monitor, error) {
+	monitor := Monitor{}
+	err := s.get("monitors", id, &monitor, errNoKey)
+	return monitor, err
+}
+
+// SaveMonitor inserts a new monitor or updates an existing one.
+func (s *sqliteStore) SaveMonitor(monitor Monitor, update bool) error {
+	return s.save("monitors", monitor.ID, monitor, update, errKeyExists, errNoKey)
+}
+
+// DeleteMonitor deletes the monitor with the given ID and removes it from the parents of other monitors.
+func (s *sqliteStore) DeleteMonitor(id string) error {
+	if _, err := s.db.Exec("DELETE FROM monitors WHERE id = ?", id); err != nil {
+		return err
+	}
+	monitors, err := s.Monitors()
+	if err != nil {
+		return err
+	}
+	for _, monitor := range monitors {
+		if !slices.Contains(monitor.Parents, id) {
+			continue
+		}
+		monitor.Parents = slices.DeleteFunc(monitor.Parents, func(p string) bool { return p == id })
+		if err := s.SaveMonitor(monitor, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status returns the latest status of the monitor with the given ID.
+func (s *sqliteStore) Status(id string) (Status, error) {
+	status := Status{}
+	err := s.get("status", id, &status, errNoKey)
+	return status, err
+}
+
+// SaveStatus saves the latest status of a monitor.
+func (s *sqliteStore) SaveStatus(status Status) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("INSERT INTO status (id, data) VALUES (?, ?) "+
+		"ON CONFLICT (id) DO UPDATE SET data = excluded.data", status.MonitorID, string(data))
+	return err
+}
+
+// AddHistory saves check results to the history of the monitor with the given ID and updates its rollups.
+func (s *sqliteStore) AddHistory(id string, ok int, statuses ...Status) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	update := func(period string, t time.Time, change func(*Rollup)) error {
+		start := rollupStart(period, t)
+		key := start.Format(sqliteTime)
+		rollup := Rollup{Start: start}
+		var data string
+		err := tx.QueryRow("SELECT data FROM rollups WHERE monitor = ? AND period = ? AND start = ?",
+			id, period, key).Scan(&data)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal([]byte(data), &rollup); err != nil {
+				return err
+			}
+		}
+		change(&rollup)
+		bytes, err := json.Marshal(rollup)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO rollups (monitor, period, start, data) VALUES (?, ?, ?, ?) "+
+			"ON CONFLICT (monitor, period, start) DO UPDATE SET data = excluded.data", id, period, key, string(bytes))
+		return err
+	}
+	for _, status := range statuses {
+		key := status.Time.UTC().Format(sqliteTime)
+		previous, err := historyRecord(tx,
+			"SELECT data FROM history WHERE monitor = ? AND time < ? ORDER BY time DESC LIMIT 1", id, key)
+		if err != nil {
+			return err
+		}
+		next, err := historyRecord(tx, "SELECT data FROM history WHERE monitor = ? AND time > ? ORDER BY time LIMIT 1",
+			id, key)
+		if err != nil {
+			return err
+		}
+		bytes, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT OR REPLACE INTO history "+
+			"(monitor, time, status_code, status, response_ms, maintenance, data) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			id, key, status.StatusCode, status.Status,
+			float64(status.ResponseTime)/float64(time.Millisecond), status.Maintenance, string(bytes)); err != nil {
+			return err
+		}
+		if err := applyRollup(update, previous, next, status, ok); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// historyRecord returns the history record selected by the query, nil if there is none.
+func historyRecord(tx *sql.Tx, query string, args ...any) (*Status, error) {
+	var data string
+	err := tx.QueryRow(query, args...).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil //nolint:nilnil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{}
+	return status, json.Unmarshal([]byte(data), status)
+}
+
+// History returns up to limit history records of the monitor with the given ID between from and to; a limit of 0
+// returns all.
+func (s *sqliteStore) History(id string, from, to time.Time, limit int) ([]Status, error) {
+	history := []Status{}
+	if limit == 0 {
+		limit = -1 // no limit
+	}
+	err := s.eachHistory("SELECT data FROM history WHERE monitor = ? AND time >= ? AND time <= ? ORDER BY time LIMIT ?",
+		func(status Status) error {
+			history = append(history, status)
+			return nil
+		}, id, from.UTC().Format(sqliteTime), to.UTC().Format(sqliteTime), limit)
+	return history, err
+}
+
+// EachHistory calls fn for each history record of the monitor with the given ID.
+func (s *sqliteStore) EachHistory(id string, fn func(Status) error) error {
+	return s.eachHistory("SELECT data FROM history WHERE monitor = ? ORDER BY time", fn, id)
+}
+
+// LastHistory returns the newest history record of the monitor with the given ID.
+func (s *sqliteStore) LastHistory(id string) (Status, error) {
+	var status Status
+	var data string
+	err := s.db.QueryRow("SELECT data FROM history WHERE monitor = ? ORDER BY time DESC LIMIT 1", id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, errNoKey
+	}
+	if err != nil {
+		return status, err
+	}
+	return status, json.Unmarshal([]byte(data), &status)
+}
+
+func (s *sqliteStore) eachHistory(query string, fn func(Status) error, args ...any) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		var status Status
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			return err
+		}
+		if err := fn(status); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// PruneHistory deletes up to limit history records of the monitor with the given ID older than before and returns
+// the number deleted; a limit of 0 deletes all.
+func (s *sqliteStore) PruneHistory(id string, before time.Time, limit int) (int, error) {
+	query := "DELETE FROM history WHERE monitor = ? AND time < ?"
+	args := []any{id, before.UTC().Format(sqliteTime)}
+	if limit > 0 {
+		query = "DELETE FROM history WHERE rowid IN " +
+			"(SELECT rowid FROM history WHERE monitor = ? AND time < ? ORDER BY time LIMIT ?)"
+		args = append(args, limit)
+	}
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// DeleteHistory deletes the history, rollups and status of the monitor with the given ID.
+func (s *sqliteStore) DeleteHistory(id string) error {
+	for _, query := range []string{
+		"DELETE FROM history WHERE monitor = ?",
+		"DELETE FROM rollups WHERE monitor = ?",
+		"DELETE FROM status WHERE id = ?",
+	} {
+		if _, err := s.db.Exec(query, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistoryCounts returns the number of history records of each monitor.
+func (s *sqliteStore) HistoryCounts() (map[string]int, error) {
+	rows, err := s.db.Query("SELECT monitor, count(*) FROM history GROUP BY monitor")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{}
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// Rollups returns the rollups of the monitor with the given ID for the period starting at or after since.
+func (s *sqliteStore) Rollups(id, period string, since time.Time) ([]Rollup, error) {
+	rows, err := s.db.Query("SELECT data FROM rollups WHERE monitor = ? AND period = ? AND start >= ? ORDER BY start",
+		id, period, since.UTC().Format(sqliteTime))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rollups := []Rollup{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var rollup Rollup
+		if err := json.Unmarshal([]byte(data), &rollup); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, rollup)
+	}
+	return rollups, rows.Err()
+}
+
+// Users returns all users.
+func (s *sqliteStore) Users() ([]User, error) {
+	rows, err := s.db.Query("SELECT name, data FROM users ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var name, data string
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, err
+		}
+		var user User
+		if err := json.Unmarshal([]byte(data), &user); err != nil {
+			return nil, err
+		}
+		user.Name = name
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// User returns the named user.
+func (s *sqliteStore) User(name string) (User, error) {
+	user := User{}
+	err := s.get("users", name, &user, errNoUser)
+	return user, err
+}
+
+// SaveUser inserts a new user or updates an existing one; the password must already be hashed.
+func (s *sqliteStore) SaveUser(user User, update bool) error {
+	return s.save("users", user.Name, user, update, errUser, errNoUser)
+}
+
+// DeleteUser deletes the named user.
+func (s *sqliteStore) DeleteUser(name string) error {
+	result, err := s.db.Exec("DELETE FROM users WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errNoUser
+	}
+	return nil
+}
+
+// Notifiers returns the IDs of all notifiers.
+func (s *sqliteStore) Notifiers() ([]string, error) {
+	rows, err := s.db.Query("SELECT id FROM notifiers ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Notifier returns the type and data of the notifier with the given ID.
+func (s *sqliteStore) Notifier(id string) (NotifyType, []byte, error) {
+	var kind, data string
+	err := s.db.QueryRow("SELECT type, data FROM notifiers WHERE id = ?", id).Scan(&kind, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, errNoKey
+	}
+	return NotifyType(kind), []byte(data), err
+}
+
+// CreateNotifier inserts a new notifier.
+func (s *sqliteStore) CreateNotifier(id string, kind NotifyType, data []byte) error {
+	if s.exists("notifiers", id) {
+		return errKeyExists
+	}
+	_, err := s.db.Exec("INSERT INTO notifiers (id, type, data) VALUES (?, ?, ?)", id, string(kind), string(data))
+	return err
+}
+
+// UpdateNotifier replaces the data of an existing notifier.
+func (s *sqliteStore) UpdateNotifier(id string, data []byte) error {
+	result, err := s.db.Exec("UPDATE notifiers SET data = ? WHERE id = ?", string(data), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errNoKey
+	}
+	return nil
+}
+
+// DeleteNotifier deletes the notifier with the given ID and removes it from the notifiers and escalation
+// notifiers of all monitors.
+func (s *sqliteStore) DeleteNotifier(id string) error {
+	result, err := s.db.Exec("DELETE FROM notifiers WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errNoKey
+	}
+	monitors, err := s.Monitors()
+	if err != nil {
+		return err
+	}
+	for _, monitor := range monitors {
+		if !slices.Contains(monitor.Notifiers, id) && !slices.Contains(monitor.EscalateTo, id) {
+			continue
+		}
+		deleted := func(n string) bool { return n == id }
+		monitor.Notifiers = slices.DeleteFunc(monitor.Notifiers, deleted)
+		monitor.EscalateTo = slices.DeleteFunc(monitor.EscalateTo, deleted)
+		if err := s.SaveMonitor(monitor, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backup writes a consistent copy of the database to file, which must not exist.
+func (s *sqliteStore) backup(file string) error {
+	_, err := s.db.Exec("VACUUM INTO ?", file)
+	return err
+}
+
+// Close closes the sqlite database.
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
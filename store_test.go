@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStoreMonitors(t *testing.T) {
+	for _, backend := range []string{backendBolt, backendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			testDB(t, backend)
+			parent := Monitor{ID: "p1", Name: "parent", StatusOK: 200}
+			child := Monitor{ID: "c1", Name: "child", StatusOK: 200, Parents: []string{"p1", "p2"}}
+			for _, m := range []Monitor{parent, child} {
+				if err := store.SaveMonitor(m, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.SaveMonitor(parent, false); !errors.Is(err, errKeyExists) {
+				t.Errorf("insert existing monitor error = %v, want %v", err, errKeyExists)
+			}
+			if err := store.SaveMonitor(Monitor{ID: "missing"}, true); !errors.Is(err, errNoKey) {
+				t.Errorf("update missing monitor error = %v, want %v", err, errNoKey)
+			}
+			parent.Name = "renamed"
+			if err := store.SaveMonitor(parent, true); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.Monitor("p1"); err != nil || got.Name != "renamed" {
+				t.Errorf("Monitor() = %q, %v, want renamed", got.Name, err)
+			}
+			if _, err := store.Monitor("missing"); !errors.Is(err, errNoKey) {
+				t.Errorf("Monitor(missing) error = %v, want %v", err, errNoKey)
+			}
+			if err := store.DeleteMonitor("p1"); err != nil {
+				t.Fatal(err)
+			}
+			monitors, err := store.Monitors()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(monitors) != 1 || !slices.Equal(monitors[0].Parents, []string{"p2"}) {
+				t.Errorf("after delete, monitors %+v, want child with parent p2", monitors)
+			}
+			status := Status{MonitorID: "c1", Time: time.Now().UTC().Truncate(time.Second), StatusCode: 200}
+			if err := store.SaveStatus(status); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.Status("c1"); err != nil || !got.Time.Equal(status.Time) {
+				t.Errorf("Status() = %v, %v, want %v", got.Time, err, status.Time)
+			}
+			if _, err := store.Status("p1"); !errors.Is(err, errNoKey) {
+				t.Errorf("Status(missing) error = %v, want %v", err, errNoKey)
+			}
+		})
+	}
+}
+
+func TestStoreHistory(t *testing.T) {
+	for _, backend := range []string{backendBolt, backendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			testDB(t, backend)
+			start := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+			at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+			record := func(minutes, code int) Status {
+				return Status{MonitorID: "m1", Time: at(minutes), StatusCode: code, ResponseTime: time.Millisecond}
+			}
+			if _, err := store.LastHistory("m1"); !errors.Is(err, errNoKey) {
+				t.Errorf("LastHistory() without history error = %v, want %v", err, errNoKey)
+			}
+			// added out of order, across three hours
+			for _, batch := range [][]Status{
+				{record(0, 200), record(30, 503)},
+				{record(150, 200)},
+				{record(60, 503), record(90, 200)},
+			} {
+				if err := store.AddHistory("m1", 200, batch...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.AddHistory("m2", 200, record(10, 200)); err != nil {
+				t.Fatal(err)
+			}
+			history, err := store.History("m1", at(30), at(90), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			times := []time.Time{}
+			for _, status := range history {
+				times = append(times, status.Time)
+			}
+			if want := []time.Time{at(30), at(60), at(90)}; !slices.EqualFunc(times, want, time.Time.Equal) {
+				t.Errorf("History() = %v, want %v", times, want)
+			}
+			history, err = store.History("m1", at(0), at(150), 2)
+			if err != nil || len(history) != 2 || !history[1].Time.Equal(at(30)) {
+				t.Errorf("History() with limit 2 = %v, %v, want the first 2 records", history, err)
+			}
+			if last, err := store.LastHistory("m1"); err != nil || !last.Time.Equal(at(150)) {
+				t.Errorf("LastHistory() = %v, %v, want %v", last.Time, err, at(150))
+			}
+			rollups, err := store.Rollups("m1", rollupHour, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var counts []int
+			up, down := time.Duration(0), time.Duration(0)
+			for _, rollup := range rollups {
+				counts = append(counts, rollup.Count)
+				up += rollup.Up
+				down += rollup.Down
+			}
+			if !slices.Equal(counts, []int{2, 2, 1}) || up != 90*time.Minute || down != 60*time.Minute {
+				t.Errorf("hourly rollups of %v checks, up %v, down %v, want [2 2 1], 1h30m0s, 1h0m0s",
+					counts, up, down)
+			}
+			pruned, err := store.PruneHistory("m1", at(90), 1)
+			if err != nil || pruned != 1 {
+				t.Errorf("PruneHistory() with limit = %d, %v, want 1", pruned, err)
+			}
+			pruned, err = store.PruneHistory("m1", at(90), 0)
+			if err != nil || pruned != 2 {
+				t.Errorf("PruneHistory() = %d, %v, want 2", pruned, err)
+			}
+			stored, err := store.HistoryCounts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored["m1"] != 2 || stored["m2"] != 1 {
+				t.Errorf("HistoryCounts() = %v, want m1 2 and m2 1", stored)
+			}
+			if err := store.DeleteHistory("m1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.LastHistory("m1"); !errors.Is(err, errNoKey) {
+				t.Errorf("LastHistory() after delete error = %v, want %v", err, errNoKey)
+			}
+			if rollups, err := store.Rollups("m1", rollupDay, start); err != nil || len(rollups) != 0 {
+				t.Errorf("Rollups() after delete = %d, %v, want none", len(rollups), err)
+			}
+			if last, err := store.LastHistory("m2"); err != nil || !last.Time.Equal(at(10)) {
+				t.Errorf("LastHistory() of other monitor = %v, %v, want %v", last.Time, err, at(10))
+			}
+		})
+	}
+}
+
+func TestStoreHistorySameSecond(t *testing.T) {
+	for _, backend := range []string{backendBolt, backendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			testDB(t, backend)
+			start := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+			// a scheduled check and a check now in the same second, then the next scheduled check
+			for _, status := range []Status{
+				{Time: start, StatusCode: 200},
+				{Time: start.Add(300 * time.Millisecond), StatusCode: 503},
+				{Time: start.Add(10 * time.Minute), StatusCode: 200},
+			} {
+				status.MonitorID = "m1"
+				if err := store.AddHistory("m1", 200, status); err != nil {
+					t.Fatal(err)
+				}
+			}
+			history, err := store.History("m1", start, start.Add(time.Hour), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 3 || !history[1].Time.Equal(start.Add(300*time.Millisecond)) {
+				t.Errorf("History() = %v, want 3 records", history)
+			}
+			stored, err := store.History("m1", start, start, 0)
+			if err != nil || len(stored) != 1 || stored[0].StatusCode != 200 {
+				t.Errorf("History() at %v = %v, %v, want only that record", start, stored, err)
+			}
+			rollups, err := store.Rollups("m1", rollupHour, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rollups) != 1 || rollups[0].Count != 3 || rollups[0].Up != 300*time.Millisecond ||
+				rollups[0].Up+rollups[0].Down != 10*time.Minute {
+				t.Errorf("hourly rollups = %+v, want 3 checks over 10m0s, up 300ms", rollups)
+			}
+		})
+	}
+}
+
+func TestStoreUsersAndNotifiers(t *testing.T) {
+	for _, backend := range []string{backendBolt, backendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			testDB(t, backend)
+			user := User{Name: "alice", Pass: "hash", Role: roleEditor}
+			if err := store.SaveUser(user, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SaveUser(user, false); err == nil {
+				t.Error("inserted existing user")
+			}
+			if got, err := store.User("alice"); err != nil || got.Role != roleEditor {
+				t.Errorf("User() = %+v, %v", got, err)
+			}
+			if err := store.DeleteUser("alice"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.User("alice"); err == nil {
+				t.Error("found deleted user")
+			}
+
+			if err := store.CreateNotifier("n1", Slack, []byte(`{"Name":"ops"}`)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.CreateNotifier("n1", Slack, []byte(`{"Name":"ops"}`)); err == nil {
+				t.Error("created existing notifier")
+			}
+			if err := store.UpdateNotifier("n1", []byte(`{"Name":"oncall"}`)); err != nil {
+				t.Fatal(err)
+			}
+			if kind, data, err := store.Notifier("n1"); err != nil || kind != Slack || string(data) != `{"Name":"oncall"}` {
+				t.Errorf("Notifier() = %v, %s, %v", kind, data, err)
+			}
+			m := Monitor{ID: "m1", Name: "site", Notifiers: []string{"n1", "n2"}}
+			if err := store.SaveMonitor(m, false); err != nil {
+				t.Fatal(err)
+			}
+			escalating := Monitor{ID: "m2", Name: "escalating", EscalateTo: []string{"n3", "n1"}}
+			if err := store.SaveMonitor(escalating, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.DeleteNotifier("n1"); err != nil {
+				t.Fatal(err)
+			}
+			if ids, err := store.Notifiers(); err != nil || len(ids) != 0 {
+				t.Errorf("Notifiers() = %v, %v, want none", ids, err)
+			}
+			if got, err := store.Monitor("m1"); err != nil || !slices.Equal(got.Notifiers, []string{"n2"}) {
+				t.Errorf("monitor notifiers %v, %v, want [n2]", got.Notifiers, err)
+			}
+			if got, err := store.Monitor("m2"); err != nil || !slices.Equal(got.EscalateTo, []string{"n3"}) {
+				t.Errorf("monitor escalation notifiers %v, %v, want [n3]", got.EscalateTo, err)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	testDB(t, backendBolt)
+	now := time.Now().UTC().Truncate(time.Second)
+	m := Monitor{ID: "m1", Name: "site", StatusOK: 200}
+	if err := store.SaveMonitor(m, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveUser(User{Name: "admin", Pass: "hash", Role: roleAdmin}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateNotifier("n1", Discord, []byte(`{"Name":"chat"}`)); err != nil {
+		t.Fatal(err)
+	}
+	history := make([]Status, 0, migrateBatch+1)
+	for i := range migrateBatch + 1 {
+		history = append(history, Status{MonitorID: m.ID, Time: now.Add(time.Duration(i-migrateBatch) * time.Second),
+			StatusCode: 200})
+	}
+	if err := store.AddHistory(m.ID, 200, history...); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveStatus(history[len(history)-1]); err != nil {
+		t.Fatal(err)
+	}
+	destination, err := newStore(backendSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer destination.Close()
+	if err := migrate(store, destination); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := destination.User("admin"); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := destination.Notifier("n1"); err != nil {
+		t.Error(err)
+	}
+	if status, err := destination.Status(m.ID); err != nil || !status.Time.Equal(now) {
+		t.Errorf("migrated status %v, %v, want %v", status.Time, err, now)
+	}
+	counts, err := destination.HistoryCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[m.ID] != migrateBatch+1 {
+		t.Errorf("migrated %d history records, want %d", counts[m.ID], migrateBatch+1)
+	}
+	if err := migrate(store, destination); err == nil {
+		t.Error("migrated into a store that already holds the records")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing represents the phases of a successful HTTP check.
+type Timing struct {
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	TTFB     time.Duration // connection ready to first response byte
+	Transfer time.Duration // first response byte to end of body
+}
+
+// Total returns the sum of all phases.
+func (t Timing) Total() time.Duration {
+	return t.DNS + t.Connect + t.TLS + t.TTFB + t.Transfer
+}
+
+// tracer records the phase boundaries of a single HTTP request.
+type tracer struct {
+	lock         sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	firstByte    time.Time
+}
+
+// context returns ctx with the tracer attached.
+func (t *tracer) context(ctx context.Context) context.Context {
+	record := func(field *time.Time) {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		if field.IsZero() {
+			*field = time.Now()
+		}
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { record(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { record(&t.dnsDone) },
+		ConnectStart:         func(_, _ string) { record(&t.connectStart) },
+		ConnectDone:          func(_, _ string, _ error) { record(&t.connectDone) },
+		TLSHandshakeStart:    func() { record(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { record(&t.tlsDone) },
+		GotConn:              func(httptrace.GotConnInfo) { record(&t.gotConn) },
+		GotFirstResponseByte: func() { record(&t.firstByte) },
+	})
+}
+
+// timing returns the phase durations given the time the response body was fully read.
+func (t *tracer) timing(done time.Time) Timing {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	span := func(start, end time.Time) time.Duration {
+		if start.IsZero() || end.IsZero() || end.Before(start) {
+			return 0
+		}
+		return end.Sub(start)
+	}
+	return Timing{
+		DNS:      span(t.dnsStart, t.dnsDone),
+		Connect:  span(t.connectStart, t.connectDone),
+		TLS:      span(t.tlsStart, t.tlsDone),
+		TTFB:     span(t.gotConn, t.firstByte),
+		Transfer: span(t.firstByte, done),
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracerTiming(t *testing.T) {
+	base := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+	tests := []struct {
+		name   string
+		tracer *tracer
+		done   time.Time
+		want   Timing
+	}{
+		{"all phases", &tracer{
+			dnsStart: at(0), dnsDone: at(10), connectStart: at(10), connectDone: at(30), tlsStart: at(30),
+			tlsDone: at(70), gotConn: at(70), firstByte: at(170),
+		}, at(200), Timing{
+			DNS: 10 * time.Millisecond, Connect: 20 * time.Millisecond, TLS: 40 * time.Millisecond,
+			TTFB: 100 * time.Millisecond, Transfer: 30 * time.Millisecond,
+		}},
+		{"plain http to an address", &tracer{connectStart: at(0), connectDone: at(5), gotConn: at(5), firstByte: at(25)},
+			at(25), Timing{Connect: 5 * time.Millisecond, TTFB: 20 * time.Millisecond}},
+		{"reused connection", &tracer{gotConn: at(0), firstByte: at(15)}, at(20),
+			Timing{TTFB: 15 * time.Millisecond, Transfer: 5 * time.Millisecond}},
+		{"no response", &tracer{dnsStart: at(0), dnsDone: at(3), connectStart: at(3)}, at(50),
+			Timing{DNS: 3 * time.Millisecond}},
+		{"clock went backwards", &tracer{gotConn: at(10), firstByte: at(5)}, at(4), Timing{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.tracer.timing(tt.done)
+			if got != tt.want {
+				t.Errorf("timing() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	total := Timing{DNS: 1, Connect: 2, TLS: 3, TTFB: 4, Transfer: 5}.Total()
+	if total != 15 {
+		t.Errorf("Total() = %v, want 15ns", total)
+	}
+}
+
+func TestCheckHTTPTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	m := Monitor{ID: "m1", Name: "site", Type: HTTP, URL: server.URL, Timeout: "5s", StatusOK: http.StatusNoContent}
+	status := m.Check(context.Background())
+	if status.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d %s, want %d", status.StatusCode, status.Status, http.StatusNoContent)
+	}
+	if status.Timing.TTFB < 50*time.Millisecond {
+		t.Errorf("TTFB = %v, want at least the 50ms the server waited", status.Timing.TTFB)
+	}
+	if status.Timing.TLS != 0 {
+		t.Errorf("TLS = %v for plain http, want 0", status.Timing.TLS)
+	}
+	if status.Timing.Total() > status.ResponseTime {
+		t.Errorf("phases total %v, more than the response time %v", status.Timing.Total(), status.ResponseTime)
+	}
+}
+
+func TestCheckHTTPNewConnection(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	var mu sync.Mutex
+	connections := 0
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			connections++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+	m := Monitor{ID: "m1", Name: "site", Type: HTTP, URL: server.URL, Timeout: "5s", StatusOK: http.StatusOK}
+	for range 3 {
+		if status := m.Check(context.Background()); status.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d %s, want %d", status.StatusCode, status.Status, http.StatusOK)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if connections != 3 {
+		t.Errorf("3 checks used %d connections, want 3", connections)
+	}
+}
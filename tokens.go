@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// API token scopes.
+const (
+	scopeMonitorsRead   = "monitors:read"   // monitors, status, history and stats
+	scopeMonitorsWrite  = "monitors:write"  // create, update and delete monitors
+	scopeNotifiersRead  = "notifiers:read"  // notifiers, with credentials redacted
+	scopeNotifiersWrite = "notifiers:write" // create, update and delete notifiers
+	scopeBackup         = "backup"          // download database backups
+)
+
+// tokenPrefix starts every API token so that leaked tokens are easy to find.
+const tokenPrefix = "uptime_"
+
+// tokenLastUsedInterval is the minimum time between updates of the last use of a token.
+const tokenLastUsedInterval = time.Minute
+
+var (
+	scopes = []string{scopeMonitorsRead, scopeMonitorsWrite, scopeNotifiersRead, scopeNotifiersWrite, scopeBackup}
+
+	// writeScopes require the editor role of the token's user.
+	writeScopes = []string{scopeMonitorsWrite, scopeNotifiersWrite}
+
+	// adminScopes require the admin role of the token's user.
+	adminScopes = []string{scopeBackup}
+
+	// tokenLifetimes are the expiry choices of new tokens in days; 0 never expires.
+	tokenLifetimes = []int{30, 90, 365, 0}
+
+	errTokenAuth = errors.New("invalid or expired api token")
+)
+
+// APIToken authenticates a script or tool as its user. Only the hash of the secret is kept.
+type APIToken struct {
+	ID       string
+	Name     string
+	User     string
+	Scopes   []string
+	Hash     string
+	Created  time.Time
+	Expires  time.Time // never if zero
+	LastUsed time.Time
+}
+
+type apiTokenKey struct{}
+
+// expired reports whether the token has expired at time t.
+func (t APIToken) expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// newAPIToken creates and saves a token for the user; the token is returned only here.
+func newAPIToken(user User, name string, granted []string, expires time.Time) (APIToken, string, error) {
+	token := APIToken{
+		Name:    strings.TrimSpace(name),
+		User:    user.Name,
+		Created: time.Now(),
+		Expires: expires,
+	}
+	if token.Name == "" {
+		return token, "", errors.New("token name is required")
+	}
+	if len(granted) == 0 {
+		return token, "", errors.New("select at least one scope")
+	}
+	for _, scope := range granted {
+		if !slices.Contains(scopes, scope) {
+			return token, "", errors.New("invalid scope " + scope)
+		}
+		if slices.Contains(writeScopes, scope) && !user.can(roleEditor) {
+			return token, "", errors.New("scope " + scope + " requires the editor role")
+		}
+		if slices.Contains(adminScopes, scope) && !user.can(roleAdmin) {
+			return token, "", errors.New("scope " + scope + " requires the admin role")
+		}
+	}
+	token.Scopes = granted
+	var err error
+	if token.ID, err = newID(); err != nil {
+		return token, "", err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return token, "", err
+	}
+	secret := hex.EncodeToString(raw)
+	token.Hash = hashToken(secret)
+	if err := saveAPIToken(token); err != nil {
+		return token, "", err
+	}
+	return token, tokenPrefix + token.ID + "_" + secret, nil
+}
+
+// revokeUserTokens deletes the api tokens of the named user.
+func revokeUserTokens(name string) error {
+	tokens, err := getAPITokens()
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, token := range tokens {
+		if token.User == name {
+			ids = append(ids, token.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return removeAPITokens(ids...)
+}
+
+// apiAuth authenticates api requests by bearer token and makes the token's user the user of the request.
+func apiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		id, secret, _ := strings.Cut(strings.TrimPrefix(bearer, tokenPrefix), "_")
+		token, err := getAPIToken(id)
+		if err != nil || secret == "" || token.expired(time.Now()) ||
+			subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashToken(secret))) != 1 {
+			log.Println("api authentication failed", r.RemoteAddr)
+			apiError(w, http.StatusUnauthorized, errTokenAuth)
+			return
+		}
+		user, err := store.User(token.User)
+		if err != nil {
+			apiError(w, http.StatusUnauthorized, errTokenAuth)
+			return
+		}
+		user.Pass = ""
+		if time.Since(token.LastUsed) > tokenLastUsedInterval {
+			token.LastUsed = time.Now()
+			if err := saveAPIToken(token); err != nil {
+				log.Println("update api token", token.ID, err)
+			}
+		}
+		ctx := context.WithValue(r.Context(), apiTokenKey{}, token)
+		ctx = context.WithValue(ctx, userKey{}, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestToken returns the api token of the request.
+func requestToken(r *http.Request) (APIToken, bool) {
+	token, ok := r.Context().Value(apiTokenKey{}).(APIToken)
+	return token, ok
+}
+
+// requireScope rejects api requests whose token lacks the scope. Write scopes also require the editor role
+// and, for editors in teams, that the user manages the monitor or notifier of the path; see requestTeams.
+// Admin scopes require the admin role.
+func requireScope(scope string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := requestToken(r)
+			if !ok || !slices.Contains(token.Scopes, scope) {
+				apiError(w, http.StatusForbidden, errors.New("token lacks scope "+scope))
+				return
+			}
+			user, err := currentUser(r)
+			if err != nil {
+				apiError(w, http.StatusUnauthorized, errTokenAuth)
+				return
+			}
+			if slices.Contains(adminScopes, scope) && !user.can(roleAdmin) {
+				apiError(w, http.StatusForbidden, errors.New("admin access required"))
+				return
+			}
+			if !slices.Contains(writeScopes, scope) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !user.can(roleEditor) {
+				apiError(w, http.StatusForbidden, errors.New("editor access required"))
+				return
+			}
+			for _, team := range requestTeams(r) {
+				if !user.manages(team) {
+					apiError(w, http.StatusForbidden, teamError(team))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		expires time.Time
+		want    bool
+	}{
+		{"never", time.Time{}, false},
+		{"later", now.Add(time.Second), false},
+		{"now", now, true},
+		{"earlier", now.Add(-time.Second), true},
+	}
+	for _, tt := range tests {
+		if got := (APIToken{Expires: tt.expires}).expired(now); got != tt.want {
+			t.Errorf("%s: expired() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewAPIToken(t *testing.T) {
+	testDB(t, backendBolt)
+	viewer := User{Name: "viewer", Role: roleViewer}
+	editor := User{Name: "editor", Role: roleEditor}
+	admin := User{Name: "admin", Role: roleAdmin}
+	tests := []struct {
+		name   string
+		user   User
+		token  string
+		scopes []string
+		err    bool
+	}{
+		{"read", viewer, "ci", []string{scopeMonitorsRead, scopeNotifiersRead}, false},
+		{"write", editor, "ci", []string{scopeMonitorsWrite}, false},
+		{"backup", admin, "backups", []string{scopeBackup}, false},
+		{"no name", editor, "  ", []string{scopeMonitorsRead}, true},
+		{"no scope", editor, "ci", nil, true},
+		{"invalid scope", editor, "ci", []string{"everything"}, true},
+		{"viewer writing", viewer, "ci", []string{scopeMonitorsRead, scopeMonitorsWrite}, true},
+		{"editor backing up", editor, "ci", []string{scopeBackup}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, secret, err := newAPIToken(tt.user, tt.token, tt.scopes, time.Time{})
+			if (err != nil) != tt.err {
+				t.Fatalf("newAPIToken() error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			saved, err := getAPIToken(token.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.User != tt.user.Name || saved.Hash != hashToken(secret[len(tokenPrefix+token.ID+"_"):]) {
+				t.Errorf("saved token = %+v, want hash of the secret of %s", saved, tt.user.Name)
+			}
+		})
+	}
+}
+
+// apiRequest returns a request authenticated by the bearer token.
+func apiRequest(bearer string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/monitors", nil)
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return r
+}
+
+func TestAPIAuth(t *testing.T) {
+	testDB(t, backendBolt)
+	for _, user := range []User{{Name: "alice", Pass: "hash", Role: roleEditor}, {Name: "bob", Pass: "hash"}} {
+		if err := store.SaveUser(user, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, secret, err := newAPIToken(User{Name: "alice", Role: roleEditor}, "ci", []string{scopeMonitorsRead},
+		time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, expiredSecret, err := newAPIToken(User{Name: "alice"}, "old", []string{scopeMonitorsRead},
+		time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, deletedSecret, err := newAPIToken(User{Name: "bob"}, "bob", []string{scopeMonitorsRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"valid", secret, http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong secret", tokenPrefix + token.ID + "_" + "00", http.StatusUnauthorized},
+		{"no secret", tokenPrefix + token.ID, http.StatusUnauthorized},
+		{"unknown id", tokenPrefix + "missing_00", http.StatusUnauthorized},
+		{"expired", expiredSecret, http.StatusUnauthorized},
+		{"deleted user", deletedSecret, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user User
+			w := httptest.NewRecorder()
+			apiAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got, ok := requestToken(r); !ok || got.ID != token.ID {
+					t.Errorf("requestToken() = %+v, %v, want %s", got, ok, token.ID)
+				}
+				user, _ = currentUser(r)
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, apiRequest(tt.bearer))
+			if w.Code != tt.want {
+				t.Fatalf("apiAuth() = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusOK && (user.Name != "alice" || user.Role != roleEditor || user.Pass != "") {
+				t.Errorf("user = %+v, want alice without password", user)
+			}
+		})
+	}
+	saved, err := getAPIToken(token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(saved.LastUsed) > time.Minute {
+		t.Errorf("last used = %v, want now", saved.LastUsed)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	testDB(t, backendBolt)
+	teamFixture(t)
+	admin := User{Name: "admin", Pass: "hash", Role: roleAdmin}
+	web := User{Name: "web", Pass: "hash", Role: roleEditor, Teams: []string{"web"}}
+	for _, user := range []User{admin, web} {
+		if err := store.SaveUser(user, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, adminSecret, err := newAPIToken(admin, "all", scopes, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, webSecret, err := newAPIToken(web, "web", []string{scopeMonitorsRead, scopeMonitorsWrite}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	demoted := User{Name: "demoted", Pass: "hash", Role: roleAdmin}
+	if err := store.SaveUser(demoted, false); err != nil {
+		t.Fatal(err)
+	}
+	_, demotedSecret, err := newAPIToken(demoted, "all", scopes, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a token keeps its scopes but not the role its user had when it was created
+	demoted.Role = roleViewer
+	if err := store.SaveUser(demoted, true); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		bearer string
+		scope  string
+		site   string
+		want   int
+	}{
+		{"admin reads", adminSecret, scopeMonitorsRead, "", http.StatusOK},
+		{"admin backs up", adminSecret, scopeBackup, "", http.StatusOK},
+		{"admin writes other team", adminSecret, scopeMonitorsWrite, "db", http.StatusOK},
+		{"scope missing", webSecret, scopeNotifiersRead, "", http.StatusForbidden},
+		{"editor backs up", webSecret, scopeBackup, "", http.StatusForbidden},
+		{"editor writes own team", webSecret, scopeMonitorsWrite, "web", http.StatusOK},
+		{"editor writes other team", webSecret, scopeMonitorsWrite, "db", http.StatusForbidden},
+		{"demoted reads", demotedSecret, scopeMonitorsRead, "", http.StatusOK},
+		{"demoted writes", demotedSecret, scopeMonitorsWrite, "web", http.StatusForbidden},
+		{"demoted backs up", demotedSecret, scopeBackup, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := apiRequest(tt.bearer)
+			if tt.site != "" {
+				r.SetPathValue("site", tt.site)
+			}
+			w := httptest.NewRecorder()
+			apiAuth(requireScope(tt.scope)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("requireScope(%s) = %d, want %d", tt.scope, w.Code, tt.want)
+			}
+		})
+	}
+	// without apiAuth there is no token
+	w := httptest.NewRecorder()
+	requireScope(scopeMonitorsRead)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, asUser(apiRequest(""), admin))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("requireScope() without token = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	testDB(t, backendBolt)
+	for _, name := range []string{"alice", "alice", "bob"} {
+		if _, _, err := newAPIToken(User{Name: name}, "ci", []string{scopeMonitorsRead}, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := revokeUserTokens("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := revokeUserTokens("carol"); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := getAPITokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].User != "bob" {
+		t.Errorf("tokens = %+v, want the token of bob", tokens)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	exportVersion = 1
+	redacted      = "REDACTED"
+)
+
+// conflict handling of an import for names that already exist.
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+var errConflict = errors.New("invalid conflict handling")
+
+// secretFields are the keys of notifier data that hold credentials.
+var secretFields = []string{"token", "api_key", "url"}
+
+// exportDocument is a portable export of monitors and notifiers. Notifiers have the layout of the config
+// file, so an export can also serve as one.
+type exportDocument struct {
+	Version   int
+	Exported  time.Time
+	Monitors  []Monitor
+	Notifiers []map[string]any
+}
+
+// exportConfig returns all monitors and notifiers, optionally with notifier credentials redacted. Monitors
+// and notifiers are referred to by name, so the export can be imported into another database.
+func exportConfig(redact bool) (exportDocument, error) {
+	doc := exportDocument{Version: exportVersion, Exported: time.Now(), Notifiers: []map[string]any{}}
+	cat, err := loadCatalog()
+	if err != nil {
+		return doc, err
+	}
+	monitors, err := getMonitors()
+	if err != nil {
+		return doc, err
+	}
+	for _, monitor := range monitors {
+		monitor = cat.named(monitor)
+		monitor.ID = ""
+		doc.Monitors = append(doc.Monitors, monitor)
+	}
+	ids, err := store.Notifiers()
+	if err != nil {
+		return doc, err
+	}
+	for _, id := range ids {
+		kind, data, err := store.Notifier(id)
+		if err != nil {
+			return doc, err
+		}
+		name := cat.notifierNames[id]
+		fields, err := notifierFields(kind, data, redact)
+		if err != nil {
+			return doc, errors.New("notifier " + name + ": " + err.Error())
+		}
+		fields["name"] = name
+		doc.Notifiers = append(doc.Notifiers, fields)
+	}
+	return doc, nil
+}
+
+// notifierFields returns the data of a notifier with its type, in the layout of the config file, optionally
+// with credentials redacted.
+func notifierFields(kind NotifyType, data []byte, redact bool) (map[string]any, error) {
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["type"] = string(kind)
+	if redact {
+		for _, key := range secretFields {
+			if value, ok := fields[key].(string); ok && value != "" {
+				fields[key] = redacted
+			}
+		}
+	}
+	return fields, nil
+}
+
+// uniqueName returns name with the lowest -imported suffix not taken.
+func uniqueName(name string, taken func(string) bool) string {
+	candidate := name + "-imported"
+	for i := 2; taken(candidate); i++ {
+		candidate = name + "-imported-" + strconv.Itoa(i)
+	}
+	return candidate
+}
+
+// keepSecrets replaces redacted credentials of imported notifier data by those of the existing notifier.
+func keepSecrets(imported, existing []byte) ([]byte, error) {
+	fields, current := map[string]any{}, map[string]any{}
+	if err := json.Unmarshal(imported, &fields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(existing, &current); err != nil {
+		return nil, err
+	}
+	for _, key := range secretFields {
+		if fields[key] == redacted {
+			fields[key] = current[key]
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// hasRedacted reports whether notifier data contains redacted credentials.
+func hasRedacted(data []byte) bool {
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	for _, key := range secretFields {
+		if fields[key] == redacted {
+			return true
+		}
+	}
+	return false
+}
+
+// importConfig imports the monitors and notifiers of an export document. Names that already exist are
+// skipped, overwritten or imported under a new name, in which case references in the document are updated.
+// Entries managed by the config file are never overwritten. Returns a report of what was done.
+func importConfig(data []byte, conflict string) ([]string, error) {
+	if conflict != conflictSkip && conflict != conflictOverwrite && conflict != conflictRename {
+		return nil, errConflict
+	}
+	var header struct{ Version int }
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.Version > exportVersion {
+		return nil, errors.New("export version " + strconv.Itoa(header.Version) + " is not supported")
+	}
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	report := []string{}
+	cat, err := loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	notifierNames := slices.Collect(maps.Keys(cat.notifierIDs))
+	monitors, err := getMonitors()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]Monitor{}
+	for _, monitor := range monitors {
+		byName[monitor.Name] = cat.named(monitor)
+	}
+	renamedNotifiers, renamedMonitors := map[string]string{}, map[string]string{}
+	notifiers := []configNotifier{}
+	updateNotifiers := map[string]bool{}
+	for _, notifier := range config.Notifiers {
+		if notifier.Name == "" {
+			return nil, errors.New("notifier without name")
+		}
+		exists := slices.Contains(notifierNames, notifier.Name)
+		switch {
+		case !exists:
+		case conflict == conflictSkip || isManagedNotifier(notifier.Name):
+			report = append(report, "skipped notifier "+notifier.Name+": exists")
+			continue
+		case conflict == conflictOverwrite:
+			kind, current, err := store.Notifier(cat.notifierIDs[notifier.Name])
+			if err != nil {
+				return nil, err
+			}
+			if kind != notifier.Type {
+				return nil, errors.New("notifier " + notifier.Name + " exists with type " + string(kind))
+			}
+			if notifier.Data, err = keepSecrets(notifier.Data, current); err != nil {
+				return nil, err
+			}
+			updateNotifiers[notifier.Name] = true
+		case conflict == conflictRename:
+			name := uniqueName(notifier.Name, func(name string) bool {
+				return slices.Contains(notifierNames, name)
+			})
+			renamedNotifiers[notifier.Name] = name
+			notifier.Name = name
+		}
+		notifierNames = append(notifierNames, notifier.Name)
+		notifiers = append(notifiers, notifier)
+	}
+	imported := []Monitor{}
+	updateMonitors := map[string]bool{}
+	for _, monitor := range config.Monitors {
+		if monitor.Name == "" {
+			return nil, errors.New("monitor without name")
+		}
+		_, exists := byName[monitor.Name]
+		switch {
+		case !exists:
+		case conflict == conflictSkip || isManagedMonitor(monitor.Name):
+			report = append(report, "skipped monitor "+monitor.Name+": exists")
+			continue
+		case conflict == conflictOverwrite:
+			updateMonitors[monitor.Name] = true
+		case conflict == conflictRename:
+			name := uniqueName(monitor.Name, func(name string) bool {
+				_, ok := byName[name]
+				return ok
+			})
+			renamedMonitors[monitor.Name] = name
+			monitor.Name = name
+		}
+		byName[monitor.Name] = monitor
+		imported = append(imported, monitor)
+	}
+	rename := func(names []string, renamed map[string]string) []string {
+		for i, name := range names {
+			if replacement, ok := renamed[name]; ok {
+				names[i] = replacement
+			}
+		}
+		return names
+	}
+	for i := range imported {
+		monitor := &imported[i]
+		monitor.Parents = rename(monitor.Parents, renamedMonitors)
+		monitor.Notifiers = rename(monitor.Notifiers, renamedNotifiers)
+		monitor.EscalateTo = rename(monitor.EscalateTo, renamedNotifiers)
+		byName[monitor.Name] = *monitor
+	}
+	for _, monitor := range imported {
+		if err := validateConfigMonitor(monitor); err != nil {
+			return nil, errors.New("monitor " + monitor.Name + ": " + err.Error())
+		}
+		if err := monitor.checkParents(monitor.Name, byName); err != nil {
+			return nil, errors.New("monitor " + monitor.Name + ": " + err.Error())
+		}
+		for _, name := range append(slices.Clone(monitor.Notifiers), monitor.EscalateTo...) {
+			if !slices.Contains(notifierNames, name) {
+				return nil, errors.New("monitor " + monitor.Name + ": no such notifier " + name)
+			}
+		}
+	}
+	for _, notifier := range notifiers {
+		action := "created"
+		if notifier.Data, err = setNotifierName(notifier.Data, notifier.Name); err != nil {
+			return report, errors.New("notifier " + notifier.Name + ": " + err.Error())
+		}
+		if updateNotifiers[notifier.Name] {
+			action = "overwrote"
+			err = store.UpdateNotifier(cat.notifierIDs[notifier.Name], notifier.Data)
+		} else {
+			var id string
+			if id, err = cat.addNotifier(notifier.Name); err == nil {
+				err = store.CreateNotifier(id, notifier.Type, notifier.Data)
+			}
+		}
+		if err != nil {
+			return report, errors.New("notifier " + notifier.Name + ": " + err.Error())
+		}
+		line := action + " notifier " + notifier.Name
+		for original, name := range renamedNotifiers {
+			if name == notifier.Name {
+				line += " (renamed from " + original + ")"
+			}
+		}
+		if hasRedacted(notifier.Data) {
+			line += "; credentials were redacted, edit the notifier before use"
+		}
+		report = append(report, line)
+	}
+	for _, monitor := range imported {
+		if _, err := cat.addMonitor(monitor.Name); err != nil {
+			return report, err
+		}
+	}
+	for _, monitor := range imported {
+		action := "created"
+		if updateMonitors[monitor.Name] {
+			action = "overwrote"
+		}
+		identified, err := cat.identified(monitor)
+		if err == nil {
+			err = saveMonitor(identified, updateMonitors[monitor.Name])
+		}
+		if err != nil {
+			return report, errors.New("monitor " + monitor.Name + ": " + err.Error())
+		}
+		line := action + " monitor " + monitor.Name
+		for original, name := range renamedMonitors {
+			if name == monitor.Name {
+				line += " (renamed from " + original + ")"
+			}
+		}
+		report = append(report, line)
+	}
+	return report, nil
+}
+
+// exportHistory writes the history of the monitor with the given ID, oldest first, as csv or ndjson.
+func exportHistory(w io.Writer, id, format string) error {
+	switch format {
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		return store.EachHistory(id, func(status Status) error {
+			return encoder.Encode(status)
+		})
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"time", "status_code", "status", "response_ms", "cert_expiry_days",
+			"maintenance", "unreachable", "location"}); err != nil {
+			return err
+		}
+		if err := store.EachHistory(id, func(status Status) error {
+			return writer.Write([]string{
+				status.Time.Format(time.RFC3339),
+				strconv.Itoa(status.StatusCode),
+				status.Status,
+				strconv.FormatInt(status.ResponseTime.Milliseconds(), 10),
+				strconv.Itoa(status.CertExpiry),
+				strconv.FormatBool(status.Maintenance),
+				strconv.FormatBool(status.Unreachable),
+				status.Location,
+			})
+		}); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return errors.New("invalid history format " + format)
+	}
+}
+
+// importHistory adds ndjson history records to the monitor with the given ID, merged with its history by
+// time. Records at the time of a stored or earlier imported record are skipped, so an import can be
+// repeated safely.
+func importHistory(r io.Reader, id string) (int, int, error) {
+	monitor, err := getMonitor(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	newest, err := store.LastHistory(id)
+	if err != nil && !errors.Is(err, errNoKey) {
+		return 0, 0, err
+	}
+	seen := map[time.Time]bool{}
+	added, skipped := 0, 0
+	batch := make([]Status, 0, migrateBatch)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBodySize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var status Status
+		if err := json.Unmarshal(scanner.Bytes(), &status); err != nil {
+			return added, skipped, errors.New("line " + strconv.Itoa(line) + ": " + err.Error())
+		}
+		status.Time = status.Time.UTC()
+		if seen[status.Time] {
+			skipped++
+			continue
+		}
+		seen[status.Time] = true
+		if !status.Time.After(newest.Time) {
+			stored, err := store.History(id, status.Time, status.Time, 0)
+			if err != nil && !errors.Is(err, errPath) {
+				return added, skipped, err
+			}
+			if len(stored) > 0 {
+				skipped++
+				continue
+			}
+		}
+		status.Site = monitor.Name
+		status.MonitorID = id
+		batch = append(batch, status)
+		if len(batch) == migrateBatch {
+			if err := store.AddHistory(id, monitor.StatusOK, batch...); err != nil {
+				return added, skipped, err
+			}
+			added += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return added, skipped, err
+	}
+	if err := store.AddHistory(id, monitor.StatusOK, batch...); err != nil {
+		return added, skipped, err
+	}
+	return added + len(batch), skipped, nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// namedMonitor returns the monitor with the given name, with parents and notifiers referred to by name.
+func namedMonitor(t *testing.T, name string) Monitor {
+	t.Helper()
+	cat, err := loadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor, err := getMonitorByName(name)
+	if err != nil {
+		t.Fatal(name, err)
+	}
+	return cat.named(monitor)
+}
+
+// notifierToken returns the token of the named slack notifier.
+func notifierToken(t *testing.T, name string) string {
+	t.Helper()
+	cat, err := loadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, data, err := store.Notifier(cat.notifierIDs[name])
+	if err != nil {
+		t.Fatal(name, err)
+	}
+	var notifier SlackNotifier
+	if err := json.Unmarshal(data, &notifier); err != nil {
+		t.Fatal(err)
+	}
+	return notifier.Token
+}
+
+func TestImportConfig(t *testing.T) {
+	existing := `{"Version": 1,
+"Monitors": [{"Name": "api", "URL": "https://api.example.com", "Freq": "5m", "Notifiers": ["ops"]}],
+"Notifiers": [{"name": "ops", "type": "slack", "token": "secret"}]}`
+	imported := `{"Version": 1,
+"Monitors": [
+	{"Name": "api", "URL": "https://api.example.com", "Freq": "1m", "Notifiers": ["ops"]},
+	{"Name": "cache", "URL": "https://cache.example.com", "Parents": ["api"]}
+],
+"Notifiers": [{"name": "ops", "type": "slack", "token": "REDACTED", "channel": "alerts"}]}`
+	tests := []struct {
+		conflict string
+		report   []string
+		api      string // frequency of api
+		parent   string // parent of cache
+		notifier string // notifier of the parent
+		token    string // token of that notifier
+	}{
+		{conflictSkip, []string{
+			"skipped notifier ops: exists",
+			"skipped monitor api: exists",
+			"created monitor cache",
+		}, "5m", "api", "ops", "secret"},
+		{conflictOverwrite, []string{
+			"overwrote notifier ops",
+			"overwrote monitor api",
+			"created monitor cache",
+		}, "1m", "api", "ops", "secret"},
+		{conflictRename, []string{
+			"created notifier ops-imported (renamed from ops); credentials were redacted, edit the notifier before use",
+			"created monitor api-imported (renamed from api)",
+			"created monitor cache",
+		}, "5m", "api-imported", "ops-imported", redacted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.conflict, func(t *testing.T) {
+			testDB(t, backendBolt)
+			if _, err := importConfig([]byte(existing), conflictSkip); err != nil {
+				t.Fatal(err)
+			}
+			report, err := importConfig([]byte(imported), tt.conflict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(report, tt.report) {
+				t.Errorf("importConfig() report\n%s\nwant\n%s", strings.Join(report, "\n"), strings.Join(tt.report, "\n"))
+			}
+			if api := namedMonitor(t, "api"); api.Freq != tt.api {
+				t.Errorf("api frequency %s, want %s", api.Freq, tt.api)
+			}
+			cache := namedMonitor(t, "cache")
+			if !slices.Equal(cache.Parents, []string{tt.parent}) {
+				t.Errorf("cache parents %v, want %s", cache.Parents, tt.parent)
+			}
+			if parent := namedMonitor(t, tt.parent); !slices.Equal(parent.Notifiers, []string{tt.notifier}) {
+				t.Errorf("%s notifiers %v, want %s", tt.parent, parent.Notifiers, tt.notifier)
+			}
+			if token := notifierToken(t, tt.notifier); token != tt.token {
+				t.Errorf("%s token %q, want %q", tt.notifier, token, tt.token)
+			}
+			if token := notifierToken(t, "ops"); tt.conflict != conflictOverwrite && token != "secret" {
+				t.Errorf("existing notifier token %q changed", token)
+			}
+		})
+	}
+}
+
+func TestImportConfigRenameTwice(t *testing.T) {
+	testDB(t, backendBolt)
+	doc := `{"Monitors": [{"Name": "api", "URL": "https://api.example.com"}]}`
+	for range 3 {
+		if _, err := importConfig([]byte(doc), conflictRename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"api", "api-imported", "api-imported-2"} {
+		namedMonitor(t, name)
+	}
+}
+
+func TestImportConfigInvalid(t *testing.T) {
+	testDB(t, backendBolt)
+	if _, err := importConfig([]byte(`{"Notifiers": [{"name": "ops", "type": "slack"}]}`), conflictSkip); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		doc      string
+		conflict string
+		err      string
+	}{
+		{"conflict", `{}`, "merge", errConflict.Error()},
+		{"newer version", `{"Version": 2}`, conflictSkip, "not supported"},
+		{"not json", `monitors: []`, conflictSkip, "invalid character"},
+		{"monitor without name", `{"Monitors": [{"URL": "https://example.com"}]}`, conflictSkip, "without name"},
+		{"invalid monitor", `{"Monitors": [{"Name": "api", "URL": "example.com"}]}`, conflictSkip, "invalid url"},
+		{"missing notifier", `{"Monitors": [{"Name": "api", "URL": "https://example.com", "Notifiers": ["chat"]}]}`,
+			conflictSkip, "no such notifier chat"},
+		{"missing parent", `{"Monitors": [{"Name": "api", "URL": "https://example.com", "Parents": ["db"]}]}`,
+			conflictSkip, "monitor api"},
+		{"notifier type", `{"Notifiers": [{"name": "ops", "type": "discord"}]}`, conflictOverwrite, "exists with type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := importConfig([]byte(tt.doc), tt.conflict); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("importConfig() error = %v, want %q", err, tt.err)
+			}
+			if monitors, _ := getMonitors(); len(monitors) != 0 {
+				t.Errorf("invalid import created monitors %v", monitors)
+			}
+		})
+	}
+}
+
+func TestExportImportConfig(t *testing.T) {
+	testDB(t, backendBolt)
+	doc := `{"Monitors": [
+	{"Name": "api", "URL": "https://api.example.com", "Notifiers": ["ops"]},
+	{"Name": "web", "URL": "https://web.example.com", "Parents": ["api"]}
+],
+"Notifiers": [{"name": "ops", "type": "slack", "token": "secret"}]}`
+	if _, err := importConfig([]byte(doc), conflictSkip); err != nil {
+		t.Fatal(err)
+	}
+	export, err := exportConfig(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) || slices.ContainsFunc(export.Monitors, func(m Monitor) bool {
+		return m.ID != ""
+	}) {
+		t.Errorf("export %s, want credentials redacted and no IDs", data)
+	}
+	store.Close()
+	db.Close()
+	testDB(t, backendSQLite)
+	report, err := importConfig(data, conflictSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 3 || !strings.HasSuffix(report[0], "edit the notifier before use") {
+		t.Errorf("import report %q", report)
+	}
+	if web := namedMonitor(t, "web"); !slices.Equal(web.Parents, []string{"api"}) {
+		t.Errorf("imported web parents %v, want [api]", web.Parents)
+	}
+}
+
+func TestImportHistory(t *testing.T) {
+	start := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	record := func(minutes, code int) Status {
+		return Status{Time: start.Add(time.Duration(minutes) * time.Minute), StatusCode: code,
+			Status: "status", ResponseTime: time.Duration(minutes) * time.Millisecond}
+	}
+	ndjson := func(statuses ...Status) string {
+		var buf bytes.Buffer
+		for _, status := range statuses {
+			if err := json.NewEncoder(&buf).Encode(status); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.String()
+	}
+	// 12:30 in another time zone is the stored record at 12:30 UTC
+	offset := record(30, 200)
+	offset.Time = offset.Time.In(time.FixedZone("CET", 60*60))
+	stored := []Status{record(0, 200), record(30, 503), record(60, 200)}
+	input := ndjson(record(15, 503), record(30, 200), offset, record(45, 503), record(45, 503), record(90, 503)) +
+		"\n" + ndjson(record(75, 200))
+	merged := []Status{record(0, 200), record(15, 503), record(30, 503), record(45, 503), record(60, 200),
+		record(75, 200), record(90, 503)}
+	for _, backend := range []string{backendBolt, backendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			testDB(t, backend)
+			for _, id := range []string{"m1", "m2"} {
+				if err := store.SaveMonitor(Monitor{ID: id, Name: id, StatusOK: 200}, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.AddHistory("m1", 200, stored...); err != nil {
+				t.Fatal(err)
+			}
+			added, skipped, err := importHistory(strings.NewReader(input), "m1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if added != 4 || skipped != 3 {
+				t.Errorf("importHistory() added %d, skipped %d, want 4, 3", added, skipped)
+			}
+			history, err := store.History("m1", start, start.Add(time.Hour*2), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(history, merged, func(a, b Status) bool {
+				return a.Time.Equal(b.Time) && a.StatusCode == b.StatusCode
+			}) {
+				t.Errorf("merged history %v, want %v", history, merged)
+			}
+			// rollups match those of the history recorded in order
+			if err := store.AddHistory("m2", 200, merged...); err != nil {
+				t.Fatal(err)
+			}
+			for _, period := range []string{rollupHour, rollupDay} {
+				got, err := store.Rollups("m1", period, start)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, err := store.Rollups("m2", period, start)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != len(want) {
+					t.Fatalf("%d %s rollups, want %d", len(got), period, len(want))
+				}
+				for i := range got {
+					if got[i].Count != want[i].Count || got[i].Up != want[i].Up || got[i].Down != want[i].Down ||
+						got[i].Sum != want[i].Sum {
+						t.Errorf("%s rollup %v: %d checks, up %v, down %v, want %d, %v, %v", period, got[i].Start,
+							got[i].Count, got[i].Up, got[i].Down, want[i].Count, want[i].Up, want[i].Down)
+					}
+				}
+			}
+			added, skipped, err = importHistory(strings.NewReader(input), "m1")
+			if err != nil || added != 0 || skipped != 7 {
+				t.Errorf("repeated importHistory() = %d, %d, %v, want 0, 7", added, skipped, err)
+			}
+			if _, _, err := importHistory(strings.NewReader("{}\nnot json\n"), "m1"); err == nil ||
+				!strings.HasPrefix(err.Error(), "line 2") {
+				t.Errorf("importHistory() of invalid line error = %v, want line 2", err)
+			}
+			if _, _, err := importHistory(strings.NewReader(input), "missing"); !errors.Is(err, errNoKey) {
+				t.Errorf("importHistory() of missing monitor error = %v, want %v", err, errNoKey)
+			}
+		})
+	}
+}
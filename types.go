@@ -11,6 +11,30 @@ const (
 	httpAddr    = ":8090"
 	discordRed  = 14177041
 	discordBlue = 1127128
+
+	defaultWorkers     = 10               // concurrent checks, override with UPTIME_WORKERS
+	defaultHostWorkers = 2                // concurrent checks per host, override with UPTIME_HOST_WORKERS
+	maxStartJitter     = 5 * time.Minute  // upper bound of random start offset
+	maxCheckLag        = 30 * time.Second // log checks that start later than this
+	maxBodySize        = 10 << 20         // bytes of response body read by http checks
+	agentRefresh       = time.Minute      // interval agents refresh their monitor assignments
+	agentBuffer        = 10000            // results an agent keeps while the server is unreachable
+	agentPushRetry     = 5 * time.Second  // first delay before an agent retries a failed push
+
+	defaultFlapThreshold = 5         // state changes within defaultFlapWindow before a monitor is flapping
+	defaultFlapWindow    = time.Hour // window for flap detection
+
+	defaultStableFor = 5 * time.Minute // time up before a recovered monitor returns to its normal frequency
+
+	incidentLinkLifetime = 7 * 24 * time.Hour // validity of signed incident links in notifications
+
+	certNotifyInterval = time.Hour // minimum time between certificate expiry notifications
+
+	janitorInterval = time.Hour // time between history pruning runs
+	janitorBatch    = 1000      // history records deleted per transaction
+	migrateBatch    = 1000      // history records copied per transaction by the migrate command
+
+	defaultBackupKeep = 7 // scheduled backups kept
 )
 
 // Generic types.
@@ -53,28 +77,46 @@ const (
 type User struct {
 	Name  string
 	Pass  string
-	Admin bool
+	Admin bool     `json:",omitempty"` // saved before roles existed, read as the admin role when Role is empty
+	Role  Role     `json:",omitempty"`
+	Teams []string `json:",omitempty"` // teams whose monitors and notifiers an editor manages; all if empty
 }
 
 // SessionUser represents a logged in user.
 type SessionUser struct {
-	Name  string
-	Admin bool
+	Name string
 }
 
 // Status represents the current status of an endpoint monitor.
 type Status struct {
+	MonitorID    string `json:",omitempty"`
 	Site         string
 	URL          string
 	Time         time.Time
 	StatusCode   int
 	Status       string
 	CertExpiry   int
+	CertNotAfter time.Time
+	CertIssuer   string
 	ResponseTime time.Duration
+	Timing       Timing
+	Maintenance  bool
+	Unreachable  bool
+	Location     string
+	Locations    []LocationResult `json:",omitempty"`
+}
+
+// LocationResult represents the result of a check from a single location.
+type LocationResult struct {
+	Location   string
+	Time       time.Time
+	StatusCode int
+	Status     string
 }
 
 // Monitor represents an endpoint monitor.
 type Monitor struct {
+	ID        string `json:",omitempty"` // immutable, used in database keys and urls; the name is an editable label
 	Type      MonitorType
 	URL       string
 	Freq      string
@@ -82,13 +124,51 @@ type Monitor struct {
 	Timeout   string
 	StatusOK  int
 	Active    bool
-	Notifiers []string
+	Notifiers []string // notifier IDs
+	Schedule  Schedule
+	Group     string
+	Parents   []string // monitor IDs
+
+	FlapThreshold int    // state changes within FlapWindow that mark the monitor as flapping
+	FlapWindow    string // duration
+	DownFreq      string // recheck interval while down, Freq is used if empty
+	StableFor     string // time up after recovery before returning to Freq
+
+	Locations []string // remote agent locations that also check the monitor
+	Quorum    int      // locations that must report down for the monitor to be down; 0 uses local only
+
+	RepeatAlert   string   // repeat notifications of unacknowledged incidents at this interval
+	EscalateAfter string   // notify EscalateTo when an incident is unacknowledged for this long
+	EscalateTo    []string // escalation notifier IDs
+
+	Retention string // keep raw history for this long (e.g. 30d), overrides the global setting
+
+	Team string // team that manages the monitor; only admins and editors in no team manage it if empty
+}
+
+// Settings represents global settings.
+type Settings struct {
+	Retention      string // keep raw history for this long (e.g. 30d), forever if empty
+	BackupInterval string // take a scheduled backup this often (e.g. 1d), never if empty
+	BackupKeep     int    // number of scheduled backups kept, defaultBackupKeep if zero
+	BackupDir      string // directory of scheduled backups, the backups directory of the data directory if empty
+}
+
+// Schedule restricts when a monitor is checked.
+type Schedule struct {
+	Cron     string         // cron expression, replaces Freq when set
+	TimeZone string         // IANA time zone of Cron and the daily window
+	Days     []time.Weekday // days checks are permitted, every day if empty
+	Start    string         // start of daily window, HH:MM
+	End      string         // end of daily window, HH:MM
 }
 
 // Notification represents a notification.
 type Notification struct {
+	ID           string
 	Name         string
 	Type         NotifyType
+	Team         string
 	Notification any
 }
 
@@ -106,8 +186,11 @@ var (
 
 // MonitorDisplay represents an endpoint monitor.
 type MonitorDisplay struct {
+	ID            string
 	Name          string
 	Active        bool
+	Maintenance   bool
+	Flapping      bool
 	DisplayStatus bool
 	PerCent       float64
 	Status        Status
@@ -115,11 +198,12 @@ type MonitorDisplay struct {
 
 // Details represents the details for an endpoint monitor.
 type Details struct {
-	Status     []Status
 	Response24 int
 	Response30 int
 	Uptime24   float64
 	Uptime30   float64
+	Month      Rollup
+	Year       Rollup
 }
 
 func compact(status []Status) []Status {
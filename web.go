@@ -17,46 +17,126 @@ func web(ctx context.Context, wg *sync.WaitGroup) {
 	}
 	log.Println("starting web server")
 
-	router := NewRouter(Logger)
+	router := NewRouter(Logger, firstRun)
 
 	router.Get("/favicon.ico", favicon)
 	router.Get("/logout", logout)
 	router.Get("/login", displayLogin)
 	router.Post("/login", login)
+	router.Get("/setup", setupPage)
+	router.Post("/setup", setup)
 	router.Get("/styles.css", styles)
 	router.Get("/{$}", mainPage)
+	router.Get("/incident/{id}/{action}", signedIncident)
+	router.Post("/incident/{id}/{action}", signedIncidentAction)
+
+	viewers, editors, admins := authorize(roleViewer), authorize(roleEditor), authorize(roleAdmin)
 
 	plain := router.Group("", auth)
-	plain.Get("/logs", logs)
+	plain.With(admins).Get("/logs", logs)
+	plain.With(viewers).Get("/scheduler", schedulerStatus)
 
 	user := router.Group("/user", auth)
-	user.Get("/{$}", admin)
-	user.Get("/{user}", editUser)
-	user.Post("/delete/{user}", deleteUser)
-	user.Post("/add", addUser)
-	user.Post("/{user}", updateUser)
+	user.With(viewers).Get("/{$}", admin)
+	user.With(authorizeSelf).Get("/{user}", editUser)
+	user.With(admins).Post("/delete/{user}", deleteUser)
+	user.With(admins).Post("/add", addUser)
+	user.With(authorizeSelf).Post("/{user}", updateUser)
 
 	monitor := router.Group("/monitor", auth)
-	monitor.Get("/details/{site}", details)
-	monitor.Get("/pause/{site}", pauseMonitor)
-	monitor.Get("/resume/{site}", resumeMonitor)
-	monitor.Get("/new", newMonitor)
-	monitor.Post("/new", createMonitor)
-	monitor.Get("/delete/{site}", deleteSite)
-	monitor.Post("/delete/{site}", deleteMonitor)
-	monitor.Get("/edit/{site}", editMonitor)
-	monitor.Post("/edit/{site}", updateMonitor)
-	monitor.Get("/history/{site}/{duration}", history)
-	monitor.Post("/history/purge/{site}", purgeHistory)
+	monitorView, monitorEdit := monitor.With(viewers), monitor.With(editors)
+	monitorSave := monitorEdit.With(authorizeTeam)
+	monitorView.Get("/details/{site}", details)
+	monitorEdit.Post("/check/{site}", checkNow)
+	monitorEdit.Post("/pause/{site}", pauseMonitor)
+	monitorEdit.Post("/resume/{site}", resumeMonitor)
+	monitorEdit.Get("/new", newMonitor)
+	monitorSave.Post("/new", createMonitor)
+	monitorEdit.Get("/delete/{site}", deleteSite)
+	monitorEdit.Post("/delete/{site}", deleteMonitor)
+	monitorEdit.Get("/edit/{site}", editMonitor)
+	monitorSave.Post("/edit/{site}", updateMonitor)
+	monitorView.Get("/history/{site}/{duration}", history)
+	monitorEdit.Post("/history/purge/{site}", purgeHistory)
+	monitorView.Get("/history/{site}/export/{format}", exportMonitorHistory)
+	monitorEdit.Post("/history/import/{site}", importMonitorHistory)
 
 	notification := router.Group("/notifications", auth)
-	notification.Get("/", notifications)
-	notification.Get("/new", newNotification)
-	notification.Post("/new", createNotification)
-	notification.Post("/delete/{notify}", deleletNotification)
-	notification.Get("/edit/{notify}", displayEditnotification)
-	notification.Post("/edit/{notify}", editNotification)
-	notification.Get("/test/{notify}", testNotification)
+	notificationView, notificationEdit := notification.With(viewers), notification.With(editors)
+	notificationSave := notificationEdit.With(authorizeTeam)
+	notificationView.Get("/", notifications)
+	notificationEdit.Get("/new", newNotification)
+	notificationSave.Post("/new", createNotification)
+	notificationEdit.Post("/delete/{notify}", deleletNotification)
+	notificationEdit.Get("/edit/{notify}", displayEditnotification)
+	notificationSave.Post("/edit/{notify}", editNotification)
+	notificationEdit.Get("/test/{notify}", testNotification)
+
+	maintenance := router.Group("/maintenance", auth)
+	maintenance.With(viewers).Get("/{$}", maintenancePage)
+	maintenance.With(editors).Get("/new", newMaintenance)
+	maintenance.With(editors).Post("/new", createMaintenance)
+	maintenance.With(editors).Post("/delete/{window}", deleteMaintenance)
+
+	incidents := router.Group("/incidents", auth)
+	incidentView, incidentEdit := incidents.With(viewers), incidents.With(editors)
+	incidentView.Get("/{$}", incidentsPage)
+	incidentView.Get("/{id}", incidentDetails)
+	incidentEdit.Post("/{id}/ack", ackIncident)
+	incidentEdit.Post("/{id}/resolve", closeIncident)
+	incidentEdit.Post("/{id}/assign", assignIncident)
+	incidentEdit.Post("/{id}/note", addIncidentNote)
+
+	database := router.Group("/database", auth).With(admins)
+	database.Get("/{$}", databasePage)
+	database.Post("/retention", updateRetention)
+	database.Post("/prune", pruneNow)
+	database.Get("/backup", downloadBackup)
+	database.Post("/backup", backupNow)
+	database.Post("/backup/settings", updateBackupSettings)
+	database.Post("/config", applyConfigNow)
+	database.Get("/export", exportData)
+	database.Post("/import", importData)
+	database.Post("/import/foreign", importForeignData)
+
+	audit := router.Group("/audit", auth).With(admins)
+	audit.Get("/{$}", auditPage)
+	audit.Get("/export/{format}", exportAuditLog)
+
+	agents := router.Group("/agents", auth).With(admins)
+	agents.Get("/{$}", agentsPage)
+	agents.Post("/new", createAgent)
+	agents.Post("/delete/{name}", deleteAgent)
+
+	tokens := router.Group("/tokens", auth).With(viewers)
+	tokens.Get("/{$}", tokensPage)
+	tokens.Post("/new", createToken)
+	tokens.Post("/delete/{token}", revokeToken)
+
+	api := router.Group("/api/v1", apiAuth)
+	monitorsRead, monitorsWrite := api.With(requireScope(scopeMonitorsRead)), api.With(requireScope(scopeMonitorsWrite))
+	monitorsRead.Get("/status", apiStatuses)
+	monitorsRead.Get("/monitors", apiMonitors)
+	monitorsWrite.Post("/monitors", apiCreateMonitor)
+	monitorsRead.Get("/monitors/{site}", apiMonitor)
+	monitorsWrite.Put("/monitors/{site}", apiReplaceMonitor)
+	monitorsWrite.Patch("/monitors/{site}", apiPatchMonitor)
+	monitorsWrite.Delete("/monitors/{site}", apiDeleteMonitor)
+	monitorsRead.Get("/monitors/{site}/status", apiMonitorStatus)
+	monitorsRead.Get("/monitors/{site}/history", apiHistory)
+	monitorsRead.Get("/monitors/{site}/stats", apiStats)
+	notifiersRead := api.With(requireScope(scopeNotifiersRead))
+	notifiersWrite := api.With(requireScope(scopeNotifiersWrite))
+	notifiersRead.Get("/notifiers", apiNotifiers)
+	notifiersWrite.Post("/notifiers", apiCreateNotifier)
+	notifiersRead.Get("/notifiers/{notify}", apiNotifier)
+	notifiersWrite.Put("/notifiers/{notify}", apiUpdateNotifier)
+	notifiersWrite.Delete("/notifiers/{notify}", apiDeleteNotifier)
+	api.With(requireScope(scopeBackup)).Get("/backup", downloadBackup)
+
+	agent := router.Group("/agent", agentAuth)
+	agent.Get("/monitors", agentMonitors)
+	agent.Post("/results", agentResults)
 
 	server := http.Server{Addr: httpAddr, ReadHeaderTimeout: time.Second, Handler: router} //nolint:exhaustruct
 	go func() {